@@ -1,3 +1,6 @@
+-- Trigram similarity for the fuzzy patient search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 -- Create `user_role` type if it doesn't exist
 DO $$
 BEGIN
@@ -22,6 +25,14 @@ BEGIN
     END IF;
 END $$;
 
+-- Create `allergy_severity` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'allergy_severity') THEN
+        CREATE TYPE allergy_severity AS ENUM ('mild', 'moderate', 'severe', 'life_threatening');
+    END IF;
+END $$;
+
 -- Create `status` type if it doesn't exist
 DO $$
 BEGIN
@@ -30,12 +41,110 @@ BEGIN
     END IF;
 END $$;
 
+-- Create `bed_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'bed_status') THEN
+        CREATE TYPE bed_status AS ENUM ('available', 'occupied', 'cleaning', 'maintenance');
+    END IF;
+END $$;
+
+-- Create `billing_item_type` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'billing_item_type') THEN
+        CREATE TYPE billing_item_type AS ENUM ('appointment', 'encounter', 'lab_test', 'drug', 'other');
+    END IF;
+END $$;
+
+-- Create `claim_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'claim_status') THEN
+        CREATE TYPE claim_status AS ENUM ('not_applicable', 'pending', 'submitted', 'approved', 'rejected');
+    END IF;
+END $$;
+
+-- Create `payer_type` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'payer_type') THEN
+        CREATE TYPE payer_type AS ENUM ('patient', 'insurer');
+    END IF;
+END $$;
+
+-- Create `lab_order_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'lab_order_status') THEN
+        CREATE TYPE lab_order_status AS ENUM ('ordered', 'collected', 'resulted', 'verified', 'cancelled');
+    END IF;
+END $$;
+
+-- Create `lab_priority` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'lab_priority') THEN
+        CREATE TYPE lab_priority AS ENUM ('routine', 'urgent', 'stat');
+    END IF;
+END $$;
+
+-- Create `consent_type` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'consent_type') THEN
+        CREATE TYPE consent_type AS ENUM ('treatment', 'data_sharing', 'research', 'communication_email', 'communication_sms', 'communication_phone');
+    END IF;
+END $$;
+
+-- Create `reminder_channel` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'reminder_channel') THEN
+        CREATE TYPE reminder_channel AS ENUM ('email', 'sms');
+    END IF;
+END $$;
+
+-- Create `reminder_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'reminder_status') THEN
+        CREATE TYPE reminder_status AS ENUM ('pending', 'sent', 'failed', 'cancelled');
+    END IF;
+END $$;
+
+-- Create `job_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'job_status') THEN
+        CREATE TYPE job_status AS ENUM ('queued', 'running', 'succeeded', 'dead', 'cancelled');
+    END IF;
+END $$;
+
+-- Create `queue_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'queue_status') THEN
+        CREATE TYPE queue_status AS ENUM ('waiting', 'called', 'completed', 'no_show', 'cancelled');
+    END IF;
+END $$;
+
+-- Create `webhook_delivery_status` type if it doesn't exist
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'webhook_delivery_status') THEN
+        CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'delivered', 'failed');
+    END IF;
+END $$;
+
 -- Create Users table
 CREATE TABLE IF NOT EXISTS Users (
     user_id SERIAL PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
     password TEXT NOT NULL,
-    role user_role NOT NULL
+    role user_role NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    tokens_revoked_at TIMESTAMP -- UTC
 );
 
 -- Create Patient table
@@ -49,27 +158,17 @@ CREATE TABLE IF NOT EXISTS Patient (
     gender sex NOT NULL,
     blood_type blood_group NOT NULL,
     email VARCHAR(50) UNIQUE NOT NULL,
-    health_insurance status NOT NULL,
     address TEXT NOT NULL,
     phone_number VARCHAR(15) NOT NULL,
     id_card_number VARCHAR(13) UNIQUE NOT NULL,
     ongoing_treatment VARCHAR(50) NOT NULL,
     unhealthy_habits VARCHAR(50) NOT NULL,
+    deleted_at TIMESTAMP, -- set by DELETE /api/v1/patients/:id, the patient is hidden and every row linked to them kept
     FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE SET NULL,
     CHECK (phone_number ~ '^[0-9]+$'),
     UNIQUE (first_name, last_name)
 );
 
--- Create Medical_history table
-CREATE TABLE IF NOT EXISTS Medical_history (
-    medical_history_id SERIAL PRIMARY KEY,
-    patient_id VARCHAR(4) NOT NULL,
-    detail TEXT NOT NULL,
-    time TIME NOT NULL,
-    date date NOT NULL,
-    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE
-);
-
 -- Create Department table
 CREATE TABLE IF NOT EXISTS Department(
     department_id VARCHAR(4) PRIMARY KEY,
@@ -104,6 +203,120 @@ CREATE TABLE IF NOT EXISTS Employee(
     UNIQUE (first_name, last_name)
 );
 
+-- Create Medical_history table (each row is a clinical encounter, detail holds the clinician's notes)
+CREATE TABLE IF NOT EXISTS Medical_history (
+    medical_history_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    detail TEXT NOT NULL,
+    time TIME NOT NULL,
+    date date NOT NULL,
+    employee_id VARCHAR(4),
+    chief_complaint TEXT,
+    plan TEXT,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (employee_id) REFERENCES Employee(employee_id) ON DELETE SET NULL
+);
+
+-- Create Observation_type table (what can be measured, its unit and reference ranges)
+CREATE TABLE IF NOT EXISTS Observation_type (
+    observation_type VARCHAR(20) PRIMARY KEY,
+    display_name VARCHAR(50) NOT NULL,
+    unit VARCHAR(20) NOT NULL,
+    normal_low NUMERIC(7,2),
+    normal_high NUMERIC(7,2),
+    critical_low NUMERIC(7,2),
+    critical_high NUMERIC(7,2),
+    valid_min NUMERIC(7,2) NOT NULL,
+    valid_max NUMERIC(7,2) NOT NULL
+);
+
+-- Create Observation table (time series of vital signs and measurements per patient)
+CREATE TABLE IF NOT EXISTS Observation (
+    observation_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    observation_type VARCHAR(20) NOT NULL,
+    value NUMERIC(7,2) NOT NULL,
+    observed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    employee_id VARCHAR(4),
+    medical_history_id INT,
+    note TEXT,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (observation_type) REFERENCES Observation_type(observation_type),
+    FOREIGN KEY (employee_id) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    FOREIGN KEY (medical_history_id) REFERENCES Medical_history(medical_history_id) ON DELETE CASCADE
+);
+
+-- Create Insurer table
+CREATE TABLE IF NOT EXISTS Insurer (
+    insurer_id VARCHAR(4) PRIMARY KEY,
+    insurer_name VARCHAR(100) NOT NULL UNIQUE,
+    phone_number VARCHAR(15),
+    email VARCHAR(50),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Create Insurance_policy table (replaces Patient.health_insurance, a patient is covered on a date when a policy is valid on it)
+CREATE TABLE IF NOT EXISTS Insurance_policy (
+    policy_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    insurer_id VARCHAR(4) NOT NULL,
+    policy_number VARCHAR(30) NOT NULL,
+    plan_name VARCHAR(50),
+    coverage_percent NUMERIC(5,2) NOT NULL CHECK (coverage_percent BETWEEN 0 AND 100),
+    annual_limit NUMERIC(12,2) CHECK (annual_limit >= 0),
+    valid_from DATE NOT NULL,
+    valid_to DATE,
+    priority SMALLINT NOT NULL DEFAULT 1,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (insurer_id) REFERENCES Insurer(insurer_id),
+    UNIQUE (insurer_id, policy_number),
+    CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+-- Create Patient_emergency_contact table (next-of-kin, priority 1 is called first)
+CREATE TABLE IF NOT EXISTS Patient_emergency_contact (
+    contact_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    contact_name VARCHAR(100) NOT NULL,
+    relationship VARCHAR(30) NOT NULL,
+    phone_number VARCHAR(15) NOT NULL,
+    email VARCHAR(50),
+    priority SMALLINT NOT NULL CHECK (priority > 0),
+    consent_to_share BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    UNIQUE (patient_id, priority)
+);
+
+-- Create Consent_document table (the versioned text a patient agrees to)
+CREATE TABLE IF NOT EXISTS Consent_document (
+    consent_type consent_type NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    effective_from DATE NOT NULL DEFAULT CURRENT_DATE,
+    PRIMARY KEY (consent_type, version)
+);
+
+-- Create Patient_consent table (every decision is kept, a new decision on the same type supersedes the current one)
+CREATE TABLE IF NOT EXISTS Patient_consent (
+    consent_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    consent_type consent_type NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    granted BOOLEAN NOT NULL,
+    signed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    recorded_by VARCHAR(4),
+    note TEXT,
+    superseded_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(4),
+    revocation_reason TEXT,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (consent_type, version) REFERENCES Consent_document(consent_type, version),
+    FOREIGN KEY (recorded_by) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    FOREIGN KEY (revoked_by) REFERENCES Employee(employee_id) ON DELETE SET NULL
+);
+
 -- Create Patient_Appointment table
 CREATE TABLE IF NOT EXISTS Patient_Appointment (
     appointment_id SERIAL PRIMARY KEY,
@@ -111,13 +324,53 @@ CREATE TABLE IF NOT EXISTS Patient_Appointment (
     time TIME NOT NULL,
     date DATE NOT NULL,
     topic TEXT NOT NULL,
-    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE
+    employee_id VARCHAR(4),
+    policy_id INT,
+    cancelled_at TIMESTAMP,
+    cancellation_reason TEXT,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (employee_id) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    FOREIGN KEY (policy_id) REFERENCES Insurance_policy(policy_id) ON DELETE SET NULL
+);
+
+-- Create Appointment_reminder table (one row per reminder to send, it is also the delivery log)
+CREATE TABLE IF NOT EXISTS Appointment_reminder (
+    reminder_id SERIAL PRIMARY KEY,
+    appointment_id INT NOT NULL,
+    channel reminder_channel NOT NULL,
+    recipient VARCHAR(100) NOT NULL,
+    offset_minutes INT NOT NULL,
+    send_at TIMESTAMP NOT NULL,
+    status reminder_status NOT NULL DEFAULT 'pending',
+    attempts SMALLINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    sent_at TIMESTAMP,
+    cancelled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (appointment_id) REFERENCES Patient_Appointment(appointment_id) ON DELETE CASCADE
+);
+
+-- Create Employee_offboarding table (log of every offboarding done through the API)
+CREATE TABLE IF NOT EXISTS Employee_offboarding (
+    offboarding_id SERIAL PRIMARY KEY,
+    employee_id VARCHAR(4) NOT NULL,
+    resignation_date DATE NOT NULL,
+    reason TEXT,
+    reassigned_to VARCHAR(4),
+    appointments_reassigned INT NOT NULL DEFAULT 0,
+    account_disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    performed_by VARCHAR(50) NOT NULL,
+    performed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (employee_id) REFERENCES Employee(employee_id) ON DELETE CASCADE,
+    FOREIGN KEY (reassigned_to) REFERENCES Employee(employee_id) ON DELETE SET NULL
 );
 
 -- Create Disease table
 CREATE TABLE IF NOT EXISTS Disease (
     disease_id VARCHAR(4) PRIMARY KEY, 
     disease_name VARCHAR(100) NOT NULL, 
+    icd10_code VARCHAR(8) UNIQUE,
     UNIQUE(disease_name)
 );
 
@@ -131,21 +384,376 @@ CREATE TABLE IF NOT EXISTS Patient_chronic_disease (
     UNIQUE (patient_id, disease_id)
 );
 
+-- Create Encounter_diagnosis table (diagnosis codes of an encounter, from the Disease catalog)
+CREATE TABLE IF NOT EXISTS Encounter_diagnosis (
+    medical_history_id INT NOT NULL,
+    disease_id VARCHAR(4) NOT NULL,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (medical_history_id, disease_id),
+    FOREIGN KEY (medical_history_id) REFERENCES Medical_history(medical_history_id) ON DELETE CASCADE,
+    FOREIGN KEY (disease_id) REFERENCES Disease(disease_id)
+);
+
+-- Create Drug_class table (pharmacological class, e.g. penicillins)
+CREATE TABLE IF NOT EXISTS Drug_class (
+    drug_class_id VARCHAR(4) PRIMARY KEY,
+    class_name VARCHAR(100) UNIQUE NOT NULL
+);
+
 -- Create drug table
 CREATE TABLE IF NOT EXISTS drug (
     drug_id VARCHAR(4) PRIMARY KEY, 
     drug_name VARCHAR(100) NOT NULL, 
+    atc_code VARCHAR(7),
+    rxnorm_code VARCHAR(20),
+    drug_class_id VARCHAR(4),
+    FOREIGN KEY (drug_class_id) REFERENCES Drug_class(drug_class_id) ON DELETE SET NULL,
     UNIQUE(drug_name)
 );
 
--- Create Patient_drug_allergy table
+-- Create Drug_ingredient table (active ingredients, a drug can contain several)
+CREATE TABLE IF NOT EXISTS Drug_ingredient (
+    ingredient_id VARCHAR(4) PRIMARY KEY,
+    ingredient_name VARCHAR(100) UNIQUE NOT NULL
+);
+
+-- Create Drug_ingredient_link table
+CREATE TABLE IF NOT EXISTS Drug_ingredient_link (
+    drug_id VARCHAR(4) NOT NULL,
+    ingredient_id VARCHAR(4) NOT NULL,
+    PRIMARY KEY (drug_id, ingredient_id),
+    FOREIGN KEY (drug_id) REFERENCES drug(drug_id) ON DELETE CASCADE,
+    FOREIGN KEY (ingredient_id) REFERENCES Drug_ingredient(ingredient_id) ON DELETE CASCADE
+);
+
+-- Create Drug_class_cross_sensitivity table (known cross-reactions between two classes, stored once per pair)
+CREATE TABLE IF NOT EXISTS Drug_class_cross_sensitivity (
+    drug_class_id VARCHAR(4) NOT NULL,
+    related_class_id VARCHAR(4) NOT NULL,
+    note TEXT,
+    PRIMARY KEY (drug_class_id, related_class_id),
+    FOREIGN KEY (drug_class_id) REFERENCES Drug_class(drug_class_id) ON DELETE CASCADE,
+    FOREIGN KEY (related_class_id) REFERENCES Drug_class(drug_class_id) ON DELETE CASCADE,
+    CHECK (drug_class_id <> related_class_id)
+);
+
+-- Create Patient_drug_allergy table (an allergy is recorded either to one drug or to a whole drug class)
 CREATE TABLE IF NOT EXISTS Patient_drug_allergy (
     id SERIAL PRIMARY KEY,
     patient_id VARCHAR(4) NOT NULL,
-    drug_id VARCHAR(4) NOT NULL,
+    drug_id VARCHAR(4),
+    drug_class_id VARCHAR(4),
+    severity allergy_severity,
+    reaction_type VARCHAR(50),
     FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
     FOREIGN KEY (drug_id) REFERENCES drug(drug_id) ON DELETE CASCADE,
-    UNIQUE (patient_id, drug_id)
+    FOREIGN KEY (drug_class_id) REFERENCES Drug_class(drug_class_id) ON DELETE CASCADE,
+    CHECK ((drug_id IS NULL) <> (drug_class_id IS NULL)),
+    UNIQUE (patient_id, drug_id),
+    UNIQUE (patient_id, drug_class_id)
+);
+
+-- Create Lab_test table (orderable test or panel)
+CREATE TABLE IF NOT EXISTS Lab_test (
+    lab_test_id VARCHAR(10) PRIMARY KEY,
+    test_name VARCHAR(100) NOT NULL,
+    specimen_type VARCHAR(30) NOT NULL,
+    loinc_code VARCHAR(10)
+);
+
+-- Create Lab_test_component table (the analytes a test reports, with unit and reference ranges)
+CREATE TABLE IF NOT EXISTS Lab_test_component (
+    component_id SERIAL PRIMARY KEY,
+    lab_test_id VARCHAR(10) NOT NULL,
+    component_name VARCHAR(100) NOT NULL,
+    unit VARCHAR(20) NOT NULL,
+    normal_low NUMERIC(10,3),
+    normal_high NUMERIC(10,3),
+    critical_low NUMERIC(10,3),
+    critical_high NUMERIC(10,3),
+    FOREIGN KEY (lab_test_id) REFERENCES Lab_test(lab_test_id) ON DELETE CASCADE,
+    UNIQUE (lab_test_id, component_name)
+);
+
+-- Create Lab_order table (one test ordered for a patient, tracked from order to verification)
+CREATE TABLE IF NOT EXISTS Lab_order (
+    lab_order_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    lab_test_id VARCHAR(10) NOT NULL,
+    ordered_by VARCHAR(4) NOT NULL,
+    medical_history_id INT,
+    priority lab_priority NOT NULL DEFAULT 'routine',
+    status lab_order_status NOT NULL DEFAULT 'ordered',
+    note TEXT,
+    ordered_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    specimen_id VARCHAR(30),
+    collected_by VARCHAR(4),
+    collected_at TIMESTAMP,
+    resulted_by VARCHAR(4),
+    resulted_at TIMESTAMP,
+    verified_by VARCHAR(4),
+    verified_at TIMESTAMP,
+    cancelled_at TIMESTAMP,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (lab_test_id) REFERENCES Lab_test(lab_test_id),
+    FOREIGN KEY (ordered_by) REFERENCES Employee(employee_id),
+    FOREIGN KEY (medical_history_id) REFERENCES Medical_history(medical_history_id) ON DELETE SET NULL,
+    FOREIGN KEY (collected_by) REFERENCES Employee(employee_id),
+    FOREIGN KEY (resulted_by) REFERENCES Employee(employee_id),
+    FOREIGN KEY (verified_by) REFERENCES Employee(employee_id)
+);
+
+-- Create Lab_result table (unit, ranges and flag are copied from the component when the result is entered)
+CREATE TABLE IF NOT EXISTS Lab_result (
+    lab_result_id SERIAL PRIMARY KEY,
+    lab_order_id INT NOT NULL,
+    component_id INT NOT NULL,
+    value NUMERIC(10,3) NOT NULL,
+    unit VARCHAR(20) NOT NULL,
+    normal_low NUMERIC(10,3),
+    normal_high NUMERIC(10,3),
+    flag VARCHAR(15) NOT NULL,
+    FOREIGN KEY (lab_order_id) REFERENCES Lab_order(lab_order_id) ON DELETE CASCADE,
+    FOREIGN KEY (component_id) REFERENCES Lab_test_component(component_id),
+    UNIQUE (lab_order_id, component_id)
+);
+
+-- Create Ward table (each ward belongs to a department)
+CREATE TABLE IF NOT EXISTS Ward (
+    ward_id VARCHAR(4) PRIMARY KEY,
+    ward_name VARCHAR(50) NOT NULL,
+    department_id VARCHAR(4) NOT NULL,
+    FOREIGN KEY (department_id) REFERENCES Department(department_id)
+);
+
+-- Create Bed table
+CREATE TABLE IF NOT EXISTS Bed (
+    bed_id SERIAL PRIMARY KEY,
+    ward_id VARCHAR(4) NOT NULL,
+    bed_number VARCHAR(10) NOT NULL,
+    status bed_status NOT NULL DEFAULT 'available',
+    FOREIGN KEY (ward_id) REFERENCES Ward(ward_id) ON DELETE CASCADE,
+    UNIQUE (ward_id, bed_number)
+);
+
+-- Create Admission table (one inpatient stay, discharged_at IS NULL while the patient is in hospital)
+CREATE TABLE IF NOT EXISTS Admission (
+    admission_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    admitted_by VARCHAR(4) NOT NULL,
+    reason TEXT NOT NULL,
+    admitted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    discharged_by VARCHAR(4),
+    discharged_at TIMESTAMP,
+    discharge_note TEXT,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (admitted_by) REFERENCES Employee(employee_id),
+    FOREIGN KEY (discharged_by) REFERENCES Employee(employee_id)
+);
+
+-- Create Bed_assignment table (the beds of an admission over time, released_at IS NULL for the current bed)
+CREATE TABLE IF NOT EXISTS Bed_assignment (
+    bed_assignment_id SERIAL PRIMARY KEY,
+    admission_id INT NOT NULL,
+    bed_id INT NOT NULL,
+    assigned_by VARCHAR(4) NOT NULL,
+    assigned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    released_at TIMESTAMP,
+    reason TEXT,
+    FOREIGN KEY (admission_id) REFERENCES Admission(admission_id) ON DELETE CASCADE,
+    FOREIGN KEY (bed_id) REFERENCES Bed(bed_id),
+    FOREIGN KEY (assigned_by) REFERENCES Employee(employee_id)
+);
+
+-- A bed holds at most one current assignment and a patient at most one open admission,
+-- so concurrent admits/transfers into the same bed cannot both succeed
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bed_assignment_current_bed ON Bed_assignment(bed_id) WHERE released_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bed_assignment_current_admission ON Bed_assignment(admission_id) WHERE released_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_admission_open_patient ON Admission(patient_id) WHERE discharged_at IS NULL;
+
+-- Create Prescription table (a drug prescribed to a patient, optionally during an encounter)
+CREATE TABLE IF NOT EXISTS Prescription (
+    prescription_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    drug_id VARCHAR(4) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    instructions TEXT,
+    prescribed_by VARCHAR(4) NOT NULL,
+    medical_history_id INT,
+    prescribed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (drug_id) REFERENCES drug(drug_id),
+    FOREIGN KEY (prescribed_by) REFERENCES Employee(employee_id),
+    FOREIGN KEY (medical_history_id) REFERENCES Medical_history(medical_history_id) ON DELETE SET NULL
+);
+
+-- Create Service_price table (price list, item_code '' is the default price of the item type)
+CREATE TABLE IF NOT EXISTS Service_price (
+    price_id SERIAL PRIMARY KEY,
+    item_type billing_item_type NOT NULL,
+    item_code VARCHAR(10) NOT NULL DEFAULT '',
+    description VARCHAR(100) NOT NULL,
+    unit_price NUMERIC(10,2) NOT NULL CHECK (unit_price >= 0),
+    insurance_coverage NUMERIC(5,2) NOT NULL DEFAULT 0 CHECK (insurance_coverage BETWEEN 0 AND 100),
+    UNIQUE (item_type, item_code)
+);
+
+-- Create Invoice table (amounts are the sums of its charges, the insurance split is fixed when the invoice is issued)
+CREATE TABLE IF NOT EXISTS Invoice (
+    invoice_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    issued_by VARCHAR(4) NOT NULL,
+    issued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    insured BOOLEAN NOT NULL,
+    policy_id INT,
+    total_amount NUMERIC(12,2) NOT NULL,
+    insurance_amount NUMERIC(12,2) NOT NULL,
+    patient_amount NUMERIC(12,2) NOT NULL,
+    claim_status claim_status NOT NULL DEFAULT 'not_applicable',
+    voided_at TIMESTAMP,
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (issued_by) REFERENCES Employee(employee_id),
+    FOREIGN KEY (policy_id) REFERENCES Insurance_policy(policy_id)
+);
+
+-- Create Charge table (captured billable items, they become the line items of an invoice)
+CREATE TABLE IF NOT EXISTS Charge (
+    charge_id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    item_type billing_item_type NOT NULL,
+    item_code VARCHAR(10) NOT NULL DEFAULT '',
+    source_type VARCHAR(20) NOT NULL,
+    source_id INT,
+    description VARCHAR(200) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC(10,2) NOT NULL,
+    amount NUMERIC(12,2) NOT NULL,
+    insurance_coverage NUMERIC(5,2) NOT NULL,
+    charged_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    invoice_id INT,
+    insurance_amount NUMERIC(12,2),
+    patient_amount NUMERIC(12,2),
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE,
+    FOREIGN KEY (invoice_id) REFERENCES Invoice(invoice_id) ON DELETE SET NULL,
+    UNIQUE (source_type, source_id)
+);
+
+-- Create Payment table
+CREATE TABLE IF NOT EXISTS Payment (
+    payment_id SERIAL PRIMARY KEY,
+    invoice_id INT NOT NULL,
+    payer payer_type NOT NULL,
+    amount NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+    method VARCHAR(20) NOT NULL,
+    reference VARCHAR(50),
+    paid_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    received_by VARCHAR(4),
+    FOREIGN KEY (invoice_id) REFERENCES Invoice(invoice_id) ON DELETE CASCADE,
+    FOREIGN KEY (received_by) REFERENCES Employee(employee_id)
+);
+
+-- Create Job table (durable background job queue, workers claim jobs with FOR UPDATE SKIP LOCKED; 'dead' is the dead-letter state)
+CREATE TABLE IF NOT EXISTS Job (
+    job_id BIGSERIAL PRIMARY KEY,
+    job_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status job_status NOT NULL DEFAULT 'queued',
+    priority SMALLINT NOT NULL DEFAULT 0,
+    run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    attempts SMALLINT NOT NULL DEFAULT 0,
+    max_attempts SMALLINT NOT NULL DEFAULT 5 CHECK (max_attempts > 0),
+    unique_key VARCHAR(100),
+    last_error TEXT,
+    result JSONB,
+    locked_by VARCHAR(100),
+    locked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Create Job_schedule table (recurring jobs, the scheduler enqueues job_type every interval_seconds)
+CREATE TABLE IF NOT EXISTS Job_schedule (
+    schedule_name VARCHAR(50) PRIMARY KEY,
+    job_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    interval_seconds INT NOT NULL CHECK (interval_seconds > 0),
+    next_run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_run_at TIMESTAMP,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Create Appointment_checkin table (waiting room: one row per arrived appointment, queue numbers restart per department and day)
+CREATE TABLE IF NOT EXISTS Appointment_checkin (
+    checkin_id SERIAL PRIMARY KEY,
+    appointment_id INT UNIQUE NOT NULL,
+    department_id VARCHAR(4) NOT NULL,
+    queue_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    queue_number INT NOT NULL CHECK (queue_number > 0),
+    status queue_status NOT NULL DEFAULT 'waiting',
+    checked_in_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    checked_in_by VARCHAR(4),
+    called_at TIMESTAMP,
+    called_by VARCHAR(4),
+    room VARCHAR(20),
+    finished_at TIMESTAMP,
+    FOREIGN KEY (appointment_id) REFERENCES Patient_Appointment(appointment_id) ON DELETE CASCADE,
+    FOREIGN KEY (department_id) REFERENCES Department(department_id),
+    FOREIGN KEY (checked_in_by) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    FOREIGN KEY (called_by) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    UNIQUE (department_id, queue_date, queue_number)
+);
+
+-- Create Outbox_event table (transactional outbox: domain events are written in the transaction of the change, then fanned out to webhooks)
+CREATE TABLE IF NOT EXISTS Outbox_event (
+    event_id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    aggregate_type VARCHAR(30) NOT NULL,
+    aggregate_id VARCHAR(20) NOT NULL,
+    patient_id VARCHAR(4), -- patient the event is about, its data_sharing consent decides what webhooks receive
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMP
+);
+
+-- Create Webhook_subscription table (external systems notified of domain events, payloads are signed with secret)
+CREATE TABLE IF NOT EXISTS Webhook_subscription (
+    subscription_id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}', -- empty means every event type
+    description TEXT,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create Webhook_delivery table (one row per event and subscription, it is also the delivery log)
+CREATE TABLE IF NOT EXISTS Webhook_delivery (
+    delivery_id BIGSERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL,
+    event_id BIGINT NOT NULL,
+    status webhook_delivery_status NOT NULL DEFAULT 'pending',
+    attempts SMALLINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_status_code INT,
+    last_error TEXT,
+    response_body TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP,
+    FOREIGN KEY (subscription_id) REFERENCES Webhook_subscription(subscription_id) ON DELETE CASCADE,
+    FOREIGN KEY (event_id) REFERENCES Outbox_event(event_id) ON DELETE CASCADE,
+    UNIQUE (subscription_id, event_id)
+);
+
+-- Create Patient_record_access table (audit of who viewed or exported a patient's record, shown to the patient in their data export)
+CREATE TABLE IF NOT EXISTS Patient_record_access (
+    access_id BIGSERIAL PRIMARY KEY,
+    patient_id VARCHAR(4) NOT NULL,
+    accessed_by VARCHAR(50) NOT NULL, -- username
+    role VARCHAR(30) NOT NULL,
+    action VARCHAR(20) NOT NULL, -- view (one patient), list (lists, searches), export (files, ADT messages)
+    accessed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (patient_id) REFERENCES Patient(patient_id) ON DELETE CASCADE
 );
 
 -- Create indexes
@@ -153,15 +761,57 @@ CREATE TABLE IF NOT EXISTS Patient_drug_allergy (
 CREATE INDEX IF NOT EXISTS idx_patient_id ON Patient(patient_id);
 CREATE INDEX IF NOT EXISTS idx_patient_first_name ON Patient(first_name);
 CREATE INDEX IF NOT EXISTS idx_patient_last_name ON Patient(last_name);
+-- For the ranked patient search (full-text on names and email, trigrams for typos and partial numbers)
+CREATE INDEX IF NOT EXISTS idx_patient_search_vector ON Patient USING GIN (to_tsvector('simple', first_name || ' ' || last_name || ' ' || email));
+CREATE INDEX IF NOT EXISTS idx_patient_full_name_trgm ON Patient USING GIN ((first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_patient_email_trgm ON Patient USING GIN (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_patient_phone_number_prefix ON Patient(phone_number text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_patient_id_card_number_prefix ON Patient(id_card_number text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_patient_date_of_birth ON Patient(date_of_birth);
 
 -- For employee search
 CREATE INDEX IF NOT EXISTS idx_employee_id ON Employee(employee_id);
 CREATE INDEX IF NOT EXISTS idx_employee_first_name ON Employee(first_name);
 CREATE INDEX IF NOT EXISTS idx_employee_last_name ON Employee(last_name);
 
+-- For disease and drug typeahead (prefix search on lower(name))
+CREATE INDEX IF NOT EXISTS idx_disease_name_prefix ON Disease(lower(disease_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_drug_name_prefix ON drug(lower(drug_name) text_pattern_ops);
+
 -- For Foreign Keys (use to JOIN tables)
 CREATE INDEX IF NOT EXISTS idx_patient_user_id ON Patient(user_id);
 CREATE INDEX IF NOT EXISTS idx_medical_history_patient_id ON Medical_history(patient_id);
+CREATE INDEX IF NOT EXISTS idx_medical_history_employee_id ON Medical_history(employee_id);
+CREATE INDEX IF NOT EXISTS idx_observation_patient_type_time ON Observation(patient_id, observation_type, observed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_observation_medical_history_id ON Observation(medical_history_id);
 CREATE INDEX IF NOT EXISTS idx_appointment_patient_id ON Patient_Appointment(patient_id);
+CREATE INDEX IF NOT EXISTS idx_appointment_employee_id ON Patient_Appointment(employee_id);
+CREATE INDEX IF NOT EXISTS idx_offboarding_employee_id ON Employee_offboarding(employee_id);
 CREATE INDEX IF NOT EXISTS idx_chronic_disease_patient_id ON Patient_chronic_disease(patient_id);
-CREATE INDEX IF NOT EXISTS idx_drug_allergy_patient_id ON Patient_drug_allergy(patient_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_drug_allergy_patient_id ON Patient_drug_allergy(patient_id);
+CREATE INDEX IF NOT EXISTS idx_drug_drug_class_id ON drug(drug_class_id);
+CREATE INDEX IF NOT EXISTS idx_lab_order_patient_id ON Lab_order(patient_id, ordered_at DESC);
+CREATE INDEX IF NOT EXISTS idx_lab_order_status ON Lab_order(status);
+CREATE INDEX IF NOT EXISTS idx_lab_result_lab_order_id ON Lab_result(lab_order_id);
+CREATE INDEX IF NOT EXISTS idx_ward_department_id ON Ward(department_id);
+CREATE INDEX IF NOT EXISTS idx_bed_ward_id ON Bed(ward_id);
+CREATE INDEX IF NOT EXISTS idx_admission_patient_id ON Admission(patient_id);
+CREATE INDEX IF NOT EXISTS idx_bed_assignment_admission_id ON Bed_assignment(admission_id);
+CREATE INDEX IF NOT EXISTS idx_prescription_patient_id ON Prescription(patient_id);
+CREATE INDEX IF NOT EXISTS idx_charge_patient_unbilled ON Charge(patient_id) WHERE invoice_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_charge_invoice_id ON Charge(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoice_patient_id ON Invoice(patient_id);
+CREATE INDEX IF NOT EXISTS idx_invoice_policy_id ON Invoice(policy_id);
+CREATE INDEX IF NOT EXISTS idx_insurance_policy_patient_id ON Insurance_policy(patient_id, valid_from);
+CREATE INDEX IF NOT EXISTS idx_payment_invoice_id ON Payment(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_patient_consent_patient_id ON Patient_consent(patient_id, consent_type);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_patient_consent_current ON Patient_consent(patient_id, consent_type) WHERE revoked_at IS NULL AND superseded_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_reminder_due ON Appointment_reminder(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_reminder_appointment_id ON Appointment_reminder(appointment_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_reminder_pending ON Appointment_reminder(appointment_id, channel, offset_minutes) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_job_claim ON Job(priority DESC, run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_job_status_type ON Job(status, job_type);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_job_unique_key_open ON Job(unique_key) WHERE status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS idx_outbox_undispatched ON Outbox_event(event_id) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON Webhook_delivery(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_record_access_patient_id ON Patient_record_access(patient_id, accessed_at DESC);
\ No newline at end of file
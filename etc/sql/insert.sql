@@ -1,38 +1,38 @@
 INSERT INTO Patient (
     patient_id, first_name, last_name, age, date_of_birth, gender,
-    blood_type, email, health_insurance, address, phone_number,
+    blood_type, email, address, phone_number,
     id_card_number, ongoing_treatment, unhealthy_habits
 )
 VALUES
 ( 'P001', 'John', 'Doe', 30, '1994-05-15', 'male', 'A', 
- 'john.doe@example.com', 'yes', '123 Main St, Cityville', 
+ 'john.doe@example.com', '123 Main St, Cityville', 
  '0123456789', '1234567890123', 'Hypertension','Drunk'),
 ( 'P002', 'Jane', 'Smith', 45, '1979-11-22', 'female', 'B',
- 'jane.smith@example.com', 'yes', '456 Oak Ave, Townsville', 
+ 'jane.smith@example.com', '456 Oak Ave, Townsville', 
  '0987654321', '3210987654321', 'Diabetes','Drunk'),
 ( 'P003', 'Mary', 'Johnson', 25, '1999-08-10', 'female', 'O',
- 'mary.johnson@example.com', 'no', '789 Pine Rd, Villagetown', 
+ 'mary.johnson@example.com', '789 Pine Rd, Villagetown', 
  '0876543210', '6543210987654', 'Healthy','None'),
  ( 'P004', 'Michael', 'Brown', 35, '1989-02-18', 'male', 'AB', 
-  'michael.brown@example.com', 'yes', '101 Maple St, Capital City', 
+  'michael.brown@example.com', '101 Maple St, Capital City', 
   '0654321098', '9876543210123', 'Asthma', 'Smoker'),
 ( 'P005', 'Emily', 'Davis', 28, '1996-07-05', 'female', 'A', 
-  'emily.davis@example.com', 'yes', '202 Birch Ln, Riverside', 
+  'emily.davis@example.com', '202 Birch Ln, Riverside', 
   '0789012345', '1122334455667', 'Allergy', 'None'),
 ( 'P006', 'William', 'Taylor', 50, '1974-09-30', 'male', 'O', 
-  'william.taylor@example.com', 'no', '303 Cedar Dr, Hillside', 
+  'william.taylor@example.com', '303 Cedar Dr, Hillside', 
   '0923456781', '7766554433221', 'Heart Disease', 'Drunk'),
 ( 'P007', 'Sophia', 'Martinez', 40, '1984-03-12', 'female', 'B', 
-  'sophia.martinez@example.com', 'yes', '404 Elm St, Lakeside', 
+  'sophia.martinez@example.com', '404 Elm St, Lakeside', 
   '0845678910', '3344556677889', 'Obesity', 'Smoker'),
 ( 'P008', 'James', 'Wilson', 22, '2002-06-25', 'male', 'AB', 
-  'james.wilson@example.com', 'no', '505 Cherry Ave, Uptown', 
+  'james.wilson@example.com', '505 Cherry Ave, Uptown', 
   '0765432190', '9988776655443', 'Healthy', 'None'),
 ( 'P009', 'Olivia', 'Anderson', 31, '1993-12-08', 'female', 'O', 
-  'olivia.anderson@example.com', 'yes', '606 Willow Rd, Midtown', 
+  'olivia.anderson@example.com', '606 Willow Rd, Midtown', 
   '0812345678', '5566778899001', 'Hypertension', 'Drunk'),
 ( 'P010', 'Daniel', 'Thomas', 29, '1995-04-20', 'male', 'B', 
-  'daniel.thomas@example.com', 'no', '707 Ash Pl, Downtown', 
+  'daniel.thomas@example.com', '707 Ash Pl, Downtown', 
   '0743210987', '4433221100998', 'Healthy', 'None');
 
 INSERT INTO Medical_history (patient_id, detail, time, date)
@@ -104,17 +104,17 @@ INSERT INTO Patient_Appointment (patient_id, time, date, topic) VALUES
 ('P009', '11:00:00', '2025-05-23', 'Hypertension follow-up');
 
 INSERT INTO Disease VALUES
-('I001', 'streptococcus pneumoniae'),
-('I002', 'tuberculosis'),
-('I003', 'hepatitis B'),
-('I004', 'malaria'),
-('I005', 'dengue fever'),
-('I006', 'measles'),
-('I007', 'influenza'),
-('I008', 'cholera'),
-('I009', 'typhoid fever'),
-('I010', 'rabies'),
-('I011', 'meningitis');
+('I001', 'streptococcus pneumoniae', 'J13'),
+('I002', 'tuberculosis', 'A15'),
+('I003', 'hepatitis B', 'B18.1'),
+('I004', 'malaria', 'B54'),
+('I005', 'dengue fever', 'A90'),
+('I006', 'measles', 'B05'),
+('I007', 'influenza', 'J11'),
+('I008', 'cholera', 'A00'),
+('I009', 'typhoid fever', 'A01.0'),
+('I010', 'rabies', 'A82'),
+('I011', 'meningitis', 'G03');
 
 INSERT INTO Patient_chronic_disease (patient_id, disease_id)
 VALUES	('P001', 'I001'),
@@ -122,20 +122,219 @@ VALUES	('P001', 'I001'),
 		('P002', 'I002'),
 		('P003', 'I004');
 
+INSERT INTO Drug_class VALUES
+('C001', 'penicillins'),
+('C002', 'macrolides'),
+('C003', 'fluoroquinolones'),
+('C004', 'NSAIDs'),
+('C005', 'anilide analgesics'),
+('C006', 'biguanides'),
+('C007', 'proton pump inhibitors'),
+('C008', 'statins'),
+('C009', 'insulins'),
+('C010', 'ACE inhibitors'),
+('C011', 'cephalosporins');
+
 INSERT INTO drug VALUES
-('R001', 'anti bacteria'),
-('R002', 'paracetamol'),
-('R003', 'amoxicillin'),
-('R004', 'ibuprofen'),
-('R005', 'azithromycin'),
-('R006', 'ciprofloxacin'),
-('R007', 'metformin'),
-('R008', 'omeprazole'),
-('R009', 'atorvastatin'),
-('R010', 'insulin'),
-('R011', 'lisinopril');
-
-INSERT INTO Patient_drug_allergy (patient_id, drug_id)
-VALUES	('P001', 'R001'),
-		('P002', 'R003'),
-		('P003', 'R004');
+('R001', 'anti bacteria', NULL, NULL, NULL),
+('R002', 'paracetamol', 'N02BE01', '161', 'C005'),
+('R003', 'amoxicillin', 'J01CA04', '723', 'C001'),
+('R004', 'ibuprofen', 'M01AE01', '5640', 'C004'),
+('R005', 'azithromycin', 'J01FA10', '18631', 'C002'),
+('R006', 'ciprofloxacin', 'J01MA02', '2551', 'C003'),
+('R007', 'metformin', 'A10BA02', '6809', 'C006'),
+('R008', 'omeprazole', 'A02BC01', '7646', 'C007'),
+('R009', 'atorvastatin', 'C10AA05', '83367', 'C008'),
+('R010', 'insulin', 'A10AB01', '5856', 'C009'),
+('R011', 'lisinopril', 'C09AA03', '29046', 'C010'),
+('R012', 'cefalexin', 'J01DB01', '2231', 'C011'),
+('R013', 'amoxicillin/clavulanate', 'J01CR02', '19711', 'C001');
+
+INSERT INTO Drug_ingredient VALUES
+('G001', 'paracetamol'),
+('G002', 'amoxicillin'),
+('G003', 'ibuprofen'),
+('G004', 'azithromycin'),
+('G005', 'ciprofloxacin'),
+('G006', 'metformin'),
+('G007', 'omeprazole'),
+('G008', 'atorvastatin'),
+('G009', 'insulin'),
+('G010', 'lisinopril'),
+('G011', 'cefalexin'),
+('G012', 'clavulanic acid');
+
+INSERT INTO Drug_ingredient_link (drug_id, ingredient_id) VALUES
+('R002', 'G001'),
+('R003', 'G002'),
+('R004', 'G003'),
+('R005', 'G004'),
+('R006', 'G005'),
+('R007', 'G006'),
+('R008', 'G007'),
+('R009', 'G008'),
+('R010', 'G009'),
+('R011', 'G010'),
+('R012', 'G011'),
+('R013', 'G002'),
+('R013', 'G012');
+
+INSERT INTO Drug_class_cross_sensitivity (drug_class_id, related_class_id, note) VALUES
+('C001', 'C011', 'Beta-lactam ring shared by penicillins and cephalosporins, low but real cross-reactivity');
+
+INSERT INTO Patient_drug_allergy (patient_id, drug_id, severity, reaction_type)
+VALUES	('P001', 'R001', 'mild', 'rash'),
+		('P002', 'R003', 'severe', 'anaphylaxis'),
+		('P003', 'R004', 'moderate', 'urticaria');
+
+INSERT INTO Patient_drug_allergy (patient_id, drug_class_id, severity, reaction_type)
+VALUES	('P004', 'C001', 'life_threatening', 'anaphylaxis');
+
+
+INSERT INTO Medical_history (patient_id, detail, time, date, employee_id, chief_complaint, plan)
+VALUES ('P008', 'High fever for 2 days with myalgia, rapid test positive for influenza A', '09:15:00', '2025-05-22', 'E006', 'Fever and body aches', 'Oseltamivir 5 days, fluids, rest, return if short of breath');
+
+INSERT INTO Encounter_diagnosis (medical_history_id, disease_id, is_primary)
+SELECT medical_history_id, 'I007', TRUE FROM Medical_history WHERE patient_id = 'P008' AND date = '2025-05-22';
+
+INSERT INTO Observation_type VALUES
+('systolic_bp', 'Systolic blood pressure', 'mmHg', 90, 129, 70, 180, 40, 300),
+('diastolic_bp', 'Diastolic blood pressure', 'mmHg', 60, 84, 40, 120, 20, 200),
+('heart_rate', 'Heart rate', 'bpm', 60, 100, 40, 130, 20, 300),
+('respiratory_rate', 'Respiratory rate', 'breaths/min', 12, 20, 8, 30, 4, 80),
+('temperature', 'Body temperature', '°C', 36.1, 37.5, 35.0, 40.0, 25, 45),
+('spo2', 'Oxygen saturation', '%', 95, 100, 88, NULL, 0, 100),
+('weight', 'Body weight', 'kg', NULL, NULL, NULL, NULL, 0.2, 500),
+('glucose', 'Blood glucose', 'mg/dL', 70, 140, 54, 400, 10, 2000);
+
+INSERT INTO Observation (patient_id, observation_type, value, observed_at, employee_id, medical_history_id)
+SELECT 'P008', t.observation_type, t.value, '2025-05-22 09:15:00', 'E006', m.medical_history_id
+FROM Medical_history m,
+     (VALUES ('systolic_bp', 118), ('diastolic_bp', 76), ('heart_rate', 96), ('respiratory_rate', 18), ('temperature', 38.9), ('spo2', 97)) AS t(observation_type, value)
+WHERE m.patient_id = 'P008' AND m.date = '2025-05-22';
+
+INSERT INTO Observation (patient_id, observation_type, value, observed_at) VALUES
+('P009', 'systolic_bp', 152, '2025-04-20 10:00:00'),
+('P009', 'diastolic_bp', 95, '2025-04-20 10:00:00'),
+('P009', 'systolic_bp', 146, '2025-05-23 11:00:00'),
+('P009', 'diastolic_bp', 91, '2025-05-23 11:00:00'),
+('P009', 'weight', 82.5, '2025-05-23 11:00:00'),
+('P002', 'glucose', 186, '2025-05-16 09:30:00');
+
+INSERT INTO Lab_test VALUES
+('CBC', 'Complete blood count', 'whole blood', '58410-2'),
+('BMP', 'Basic metabolic panel', 'serum', '51990-0'),
+('HBA1C', 'Hemoglobin A1c', 'whole blood', '4548-4'),
+('LIPID', 'Lipid panel', 'serum', '57698-3');
+
+INSERT INTO Lab_test_component (lab_test_id, component_name, unit, normal_low, normal_high, critical_low, critical_high) VALUES
+('CBC', 'Hemoglobin', 'g/dL', 12.0, 17.5, 7.0, 20.0),
+('CBC', 'White blood cells', '10^3/uL', 4.0, 11.0, 2.0, 30.0),
+('CBC', 'Platelets', '10^3/uL', 150, 450, 50, 1000),
+('BMP', 'Sodium', 'mmol/L', 135, 145, 120, 160),
+('BMP', 'Potassium', 'mmol/L', 3.5, 5.1, 2.8, 6.2),
+('BMP', 'Creatinine', 'mg/dL', 0.6, 1.3, NULL, 10.0),
+('BMP', 'Glucose', 'mg/dL', 70, 99, 40, 450),
+('HBA1C', 'Hemoglobin A1c', '%', 4.0, 5.6, NULL, 14.0),
+('LIPID', 'Total cholesterol', 'mg/dL', NULL, 200, NULL, NULL),
+('LIPID', 'LDL cholesterol', 'mg/dL', NULL, 130, NULL, NULL),
+('LIPID', 'HDL cholesterol', 'mg/dL', 40, NULL, NULL, NULL);
+
+INSERT INTO Lab_order (patient_id, lab_test_id, ordered_by, priority, status, ordered_at, specimen_id, collected_by, collected_at, resulted_by, resulted_at, verified_by, verified_at) VALUES
+('P002', 'HBA1C', 'E006', 'routine', 'verified', '2025-05-16 09:00:00', 'S250516-001', 'E008', '2025-05-16 09:20:00', 'E003', '2025-05-16 14:00:00', 'E001', '2025-05-16 15:30:00');
+
+INSERT INTO Lab_result (lab_order_id, component_id, value, unit, normal_low, normal_high, flag)
+SELECT o.lab_order_id, c.component_id, 8.200, c.unit, c.normal_low, c.normal_high, 'high'
+FROM Lab_order o JOIN Lab_test_component c ON c.lab_test_id = o.lab_test_id
+WHERE o.patient_id = 'P002' AND o.lab_test_id = 'HBA1C';
+
+INSERT INTO Lab_order (patient_id, lab_test_id, ordered_by, priority, ordered_at) VALUES
+('P009', 'BMP', 'E006', 'routine', '2025-05-23 11:10:00');
+
+INSERT INTO Ward VALUES
+('W001', 'Cardiac Care Unit', 'D001'),
+('W002', 'Neurology Ward', 'D003'),
+('W003', 'Emergency Observation', 'D006');
+
+INSERT INTO Bed (ward_id, bed_number, status) VALUES
+('W001', 'C-01', 'available'),
+('W001', 'C-02', 'available'),
+('W001', 'C-03', 'maintenance'),
+('W002', 'N-01', 'available'),
+('W002', 'N-02', 'available'),
+('W003', 'E-01', 'available'),
+('W003', 'E-02', 'cleaning');
+
+INSERT INTO Admission (patient_id, admitted_by, reason, admitted_at) VALUES
+('P009', 'E006', 'Hypertensive urgency, BP control and monitoring', '2025-05-23 12:00:00');
+
+INSERT INTO Bed_assignment (admission_id, bed_id, assigned_by, assigned_at)
+SELECT a.admission_id, b.bed_id, 'E006', '2025-05-23 12:00:00'
+FROM Admission a, Bed b
+WHERE a.patient_id = 'P009' AND b.ward_id = 'W001' AND b.bed_number = 'C-01';
+
+UPDATE Bed SET status = 'occupied' WHERE ward_id = 'W001' AND bed_number = 'C-01';
+
+INSERT INTO Prescription (patient_id, drug_id, quantity, instructions, prescribed_by, medical_history_id, prescribed_at)
+SELECT 'P008', 'R002', 20, '500 mg every 6 hours as needed for fever', 'E006', medical_history_id, '2025-05-22 09:40:00'
+FROM Medical_history WHERE patient_id = 'P008' AND date = '2025-05-22';
+
+INSERT INTO Service_price (item_type, item_code, description, unit_price, insurance_coverage) VALUES
+('appointment', '', 'Outpatient appointment', 300.00, 80),
+('encounter', '', 'Physician consultation', 500.00, 80),
+('lab_test', '', 'Laboratory test', 250.00, 70),
+('lab_test', 'CBC', 'Complete blood count', 180.00, 70),
+('lab_test', 'BMP', 'Basic metabolic panel', 350.00, 70),
+('lab_test', 'HBA1C', 'Hemoglobin A1c', 400.00, 70),
+('lab_test', 'LIPID', 'Lipid panel', 450.00, 70),
+('drug', '', 'Medication (per unit)', 20.00, 50),
+('drug', 'R002', 'Paracetamol 500 mg tablet', 2.00, 50),
+('other', '', 'Miscellaneous service', 0.00, 0);
+
+INSERT INTO Insurer VALUES
+('I001', 'Thai Health Assurance', '021234567', 'claims@thaihealth.example.com', TRUE),
+('I002', 'Siam Life & Health', '027654321', 'claims@siamlife.example.com', TRUE),
+('I003', 'Bangkok Mutual', '029876543', 'claims@bkkmutual.example.com', FALSE);
+
+INSERT INTO Insurance_policy (patient_id, insurer_id, policy_number, plan_name, coverage_percent, annual_limit, valid_from, valid_to, priority) VALUES
+('P001', 'I001', 'THA-100234', 'Gold', 90, 500000, '2024-01-01', NULL, 1),
+('P002', 'I001', 'THA-100871', 'Silver', 70, 200000, '2025-01-01', '2027-12-31', 1),
+('P004', 'I002', 'SLH-55012', 'Standard', 80, 300000, '2023-06-01', '2027-05-31', 1),
+('P005', 'I002', 'SLH-55230', 'Standard', 80, 300000, '2025-03-01', NULL, 1),
+('P007', 'I001', 'THA-101502', 'Silver', 70, 200000, '2024-07-01', '2027-06-30', 1),
+('P009', 'I002', 'SLH-56001', 'Premium', 100, NULL, '2025-01-01', NULL, 1),
+('P009', 'I001', 'THA-102244', 'Top-up', 50, 50000, '2025-01-01', NULL, 2),
+('P003', 'I003', 'BKM-8812', 'Basic', 60, 100000, '2022-01-01', '2023-12-31', 1);
+
+INSERT INTO Patient_emergency_contact (patient_id, contact_name, relationship, phone_number, email, priority, consent_to_share) VALUES
+('P001', 'Mary Doe', 'spouse', '0811111111', 'mary.doe@example.com', 1, TRUE),
+('P001', 'Robert Doe', 'parent', '0822222222', NULL, 2, FALSE),
+('P002', 'Tom Smith', 'child', '0833333333', 'tom.smith@example.com', 1, TRUE),
+('P009', 'Liam Anderson', 'sibling', '0844444444', NULL, 1, TRUE);
+
+INSERT INTO Consent_document VALUES
+('treatment', '1.0', 'Consent to treatment', 'I agree to receive the examinations and treatment my care team considers necessary.', '2024-01-01'),
+('treatment', '2.0', 'Consent to treatment', 'I agree to receive the examinations and treatment my care team considers necessary, and I have been told about the risks and alternatives.', '2025-06-01'),
+('data_sharing', '1.0', 'Sharing of medical data', 'I agree that my medical data may be shared with my insurer and with other providers involved in my care.', '2024-01-01'),
+('research', '1.0', 'Use of data for research', 'I agree that my de-identified data may be used for approved research.', '2024-01-01'),
+('communication_email', '1.0', 'Contact by email', 'I agree to receive appointment reminders and notices by email.', '2024-01-01'),
+('communication_sms', '1.0', 'Contact by SMS', 'I agree to receive appointment reminders and notices by SMS.', '2024-01-01'),
+('communication_phone', '1.0', 'Contact by phone', 'I agree to be called about my appointments and results.', '2024-01-01');
+
+INSERT INTO Patient_consent (patient_id, consent_type, version, granted, signed_at, recorded_by, superseded_at, revoked_at, revoked_by, revocation_reason) VALUES
+('P001', 'treatment', '1.0', TRUE, '2024-03-01 09:00:00', 'E001', '2025-07-01 10:00:00', NULL, NULL, NULL),
+('P001', 'treatment', '2.0', TRUE, '2025-07-01 10:00:00', 'E001', NULL, NULL, NULL, NULL),
+('P001', 'data_sharing', '1.0', TRUE, '2024-03-01 09:00:00', 'E001', NULL, NULL, NULL, NULL),
+('P001', 'communication_email', '1.0', TRUE, '2024-03-01 09:00:00', 'E001', NULL, NULL, NULL, NULL),
+('P001', 'communication_sms', '1.0', TRUE, '2024-03-01 09:00:00', 'E001', NULL, NULL, NULL, NULL),
+('P002', 'treatment', '2.0', TRUE, '2025-08-12 14:30:00', 'E003', NULL, NULL, NULL, NULL),
+('P002', 'research', '1.0', FALSE, '2025-08-12 14:30:00', 'E003', NULL, NULL, NULL, NULL),
+('P002', 'communication_sms', '1.0', TRUE, '2025-08-12 14:30:00', 'E003', NULL, NULL, NULL, NULL),
+('P009', 'treatment', '2.0', TRUE, '2025-09-20 08:15:00', 'E001', NULL, NULL, NULL, NULL),
+('P009', 'data_sharing', '1.0', TRUE, '2025-09-20 08:15:00', 'E001', NULL, '2025-10-01 11:00:00', 'E001', 'Patient asked to stop sharing with providers outside the hospital');
+
+INSERT INTO Appointment_reminder (appointment_id, channel, recipient, offset_minutes, send_at, status, attempts, next_attempt_at, last_error, sent_at) VALUES
+(1, 'email', 'john.doe@example.com', 1440, '2025-05-14 11:30:00', 'sent', 1, '2025-05-14 11:30:00', NULL, '2025-05-14 11:30:04'),
+(1, 'sms', '0123456789', 1440, '2025-05-14 11:30:00', 'sent', 2, '2025-05-14 11:31:00', 'sms gateway timeout', '2025-05-14 11:31:02'),
+(1, 'email', 'john.doe@example.com', 120, '2025-05-15 09:30:00', 'sent', 1, '2025-05-15 09:30:00', NULL, '2025-05-15 09:30:03'),
+(1, 'sms', '0123456789', 120, '2025-05-15 09:30:00', 'sent', 1, '2025-05-15 09:30:00', NULL, '2025-05-15 09:30:01');
@@ -0,0 +1,45 @@
+-- Encounters used to keep their vital signs in columns of Medical_history; they are now observations linked to the
+-- encounter (Observation.medical_history_id), which is where GET /patient/:id reads an encounter's vitals from.
+-- Run after create.sql on a database created before the Observation table. Safe to run more than once.
+BEGIN;
+
+INSERT INTO Observation_type VALUES
+('systolic_bp', 'Systolic blood pressure', 'mmHg', 90, 129, 70, 180, 40, 300),
+('diastolic_bp', 'Diastolic blood pressure', 'mmHg', 60, 84, 40, 120, 20, 200),
+('heart_rate', 'Heart rate', 'bpm', 60, 100, 40, 130, 20, 300),
+('respiratory_rate', 'Respiratory rate', 'breaths/min', 12, 20, 8, 30, 4, 80),
+('temperature', 'Body temperature', '°C', 36.1, 37.5, 35.0, 40.0, 25, 45),
+('spo2', 'Oxygen saturation', '%', 95, 100, 88, NULL, 0, 100)
+ON CONFLICT (observation_type) DO NOTHING;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'medical_history' AND column_name = 'systolic_bp') THEN
+        INSERT INTO Observation (patient_id, observation_type, value, observed_at, employee_id, medical_history_id)
+        SELECT m.patient_id, v.observation_type, v.value, m.date + m.time, m.employee_id, m.medical_history_id
+        FROM Medical_history m
+        CROSS JOIN LATERAL (VALUES
+            ('systolic_bp', m.systolic_bp::NUMERIC),
+            ('diastolic_bp', m.diastolic_bp::NUMERIC),
+            ('heart_rate', m.heart_rate::NUMERIC),
+            ('respiratory_rate', m.respiratory_rate::NUMERIC),
+            ('temperature', m.temperature),
+            ('spo2', m.spo2::NUMERIC)
+        ) AS v(observation_type, value)
+        WHERE v.value IS NOT NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM Observation o
+              WHERE o.medical_history_id = m.medical_history_id AND o.observation_type = v.observation_type
+          );
+    END IF;
+END $$;
+
+ALTER TABLE Medical_history
+    DROP COLUMN IF EXISTS systolic_bp,
+    DROP COLUMN IF EXISTS diastolic_bp,
+    DROP COLUMN IF EXISTS heart_rate,
+    DROP COLUMN IF EXISTS respiratory_rate,
+    DROP COLUMN IF EXISTS temperature,
+    DROP COLUMN IF EXISTS spo2;
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Patients used to have a yes/no Patient.health_insurance column; coverage is now an Insurance_policy of an Insurer.
+-- Every patient marked 'yes' without a policy yet gets a policy of the placeholder insurer I000, valid from today and
+-- covering 100% of the price list coverage without an annual limit (what an insured patient was billed before). Then
+-- the column is dropped, a NOT NULL column left behind makes every patient insert fail. Replace the placeholder policies
+-- with the real ones from /patient/:id/insurance.
+-- Run after create.sql on a database created before the Insurance_policy table. Safe to run more than once.
+BEGIN;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'patient' AND column_name = 'health_insurance') THEN
+        INSERT INTO Insurer (insurer_id, insurer_name, is_active)
+        VALUES ('I000', 'Unspecified insurer (migrated)', TRUE)
+        ON CONFLICT (insurer_id) DO NOTHING;
+
+        INSERT INTO Insurance_policy (patient_id, insurer_id, policy_number, plan_name, coverage_percent, annual_limit, valid_from, priority)
+        SELECT p.patient_id, 'I000', 'MIGRATED-' || p.patient_id, 'Migrated from health_insurance', 100, NULL, CURRENT_DATE, 1
+        FROM Patient p
+        WHERE p.health_insurance::text = 'yes'
+          AND NOT EXISTS (SELECT 1 FROM Insurance_policy ip WHERE ip.patient_id = p.patient_id)
+        ON CONFLICT (insurer_id, policy_number) DO NOTHING;
+    END IF;
+END $$;
+
+ALTER TABLE Patient DROP COLUMN IF EXISTS health_insurance;
+
+COMMIT;
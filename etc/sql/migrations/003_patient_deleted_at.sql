@@ -0,0 +1,8 @@
+-- Deleting a patient used to remove the row, and ON DELETE CASCADE took their invoices, clinical records, consents and
+-- access audit with it. A deleted patient is now only marked with Patient.deleted_at and hidden from every read.
+-- Run after create.sql on a database created before the column. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Patient ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+COMMIT;
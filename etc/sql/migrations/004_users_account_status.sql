@@ -0,0 +1,11 @@
+-- Offboarding an employee disables their account (Users.is_active) and revokes the tokens issued before it
+-- (Users.tokens_revoked_at, UTC). Every authenticated request reads both columns, so the server cannot serve a database
+-- without them.
+-- Run after create.sql on a database created before the columns. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Users
+    ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMP;
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- The disease and drug catalogs carry coded terminologies: Disease.icd10_code, drug.atc_code and drug.rxnorm_code, and a
+-- drug belongs to a Drug_class (drug.drug_class_id) for the class allergy checks.
+-- Run after create.sql (which creates Drug_class) on a database created before the columns. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Disease ADD COLUMN IF NOT EXISTS icd10_code VARCHAR(8) UNIQUE;
+
+ALTER TABLE drug
+    ADD COLUMN IF NOT EXISTS atc_code VARCHAR(7),
+    ADD COLUMN IF NOT EXISTS rxnorm_code VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS drug_class_id VARCHAR(4) REFERENCES Drug_class(drug_class_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_drug_drug_class_id ON drug(drug_class_id);
+
+COMMIT;
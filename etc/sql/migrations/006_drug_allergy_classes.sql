@@ -0,0 +1,23 @@
+-- An allergy now names either a drug or a drug class (Patient_drug_allergy.drug_class_id, drug_id becomes optional),
+-- with its severity and reaction. Existing allergies all name a drug and keep it.
+-- Run after create.sql (which creates Drug_class and the allergy_severity type) on a database created before the
+-- columns. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Patient_drug_allergy
+    ADD COLUMN IF NOT EXISTS drug_class_id VARCHAR(4) REFERENCES Drug_class(drug_class_id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS severity allergy_severity,
+    ADD COLUMN IF NOT EXISTS reaction_type VARCHAR(50),
+    ALTER COLUMN drug_id DROP NOT NULL;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'patient_drug_allergy_check') THEN
+        ALTER TABLE Patient_drug_allergy ADD CONSTRAINT patient_drug_allergy_check CHECK ((drug_id IS NULL) <> (drug_class_id IS NULL));
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'patient_drug_allergy_patient_id_drug_class_id_key') THEN
+        ALTER TABLE Patient_drug_allergy ADD CONSTRAINT patient_drug_allergy_patient_id_drug_class_id_key UNIQUE (patient_id, drug_class_id);
+    END IF;
+END $$;
+
+COMMIT;
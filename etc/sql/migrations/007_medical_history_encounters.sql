@@ -0,0 +1,15 @@
+-- A Medical_history row is a clinical encounter: the clinician who saw the patient (employee_id), the chief complaint
+-- and the plan next to the notes in detail. Its diagnoses (Encounter_diagnosis) and vital signs (Observation) are
+-- tables of create.sql. A database that already had the encounter vitals columns has these columns too, which is what
+-- 001 relies on; on an older one 001 has nothing to move.
+-- Run after create.sql on a database created before the columns. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Medical_history
+    ADD COLUMN IF NOT EXISTS employee_id VARCHAR(4) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS chief_complaint TEXT,
+    ADD COLUMN IF NOT EXISTS plan TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_medical_history_employee_id ON Medical_history(employee_id);
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- An appointment is booked with a doctor (Patient_Appointment.employee_id) and records the insurance policy found to
+-- cover it on the appointment date (policy_id).
+-- Run after create.sql (which creates Insurance_policy) on a database created before the columns. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Patient_Appointment
+    ADD COLUMN IF NOT EXISTS employee_id VARCHAR(4) REFERENCES Employee(employee_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS policy_id INT REFERENCES Insurance_policy(policy_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_appointment_employee_id ON Patient_Appointment(employee_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- A cancelled appointment is kept for the record with the time and reason of its cancellation
+-- (Patient_Appointment.cancelled_at, cancellation_reason) instead of being deleted.
+-- Run after create.sql on a database created before the columns. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE Patient_Appointment
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS cancellation_reason TEXT;
+
+COMMIT;
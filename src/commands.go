@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/NinePTH/GO_MVC-S/src/services"
+)
+
+const commandUsage = `usage:
+  import patients|employees <file.csv> [-dry-run]   bulk import, prints the report as JSON`
+
+// runCommand runs a command line tool instead of the server and returns the process exit code:
+// 0 on success, 1 when the command failed or some rows were not imported, 2 on bad usage
+func runCommand(args []string) int {
+	switch args[0] {
+	case "import":
+		return runImport(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+}
+
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate every row without writing anything")
+
+	// flag stops at the first positional argument, parse again after each one so -dry-run may come anywhere
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			fmt.Fprintln(os.Stderr, commandUsage)
+			return 2
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != 2 || !services.IsImportEntity(positional[0]) {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	file, err := os.Open(positional[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	result, err := services.ImportCSV(positional[0], file, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed:", err)
+		return 1
+	}
+	report, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(report))
+	if result.Failed_rows > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+func AdmitPatient(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.AdmitPatientRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Patient_id == "" || req.Bed_id == 0 || req.Admitted_by == "" || req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "patient_id, bed_id, admitted_by and reason are required"})
+	}
+
+	admissionID, err := services.AdmitPatient(req)
+	if err != nil {
+		return admissionError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":      "Patient admitted successfully",
+		"admission_id": admissionID,
+	})
+}
+
+func TransferPatient(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.TransferPatientRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Bed_id == 0 || req.Employee_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bed_id and employee_id are required"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.TransferPatient(id, req); err != nil {
+		return admissionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Patient transferred successfully"})
+}
+
+func DischargePatient(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.DischargePatientRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Employee_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "employee_id is required"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.DischargePatient(id, req); err != nil {
+		return admissionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Patient discharged successfully"})
+}
+
+func GetAdmission(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	admission, err := services.GetAdmission(id)
+	if err != nil {
+		if err.Error() == "admission not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, admission)
+}
+
+// GetCurrentAdmissions lists inpatients, ?ward_id= or ?department_id= to narrow down
+func GetCurrentAdmissions(c echo.Context) error {
+	admissions, err := services.GetCurrentAdmissions(c.QueryParam("ward_id"), c.QueryParam("department_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	recordPatientAccess(c, c.Param("id"), "view")
+	return c.JSON(http.StatusOK, admissions)
+}
+
+func GetPatientAdmissions(c echo.Context) error {
+	admissions, err := services.GetPatientAdmissions(c.Param("id"))
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, admissions)
+}
+
+// admissionError maps the errors of admit/transfer/discharge to a response
+func admissionError(c echo.Context, err error) error {
+	switch err.Error() {
+	case "Patient not found", "admission not found":
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case "bed not found", "employee not found or not active":
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	case "bed is not available", "patient is already admitted", "patient has already been discharged":
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
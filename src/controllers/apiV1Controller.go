@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// Handlers of the /api/v1 resources: patients and employees are addressed by /{id}, created with POST (201 and a
+// Location header), partially updated with PATCH (JSON Merge Patch) and a missing resource is a 404
+
+// mediaType is the Content-Type of the request without its parameters (charset)
+func mediaType(c echo.Context) string {
+	return strings.TrimSpace(strings.Split(c.Request().Header.Get("Content-Type"), ";")[0])
+}
+
+// bindMergePatch reads a JSON Merge Patch body (application/merge-patch+json, application/json is accepted too). A
+// patch must be an object, RFC 7386 would replace the whole resource with any other value
+func bindMergePatch(c echo.Context) (map[string]json.RawMessage, error) {
+	if ct := mediaType(c); ct != "application/merge-patch+json" && ct != "application/json" {
+		return nil, c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be application/merge-patch+json"})
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil || patch == nil {
+		return nil, c.JSON(http.StatusBadRequest, map[string]string{"error": "request body must be a JSON object"})
+	}
+	return patch, nil
+}
+
+// resourceError writes the response of a failed create / update / delete, notFound is the service's not found message
+func resourceError(c echo.Context, err error, notFound string) error {
+	err = services.ResourceWriteError(err)
+
+	var unknownErr *services.UnknownCatalogIdError
+	var patchErr *services.PatchError
+	var invalidErr *services.InvalidValueError
+	var conflictErr *services.ConflictError
+	switch {
+	case err.Error() == notFound:
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err.Error() == "position not found":
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	case errors.As(err, &unknownErr):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+	case errors.As(err, &patchErr), errors.As(err, &invalidErr):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.As(err, &conflictErr), err.Error() == "employee already exists", err.Error() == "email, phone number or name already belongs to another employee":
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// ListPatientsV1 is GET /api/v1/patients: the ranked search with ?q= (and ?date_of_birth=), every patient without,
+// paginated with ?limit= (1-100, default 20) and ?offset=
+func ListPatientsV1(c echo.Context) error {
+	dateOfBirth := c.QueryParam("date_of_birth")
+	if dateOfBirth != "" {
+		if _, err := time.Parse("2006-01-02", dateOfBirth); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "date_of_birth must be YYYY-MM-DD"})
+		}
+	}
+
+	limit := 20
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 100"})
+		}
+		limit = parsed
+	}
+	offset := 0
+	if raw := c.QueryParam("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset must be 0 or more"})
+		}
+		offset = parsed
+	}
+
+	results, err := services.SearchPatients(c.QueryParam("q"), dateOfBirth, limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	recordPatientsAccess(c, searchResultIDs(results), "list")
+	return c.JSON(http.StatusOK, results)
+}
+
+// CreatePatientV1 is POST /api/v1/patients, the body of /patient/add-patient. Answers 201 with the new patient
+func CreatePatientV1(c echo.Context) error {
+	if mediaType(c) != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be application/json"})
+	}
+
+	var req patients.AddPatientRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if err := services.ValidateNewPatient(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := services.AddPatient(req); err != nil {
+		return resourceError(c, err, "")
+	}
+
+	patient, err := services.GetPatient(req.Patient.Patient_id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/patients/"+url.PathEscape(req.Patient.Patient_id))
+	return c.JSON(http.StatusCreated, patient)
+}
+
+// GetPatientV1 is GET /api/v1/patients/:id for staff, a patient can only read their own record
+func GetPatientV1(c echo.Context) error {
+	id := c.Param("id")
+	claims, _ := c.Get("user").(jwt.MapClaims)
+	if role, _ := claims["role"].(string); role == "patient" {
+		if patientID, _ := claims["patient_id"].(string); patientID != id {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Forbidden: patients can only read their own record"})
+		}
+	}
+
+	patient, err := services.GetPatient(id)
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	recordPatientAccess(c, id, "view")
+	return c.JSON(http.StatusOK, patient)
+}
+
+// PatchPatientV1 is PATCH /api/v1/patients/:id, a merge patch of the AddPatientRequest. Answers with the updated patient
+func PatchPatientV1(c echo.Context) error {
+	patch, err := bindMergePatch(c)
+	if patch == nil {
+		return err
+	}
+
+	id := c.Param("id")
+	if err := services.PatchPatient(id, patch); err != nil {
+		return resourceError(c, err, "Patient not found")
+	}
+
+	patient, err := services.GetPatient(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, patient)
+}
+
+// DeletePatientV1 is DELETE /api/v1/patients/:id, 204 without a body
+func DeletePatientV1(c echo.Context) error {
+	if err := services.DeletePatient(c.Param("id")); err != nil {
+		return resourceError(c, err, "Patient not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListEmployeesV1 is GET /api/v1/employees with the filters and ?sort= of the employee search as query parameters
+func ListEmployeesV1(c echo.Context) error {
+	req, err := services.EmployeeSearchFromQuery(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	employees, err := services.GetEmployeeSearch(req)
+	if err != nil {
+		var searchErr *services.EmployeeSearchError
+		if errors.As(err, &searchErr) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if employees == nil {
+		employees = []models.EmployeeResponse{}
+	}
+	return c.JSON(http.StatusOK, employees)
+}
+
+// CreateEmployeeV1 is POST /api/v1/employees, the body of /employee/add-employee. Answers 201 with the new employee
+func CreateEmployeeV1(c echo.Context) error {
+	if mediaType(c) != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be application/json"})
+	}
+
+	var req models.EmployeeInsert
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if err := services.ValidateNewEmployee(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := services.AddEmployee(services.EmployeeInsertData(req)); err != nil {
+		return resourceError(c, err, "")
+	}
+
+	employee, err := services.GetEmployee(req.Employee_id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/employees/"+url.PathEscape(req.Employee_id))
+	return c.JSON(http.StatusCreated, employee)
+}
+
+// GetEmployeeV1 is GET /api/v1/employees/:id
+func GetEmployeeV1(c echo.Context) error {
+	employee, err := services.GetEmployee(c.Param("id"))
+	if err != nil {
+		if err.Error() == "employee not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, employee)
+}
+
+// PatchEmployeeV1 is PATCH /api/v1/employees/:id, a merge patch of the employee fields ("resignation_date": null
+// clears the resignation). Answers with the updated employee
+func PatchEmployeeV1(c echo.Context) error {
+	patch, err := bindMergePatch(c)
+	if patch == nil {
+		return err
+	}
+
+	id := c.Param("id")
+	if err := services.PatchEmployee(id, patch); err != nil {
+		return resourceError(c, err, "employee not found")
+	}
+
+	employee, err := services.GetEmployee(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, employee)
+}
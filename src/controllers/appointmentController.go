@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MoveAppointment reschedules an appointment, its reminders are queued again for the new time
+func MoveAppointment(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.MoveAppointmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Date == "" || req.Time == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "date and time are required"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	eligibility, reminders, err := services.MoveAppointment(id, req)
+	if err != nil {
+		switch err.Error() {
+		case "invalid appointment date or time":
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD and time HH:MM or HH:MM:SS"})
+		case "appointment not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "appointment is cancelled":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Appointment moved successfully",
+		"reminders_scheduled": reminders,
+		"coverage":            eligibility,
+	})
+}
+
+func CancelAppointment(c echo.Context) error {
+	var req patients.CancelAppointmentRequest
+	if c.Request().ContentLength > 0 {
+		if c.Request().Header.Get("Content-Type") != "application/json" {
+			return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		}
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.CancelAppointment(id, req); err != nil {
+		switch err.Error() {
+		case "appointment not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "appointment is cancelled":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Appointment cancelled successfully"})
+}
+
+// GetAppointmentReminders shows the delivery status of every reminder of an appointment
+func GetAppointmentReminders(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	reminders, err := services.GetAppointmentReminders(id)
+	if err != nil {
+		if err.Error() == "appointment not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, reminders)
+}
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/billing"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+var billingItemTypes = map[string]bool{"appointment": true, "encounter": true, "lab_test": true, "drug": true, "other": true}
+
+func GetServicePrices(c echo.Context) error {
+	prices, err := services.GetServicePrices()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, prices)
+}
+
+func AddServicePrice(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req billing.ServicePrice
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if !billingItemTypes[req.Item_type] || req.Description == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "item_type (appointment, encounter, lab_test, drug, other) and description are required"})
+	}
+	if len(req.Item_code) > 10 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "item_code must be at most 10 characters"})
+	}
+	if req.Unit_price < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unit_price must not be negative"})
+	}
+	if req.Insurance_coverage < 0 || req.Insurance_coverage > 100 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "insurance_coverage must be between 0 and 100"})
+	}
+
+	priceID, err := services.AddServicePrice(req)
+	if err != nil {
+		if err.Error() == "price already exists for this item" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":  "Price added successfully",
+		"price_id": priceID,
+	})
+}
+
+func UpdateServicePrice(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	if val, ok := raw["description"]; ok {
+		str, ok := val.(string)
+		if !ok || str == "" {
+			return c.JSON(http.StatusBadRequest, "description must be a non-empty string")
+		}
+		data["description"] = str
+	}
+	if val, ok := raw["unit_price"]; ok {
+		price, ok := val.(float64)
+		if !ok || price < 0 {
+			return c.JSON(http.StatusBadRequest, "unit_price must be a number not below 0")
+		}
+		data["unit_price"] = fmt.Sprintf("%.2f", price)
+	}
+	if val, ok := raw["insurance_coverage"]; ok {
+		coverage, ok := val.(float64)
+		if !ok || coverage < 0 || coverage > 100 {
+			return c.JSON(http.StatusBadRequest, "insurance_coverage must be a number between 0 and 100")
+		}
+		data["insurance_coverage"] = fmt.Sprintf("%.2f", coverage)
+	}
+
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, "No valid data to update")
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rowsAffected, err := services.UpdateServicePrice(id, data)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "price not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Price updated successfully"})
+}
+
+// GenerateCharges captures charges for the patient's appointments, encounters, lab orders and prescriptions not charged yet
+func GenerateCharges(c echo.Context) error {
+	result, err := services.GenerateCharges(c.Param("id"))
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func AddManualCharge(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req billing.AddChargeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if !billingItemTypes[req.Item_type] || req.Description == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "item_type (appointment, encounter, lab_test, drug, other) and description are required"})
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "quantity must be greater than 0"})
+	}
+	if req.Unit_price != nil && *req.Unit_price < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unit_price must not be negative"})
+	}
+
+	charge, err := services.AddManualCharge(c.Param("id"), req)
+	if err != nil {
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "no price for this item":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, charge)
+}
+
+// GetPatientCharges lists the patient's charges, ?unbilled=true for the ones not on an invoice yet
+func GetPatientCharges(c echo.Context) error {
+	charges, err := services.GetPatientCharges(c.Param("id"), c.QueryParam("unbilled") == "true")
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, charges)
+}
+
+func CreateInvoice(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req billing.CreateInvoiceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Issued_by == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "issued_by is required"})
+	}
+
+	invoice, err := services.CreateInvoice(c.Param("id"), req)
+	if err != nil {
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		case "no unbilled charges":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, invoice)
+}
+
+func GetPatientInvoices(c echo.Context) error {
+	invoices, err := services.GetPatientInvoices(c.Param("id"))
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, invoices)
+}
+
+// GetInvoice returns the invoice as JSON, or with ?format=csv as a CSV file of its line items and totals
+func GetInvoice(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or csv"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	invoice, err := services.GetInvoice(id)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	if format == "csv" {
+		body, err := invoiceCSV(invoice)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=invoice-%d.csv", invoice.Invoice_id))
+		return c.Blob(http.StatusOK, "text/csv; charset=utf-8", body)
+	}
+
+	return c.JSON(http.StatusOK, invoice)
+}
+
+// invoiceCSV writes one row per line item followed by the totals and balances
+func invoiceCSV(invoice *billing.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	money := func(amount float64) string { return fmt.Sprintf("%.2f", amount) }
+
+	rows := [][]string{{"invoice_id", "patient_id", "charge_id", "charged_at", "item_type", "item_code", "description", "quantity", "unit_price", "amount", "insurance_amount", "patient_amount"}}
+	for _, line := range invoice.Lines {
+		var insuranceAmount, patientAmount float64
+		if line.Insurance_amount != nil {
+			insuranceAmount = *line.Insurance_amount
+		}
+		if line.Patient_amount != nil {
+			patientAmount = *line.Patient_amount
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(invoice.Invoice_id), invoice.Patient_id, fmt.Sprint(line.Charge_id), line.Charged_at, line.Item_type, line.Item_code,
+			line.Description, fmt.Sprint(line.Quantity), money(line.Unit_price), money(line.Amount), money(insuranceAmount), money(patientAmount),
+		})
+	}
+	rows = append(rows,
+		[]string{fmt.Sprint(invoice.Invoice_id), invoice.Patient_id, "", "", "", "", "TOTAL", "", "", money(invoice.Total_amount), money(invoice.Insurance_amount), money(invoice.Patient_amount)},
+		[]string{fmt.Sprint(invoice.Invoice_id), invoice.Patient_id, "", "", "", "", "PAID", "", "", money(invoice.Insurer_paid + invoice.Patient_paid), money(invoice.Insurer_paid), money(invoice.Patient_paid)},
+		[]string{fmt.Sprint(invoice.Invoice_id), invoice.Patient_id, "", "", "", "", "BALANCE (" + strings.ToUpper(invoice.Status) + ")", "", "", money(invoice.Insurer_balance + invoice.Patient_balance), money(invoice.Insurer_balance), money(invoice.Patient_balance)},
+	)
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func AddPayment(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req billing.AddPaymentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Payer != "patient" && req.Payer != "insurer" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "payer must be patient or insurer"})
+	}
+	if req.Amount <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "amount must be greater than 0"})
+	}
+	if req.Method == "" || len(req.Method) > 20 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "method is required and must be at most 20 characters"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.AddPayment(id, req); err != nil {
+		return invoiceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Payment recorded successfully"})
+}
+
+func UpdateClaimStatus(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req billing.UpdateClaimRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Claim_status != "submitted" && req.Claim_status != "approved" && req.Claim_status != "rejected" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "claim_status must be submitted, approved or rejected"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.UpdateClaimStatus(id, req.Claim_status); err != nil {
+		return invoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Claim status updated successfully"})
+}
+
+func VoidInvoice(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.VoidInvoice(id); err != nil {
+		return invoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Invoice voided, its charges can be invoiced again"})
+}
+
+// invoiceError maps the errors of payment, claim and void requests to a response
+func invoiceError(c echo.Context, err error) error {
+	if strings.HasPrefix(err.Error(), "claim cannot move from") {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	switch err.Error() {
+	case "invoice not found":
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case "employee not found or not active":
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	case "invoice is void", "invoice has payments", "invoice has no open insurance claim", "payment exceeds the outstanding balance":
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/catalog"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	icd10CodePattern  = regexp.MustCompile(`^[A-Z][0-9]{2}(\.[0-9A-Z]{1,4})?$`)             // A15, B18.1
+	atcCodePattern    = regexp.MustCompile(`^[A-Z]([0-9]{2}([A-Z]([A-Z]([0-9]{2})?)?)?)?$`) // any ATC level, J / J01 / J01CA04
+	rxnormCodePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+)
+
+// ตรวจ format ของ code ถ้ามีการส่งมา (ค่าว่าง = ไม่มี code)
+func validateCatalogCode(field string, value string, pattern *regexp.Regexp) error {
+	if value != "" && !pattern.MatchString(value) {
+		return fmt.Errorf("%s has an invalid format", field)
+	}
+	return nil
+}
+
+// typeahead ?q= และ ?limit= (default 10, max 50)
+func catalogSearchParams(c echo.Context) (string, int) {
+	limit := 10
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 && l <= 50 {
+		limit = l
+	}
+	return strings.TrimSpace(c.QueryParam("q")), limit
+}
+
+// bindCatalogUpdate keeps the given string fields of the body, name fields must not be empty and
+// empty code fields are stored as NULL (clears the code)
+func bindCatalogUpdate(c echo.Context, nameField string, optionalFields []string) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return nil, fmt.Errorf("Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	for _, key := range append([]string{nameField}, optionalFields...) {
+		val, ok := raw[key]
+		if !ok {
+			continue
+		}
+		str, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+		str = strings.TrimSpace(str)
+		if key == nameField {
+			if str == "" {
+				return nil, fmt.Errorf("%s must not be empty", key)
+			}
+			data[key] = str
+		} else if str == "" {
+			data[key] = nil
+		} else {
+			data[key] = str
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("No valid data to update")
+	}
+
+	return data, nil
+}
+
+// ============ Disease ============
+
+func SearchDiseases(c echo.Context) error {
+	query, limit := catalogSearchParams(c)
+	diseases, err := services.SearchDiseases(query, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, diseases)
+}
+
+func GetDisease(c echo.Context) error {
+	disease, err := services.GetDisease(c.Param("id"))
+	if err != nil {
+		if err.Error() == "disease not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, disease)
+}
+
+func AddDisease(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.Disease
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Disease_id == "" || req.Disease_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "disease_id and disease_name are required"})
+	}
+	if len(req.Disease_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "disease_id must be at most 4 characters"})
+	}
+	if err := validateCatalogCode("icd10_code", req.Icd10_code, icd10CodePattern); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := services.AddDisease(req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Disease added successfully"})
+}
+
+func UpdateDisease(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	data, err := bindCatalogUpdate(c, "disease_name", []string{"icd10_code"})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if code, ok := data["icd10_code"].(string); ok {
+		if err := validateCatalogCode("icd10_code", code, icd10CodePattern); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	rowsAffected, err := services.UpdateDisease(c.Param("id"), data)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "disease not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Disease updated successfully"})
+}
+
+func DeleteDisease(c echo.Context) error {
+	rowsAffected, err := services.DeleteDisease(c.Param("id"))
+	if err != nil {
+		if err.Error() == "disease is recorded on patients" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "disease not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Disease deleted successfully"})
+}
+
+// ============ Drug ============
+
+func SearchDrugs(c echo.Context) error {
+	query, limit := catalogSearchParams(c)
+	drugs, err := services.SearchDrugs(query, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, drugs)
+}
+
+func GetDrug(c echo.Context) error {
+	drug, err := services.GetDrug(c.Param("id"))
+	if err != nil {
+		if err.Error() == "drug not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, drug)
+}
+
+func AddDrug(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.Drug
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Drug_id == "" || req.Drug_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "drug_id and drug_name are required"})
+	}
+	if len(req.Drug_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "drug_id must be at most 4 characters"})
+	}
+	if err := validateCatalogCode("atc_code", req.Atc_code, atcCodePattern); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := validateCatalogCode("rxnorm_code", req.Rxnorm_code, rxnormCodePattern); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := services.AddDrug(req); err != nil {
+		if err.Error() == "drug class not found" {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Drug added successfully"})
+}
+
+func UpdateDrug(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	data, err := bindCatalogUpdate(c, "drug_name", []string{"atc_code", "rxnorm_code", "drug_class_id"})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if code, ok := data["atc_code"].(string); ok {
+		if err := validateCatalogCode("atc_code", code, atcCodePattern); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if code, ok := data["rxnorm_code"].(string); ok {
+		if err := validateCatalogCode("rxnorm_code", code, rxnormCodePattern); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	rowsAffected, err := services.UpdateDrug(c.Param("id"), data)
+	if err != nil {
+		if err.Error() == "drug class not found" {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "drug not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Drug updated successfully"})
+}
+
+func DeleteDrug(c echo.Context) error {
+	rowsAffected, err := services.DeleteDrug(c.Param("id"))
+	if err != nil {
+		if err.Error() == "drug is recorded on patients" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "drug not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Drug deleted successfully"})
+}
+
+// ============ Drug class ============
+
+func GetAllDrugClasses(c echo.Context) error {
+	classes, err := services.GetAllDrugClasses()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, classes)
+}
+
+func AddDrugClass(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.DrugClass
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Drug_class_id == "" || req.Class_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "drug_class_id and class_name are required"})
+	}
+	if len(req.Drug_class_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "drug_class_id must be at most 4 characters"})
+	}
+
+	if _, err := services.AddDrugClass(req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Drug class added successfully"})
+}
+
+// ============ Ingredient ============
+
+func GetAllIngredients(c echo.Context) error {
+	ingredients, err := services.GetAllIngredients()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, ingredients)
+}
+
+func AddIngredient(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.DrugIngredient
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Ingredient_id == "" || req.Ingredient_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ingredient_id and ingredient_name are required"})
+	}
+	if len(req.Ingredient_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ingredient_id must be at most 4 characters"})
+	}
+
+	if _, err := services.AddIngredient(req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Ingredient added successfully"})
+}
+
+func GetDrugIngredients(c echo.Context) error {
+	ingredients, err := services.GetDrugIngredients(c.Param("id"))
+	if err != nil {
+		if err.Error() == "drug not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, ingredients)
+}
+
+func SetDrugIngredients(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.DrugIngredientsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := services.SetDrugIngredients(c.Param("id"), req.Ingredient_ids); err != nil {
+		var unknownErr *services.UnknownCatalogIdError
+		if errors.As(err, &unknownErr) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+		}
+		if err.Error() == "drug not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Drug ingredients updated successfully"})
+}
+
+// ============ Cross-sensitivity ============
+
+func GetAllCrossSensitivities(c echo.Context) error {
+	pairs, err := services.GetAllCrossSensitivities()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, pairs)
+}
+
+func AddCrossSensitivity(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.DrugClassCrossSensitivity
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Drug_class_id == "" || req.Related_class_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "drug_class_id and related_class_id are required"})
+	}
+	if req.Drug_class_id == req.Related_class_id {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "a class cannot cross-react with itself"})
+	}
+
+	if _, err := services.AddCrossSensitivity(req); err != nil {
+		var unknownErr *services.UnknownCatalogIdError
+		if errors.As(err, &unknownErr) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+		}
+		if err.Error() == "cross-sensitivity already recorded" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Cross-sensitivity added successfully"})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+const consentTypeError = "consent_type must be one of treatment, data_sharing, research, communication_email, communication_sms, communication_phone"
+
+func GetConsentDocuments(c echo.Context) error {
+	consentType := c.QueryParam("type")
+	if consentType != "" && !services.IsValidConsentType(consentType) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": consentTypeError})
+	}
+
+	documents, err := services.GetConsentDocuments(consentType)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, documents)
+}
+
+func AddConsentDocument(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.ConsentDocument
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Version == "" || req.Title == "" || req.Content == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "consent_type, version, title and content are required"})
+	}
+	if !services.IsValidConsentType(req.Consent_type) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": consentTypeError})
+	}
+	if len(req.Version) > 10 || len(req.Title) > 100 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "version must be at most 10 and title at most 100 characters"})
+	}
+	if req.Effective_from != "" {
+		if _, err := time.Parse("2006-01-02", req.Effective_from); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "effective_from must be YYYY-MM-DD"})
+		}
+	}
+
+	if err := services.AddConsentDocument(req); err != nil {
+		if err.Error() == "consent version already exists" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Consent document added successfully"})
+}
+
+// GetPatientConsents returns the current decision per consent type, ?history=true for every decision
+func GetPatientConsents(c echo.Context) error {
+	consents, err := services.GetPatientConsents(c.Param("id"), c.QueryParam("history") == "true")
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, consents)
+}
+
+func RecordConsent(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.RecordConsentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Granted == nil || req.Recorded_by == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "consent_type, granted and recorded_by are required"})
+	}
+	if !services.IsValidConsentType(req.Consent_type) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": consentTypeError})
+	}
+	if req.Signed_at != "" {
+		signedAt, err := time.Parse("2006-01-02 15:04:05", req.Signed_at)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "signed_at must be YYYY-MM-DD HH:MM:SS"})
+		}
+		if signedAt.After(time.Now()) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "signed_at must not be in the future"})
+		}
+	}
+
+	consentID, err := services.RecordConsent(c.Param("id"), req)
+	if err != nil {
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "consent version not found", "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{"message": "Consent recorded successfully", "consent_id": consentID})
+}
+
+func RevokeConsent(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.RevokeConsentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Revoked_by == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "revoked_by is required"})
+	}
+
+	consentID, err := parseIDParam(c, "consent_id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.RevokeConsent(c.Param("id"), consentID, req); err != nil {
+		switch err.Error() {
+		case "consent not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "consent is already revoked", "consent has been superseded":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Consent revoked successfully"})
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+func GetAllDepartments(c echo.Context) error {
+	departments, err := services.GetAllDepartments()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, departments)
+}
+
+func GetDepartment(c echo.Context) error {
+	department, err := services.GetDepartment(c.Param("id"))
+	if err != nil {
+		if err.Error() == "department not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, department)
+}
+
+func GetDepartmentEmployees(c echo.Context) error {
+	employees, err := services.GetDepartmentEmployees(c.Param("id"))
+	if err != nil {
+		if err.Error() == "department not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, employees)
+}
+
+func AddDepartment(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.Department
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Department_id == "" || req.Department_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "department_id and department_name are required"})
+	}
+	if len(req.Department_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "department_id must be at most 4 characters"})
+	}
+
+	if _, err := services.AddDepartment(req); err != nil {
+		if err.Error() == "department already exists" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Department added successfully"})
+}
+
+func UpdateDepartment(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	name, ok := raw["department_name"].(string)
+	if !ok || name == "" {
+		return c.JSON(http.StatusBadRequest, "department_name must be a non-empty string")
+	}
+
+	rowsAffected, err := services.UpdateDepartment(c.Param("id"), map[string]interface{}{"department_name": name})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "department not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Department updated successfully"})
+}
+
+func DeleteDepartment(c echo.Context) error {
+	rowsAffected, err := services.DeleteDepartment(c.Param("id"))
+	if err != nil {
+		if err.Error() == "department still has positions" || err.Error() == "department still has wards" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "department not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": fmt.Sprintf("Department %s deleted successfully", c.Param("id"))})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	//"github.com/NinePTH/GO_MVC-S/src/models/patients"
 	"github.com/NinePTH/GO_MVC-S/src/services"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
@@ -27,8 +29,12 @@ func SearchEmployee(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, "Invalid request body")
 	}
 
-	patients, err := services.GetEmployeeSearch(req.Employee_id, req.First_name, req.Last_name)
+	patients, err := services.GetEmployeeSearch(req)
 	if err != nil {
+		var searchErr *services.EmployeeSearchError
+		if errors.As(err, &searchErr) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
@@ -95,6 +101,9 @@ func UpdateEmployee(c echo.Context) error {
 
 	rowsAffected, err := services.UpdateEmployee(employeeID, data)
 	if err != nil {
+		if err.Error() == "position not found" {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
@@ -177,32 +186,19 @@ func AddEmployee(c echo.Context) error { // แยก model ตอนส่ง
 	}
 
 	// ตรวจสอบ fields ที่จำเป็น
-	if req.Employee_id == "" || req.First_name == "" || req.Last_name == "" ||
-		req.Position_id == "" || req.Phone_number == "" ||
-		req.Email == "" || req.Hire_date == "" || req.Work_status == "" || req.Salary == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "All fields are required"})
+	if err := services.ValidateNewEmployee(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
 	// เตรียมข้อมูล insert
-	data := map[string]interface{}{
-		"employee_id":      req.Employee_id,
-		"first_name":       req.First_name,
-		"last_name":        req.Last_name,
-		"position_id":      req.Position_id,
-		"phone_number":     req.Phone_number,
-		"salary":           req.Salary,
-		"email":            req.Email,
-		"hire_date":        req.Hire_date,
-		"resignation_date": nil,
-		"work_status":      req.Work_status,
-	}
-
-	if req.Resignation_date != "" {
-		data["resignation_date"] = req.Resignation_date
-	}
-
-	rowsAffected, err := services.AddEmployee(data)
+	rowsAffected, err := services.AddEmployee(services.EmployeeInsertData(req))
 	if err != nil {
+		if err.Error() == "position not found" {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		if err.Error() == "employee already exists" || err.Error() == "email, phone number or name already belongs to another employee" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
@@ -231,3 +227,41 @@ func GetEmployee(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, user)
 }
+
+// OffboardEmployee sets resignation data, disables the employee's account and hands over their future appointments
+func OffboardEmployee(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	id := c.Param("id")
+
+	var req models.EmployeeOffboardRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// ใครเป็นคนทำ offboard (เก็บลง log)
+	claims, ok := c.Get("user").(jwt.MapClaims)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, "Invalid or missing user claims")
+	}
+	performedBy, _ := claims["username"].(string)
+
+	result, err := services.OffboardEmployee(id, req, performedBy)
+	if err != nil {
+		switch err.Error() {
+		case "employee not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "employee has already been offboarded":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case "resignation_date must be in YYYY-MM-DD format",
+			"cannot reassign appointments to the employee being offboarded",
+			"reassign_to employee not found or not active":
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
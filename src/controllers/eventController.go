@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+	"github.com/NinePTH/GO_MVC-S/src/utils/eventbus"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	eventHeartbeat    = 25 * time.Second // keeps proxies from closing an idle stream
+	eventRecheckEvery = time.Minute      // how often the account is checked for disabled / revoked tokens
+)
+
+// StreamEvents is a Server-Sent Events stream of the ?topics= (comma separated), e.g.
+// topics=queue:D001,schedule:E001. Clients reconnecting with Last-Event-ID receive the recent events they missed.
+// The stream ends when the token expires or is revoked, the client then reconnects with a fresh token
+func StreamEvents(c echo.Context) error {
+	claims, ok := c.Get("user").(jwt.MapClaims)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, "Invalid or missing user claims")
+	}
+	role, _ := claims["role"].(string)
+	patientID, _ := claims["patient_id"].(string)
+
+	var topics []string
+	for _, topic := range strings.Split(c.QueryParam("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "topics is required, e.g. topics=queue:D001,schedule:E001"})
+	}
+	for _, topic := range topics {
+		if err := services.CheckTopicAccess(role, patientID, topic); err != nil {
+			var accessErr *services.TopicAccessError
+			if errors.As(err, &accessErr) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+	var since int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Last-Event-ID must be an event id"})
+		}
+		since = id
+	}
+
+	sub, missed := eventbus.Subscribe(topics, since)
+	defer sub.Close()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx must not buffer the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return nil
+		}
+	}
+	w.Flush()
+
+	expiry := time.NewTimer(time.Until(tokenExpiry(claims)))
+	defer expiry.Stop()
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	lastCheck := time.Now()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-sub.Done():
+			// Fell behind, the client reconnects with Last-Event-ID and catches up from the replay buffer
+			return nil
+		case <-expiry.C:
+			fmt.Fprint(w, "event: token_expired\ndata: {}\n\n")
+			w.Flush()
+			return nil
+		case <-heartbeat.C:
+			if time.Since(lastCheck) >= eventRecheckEvery {
+				if err := middlewares.CheckTokenClaims(claims); err != nil {
+					fmt.Fprint(w, "event: token_revoked\ndata: {}\n\n")
+					w.Flush()
+					return nil
+				}
+				lastCheck = time.Now()
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		case event := <-sub.Events():
+			if err := writeEvent(w, event); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
+
+func writeEvent(w *echo.Response, event eventbus.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// tokenExpiry is the "exp" claim, tokens without one are treated as valid for a day like the ones GenerateJWT issues
+func tokenExpiry(claims jwt.MapClaims) time.Time {
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		return exp.Time
+	}
+	return time.Now().Add(24 * time.Hour)
+}
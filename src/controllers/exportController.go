@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/services"
+	"github.com/NinePTH/GO_MVC-S/src/utils/xlsx"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportFlushEvery is how many rows are buffered before they are pushed to the client
+const exportFlushEvery = 500
+
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"xlsx":   xlsx.ContentType,
+}
+
+// exportWriter writes the rows of an export in one file format
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Flush() error
+	Close() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			record[i] = ""
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			record[i] = escapeCSVFormula(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return e.w.Write(record)
+}
+
+// escapeCSVFormula prefixes text starting with =, +, - or @ (or a tab or carriage return) with a quote, so a spreadsheet
+// opening the CSV shows the text instead of running it as a formula (CSV / formula injection)
+func escapeCSVFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) Close() error {
+	return e.Flush()
+}
+
+// ndjsonExportWriter writes one JSON object per line, keys in the order of the selected columns
+type ndjsonExportWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (e *ndjsonExportWriter) WriteRow(values []interface{}) error {
+	e.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.columns[i])
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.w.Write(key)
+		e.w.WriteByte(':')
+		e.w.Write(encoded)
+	}
+	_, err := e.w.WriteString("}\n")
+	return err
+}
+
+func (e *ndjsonExportWriter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *ndjsonExportWriter) Close() error {
+	return e.w.Flush()
+}
+
+// newExportWriter starts a file of format on w, csv and xlsx begin with a header row of the column names
+func newExportWriter(w io.Writer, format string, sheetName string, columns []string) (exportWriter, error) {
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+
+	var out exportWriter
+	switch format {
+	case "ndjson":
+		return &ndjsonExportWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case "xlsx":
+		sheet, err := xlsx.NewWriter(w, sheetName)
+		if err != nil {
+			return nil, err
+		}
+		out = sheet
+	default:
+		out = &csvExportWriter{w: csv.NewWriter(w)}
+	}
+	return out, out.WriteRow(header)
+}
+
+// ExportPatients streams the patients who agreed to data sharing, see exportList
+func ExportPatients(c echo.Context) error {
+	return exportList(c, "patients")
+}
+
+// ExportEmployees streams the employee roster, see exportList. ?sort= orders it like the employee search
+func ExportEmployees(c echo.Context) error {
+	return exportList(c, "employees")
+}
+
+// exportList streams the list of entity as a download, ?format=csv|ndjson|xlsx (default csv), ?columns=a,b,c to pick
+// and order the columns, plus the filters of the search API (e.g. ?first_name=). The response starts with the first
+// row, an error after that can only cut the file short
+func exportList(c echo.Context, entity string) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be one of csv, ndjson, xlsx"})
+	}
+
+	columns := []string{}
+	for _, column := range strings.Split(c.QueryParam("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		columns = services.ExportColumns(entity)
+	}
+
+	w := c.Response()
+	var out exportWriter
+	start := func() error {
+		w.Header().Set(echo.HeaderContentType, contentType)
+		w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.%s", entity, time.Now().Format("20060102"), format)))
+		w.Header().Set("X-Accel-Buffering", "no") // nginx must not buffer the download
+		w.WriteHeader(http.StatusOK)
+		var err error
+		out, err = newExportWriter(w, format, entity, columns)
+		return err
+	}
+
+	rows := 0
+	exportedPatients := []string{}
+	err := services.ExportRows(c.Request().Context(), entity, columns, c.QueryParams(), func(key string, values []interface{}) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := out.WriteRow(values); err != nil {
+			return err
+		}
+		rows++
+		if entity == "patients" {
+			exportedPatients = append(exportedPatients, key)
+		}
+		if rows%exportFlushEvery == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			w.Flush()
+		}
+		return nil
+	})
+	recordPatientsAccess(c, exportedPatients, "export") // the rows written before an error left too
+	if err == nil && out == nil {
+		err = start() // no rows, the file still has its header
+	}
+	if err != nil {
+		if !w.Committed {
+			var requestErr *services.ExportRequestError
+			if errors.As(err, &requestErr) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		fmt.Println("Export of", entity, "stopped after", rows, "rows:", err)
+		return nil
+	}
+
+	if err := out.Close(); err != nil {
+		fmt.Println("Export of", entity, "could not be finished:", err)
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/fhir"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fhirJSON answers with the FHIR media type, c.JSON keeps a Content-Type that is already set
+func fhirJSON(c echo.Context, status int, resource interface{}) error {
+	c.Response().Header().Set(echo.HeaderContentType, "application/fhir+json; charset=utf-8")
+	return c.JSON(status, resource)
+}
+
+// fhirError is the FHIR way to report an error, an OperationOutcome with one issue
+func fhirError(c echo.Context, status int, code string, diagnostics string) error {
+	return fhirJSON(c, status, fhir.OperationOutcome{
+		Resource_type: "OperationOutcome",
+		Issue:         []fhir.OperationOutcomeIssue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	})
+}
+
+func fhirBaseURL(c echo.Context) string {
+	return c.Scheme() + "://" + c.Request().Host + "/fhir/R4"
+}
+
+// GetFhirMetadata is the CapabilityStatement, public as the FHIR spec expects
+func GetFhirMetadata(c echo.Context) error {
+	return fhirJSON(c, http.StatusOK, services.GetFhirCapabilityStatement())
+}
+
+// SearchFhirResources answers GET /fhir/R4/:type with a searchset Bundle, paged with _count (default 50, at most 500) and _offset
+func SearchFhirResources(c echo.Context) error {
+	resourceType := c.Param("type")
+	if !services.IsFhirResourceType(resourceType) {
+		return fhirError(c, http.StatusNotFound, "not-supported", "resource type "+resourceType+" is not supported")
+	}
+
+	query := c.Request().URL.Query()
+	count, offset := 50, 0
+	if raw := query.Get("_count"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 || value > 500 {
+			return fhirError(c, http.StatusBadRequest, "invalid", "_count must be between 0 and 500")
+		}
+		count = value
+	}
+	if raw := query.Get("_offset"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return fhirError(c, http.StatusBadRequest, "invalid", "_offset must be 0 or more")
+		}
+		offset = value
+	}
+
+	searchParams := map[string][]string{}
+	for name, values := range c.QueryParams() {
+		if name != "_count" && name != "_offset" && name != "_format" {
+			searchParams[name] = values
+		}
+	}
+	strict := strings.Contains(c.Request().Header.Get("Prefer"), "handling=strict")
+
+	entries, total, err := services.SearchFhirResources(resourceType, searchParams, count, offset, strict)
+	if err != nil {
+		var searchErr *services.FhirSearchError
+		if errors.As(err, &searchErr) {
+			return fhirError(c, http.StatusBadRequest, "invalid", searchErr.Message)
+		}
+		return fhirError(c, http.StatusInternalServerError, "exception", err.Error())
+	}
+
+	base := fhirBaseURL(c)
+	bundle := fhir.Bundle{
+		Resource_type: "Bundle",
+		Type:          "searchset",
+		Total:         total,
+		Link:          []fhir.BundleLink{{Relation: "self", Url: base + "/" + resourceType + "?" + query.Encode()}},
+		Entry:         []fhir.BundleEntry{},
+	}
+	if count > 0 && offset+count < total {
+		query.Set("_count", strconv.Itoa(count))
+		query.Set("_offset", strconv.Itoa(offset+count))
+		bundle.Link = append(bundle.Link, fhir.BundleLink{Relation: "next", Url: base + "/" + resourceType + "?" + query.Encode()})
+	}
+	resources := []interface{}{}
+	for _, entry := range entries {
+		entry.Full_url = base + "/" + entry.Full_url
+		bundle.Entry = append(bundle.Entry, entry)
+		resources = append(resources, entry.Resource)
+	}
+	recordPatientsAccess(c, services.FhirPatientIDs(resources...), "list")
+
+	return fhirJSON(c, http.StatusOK, bundle)
+}
+
+// ReadFhirResource answers GET /fhir/R4/:type/:id
+func ReadFhirResource(c echo.Context) error {
+	resourceType := c.Param("type")
+	if !services.IsFhirResourceType(resourceType) {
+		return fhirError(c, http.StatusNotFound, "not-supported", "resource type "+resourceType+" is not supported")
+	}
+
+	resource, err := services.ReadFhirResource(resourceType, c.Param("id"))
+	if err != nil {
+		if err.Error() == "resource not found" {
+			return fhirError(c, http.StatusNotFound, "not-found", resourceType+"/"+c.Param("id")+" not found")
+		}
+		return fhirError(c, http.StatusInternalServerError, "exception", err.Error())
+	}
+	recordPatientsAccess(c, services.FhirPatientIDs(resource), "view")
+	return fhirJSON(c, http.StatusOK, resource)
+}
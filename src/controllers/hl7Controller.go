@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/services"
+	"github.com/NinePTH/GO_MVC-S/src/utils/hl7"
+
+	"github.com/labstack/echo/v4"
+)
+
+// hl7ContentType is the media type of ER7 encoded HL7 v2 messages
+const hl7ContentType = "x-application/hl7-v2+er7"
+
+// ReceiveHL7Message takes one ADT message in the body (as the MLLP listener does) and answers with its ACK.
+// The HTTP status is 200 whenever an ACK was built, the outcome is in MSA-1 (AA, AE or AR)
+func ReceiveHL7Message(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, hl7.MaxMessageSize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+	if len(body) > hl7.MaxMessageSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "message is too large"})
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "request body must be an HL7 v2 message"})
+	}
+
+	ack := services.HandleHL7Message(string(body))
+	return c.Blob(http.StatusOK, hl7ContentType, []byte(ack))
+}
+
+// GetPatientADT returns the patient as an ADT message, ?event=A04 or A08 (default) for other hospital systems
+func GetPatientADT(c echo.Context) error {
+	event := c.QueryParam("event")
+	if event == "" {
+		event = "A08"
+	}
+	if event != "A04" && event != "A08" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "event must be A04 or A08"})
+	}
+
+	msg, err := services.BuildPatientADT(c.Param("id"), event)
+	if err != nil {
+		var consentErr *services.ConsentRequiredError
+		switch {
+		case err.Error() == "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.As(err, &consentErr):
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	recordPatientAccess(c, c.Param("id"), "export")
+	return c.Blob(http.StatusOK, hl7ContentType, []byte(msg))
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+const importMaxFileSize = 10 << 20
+
+// ImportCSV imports /admin/import/:entity (patients or employees) from a CSV file, uploaded as the multipart field
+// "file" or sent as a text/csv body. ?dry_run=true validates every row without writing anything
+func ImportCSV(c echo.Context) error {
+	entity := c.Param("entity")
+	if !services.IsImportEntity(entity) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "entity must be patients or employees"})
+	}
+
+	dryRun := false
+	if raw := c.QueryParam("dry_run"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "dry_run must be true or false"})
+		}
+		dryRun = parsed
+	}
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, importMaxFileSize)
+
+	var file io.Reader
+	contentType := req.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		header, err := c.FormFile("file")
+		if err != nil {
+			return importBodyError(c, err, "the CSV file must be uploaded in the form field \"file\"")
+		}
+		opened, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		defer opened.Close()
+		file = opened
+	case strings.HasPrefix(contentType, "text/csv"):
+		file = req.Body
+	default:
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be multipart/form-data or text/csv"})
+	}
+
+	result, err := services.ImportCSV(entity, file, dryRun)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			return importBodyError(c, err, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// importBodyError answers 413 when the upload went over importMaxFileSize, 400 otherwise
+func importBodyError(c echo.Context, err error, message string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || strings.Contains(err.Error(), "request body too large") {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "the file may be at most 10 MB"})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": message})
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/billing"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+func GetInsurers(c echo.Context) error {
+	insurers, err := services.GetInsurers()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, insurers)
+}
+
+func AddInsurer(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req billing.Insurer
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Insurer_id == "" || req.Insurer_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "insurer_id and insurer_name are required"})
+	}
+	if len(req.Insurer_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "insurer_id must be at most 4 characters"})
+	}
+
+	if err := services.AddInsurer(req); err != nil {
+		switch err.Error() {
+		case "insurer already exists", "insurer name already exists":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Insurer added successfully"})
+}
+
+func UpdateInsurer(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	for _, field := range []string{"insurer_name", "phone_number", "email"} {
+		if val, ok := raw[field]; ok {
+			str, ok := val.(string)
+			if !ok || str == "" {
+				return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s must be a non-empty string", field))
+			}
+			data[field] = str
+		}
+	}
+	if val, ok := raw["is_active"]; ok {
+		active, ok := val.(bool)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, "is_active must be a boolean")
+		}
+		data["is_active"] = active
+	}
+
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, "No valid data to update")
+	}
+
+	rowsAffected, err := services.UpdateInsurer(c.Param("id"), data)
+	if err != nil {
+		if err.Error() == "insurer name already exists" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "insurer not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Insurer updated successfully"})
+}
+
+func GetPatientPolicies(c echo.Context) error {
+	policies, err := services.GetPatientPolicies(c.Param("id"))
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+func AddInsurancePolicy(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.AddInsurancePolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Insurer_id == "" || req.Policy_number == "" || req.Valid_from == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "insurer_id, policy_number and valid_from are required"})
+	}
+	if req.Coverage_percent < 0 || req.Coverage_percent > 100 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "coverage_percent must be between 0 and 100"})
+	}
+	if req.Annual_limit != nil && *req.Annual_limit < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "annual_limit must not be below 0"})
+	}
+	if req.Priority < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "priority must be greater than 0"})
+	}
+	validFrom, err := time.Parse("2006-01-02", req.Valid_from)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "valid_from must be YYYY-MM-DD"})
+	}
+	if req.Valid_to != "" {
+		validTo, err := time.Parse("2006-01-02", req.Valid_to)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "valid_to must be YYYY-MM-DD"})
+		}
+		if validTo.Before(validFrom) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "valid_to must not be before valid_from"})
+		}
+	}
+
+	policyID, err := services.AddInsurancePolicy(c.Param("id"), req)
+	if err != nil {
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "insurer not found", "insurer is not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		case "policy number already exists for this insurer":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{"message": "Insurance policy added successfully", "policy_id": policyID})
+}
+
+func UpdateInsurancePolicy(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	if val, ok := raw["plan_name"]; ok {
+		str, ok := val.(string)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, "plan_name must be a string")
+		}
+		data["plan_name"] = str
+	}
+	if val, ok := raw["coverage_percent"]; ok {
+		coverage, ok := val.(float64)
+		if !ok || coverage < 0 || coverage > 100 {
+			return c.JSON(http.StatusBadRequest, "coverage_percent must be a number between 0 and 100")
+		}
+		data["coverage_percent"] = fmt.Sprintf("%.2f", coverage)
+	}
+	if val, ok := raw["annual_limit"]; ok {
+		// null removes the limit
+		if val == nil {
+			data["annual_limit"] = nil
+		} else {
+			limit, ok := val.(float64)
+			if !ok || limit < 0 {
+				return c.JSON(http.StatusBadRequest, "annual_limit must be a number not below 0 or null")
+			}
+			data["annual_limit"] = fmt.Sprintf("%.2f", limit)
+		}
+	}
+	if val, ok := raw["valid_to"]; ok {
+		// null makes the policy open ended
+		if val == nil {
+			data["valid_to"] = nil
+		} else {
+			str, ok := val.(string)
+			if _, err := time.Parse("2006-01-02", str); !ok || err != nil {
+				return c.JSON(http.StatusBadRequest, "valid_to must be YYYY-MM-DD or null")
+			}
+			data["valid_to"] = str
+		}
+	}
+	if val, ok := raw["priority"]; ok {
+		priority, ok := val.(float64)
+		if !ok || priority < 1 || priority != float64(int(priority)) {
+			return c.JSON(http.StatusBadRequest, "priority must be a whole number greater than 0")
+		}
+		data["priority"] = int(priority)
+	}
+
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, "No valid data to update")
+	}
+
+	policyID, err := parseIDParam(c, "policy_id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.UpdateInsurancePolicy(c.Param("id"), policyID, data); err != nil {
+		switch err.Error() {
+		case "policy not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "valid_to must not be before valid_from":
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Insurance policy updated successfully"})
+}
+
+// CheckCoverageEligibility checks the patient's insurance on ?date= (YYYY-MM-DD, default today)
+func CheckCoverageEligibility(c echo.Context) error {
+	date := c.QueryParam("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD"})
+	}
+
+	eligibility, err := services.CheckCoverageEligibility(c.Param("id"), date)
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		if err.Error() == "date must be YYYY-MM-DD" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, eligibility)
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+var jobStatuses = map[string]bool{"queued": true, "running": true, "succeeded": true, "dead": true, "cancelled": true}
+
+// GetJobs lists jobs newest first, ?status=&type=&limit= (default 50, at most 500)
+func GetJobs(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status != "" && !jobStatuses[status] {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be one of queued, running, succeeded, dead, cancelled"})
+	}
+
+	limit, ok := listLimit(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+	}
+
+	jobs, err := services.GetJobs(status, c.QueryParam("type"), limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, jobs)
+}
+
+func GetJob(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	job, err := services.GetJob(id)
+	if err != nil {
+		if err.Error() == "job not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// GetJobStats returns the job counts per type and status, and the job types this server can run
+func GetJobStats(c echo.Context) error {
+	stats, err := services.GetJobStats()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"counts":    stats,
+		"job_types": services.GetJobTypes(),
+	})
+}
+
+// EnqueueJob queues a job by hand, e.g. to run a cleanup or a report now
+func EnqueueJob(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.EnqueueJobRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Job_type == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "job_type is required"})
+	}
+	if !services.IsRegisteredJobType(req.Job_type) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "unknown job_type, must be one of " + strings.Join(services.GetJobTypes(), ", ")})
+	}
+	if req.Max_attempts < 0 || req.Max_attempts > 100 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_attempts must be between 1 and 100"})
+	}
+
+	opts := services.JobOptions{Max_attempts: req.Max_attempts, Priority: req.Priority}
+	if req.Run_at != "" {
+		runAt, err := time.ParseInLocation("2006-01-02 15:04:05", req.Run_at, time.Local)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "run_at must be YYYY-MM-DD HH:MM:SS"})
+		}
+		opts.Run_at = runAt
+	}
+
+	var payload interface{}
+	if len(req.Payload) > 0 {
+		payload = req.Payload
+	}
+	jobID, err := services.EnqueueJob(req.Job_type, payload, opts)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{"message": "Job queued successfully", "job_id": jobID})
+}
+
+// RetryJob puts a dead or cancelled job back in the queue
+func RetryJob(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.RetryJob(id); err != nil {
+		switch {
+		case err.Error() == "job not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "only dead or cancelled jobs"), err.Error() == "a job with the same unique key is already queued":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Job queued for retry"})
+}
+
+func CancelJob(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.CancelJob(id); err != nil {
+		switch err.Error() {
+		case "job not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "only queued jobs can be cancelled":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Job cancelled successfully"})
+}
+
+func GetJobSchedules(c echo.Context) error {
+	schedules, err := services.GetJobSchedules()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, schedules)
+}
+
+// UpdateJobSchedule changes the interval of a recurring job or pauses it, {"interval_seconds": 60, "is_active": false}
+func UpdateJobSchedule(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	if val, ok := raw["interval_seconds"]; ok {
+		interval, ok := val.(float64)
+		if !ok || interval < 1 || interval != float64(int(interval)) {
+			return c.JSON(http.StatusBadRequest, "interval_seconds must be a positive whole number")
+		}
+		data["interval_seconds"] = int(interval)
+	}
+	if val, ok := raw["is_active"]; ok {
+		active, ok := val.(bool)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, "is_active must be a boolean")
+		}
+		data["is_active"] = active
+	}
+
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, "No valid data to update")
+	}
+
+	rowsAffected, err := services.UpdateJobSchedule(c.Param("name"), data)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job schedule not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Job schedule updated successfully"})
+}
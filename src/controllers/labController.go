@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/catalog"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+var loincCodePattern = regexp.MustCompile(`^[0-9]{1,7}-[0-9]$`) // 4548-4
+
+var labPriorities = map[string]bool{"": true, "routine": true, "urgent": true, "stat": true}
+var labOrderStatuses = map[string]bool{"ordered": true, "collected": true, "resulted": true, "verified": true, "cancelled": true}
+
+func GetLabTests(c echo.Context) error {
+	labTests, err := services.GetLabTests()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, labTests)
+}
+
+func AddLabTest(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req catalog.LabTest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Lab_test_id == "" || req.Test_name == "" || req.Specimen_type == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lab_test_id, test_name and specimen_type are required"})
+	}
+	if len(req.Lab_test_id) > 10 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lab_test_id must be at most 10 characters"})
+	}
+	if err := validateCatalogCode("loinc_code", req.Loinc_code, loincCodePattern); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if len(req.Components) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "components must contain at least one component"})
+	}
+	names := map[string]bool{}
+	for i, component := range req.Components {
+		if component.Component_name == "" || component.Unit == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("components[%d] needs component_name and unit", i)})
+		}
+		if names[component.Component_name] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("components[%d].component_name is duplicated", i)})
+		}
+		names[component.Component_name] = true
+		if component.Normal_low != nil && component.Normal_high != nil && *component.Normal_low > *component.Normal_high {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("components[%d].normal_low must not be above normal_high", i)})
+		}
+	}
+
+	if err := services.AddLabTest(req); err != nil {
+		if err.Error() == "lab test already exists" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Lab test added successfully"})
+}
+
+func AddLabOrder(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.AddLabOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Patient_id == "" || req.Lab_test_id == "" || req.Ordered_by == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "patient_id, lab_test_id and ordered_by are required"})
+	}
+	if !labPriorities[req.Priority] {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "priority must be routine, urgent or stat"})
+	}
+
+	labOrderID, err := services.AddLabOrder(req)
+	if err != nil {
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "lab test not found", "employee not found or not active", "encounter not found for this patient":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":      "Lab order added successfully",
+		"lab_order_id": labOrderID,
+	})
+}
+
+func GetLabOrder(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	order, err := services.GetLabOrder(id)
+	if err != nil {
+		if err.Error() == "lab order not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// GetPatientLabOrders lists the patient's lab orders with results, ?status= narrows to one status
+func GetPatientLabOrders(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status != "" && !labOrderStatuses[status] {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be ordered, collected, resulted, verified or cancelled"})
+	}
+
+	orders, err := services.GetPatientLabOrders(c.Param("id"), status)
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	recordPatientAccess(c, c.Param("id"), "view")
+	return c.JSON(http.StatusOK, orders)
+}
+
+func CollectLabOrder(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.CollectLabOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Employee_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "employee_id is required"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.CollectLabOrder(id, req); err != nil {
+		return labOrderError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Specimen collected"})
+}
+
+func EnterLabResults(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.EnterLabResultsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Employee_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "employee_id is required"})
+	}
+	if len(req.Results) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "results must contain at least one value"})
+	}
+	seen := map[int64]bool{}
+	for i, result := range req.Results {
+		if seen[result.Component_id] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("results[%d].component_id is duplicated", i)})
+		}
+		seen[result.Component_id] = true
+		if result.Value == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("results[%d].value is required", i)})
+		}
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.EnterLabResults(id, req); err != nil {
+		return labOrderError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Lab results entered"})
+}
+
+func VerifyLabOrder(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.VerifyLabOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Employee_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "employee_id is required"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.VerifyLabOrder(id, req); err != nil {
+		return labOrderError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Lab results verified"})
+}
+
+func CancelLabOrder(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.CancelLabOrder(id); err != nil {
+		return labOrderError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Lab order cancelled"})
+}
+
+// labOrderError maps the errors of the lab order workflow steps to a response
+func labOrderError(c echo.Context, err error) error {
+	var statusErr *services.LabOrderStatusError
+	if errors.As(err, &statusErr) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	var unknownErr *services.UnknownCatalogIdError
+	if errors.As(err, &unknownErr) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+	}
+	if strings.HasPrefix(err.Error(), "missing results for") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	switch err.Error() {
+	case "lab order not found":
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case "employee not found or not active", "results must be verified by a different employee":
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, err.Error())
+}
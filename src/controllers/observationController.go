@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// observedAtLayouts are the accepted formats of observed_at, local clinic time like the other date/time fields
+var observedAtLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05"}
+
+func GetObservationTypes(c echo.Context) error {
+	observationTypes, err := services.GetObservationTypes()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, observationTypes)
+}
+
+// AddObservations records one or more measurements (vital signs, weight, glucose, ...) for the patient
+func AddObservations(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.AddObservationsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if len(req.Observations) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "observations must contain at least one measurement"})
+	}
+	for i, observation := range req.Observations {
+		if observation.Observation_type == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("observations[%d].observation_type is required", i)})
+		}
+		if observation.Value == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("observations[%d].value is required", i)})
+		}
+		if observation.Observed_at != "" && !isValidObservedAt(observation.Observed_at) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("observations[%d].observed_at must be YYYY-MM-DD HH:MM[:SS]", i)})
+		}
+	}
+
+	ids, err := services.AddObservations(c.Param("id"), req)
+	if err != nil {
+		var unknownErr *services.UnknownCatalogIdError
+		if errors.As(err, &unknownErr) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+		}
+		var rangeErr *services.ObservationRangeError
+		if errors.As(err, &rangeErr) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":         "Observations added successfully",
+		"observation_ids": ids,
+	})
+}
+
+// GetPatientObservations returns the patient's series, filtered by ?type=&from=&to= (YYYY-MM-DD, inclusive) and ?abnormal=true
+func GetPatientObservations(c echo.Context) error {
+	query := patients.ObservationQuery{
+		Observation_type: c.QueryParam("type"),
+		From:             c.QueryParam("from"),
+		To:               c.QueryParam("to"),
+		Abnormal_only:    c.QueryParam("abnormal") == "true",
+	}
+
+	for name, value := range map[string]string{"from": query.From, "to": query.To} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": name + " must be YYYY-MM-DD"})
+		}
+	}
+	if query.From != "" && query.To != "" && query.From > query.To {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must not be after to"})
+	}
+
+	observations, err := services.GetPatientObservations(c.Param("id"), query)
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	recordPatientAccess(c, c.Param("id"), "view")
+	return c.JSON(http.StatusOK, observations)
+}
+
+func isValidObservedAt(value string) bool {
+	for _, layout := range observedAtLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parseIDParam reads a numeric id from the path (lab orders, invoices, jobs, ...) so the services compare the integer
+// column, which uses its primary key index
+func parseIDParam(c echo.Context, name string) (int64, error) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return id, nil
+}
@@ -3,9 +3,13 @@ package controllers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/NinePTH/GO_MVC-S/src/models/patients"
 	"github.com/NinePTH/GO_MVC-S/src/services"
@@ -31,9 +35,41 @@ func SearchPatient(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
+	recordPatientsAccess(c, patientResponseIDs(patients), "list")
 	return c.JSON(http.StatusOK, patients)
 }
 
+// SearchPatientsRanked is the single box search, ?q= (name, email, phone, id card, patient id or date of birth) and / or
+// ?date_of_birth=YYYY-MM-DD, best matches first, ?limit= (default 20, at most 100)
+func SearchPatientsRanked(c echo.Context) error {
+	query := c.QueryParam("q")
+	dateOfBirth := c.QueryParam("date_of_birth")
+	if strings.TrimSpace(query) == "" && dateOfBirth == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "q or date_of_birth is required"})
+	}
+	if dateOfBirth != "" {
+		if _, err := time.Parse("2006-01-02", dateOfBirth); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "date_of_birth must be YYYY-MM-DD"})
+		}
+	}
+
+	limit := 20
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 100"})
+		}
+		limit = parsed
+	}
+
+	results, err := services.SearchPatients(query, dateOfBirth, limit, 0)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	recordPatientsAccess(c, searchResultIDs(results), "list")
+	return c.JSON(http.StatusOK, results)
+}
+
 func AddPatientAppointment(c echo.Context) error {
 	if c.Request().Header.Get("Content-Type") != "application/json" {
 		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
@@ -75,12 +111,25 @@ func AddPatientAppointment(c echo.Context) error {
 	if err := validateString("patient.date", req.Date); err != nil {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
-	err := services.AddPatientAppointment(req)
+	appointmentID, reminders, eligibility, err := services.AddPatientAppointment(req)
 	if err != nil {
+		switch err.Error() {
+		case "invalid appointment date or time":
+			return c.JSON(http.StatusBadRequest, "date must be YYYY-MM-DD and time HH:MM or HH:MM:SS")
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "patient is not covered on the appointment date":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "coverage": eligibility})
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, "Patient appointment added successfully")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Patient appointment added successfully",
+		"appointment_id":      appointmentID,
+		"reminders_scheduled": reminders,
+		"coverage":            eligibility,
+	})
 }
 
 func AddPatientHistory(c echo.Context) error {
@@ -125,12 +174,30 @@ func AddPatientHistory(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
 
-	err := services.AddPatientHistory(req)
+	encounterID, err := services.AddPatientHistory(req)
 	if err != nil {
+		var unknownErr *services.UnknownCatalogIdError
+		if errors.As(err, &unknownErr) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+		}
+		// ค่า vitals ต้องอยู่ในช่วงที่เป็นไปได้ของ observation type (ไม่ได้วัด = null)
+		var rangeErr *services.ObservationRangeError
+		if errors.As(err, &rangeErr) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		switch err.Error() {
+		case "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		case "only one diagnosis can be primary", "a disease can only be diagnosed once per encounter":
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, "Patient history added successfully")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":      "Patient history added successfully",
+		"encounter_id": encounterID,
+	})
 }
 
 func UpdatePatient(c echo.Context) error {
@@ -173,9 +240,6 @@ func UpdatePatient(c echo.Context) error {
 	if err := validateString("patient.email", req.Patient.Email); err != nil {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
-	if err := validateString("patient.health_insurance", req.Patient.Health_insurance); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
 	if err := validateString("patient.address", req.Patient.Address); err != nil {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
@@ -204,6 +268,12 @@ func UpdatePatient(c echo.Context) error {
 		if err := validateString(fmt.Sprintf("patient_drug_allergy[%d].drug_id", i), allergy.DrugID); err != nil {
 			return c.JSON(http.StatusBadRequest, err.Error())
 		}
+		if allergy.DrugID != "" && allergy.DrugClassID != "" {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("patient_drug_allergy[%d] must have either drug_id or drug_class_id, not both", i))
+		}
+		if !services.IsValidAllergySeverity(allergy.Severity) {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("patient_drug_allergy[%d].severity must be one of mild, moderate, severe, life_threatening", i))
+		}
 	}
 
 	// Age must not be negative
@@ -211,8 +281,19 @@ func UpdatePatient(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, "Invalid Age Value")
 	}
 
+	if err := services.ValidateEmergencyContacts(req.PatientEmergencyContacts); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
 	rowsAffected, err := services.UpdatePatient(&req)
 	if err != nil {
+		var unknownErr *services.UnknownCatalogIdError
+		if errors.As(err, &unknownErr) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
+		}
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
@@ -231,6 +312,7 @@ func GetPatient(c echo.Context) error {
 		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
+	recordPatientAccess(c, id, "view")
 	return c.JSON(http.StatusOK, user)
 }
 
@@ -239,6 +321,7 @@ func GetAllPatients(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
+	recordPatientsAccess(c, patientResponseIDs(patient), "list")
 	return c.JSON(http.StatusOK, patient)
 }
 func AddPatient(c echo.Context) error {
@@ -257,84 +340,36 @@ func AddPatient(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, "Invalid request body")
 	}
 
-	// check all fields of patient must be filled
-	p := req.Patient
-	if p.Patient_id == "" || p.First_name == "" || p.Last_name == "" || p.Age == 0 || p.Gender == "" || p.Date_of_birth == "" || p.Blood_type == "" || p.Email == "" || p.Address == "" || p.Phone_number == "" || p.Id_card_number == "" || p.Ongoing_treatment == "" || p.Health_insurance == "" || p.Unhealthy_habits == "" {
-		return c.JSON(http.StatusBadRequest, "All patient fields must be provided")
-	}
-
-	// ดักว่าเป็น string มั้ย
-	validateString := func(fieldName string, value interface{}) error {
-		if _, ok := value.(string); !ok {
-			return fmt.Errorf("%s must be a string", fieldName)
-		}
-		return nil
-	}
-
-	// เช็คใน patient fields ว่าทุกค่าเป็น string หรือไม่
-	if err := validateString("patient.patient_id", req.Patient.Patient_id); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.first_name", req.Patient.First_name); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.last_name", req.Patient.Last_name); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.gender", req.Patient.Gender); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.date_of_birth", req.Patient.Date_of_birth); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.blood_type", req.Patient.Blood_type); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.email", req.Patient.Email); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.health_insurance", req.Patient.Health_insurance); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.address", req.Patient.Address); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.phone_number", req.Patient.Phone_number); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.id_card_number", req.Patient.Id_card_number); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.ongoing_treatment", req.Patient.Ongoing_treatment); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
-	}
-	if err := validateString("patient.unhealthy_habits", req.Patient.Unhealthy_habits); err != nil {
+	if err := services.ValidateNewPatient(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
 
-	// เช็คใน patient_chronic_disease ว่าทุกค่าเป็น string หรือไม่
-	for i, chronic := range req.PatientChronicDisease {
-		if err := validateString(fmt.Sprintf("patient_chronic_disease[%d].disease_id", i), chronic.DiseaseID); err != nil {
-			return c.JSON(http.StatusBadRequest, err.Error())
+	err := services.AddPatient(req)
+	if err != nil {
+		var unknownErr *services.UnknownCatalogIdError
+		if errors.As(err, &unknownErr) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "field": unknownErr.Field, "unknown_ids": unknownErr.Ids})
 		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	// เช็คใน patient_drug_allergy ว่าทุกค่าเป็น string หรือไม่
-	for i, allergy := range req.PatientDrugAllergy {
-		if err := validateString(fmt.Sprintf("patient_drug_allergy[%d].drug_id", i), allergy.DrugID); err != nil {
-			return c.JSON(http.StatusBadRequest, err.Error())
-		}
-	}
+	return c.JSON(http.StatusOK, "Patient added successfully")
+}
 
-	// Age must not be negative
-	if req.Patient.Age < 0 {
-		return c.JSON(http.StatusBadRequest, "Invalid Age Value")
+// CheckDrugAllergy reports direct and cross-sensitivity matches between ?drug_id= and the patient's allergies
+func CheckDrugAllergy(c echo.Context) error {
+	drugID := c.QueryParam("drug_id")
+	if drugID == "" {
+		return c.JSON(http.StatusBadRequest, "drug_id query parameter is required")
 	}
 
-	err := services.AddPatient(req)
+	result, err := services.CheckDrugAllergy(c.Param("id"), drugID)
 	if err != nil {
+		if err.Error() == "Patient not found" || err.Error() == "drug not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, "Patient added successfully")
+	return c.JSON(http.StatusOK, result)
 }
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+func GetAllPositions(c echo.Context) error {
+	positions, err := services.GetAllPositions(c.QueryParam("department_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, positions)
+}
+
+func GetPosition(c echo.Context) error {
+	position, err := services.GetPosition(c.Param("id"))
+	if err != nil {
+		if err.Error() == "position not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, position)
+}
+
+func AddPosition(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.Position
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Position_id == "" || req.Department_id == "" || req.Position_name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "position_id, department_id and position_name are required"})
+	}
+	if len(req.Position_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "position_id must be at most 4 characters"})
+	}
+
+	if _, err := services.AddPosition(req); err != nil {
+		if err.Error() == "department not found" {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Position added successfully"})
+}
+
+func UpdatePosition(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	for _, key := range []string{"position_name", "department_id"} {
+		val, ok := raw[key]
+		if !ok {
+			continue
+		}
+		str, ok := val.(string)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s must be a string", key))
+		}
+		if str != "" {
+			data[key] = str
+		}
+	}
+
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, "No valid data to update")
+	}
+
+	rowsAffected, err := services.UpdatePosition(c.Param("id"), data)
+	if err != nil {
+		if err.Error() == "department not found" {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "position not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Position updated successfully"})
+}
+
+func DeletePosition(c echo.Context) error {
+	rowsAffected, err := services.DeletePosition(c.Param("id"))
+	if err != nil {
+		if err.Error() == "position is held by active employees" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "position not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": fmt.Sprintf("Position %s deleted successfully", c.Param("id"))})
+}
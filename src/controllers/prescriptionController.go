@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AddPrescription prescribes a drug. Direct allergy matches are refused with 409 unless override_allergy is true,
+// cross-sensitivity matches are returned as warnings
+func AddPrescription(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.AddPrescriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Drug_id == "" || req.Prescribed_by == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "drug_id and prescribed_by are required"})
+	}
+	if req.Quantity <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "quantity must be greater than 0"})
+	}
+
+	prescriptionID, check, err := services.AddPrescription(c.Param("id"), req)
+	if err != nil {
+		var allergyErr *services.AllergyConflictError
+		if errors.As(err, &allergyErr) {
+			return c.JSON(http.StatusConflict, map[string]interface{}{"error": err.Error(), "allergy_check": allergyErr.Check})
+		}
+		switch err.Error() {
+		case "Patient not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "drug not found", "employee not found or not active", "encounter not found for this patient":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":         "Prescription added successfully",
+		"prescription_id": prescriptionID,
+		"allergy_check":   check,
+	})
+}
+
+func GetPatientPrescriptions(c echo.Context) error {
+	prescriptions, err := services.GetPatientPrescriptions(c.Param("id"))
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	recordPatientAccess(c, c.Param("id"), "view")
+	return c.JSON(http.StatusOK, prescriptions)
+}
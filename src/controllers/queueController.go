@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CheckInAppointment marks a patient arrived for today's appointment and returns the queue number
+func CheckInAppointment(c echo.Context) error {
+	var req patients.CheckInRequest
+	if c.Request().ContentLength > 0 {
+		if c.Request().Header.Get("Content-Type") != "application/json" {
+			return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		}
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	entry, err := services.CheckInAppointment(id, req)
+	if err != nil {
+		switch {
+		case err.Error() == "appointment not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case err.Error() == "appointment is cancelled", err.Error() == "appointment is already checked in":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case err.Error() == "appointment is not today", err.Error() == "department not found",
+			err.Error() == "employee not found or not active", strings.HasPrefix(err.Error(), "department_id is required"):
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{"message": "Patient checked in successfully", "checkin": entry})
+}
+
+// GetDepartmentQueue shows the live waiting room of a department, ?date= (default today), ?all=true to include closed entries
+func GetDepartmentQueue(c echo.Context) error {
+	date := c.QueryParam("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD"})
+	}
+
+	queue, err := services.GetDepartmentQueue(c.Param("id"), date, c.QueryParam("all") == "true")
+	if err != nil {
+		if err.Error() == "department not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, queue)
+}
+
+func CallNextPatient(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req patients.CallNextRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Employee_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "employee_id is required"})
+	}
+	if len(req.Room) > 20 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "room must be at most 20 characters"})
+	}
+
+	entry, err := services.CallNextPatient(c.Param("id"), req)
+	if err != nil {
+		switch err.Error() {
+		case "no patient waiting":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "employee not found or not active":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, entry)
+}
+
+func CompleteCheckIn(c echo.Context) error {
+	return finishCheckIn(c, "completed")
+}
+
+func MarkCheckInNoShow(c echo.Context) error {
+	return finishCheckIn(c, "no_show")
+}
+
+func finishCheckIn(c echo.Context, status string) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	entry, err := services.FinishCheckIn(id, status)
+	if err != nil {
+		switch err.Error() {
+		case "check-in not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "only a called patient can be completed", "only a waiting or called patient can be marked no-show":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, entry)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// recordPatientAccess adds the signed in user to the patient's access audit
+func recordPatientAccess(c echo.Context, patientID string, action string) {
+	claims, _ := c.Get("user").(jwt.MapClaims)
+	username, _ := claims["username"].(string)
+	role, _ := claims["role"].(string)
+	services.RecordPatientAccess(patientID, username, role, action)
+}
+
+// recordPatientsAccess adds the signed in user to the access audit of every patient a list or search returned
+func recordPatientsAccess(c echo.Context, patientIDs []string, action string) {
+	claims, _ := c.Get("user").(jwt.MapClaims)
+	username, _ := claims["username"].(string)
+	role, _ := claims["role"].(string)
+	services.RecordPatientsAccess(patientIDs, username, role, action)
+}
+
+// patientResponseIDs are the patient ids of a patient list or search
+func patientResponseIDs(list []patients.GetPatientResponse) []string {
+	ids := make([]string, 0, len(list))
+	for _, patient := range list {
+		ids = append(ids, patient.PatientGeneralInfo.Patient_id)
+	}
+	return ids
+}
+
+// searchResultIDs are the patient ids of a ranked search
+func searchResultIDs(results []patients.PatientSearchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.Patient_id)
+	}
+	return ids
+}
+
+// ExportMyRecord is GET /me/export, the signed in patient's copy of their record
+func ExportMyRecord(c echo.Context) error {
+	claims, ok := c.Get("user").(jwt.MapClaims)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, "Invalid or missing user claims")
+	}
+	patientID, _ := claims["patient_id"].(string)
+	if patientID == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "this account is not linked to a patient record"})
+	}
+	return exportPatientRecord(c, patientID)
+}
+
+// ExportPatientRecord is GET /patient/:id/export, the same copy downloaded by staff (e.g. for a patient without an account)
+func ExportPatientRecord(c echo.Context) error {
+	return exportPatientRecord(c, c.Param("id"))
+}
+
+// exportPatientRecord downloads the complete record as one JSON document (?format=json, default) or as a zip with a
+// JSON file per section (?format=zip)
+func exportPatientRecord(c echo.Context, patientID string) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or zip"})
+	}
+
+	claims, _ := c.Get("user").(jwt.MapClaims)
+	username, _ := claims["username"].(string)
+	role, _ := claims["role"].(string)
+	record, err := services.ExportPatientRecord(patientID, username, role)
+	if err != nil {
+		if err.Error() == "Patient not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	var body bytes.Buffer
+	contentType := "application/json"
+	if format == "zip" {
+		contentType = "application/zip"
+		err = services.WritePatientRecordZip(&body, record)
+	} else {
+		encoder := json.NewEncoder(&body)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(record)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	filename := fmt.Sprintf("patient-%s-record-%s.%s", patientID, time.Now().Format("20060102"), format)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, contentType, body.Bytes())
+}
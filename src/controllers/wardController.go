@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+func GetWards(c echo.Context) error {
+	wards, err := services.GetWards(c.QueryParam("department_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, wards)
+}
+
+func AddWard(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.Ward
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Ward_id == "" || req.Ward_name == "" || req.Department_id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ward_id, ward_name and department_id are required"})
+	}
+	if len(req.Ward_id) > 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ward_id must be at most 4 characters"})
+	}
+
+	if err := services.AddWard(req); err != nil {
+		switch err.Error() {
+		case "department not found":
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		case "ward already exists":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Ward added successfully"})
+}
+
+func GetWardBeds(c echo.Context) error {
+	beds, err := services.GetWardBeds(c.Param("id"))
+	if err != nil {
+		if err.Error() == "ward not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, beds)
+}
+
+func AddBed(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.AddBedRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Bed_number == "" || len(req.Bed_number) > 10 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bed_number is required and must be at most 10 characters"})
+	}
+
+	bedID, err := services.AddBed(c.Param("id"), req.Bed_number)
+	if err != nil {
+		switch err.Error() {
+		case "ward not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "bed number already exists in this ward":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "Bed added successfully",
+		"bed_id":  bedID,
+	})
+}
+
+func UpdateBedStatus(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.UpdateBedStatusRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// occupied มาจากการ admit/transfer เท่านั้น
+	if req.Status != "available" && req.Status != "cleaning" && req.Status != "maintenance" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be available, cleaning or maintenance"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.UpdateBedStatus(id, req.Status); err != nil {
+		switch err.Error() {
+		case "bed not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "bed is occupied":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Bed status updated successfully"})
+}
+
+// GetBedOccupancy counts beds by status per department, ?department_id= for one department
+func GetBedOccupancy(c echo.Context) error {
+	occupancy, err := services.GetBedOccupancy(c.QueryParam("department_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, occupancy)
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/services"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const eventTypeError = "event types must be among patient.created, patient.updated, patient.deleted, appointment.booked, employee.created"
+
+func validWebhookURL(raw string) bool {
+	u, err := url.ParseRequestURI(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// listLimit reads ?limit= (default 50, at most 500), ok is false when it is invalid
+func listLimit(c echo.Context) (int, bool) {
+	raw := c.QueryParam("limit")
+	if raw == "" {
+		return 50, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > 500 {
+		return 0, false
+	}
+	return limit, true
+}
+
+func GetWebhookSubscriptions(c echo.Context) error {
+	subscriptions, err := services.GetWebhookSubscriptions()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, subscriptions)
+}
+
+// AddWebhookSubscription registers an endpoint, the response holds the signing secret (it is not shown again)
+func AddWebhookSubscription(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var req models.AddWebhookSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if !validWebhookURL(req.Url) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "url must be an absolute http or https URL"})
+	}
+	if req.Secret != "" && (len(req.Secret) < 16 || len(req.Secret) > 100) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "secret must be between 16 and 100 characters"})
+	}
+	for _, eventType := range req.Event_types {
+		if !services.IsValidDomainEventType(eventType) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": eventTypeError})
+		}
+	}
+
+	subscription, err := services.AddWebhookSubscription(req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, subscription)
+}
+
+// UpdateWebhookSubscription changes the url, the event types, the description or pauses the subscription
+func UpdateWebhookSubscription(c echo.Context) error {
+	if c.Request().Header.Get("Content-Type") != "application/json" {
+		return c.JSON(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	var raw map[string]interface{}
+	if err := c.Bind(&raw); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request body")
+	}
+
+	data := map[string]interface{}{}
+	if val, ok := raw["url"]; ok {
+		str, ok := val.(string)
+		if !ok || !validWebhookURL(str) {
+			return c.JSON(http.StatusBadRequest, "url must be an absolute http or https URL")
+		}
+		data["url"] = str
+	}
+	if val, ok := raw["description"]; ok {
+		str, ok := val.(string)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, "description must be a string")
+		}
+		data["description"] = str
+	}
+	if val, ok := raw["event_types"]; ok {
+		list, ok := val.([]interface{})
+		if !ok {
+			return c.JSON(http.StatusBadRequest, eventTypeError)
+		}
+		eventTypes := []string{}
+		for _, item := range list {
+			eventType, ok := item.(string)
+			if !ok || !services.IsValidDomainEventType(eventType) {
+				return c.JSON(http.StatusBadRequest, eventTypeError)
+			}
+			eventTypes = append(eventTypes, eventType)
+		}
+		data["event_types"] = pq.Array(eventTypes)
+	}
+	if val, ok := raw["is_active"]; ok {
+		active, ok := val.(bool)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, "is_active must be a boolean")
+		}
+		data["is_active"] = active
+	}
+
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, "No valid data to update")
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rowsAffected, err := services.UpdateWebhookSubscription(id, data)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "webhook subscription not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook subscription updated successfully"})
+}
+
+func DeleteWebhookSubscription(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rowsAffected, err := services.DeleteWebhookSubscription(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "webhook subscription not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook subscription deleted successfully"})
+}
+
+// GetWebhookDeliveries is the delivery log of a subscription, ?status=&limit=
+func GetWebhookDeliveries(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status != "" && status != "pending" && status != "delivered" && status != "failed" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be one of pending, delivered, failed"})
+	}
+	limit, ok := listLimit(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+	}
+
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	deliveries, err := services.GetWebhookDeliveries(id, status, limit)
+	if err != nil {
+		if err.Error() == "webhook subscription not found" {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+func RetryWebhookDelivery(c echo.Context) error {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := services.RetryWebhookDelivery(id); err != nil {
+		switch err.Error() {
+		case "webhook delivery not found":
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case "only failed deliveries can be retried":
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook delivery queued for retry"})
+}
+
+// GetDomainEvents lists the outbox newest first, ?type=&limit=
+func GetDomainEvents(c echo.Context) error {
+	eventType := c.QueryParam("type")
+	if eventType != "" && !services.IsValidDomainEventType(eventType) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": eventTypeError})
+	}
+	limit, ok := listLimit(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+	}
+
+	events, err := services.GetDomainEvents(eventType, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, events)
+}
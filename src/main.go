@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/NinePTH/GO_MVC-S/src/routes"
+	"github.com/NinePTH/GO_MVC-S/src/services"
 	"github.com/NinePTH/GO_MVC-S/src/utils/databaseConnector"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -11,6 +13,13 @@ import (
 
 func main() {
 	databaseConnector.InitDB()
+	if len(os.Args) > 1 { // Command line tools, e.g. go run . import patients patients.csv
+		os.Exit(runCommand(os.Args[1:]))
+	}
+	services.StartReminderDispatcher() // Schedule appointment reminders
+	services.StartWebhookDispatcher()  // Schedule webhook deliveries of domain events
+	services.StartJobRunner()          // Run background jobs (reminders, cleanup, ...)
+	services.StartHL7Listener()        // Accept HL7 v2 ADT messages over MLLP when HL7_MLLP_ADDR is set
 
 	e := echo.New()
 
@@ -23,7 +32,21 @@ func main() {
 	routes.UserRoutes(e)
 	routes.PatientRoutes(e)
 	routes.EmployeeRoutes(e)
+	routes.DepartmentRoutes(e)
+	routes.CatalogRoutes(e)
+	routes.LabRoutes(e)
+	routes.WardRoutes(e)
+	routes.BillingRoutes(e)
+	routes.InsuranceRoutes(e)
+	routes.ConsentRoutes(e)
+	routes.QueueRoutes(e)
+	routes.EventRoutes(e)
+	routes.FhirRoutes(e)
+	routes.HL7Routes(e)
+	routes.AdminRoutes(e)
 	routes.AuthRoutes(e)
+	routes.MeRoutes(e)
+	routes.APIV1Routes(e)
 
 	fmt.Println("Server path is http://localhost:1323/")
 	e.Logger.Fatal(e.Start(":1323"))
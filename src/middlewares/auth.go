@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"database/sql"
 	"errors"
 	"net/http"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/NinePTH/GO_MVC-S/src/models/auth"
+	"github.com/NinePTH/GO_MVC-S/src/utils/databaseConnector"
 )
 
 var jwtSecret = []byte("supersecretkey")
@@ -19,6 +21,7 @@ func GenerateJWT(userInfo auth.GenerateJWTClaimsParams) (string, error) {
         "username": userInfo.Username,
         "role": userInfo.Role,
 		"patient_id": userInfo.PatientID, // If user is not patient, this will be empty
+        "iat":      time.Now().Unix(), // Used to reject tokens issued before Users.tokens_revoked_at
         "exp":      time.Now().Add(time.Hour * 24).Unix(),
     })
     return token.SignedString(jwtSecret)
@@ -53,9 +56,116 @@ func JWTMiddleware() echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token")
 			}
 
+			// A valid signature is not enough, the account may have been disabled (e.g. offboarded) after the token was issued
+			if err := checkTokenRevocation(claims); err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+			}
+
 			// Store claims in context
 			c.Set("user", claims)
 			return next(c)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// checkTokenRevocation rejects tokens of disabled accounts and tokens issued before the account's tokens were revoked
+func checkTokenRevocation(claims jwt.MapClaims) error {
+	username, _ := claims["username"].(string)
+
+	var isActive bool
+	var revokedAt sql.NullTime
+	err := databaseConnector.DB.QueryRow("SELECT is_active, tokens_revoked_at FROM Users WHERE username = $1", username).Scan(&isActive, &revokedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("User not found")
+	}
+	if err != nil {
+		return errors.New("Could not verify token")
+	}
+
+	if !isActive {
+		return errors.New("Account is disabled")
+	}
+
+	if revokedAt.Valid {
+		issuedAt, _ := claims["iat"].(float64) // tokens issued before "iat" was added count as revoked
+		if int64(issuedAt) <= revokedAt.Time.Unix() {
+			return errors.New("Token has been revoked")
+		}
+	}
+
+	return nil
+}
+
+// RoleMiddleware only lets requests through when the token's role is one of roles, it must be used after JWTMiddleware
+func RoleMiddleware(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := c.Get("user").(jwt.MapClaims)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing user claims")
+			}
+
+			role, _ := claims["role"].(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					return next(c)
+				}
+			}
+
+			return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to access this resource")
+		}
+	}
+}
+
+// PatientSelfOrRoleMiddleware is RoleMiddleware for the /patient/:id routes that also lets a patient through on their
+// own record (the patient_id of the token is :id), it must be used after JWTMiddleware
+func PatientSelfOrRoleMiddleware(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := c.Get("user").(jwt.MapClaims)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing user claims")
+			}
+
+			role, _ := claims["role"].(string)
+			if role == "patient" {
+				if patientID, _ := claims["patient_id"].(string); patientID != "" && patientID == c.Param("id") {
+					return next(c)
+				}
+				return echo.NewHTTPError(http.StatusForbidden, "Forbidden: patients can only read their own record")
+			}
+			for _, allowed := range roles {
+				if role == allowed {
+					return next(c)
+				}
+			}
+
+			return echo.NewHTTPError(http.StatusForbidden, "You do not have permission to access this resource")
+		}
+	}
+}
+
+// TokenFromQuery lets clients that cannot set headers (the browser EventSource API) send the JWT as ?access_token=.
+// It must run before JWTMiddleware; the token is removed from the URL so it is not written to the request log
+func TokenFromQuery() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			query := req.URL.Query()
+			if token := query.Get("access_token"); token != "" {
+				if req.Header.Get("Authorization") == "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				query.Del("access_token")
+				req.URL.RawQuery = query.Encode()
+				req.RequestURI = req.URL.RequestURI()
+			}
+			return next(c)
+		}
+	}
+}
+
+// CheckTokenClaims repeats the revocation check of JWTMiddleware, for long-lived connections that outlive the request check
+func CheckTokenClaims(claims jwt.MapClaims) error {
+	return checkTokenRevocation(claims)
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Deprecated marks a route kept as an alias of its /api/v1 successor: the response gets a Deprecation header and a Link
+// to the successor. ":id" in successor is replaced by the id of the request
+func Deprecated(successor string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			link := successor
+			if id := c.Param("id"); id != "" {
+				link = strings.Replace(link, ":id", id, 1)
+			}
+			c.Response().Header().Set("Deprecation", "true")
+			c.Response().Header().Add("Link", "<"+link+`>; rel="successor-version"`)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+type AddBedRequest struct {
+	Bed_number string `json:"bed_number"`
+}
+
+type UpdateBedStatusRequest struct {
+	Status string `json:"status"` // available, cleaning, maintenance (occupied is only set by admissions)
+}
+
+type BedResponse struct {
+	Bed_id       int64  `json:"bed_id"`
+	Ward_id      string `json:"ward_id"`
+	Bed_number   string `json:"bed_number"`
+	Status       string `json:"status"`
+	Admission_id *int64 `json:"admission_id"` // current occupant, null when the bed is free
+	Patient_id   string `json:"patient_id"`
+	Patient_name string `json:"patient_name"`
+}
+
+// DepartmentOccupancy counts the beds of all wards of a department by status
+type DepartmentOccupancy struct {
+	Department_id   string  `json:"department_id"`
+	Department_name string  `json:"department_name"`
+	Wards           int     `json:"wards"`
+	Total_beds      int     `json:"total_beds"`
+	Occupied        int     `json:"occupied"`
+	Available       int     `json:"available"`
+	Cleaning        int     `json:"cleaning"`
+	Maintenance     int     `json:"maintenance"`
+	Occupancy_rate  float64 `json:"occupancy_rate"` // occupied / total beds, 0..1
+}
@@ -0,0 +1,40 @@
+package billing
+
+// AddChargeRequest captures a charge by hand, the price list is used when unit_price is not given
+type AddChargeRequest struct {
+	Item_type   string   `json:"item_type"`
+	Item_code   string   `json:"item_code"`
+	Description string   `json:"description"`
+	Quantity    int      `json:"quantity"`
+	Unit_price  *float64 `json:"unit_price"`
+}
+
+type Charge struct {
+	Charge_id          int64    `json:"charge_id"`
+	Patient_id         string   `json:"patient_id"`
+	Item_type          string   `json:"item_type"`
+	Item_code          string   `json:"item_code"`
+	Source_type        string   `json:"source_type"` // appointment, encounter, lab_order, prescription, manual, rebill (copy of the charge source_id of a voided invoice)
+	Source_id          *int64   `json:"source_id"`
+	Description        string   `json:"description"`
+	Quantity           int      `json:"quantity"`
+	Unit_price         float64  `json:"unit_price"`
+	Amount             float64  `json:"amount"`
+	Insurance_coverage float64  `json:"insurance_coverage"`
+	Charged_at         string   `json:"charged_at"`
+	Invoice_id         *int64   `json:"invoice_id"`       // null until the charge is invoiced
+	Insurance_amount   *float64 `json:"insurance_amount"` // set when invoiced
+	Patient_amount     *float64 `json:"patient_amount"`   // set when invoiced
+}
+
+// SkippedSource is a billable record no charge could be created for
+type SkippedSource struct {
+	Source_type string `json:"source_type"`
+	Source_id   int64  `json:"source_id"`
+	Reason      string `json:"reason"`
+}
+
+type GenerateChargesResponse struct {
+	Created []Charge        `json:"created"`
+	Skipped []SkippedSource `json:"skipped"`
+}
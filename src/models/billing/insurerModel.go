@@ -0,0 +1,9 @@
+package billing
+
+type Insurer struct {
+	Insurer_id   string `json:"insurer_id"`
+	Insurer_name string `json:"insurer_name"`
+	Phone_number string `json:"phone_number"`
+	Email        string `json:"email"`
+	Is_active    bool   `json:"is_active"` // inactive insurers cannot take new policies and their policies give no coverage
+}
@@ -0,0 +1,31 @@
+package billing
+
+type CreateInvoiceRequest struct {
+	Issued_by string `json:"issued_by"` // employee_id
+}
+
+type UpdateClaimRequest struct {
+	Claim_status string `json:"claim_status"` // submitted, approved, rejected
+}
+
+type Invoice struct {
+	Invoice_id       int64     `json:"invoice_id"`
+	Patient_id       string    `json:"patient_id"`
+	Patient_name     string    `json:"patient_name"`
+	Issued_by        string    `json:"issued_by"`
+	Issued_at        string    `json:"issued_at"`
+	Insured          bool      `json:"insured"`
+	Policy_id        *int64    `json:"policy_id"` // the policy the insurance share is claimed on
+	Total_amount     float64   `json:"total_amount"`
+	Insurance_amount float64   `json:"insurance_amount"`
+	Patient_amount   float64   `json:"patient_amount"`
+	Claim_status     string    `json:"claim_status"` // not_applicable, pending, submitted, approved, rejected
+	Status           string    `json:"status"`       // unpaid, partially_paid, paid, void
+	Patient_paid     float64   `json:"patient_paid"`
+	Insurer_paid     float64   `json:"insurer_paid"`
+	Patient_balance  float64   `json:"patient_balance"` // includes the insurance share when the claim was rejected
+	Insurer_balance  float64   `json:"insurer_balance"`
+	Voided_at        string    `json:"voided_at"`
+	Lines            []Charge  `json:"lines,omitempty"`
+	Payments         []Payment `json:"payments,omitempty"`
+}
@@ -0,0 +1,19 @@
+package billing
+
+type AddPaymentRequest struct {
+	Payer       string  `json:"payer"` // patient or insurer
+	Amount      float64 `json:"amount"`
+	Method      string  `json:"method"` // cash, card, transfer, ...
+	Reference   string  `json:"reference"`
+	Received_by string  `json:"received_by"` // employee_id, optional
+}
+
+type Payment struct {
+	Payment_id  int64   `json:"payment_id"`
+	Payer       string  `json:"payer"`
+	Amount      float64 `json:"amount"`
+	Method      string  `json:"method"`
+	Reference   string  `json:"reference"`
+	Paid_at     string  `json:"paid_at"`
+	Received_by string  `json:"received_by"`
+}
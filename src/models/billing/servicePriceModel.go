@@ -0,0 +1,12 @@
+package billing
+
+// ServicePrice is one entry of the price list. item_code "" is the default price of the whole item type,
+// otherwise it is the lab_test_id / drug_id the price applies to
+type ServicePrice struct {
+	Price_id           int64   `json:"price_id"`
+	Item_type          string  `json:"item_type"` // appointment, encounter, lab_test, drug, other
+	Item_code          string  `json:"item_code"`
+	Description        string  `json:"description"`
+	Unit_price         float64 `json:"unit_price"`
+	Insurance_coverage float64 `json:"insurance_coverage"` // percent of the amount paid by the insurer for insured patients
+}
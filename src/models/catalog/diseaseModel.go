@@ -0,0 +1,7 @@
+package catalog
+
+type Disease struct {
+	Disease_id   string `json:"disease_id"`
+	Disease_name string `json:"disease_name"`
+	Icd10_code   string `json:"icd10_code"` // optional, e.g. "A15" or "B18.1"
+}
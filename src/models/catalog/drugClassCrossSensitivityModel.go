@@ -0,0 +1,7 @@
+package catalog
+
+type DrugClassCrossSensitivity struct {
+	Drug_class_id    string `json:"drug_class_id"`
+	Related_class_id string `json:"related_class_id"`
+	Note             string `json:"note"`
+}
@@ -0,0 +1,6 @@
+package catalog
+
+type DrugClass struct {
+	Drug_class_id string `json:"drug_class_id"`
+	Class_name    string `json:"class_name"`
+}
@@ -0,0 +1,10 @@
+package catalog
+
+type DrugIngredient struct {
+	Ingredient_id   string `json:"ingredient_id"`
+	Ingredient_name string `json:"ingredient_name"`
+}
+
+type DrugIngredientsRequest struct {
+	Ingredient_ids []string `json:"ingredient_ids"`
+}
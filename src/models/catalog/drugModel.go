@@ -0,0 +1,18 @@
+package catalog
+
+type Drug struct {
+	Drug_id       string `json:"drug_id"`
+	Drug_name     string `json:"drug_name"`
+	Atc_code      string `json:"atc_code"`    // optional WHO ATC code, e.g. "J01CA04"
+	Rxnorm_code   string `json:"rxnorm_code"` // optional RxNorm concept id, e.g. "723"
+	Drug_class_id string `json:"drug_class_id"`
+}
+
+type DrugResponse struct {
+	Drug_id         string `json:"drug_id"`
+	Drug_name       string `json:"drug_name"`
+	Atc_code        string `json:"atc_code"`
+	Rxnorm_code     string `json:"rxnorm_code"`
+	Drug_class_id   string `json:"drug_class_id"`
+	Drug_class_name string `json:"drug_class_name"`
+}
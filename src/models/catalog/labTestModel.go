@@ -0,0 +1,21 @@
+package catalog
+
+// LabTestComponent is one analyte reported by a lab test. Ranges are optional (null = no limit on that side)
+type LabTestComponent struct {
+	Component_id   int64    `json:"component_id"`
+	Component_name string   `json:"component_name"`
+	Unit           string   `json:"unit"`
+	Normal_low     *float64 `json:"normal_low"`
+	Normal_high    *float64 `json:"normal_high"`
+	Critical_low   *float64 `json:"critical_low"`
+	Critical_high  *float64 `json:"critical_high"`
+}
+
+// LabTest is an orderable test or panel, e.g. "CBC"
+type LabTest struct {
+	Lab_test_id   string             `json:"lab_test_id"`
+	Test_name     string             `json:"test_name"`
+	Specimen_type string             `json:"specimen_type"` // e.g. "serum", "whole blood"
+	Loinc_code    string             `json:"loinc_code"`    // optional
+	Components    []LabTestComponent `json:"components"`
+}
@@ -0,0 +1,14 @@
+package catalog
+
+// ObservationType describes something that can be measured on a patient. Ranges are optional (null = no limit on that side)
+type ObservationType struct {
+	Observation_type string   `json:"observation_type"` // e.g. "heart_rate"
+	Display_name     string   `json:"display_name"`
+	Unit             string   `json:"unit"`
+	Normal_low       *float64 `json:"normal_low"`
+	Normal_high      *float64 `json:"normal_high"`
+	Critical_low     *float64 `json:"critical_low"`
+	Critical_high    *float64 `json:"critical_high"`
+	Valid_min        float64  `json:"valid_min"` // values outside valid_min..valid_max are rejected as typos
+	Valid_max        float64  `json:"valid_max"`
+}
@@ -0,0 +1,13 @@
+package models
+
+type Department struct {
+	Department_id   string `json:"department_id"`
+	Department_name string `json:"department_name"`
+}
+
+type DepartmentResponse struct {
+	Department_id   string `json:"department_id"`
+	Department_name string `json:"department_name"`
+	Position_count  int    `json:"position_count"`
+	Headcount       int    `json:"headcount"` // active employees (work_status = 'yes') in all positions of the department
+}
@@ -0,0 +1,47 @@
+package models
+
+import "encoding/json"
+
+// DomainEvent is one row of the outbox
+type DomainEvent struct {
+	Event_id       int64           `json:"event_id"`
+	Event_type     string          `json:"event_type"`     // patient.created, patient.updated, patient.deleted, appointment.booked, employee.created
+	Aggregate_type string          `json:"aggregate_type"` // patient, appointment, employee
+	Aggregate_id   string          `json:"aggregate_id"`
+	Patient_id     string          `json:"patient_id"`
+	Payload        json.RawMessage `json:"payload"`
+	Occurred_at    string          `json:"occurred_at"`
+	Dispatched_at  string          `json:"dispatched_at"`
+}
+
+// PatientEvent is the payload of patient.created, patient.updated and patient.deleted, demographics only
+type PatientEvent struct {
+	Patient_id     string   `json:"patient_id"`
+	First_name     string   `json:"first_name"`
+	Last_name      string   `json:"last_name"`
+	Gender         string   `json:"gender"`
+	Date_of_birth  string   `json:"date_of_birth"`
+	Email          string   `json:"email"`
+	Phone_number   string   `json:"phone_number"`
+	Changed_fields []string `json:"changed_fields,omitempty"` // patient.updated only
+}
+
+// AppointmentBookedEvent is the payload of appointment.booked
+type AppointmentBookedEvent struct {
+	Appointment_id int64  `json:"appointment_id"`
+	Patient_id     string `json:"patient_id"`
+	Employee_id    string `json:"employee_id"`
+	Date           string `json:"date"`
+	Time           string `json:"time"`
+	Topic          string `json:"topic"`
+}
+
+// EmployeeCreatedEvent is the payload of employee.created
+type EmployeeCreatedEvent struct {
+	Employee_id string `json:"employee_id"`
+	First_name  string `json:"first_name"`
+	Last_name   string `json:"last_name"`
+	Position_id string `json:"position_id"`
+	Email       string `json:"email"`
+	Hire_date   string `json:"hire_date"`
+}
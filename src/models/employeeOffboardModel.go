@@ -0,0 +1,15 @@
+package models
+
+type EmployeeOffboardRequest struct {
+	Resignation_date string `json:"resignation_date"` // YYYY-MM-DD, defaults to today
+	Reason           string `json:"reason"`
+	Reassign_to      string `json:"reassign_to"` // employee who takes over future appointments, empty leaves them unassigned
+}
+
+type EmployeeOffboardResponse struct {
+	Employee_id             string `json:"employee_id"`
+	Resignation_date        string `json:"resignation_date"`
+	Account_disabled        bool   `json:"account_disabled"`
+	Reassigned_to           string `json:"reassigned_to"`
+	Appointments_reassigned int64  `json:"appointments_reassigned"`
+}
@@ -0,0 +1,185 @@
+package fhir
+
+// The structs below are the subset of HL7 FHIR R4 (https://hl7.org/fhir/R4) the /fhir/R4 API returns. Field names follow
+// the repo style, json tags follow the FHIR element names; empty elements are left out as FHIR requires
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	Use    string `json:"use,omitempty"`
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system"` // phone, email
+	Value  string `json:"value"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Address struct {
+	Text string `json:"text"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"` // e.g. Patient/P001
+	Display   string `json:"display,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Patient struct {
+	Resource_type string         `json:"resourceType"`
+	Id            string         `json:"id"`
+	Identifier    []Identifier   `json:"identifier,omitempty"`
+	Active        bool           `json:"active"`
+	Name          []HumanName    `json:"name,omitempty"`
+	Telecom       []ContactPoint `json:"telecom,omitempty"`
+	Gender        string         `json:"gender,omitempty"`
+	Birth_date    string         `json:"birthDate,omitempty"`
+	Address       []Address      `json:"address,omitempty"`
+}
+
+type Practitioner struct {
+	Resource_type string         `json:"resourceType"`
+	Id            string         `json:"id"`
+	Identifier    []Identifier   `json:"identifier,omitempty"`
+	Active        bool           `json:"active"`
+	Name          []HumanName    `json:"name,omitempty"`
+	Telecom       []ContactPoint `json:"telecom,omitempty"`
+}
+
+// PractitionerRole is the employee's position (code) in a department (specialty), its id is the employee id
+type PractitionerRole struct {
+	Resource_type string            `json:"resourceType"`
+	Id            string            `json:"id"`
+	Active        bool              `json:"active"`
+	Period        *Period           `json:"period,omitempty"`
+	Practitioner  Reference         `json:"practitioner"`
+	Code          []CodeableConcept `json:"code,omitempty"`
+	Specialty     []CodeableConcept `json:"specialty,omitempty"`
+}
+
+type AppointmentParticipant struct {
+	Actor  Reference `json:"actor"`
+	Status string    `json:"status"` // accepted
+}
+
+type Appointment struct {
+	Resource_type      string                   `json:"resourceType"`
+	Id                 string                   `json:"id"`
+	Status             string                   `json:"status"` // booked, arrived, checked-in, fulfilled, noshow, cancelled
+	Cancelation_reason *CodeableConcept         `json:"cancelationReason,omitempty"`
+	Description        string                   `json:"description,omitempty"`
+	Start              string                   `json:"start"`
+	Participant        []AppointmentParticipant `json:"participant"`
+}
+
+type AllergyReaction struct {
+	Manifestation []CodeableConcept `json:"manifestation"`
+	Severity      string            `json:"severity,omitempty"` // mild, moderate, severe
+}
+
+type AllergyIntolerance struct {
+	Resource_type   string            `json:"resourceType"`
+	Id              string            `json:"id"`
+	Clinical_status CodeableConcept   `json:"clinicalStatus"`
+	Type            string            `json:"type"`
+	Category        []string          `json:"category"`
+	Criticality     string            `json:"criticality,omitempty"` // low, high
+	Code            CodeableConcept   `json:"code"`
+	Patient         Reference         `json:"patient"`
+	Reaction        []AllergyReaction `json:"reaction,omitempty"`
+}
+
+type Condition struct {
+	Resource_type   string            `json:"resourceType"`
+	Id              string            `json:"id"`
+	Clinical_status CodeableConcept   `json:"clinicalStatus"`
+	Category        []CodeableConcept `json:"category"`
+	Code            CodeableConcept   `json:"code"`
+	Subject         Reference         `json:"subject"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"` // self, next, previous
+	Url      string `json:"url"`
+}
+
+type BundleEntrySearch struct {
+	Mode string `json:"mode"` // match
+}
+
+type BundleEntry struct {
+	Full_url string            `json:"fullUrl"`
+	Resource interface{}       `json:"resource"`
+	Search   BundleEntrySearch `json:"search"`
+}
+
+type Bundle struct {
+	Resource_type string        `json:"resourceType"`
+	Type          string        `json:"type"` // searchset
+	Total         int           `json:"total"`
+	Link          []BundleLink  `json:"link"`
+	Entry         []BundleEntry `json:"entry"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"` // error
+	Code        string `json:"code"`     // invalid, not-found, not-supported, exception
+	Diagnostics string `json:"diagnostics"`
+}
+
+type OperationOutcome struct {
+	Resource_type string                  `json:"resourceType"`
+	Issue         []OperationOutcomeIssue `json:"issue"`
+}
+
+type CapabilitySearchParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // token, string, date, reference
+}
+
+type CapabilityInteraction struct {
+	Code string `json:"code"` // read, search-type
+}
+
+type CapabilityResource struct {
+	Type         string                  `json:"type"`
+	Interaction  []CapabilityInteraction `json:"interaction"`
+	Search_param []CapabilitySearchParam `json:"searchParam"`
+}
+
+type CapabilityRest struct {
+	Mode     string               `json:"mode"` // server
+	Resource []CapabilityResource `json:"resource"`
+}
+
+type CapabilityStatement struct {
+	Resource_type string           `json:"resourceType"`
+	Status        string           `json:"status"`
+	Date          string           `json:"date"`
+	Kind          string           `json:"kind"`
+	Fhir_version  string           `json:"fhirVersion"`
+	Format        []string         `json:"format"`
+	Rest          []CapabilityRest `json:"rest"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// ImportResult is the report of a CSV import. In a dry run nothing is written and Imported_rows stays 0,
+// Valid_rows tells how many rows an actual import would add
+type ImportResult struct {
+	Entity        string           `json:"entity"` // patients, employees
+	Dry_run       bool             `json:"dry_run"`
+	Total_rows    int              `json:"total_rows"`
+	Valid_rows    int              `json:"valid_rows"`
+	Imported_rows int              `json:"imported_rows"`
+	Failed_rows   int              `json:"failed_rows"`
+	Errors        []ImportRowError `json:"errors"`
+}
+
+// ImportRowError is why one row was not imported, Line is the line of the row in the file (the header is line 1)
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Id    string `json:"id"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "encoding/json"
+
+// Job is one entry of the background job queue
+type Job struct {
+	Job_id       int64           `json:"job_id"`
+	Job_type     string          `json:"job_type"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"` // queued, running, succeeded, dead, cancelled
+	Priority     int             `json:"priority"`
+	Run_at       string          `json:"run_at"`
+	Attempts     int             `json:"attempts"`
+	Max_attempts int             `json:"max_attempts"`
+	Unique_key   string          `json:"unique_key"`
+	Last_error   string          `json:"last_error"`
+	Result       json.RawMessage `json:"result"`
+	Locked_by    string          `json:"locked_by"`
+	Created_at   string          `json:"created_at"`
+	Started_at   string          `json:"started_at"`
+	Finished_at  string          `json:"finished_at"`
+}
+
+// JobSchedule is a recurring job
+type JobSchedule struct {
+	Schedule_name    string          `json:"schedule_name"`
+	Job_type         string          `json:"job_type"`
+	Payload          json.RawMessage `json:"payload"`
+	Interval_seconds int             `json:"interval_seconds"`
+	Next_run_at      string          `json:"next_run_at"`
+	Last_run_at      string          `json:"last_run_at"`
+	Is_active        bool            `json:"is_active"`
+}
+
+// JobStats is the number of jobs per type and status
+type JobStats struct {
+	Job_type string `json:"job_type"`
+	Status   string `json:"status"`
+	Count    int64  `json:"count"`
+}
+
+type EnqueueJobRequest struct {
+	Job_type     string          `json:"job_type"`
+	Payload      json.RawMessage `json:"payload"`
+	Run_at       string          `json:"run_at"`       // optional, "YYYY-MM-DD HH:MM:SS", defaults to now
+	Max_attempts int             `json:"max_attempts"` // optional, defaults to 5
+	Priority     int             `json:"priority"`     // higher runs first
+}
@@ -5,5 +5,7 @@ Patient_id string `json:"patient_id"`
 Time string `json:"time"`
 Date string `json:"date"`
 Topic string `json:"topic"`
+Employee_id string `json:"employee_id"` // optional, the doctor/nurse in charge of this appointment
+Require_insurance bool `json:"require_insurance"` // optional, refuse the booking when no policy covers the appointment date
 }
 
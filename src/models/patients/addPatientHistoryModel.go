@@ -4,9 +4,20 @@ package patients
 // )
 type AddPatientHistory struct{
 Patient_id string `json:"patient_id"`
-Detail string `json:"detail"`
+Detail string `json:"detail"` // clinician's notes
 Time string `json:"time"`
 Date string `json:"date"`
+// Structured encounter fields, all optional so the old request body keeps working
+Employee_id string `json:"employee_id"` // attending doctor/nurse
+Chief_complaint string `json:"chief_complaint"`
+Vitals EncounterVitals `json:"vitals"`
+Diagnoses []EncounterDiagnosisInput `json:"diagnoses"`
+Plan string `json:"plan"`
+}
+
+type EncounterDiagnosisInput struct {
+Disease_id string `json:"disease_id"`
+Is_primary bool `json:"is_primary"`
 }
 
 // CREATE TABLE Medical_history (
@@ -16,4 +27,4 @@ Date string `json:"date"`
 // 	time TIME NOT NULL,
 // 	date date NOT NULL,
 // 	FOREIGN KEY (patient_id) REFERENCES Patient(patient_id)
-// );
\ No newline at end of file
+// );
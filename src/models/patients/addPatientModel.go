@@ -5,5 +5,6 @@ type AddPatientRequest struct {
 	Patient              GeneralPatientInformation            `json:"patient"`
 	PatientChronicDisease []ChronicDiseaseName `json:"patient_chronic_disease"`
 	PatientDrugAllergy    []DrugAllergyName    `json:"patient_drug_allergy"`
+	PatientEmergencyContacts []EmergencyContact `json:"patient_emergency_contacts"` // UpdatePatient: omit to keep the current contacts, [] removes them all
 	
 }
\ No newline at end of file
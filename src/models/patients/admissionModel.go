@@ -0,0 +1,45 @@
+package patients
+
+type AdmitPatientRequest struct {
+	Patient_id  string `json:"patient_id"`
+	Bed_id      int64  `json:"bed_id"`
+	Admitted_by string `json:"admitted_by"` // employee_id
+	Reason      string `json:"reason"`
+}
+
+type TransferPatientRequest struct {
+	Bed_id      int64  `json:"bed_id"`
+	Employee_id string `json:"employee_id"`
+	Reason      string `json:"reason"`
+}
+
+type DischargePatientRequest struct {
+	Employee_id    string `json:"employee_id"`
+	Discharge_note string `json:"discharge_note"`
+}
+
+type BedAssignment struct {
+	Bed_id      int64  `json:"bed_id"`
+	Ward_id     string `json:"ward_id"`
+	Ward_name   string `json:"ward_name"`
+	Bed_number  string `json:"bed_number"`
+	Assigned_by string `json:"assigned_by"`
+	Assigned_at string `json:"assigned_at"`
+	Released_at string `json:"released_at"` // empty for the current bed
+	Reason      string `json:"reason"`
+}
+
+type Admission struct {
+	Admission_id   int64           `json:"admission_id"`
+	Patient_id     string          `json:"patient_id"`
+	Patient_name   string          `json:"patient_name"`
+	Status         string          `json:"status"` // admitted or discharged
+	Admitted_by    string          `json:"admitted_by"`
+	Reason         string          `json:"reason"`
+	Admitted_at    string          `json:"admitted_at"`
+	Discharged_by  string          `json:"discharged_by"`
+	Discharged_at  string          `json:"discharged_at"`
+	Discharge_note string          `json:"discharge_note"`
+	Current_bed    *BedAssignment  `json:"current_bed"` // null after discharge
+	Bed_history    []BedAssignment `json:"bed_history"` // oldest first
+}
@@ -0,0 +1,22 @@
+package patients
+
+type AllergyMatch struct {
+	Match_type         string `json:"match_type"` // direct, shared_ingredient, drug_class, same_class, cross_sensitivity
+	Allergy_drug_id    string `json:"allergy_drug_id,omitempty"`
+	Allergy_drug_name  string `json:"allergy_drug_name,omitempty"`
+	Allergy_class_id   string `json:"allergy_class_id,omitempty"`
+	Allergy_class_name string `json:"allergy_class_name,omitempty"`
+	Severity           string `json:"severity,omitempty"`
+	Reaction_type      string `json:"reaction_type,omitempty"`
+	Detail             string `json:"detail"`
+}
+
+type AllergyCheckResponse struct {
+	Patient_id      string         `json:"patient_id"`
+	Drug_id         string         `json:"drug_id"`
+	Drug_name       string         `json:"drug_name"`
+	Drug_class_name string         `json:"drug_class_name"`
+	Has_direct      bool           `json:"has_direct_match"`
+	Has_cross       bool           `json:"has_cross_sensitivity"`
+	Matches         []AllergyMatch `json:"matches"`
+}
@@ -0,0 +1,28 @@
+package patients
+
+type MoveAppointmentRequest struct {
+	Date        string `json:"date"`        // YYYY-MM-DD
+	Time        string `json:"time"`        // HH:MM or HH:MM:SS
+	Topic       string `json:"topic"`       // optional, keeps the current topic when empty
+	Employee_id string `json:"employee_id"` // optional, keeps the current employee when empty
+}
+
+type CancelAppointmentRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AppointmentReminder is one reminder of an appointment and its delivery status
+type AppointmentReminder struct {
+	Reminder_id     int64  `json:"reminder_id"`
+	Appointment_id  int64  `json:"appointment_id"`
+	Channel         string `json:"channel"` // email, sms
+	Recipient       string `json:"recipient"`
+	Offset_minutes  int    `json:"offset_minutes"` // minutes before the appointment
+	Send_at         string `json:"send_at"`
+	Status          string `json:"status"` // pending, sent, failed, cancelled
+	Attempts        int    `json:"attempts"`
+	Next_attempt_at string `json:"next_attempt_at"`
+	Last_error      string `json:"last_error"`
+	Sent_at         string `json:"sent_at"`
+	Cancelled_at    string `json:"cancelled_at"`
+}
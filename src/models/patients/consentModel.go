@@ -0,0 +1,40 @@
+package patients
+
+// ConsentDocument is one version of the text a patient agrees to for a consent type
+type ConsentDocument struct {
+	Consent_type   string `json:"consent_type"` // treatment, data_sharing, research, communication_email, communication_sms, communication_phone
+	Version        string `json:"version"`
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Effective_from string `json:"effective_from"` // YYYY-MM-DD, defaults to today
+}
+
+type RecordConsentRequest struct {
+	Consent_type string `json:"consent_type"`
+	Version      string `json:"version"`   // optional, defaults to the latest effective version
+	Granted      *bool  `json:"granted"`   // true = agreed, false = refused
+	Signed_at    string `json:"signed_at"` // optional, "YYYY-MM-DD HH:MM:SS", defaults to now
+	Recorded_by  string `json:"recorded_by"`
+	Note         string `json:"note"`
+}
+
+type RevokeConsentRequest struct {
+	Revoked_by string `json:"revoked_by"`
+	Reason     string `json:"reason"`
+}
+
+type PatientConsent struct {
+	Consent_id        int64  `json:"consent_id"`
+	Patient_id        string `json:"patient_id"`
+	Consent_type      string `json:"consent_type"`
+	Version           string `json:"version"`
+	Granted           bool   `json:"granted"`
+	Status            string `json:"status"` // granted, refused, superseded, revoked
+	Signed_at         string `json:"signed_at"`
+	Recorded_by       string `json:"recorded_by"`
+	Note              string `json:"note"`
+	Superseded_at     string `json:"superseded_at"`
+	Revoked_at        string `json:"revoked_at"`
+	Revoked_by        string `json:"revoked_by"`
+	Revocation_reason string `json:"revocation_reason"`
+}
@@ -1,4 +1,8 @@
 package patients
 type DrugAllergyName struct {
 	DrugID string `json:"drug_id"`
+	DrugClassID string `json:"drug_class_id,omitempty"` // class level allergy (e.g. all penicillins), used instead of drug_id
+	DrugClassName string `json:"drug_class_name,omitempty"` // read only, filled in on GetPatient
+	Severity string `json:"severity,omitempty"` // mild, moderate, severe, life_threatening
+	ReactionType string `json:"reaction_type,omitempty"` // e.g. rash, anaphylaxis
 }
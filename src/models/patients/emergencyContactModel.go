@@ -0,0 +1,11 @@
+package patients
+
+type EmergencyContact struct {
+	Contact_id       int64  `json:"contact_id"` // set by the server, ignored on AddPatient/UpdatePatient
+	Contact_name     string `json:"contact_name"`
+	Relationship     string `json:"relationship"` // spouse, parent, child, sibling, ...
+	Phone_number     string `json:"phone_number"`
+	Email            string `json:"email"`
+	Priority         int    `json:"priority"`         // 1 is called first, defaults to the lowest number not taken by another contact
+	Consent_to_share bool   `json:"consent_to_share"` // the patient agrees this contact may receive information about their care
+}
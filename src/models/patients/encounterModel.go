@@ -0,0 +1,31 @@
+package patients
+
+// EncounterVitals uses pointers so "not measured" (null) is different from 0
+type EncounterVitals struct {
+	Systolic_bp      *int     `json:"systolic_bp"`
+	Diastolic_bp     *int     `json:"diastolic_bp"`
+	Heart_rate       *int     `json:"heart_rate"`
+	Respiratory_rate *int     `json:"respiratory_rate"`
+	Temperature      *float64 `json:"temperature"` // °C
+	Spo2             *int     `json:"spo2"`        // %
+}
+
+type EncounterDiagnosis struct {
+	Disease_id   string `json:"disease_id"`
+	Disease_name string `json:"disease_name"`
+	Icd10_code   string `json:"icd10_code"`
+	Is_primary   bool   `json:"is_primary"`
+}
+
+type Encounter struct {
+	Encounter_id    int64                `json:"encounter_id"`
+	Date            string               `json:"date"`
+	Time            string               `json:"time"`
+	Employee_id     string               `json:"employee_id"`
+	Clinician_name  string               `json:"clinician_name"`
+	Chief_complaint string               `json:"chief_complaint"`
+	Vitals          EncounterVitals      `json:"vitals"`
+	Diagnoses       []EncounterDiagnosis `json:"diagnoses"`
+	Plan            string               `json:"plan"`
+	Notes           string               `json:"notes"`
+}
@@ -4,6 +4,11 @@ type GetPatientResponse struct {
 	PatientGeneralInfo GeneralPatientInformation `json:"patient"`
 	PatientAppointment PatientAppointment `json:"patient_appointment"`
 	PatientMedicalHistory []MedicalHistory `json:"medical_history"`
+	PatientEncounters []Encounter `json:"encounters"` // newest first
+	PatientLatestVitals []Observation `json:"latest_vitals"` // latest value of each observation type
+	PatientLabAlerts []LabAlert `json:"lab_alerts"` // abnormal lab results, newest first
+	PatientActiveCoverage []InsurancePolicy `json:"active_coverage"` // insurance policies valid today, primary first
 	PatientChronicDisease []ChronicDiseaseName      `json:"patient_chronic_disease"`
 	PatientDrugAllergy    []DrugAllergyName         `json:"patient_drug_allergy"`
-}
\ No newline at end of file
+	PatientEmergencyContacts []EmergencyContact `json:"patient_emergency_contacts"` // priority order
+}
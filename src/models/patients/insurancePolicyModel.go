@@ -0,0 +1,37 @@
+package patients
+
+type AddInsurancePolicyRequest struct {
+	Insurer_id       string   `json:"insurer_id"`
+	Policy_number    string   `json:"policy_number"`
+	Plan_name        string   `json:"plan_name"`
+	Coverage_percent float64  `json:"coverage_percent"`
+	Annual_limit     *float64 `json:"annual_limit"` // optional, nil = no limit
+	Valid_from       string   `json:"valid_from"`   // YYYY-MM-DD
+	Valid_to         string   `json:"valid_to"`     // optional, "" = open ended
+	Priority         int      `json:"priority"`     // 1 = primary, defaults to 1
+}
+
+type InsurancePolicy struct {
+	Policy_id        int64    `json:"policy_id"`
+	Patient_id       string   `json:"patient_id"`
+	Insurer_id       string   `json:"insurer_id"`
+	Insurer_name     string   `json:"insurer_name"`
+	Policy_number    string   `json:"policy_number"`
+	Plan_name        string   `json:"plan_name"`
+	Coverage_percent float64  `json:"coverage_percent"`
+	Annual_limit     *float64 `json:"annual_limit"`
+	Valid_from       string   `json:"valid_from"`
+	Valid_to         string   `json:"valid_to"`
+	Priority         int      `json:"priority"`
+	Is_active        bool     `json:"is_active"` // valid today and the insurer is active
+}
+
+// CoverageEligibility is the result of checking a patient's insurance on a date. Policy is the policy that
+// would pay (lowest priority number), nil when the patient is not covered
+type CoverageEligibility struct {
+	Patient_id string           `json:"patient_id"`
+	Date       string           `json:"date"`
+	Eligible   bool             `json:"eligible"`
+	Policy     *InsurancePolicy `json:"policy"`
+	Reason     string           `json:"reason,omitempty"`
+}
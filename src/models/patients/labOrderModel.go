@@ -0,0 +1,77 @@
+package patients
+
+type AddLabOrderRequest struct {
+	Patient_id   string `json:"patient_id"`
+	Lab_test_id  string `json:"lab_test_id"`
+	Ordered_by   string `json:"ordered_by"`   // employee_id of the ordering clinician
+	Encounter_id *int64 `json:"encounter_id"` // optional, the encounter the test was ordered in
+	Priority     string `json:"priority"`     // routine (default), urgent, stat
+	Note         string `json:"note"`
+}
+
+type CollectLabOrderRequest struct {
+	Employee_id string `json:"employee_id"`
+	Specimen_id string `json:"specimen_id"` // label on the tube, optional
+}
+
+type LabResultInput struct {
+	Component_id int64    `json:"component_id"`
+	Value        *float64 `json:"value"` // required, a pointer so a missing value is not stored as 0
+}
+
+type EnterLabResultsRequest struct {
+	Employee_id string           `json:"employee_id"`
+	Results     []LabResultInput `json:"results"`
+}
+
+type VerifyLabOrderRequest struct {
+	Employee_id string `json:"employee_id"`
+}
+
+// LabResult keeps the unit and range that applied when the value was entered
+type LabResult struct {
+	Component_id   int64    `json:"component_id"`
+	Component_name string   `json:"component_name"`
+	Value          float64  `json:"value"`
+	Unit           string   `json:"unit"`
+	Normal_low     *float64 `json:"normal_low"`
+	Normal_high    *float64 `json:"normal_high"`
+	Flag           string   `json:"flag"` // normal, low, high, critical_low, critical_high
+	Is_abnormal    bool     `json:"is_abnormal"`
+}
+
+type LabOrder struct {
+	Lab_order_id  int64       `json:"lab_order_id"`
+	Patient_id    string      `json:"patient_id"`
+	Lab_test_id   string      `json:"lab_test_id"`
+	Test_name     string      `json:"test_name"`
+	Specimen_type string      `json:"specimen_type"`
+	Ordered_by    string      `json:"ordered_by"`
+	Encounter_id  *int64      `json:"encounter_id"`
+	Priority      string      `json:"priority"`
+	Status        string      `json:"status"` // ordered, collected, resulted, verified, cancelled
+	Note          string      `json:"note"`
+	Ordered_at    string      `json:"ordered_at"`
+	Specimen_id   string      `json:"specimen_id"`
+	Collected_by  string      `json:"collected_by"`
+	Collected_at  string      `json:"collected_at"`
+	Resulted_by   string      `json:"resulted_by"`
+	Resulted_at   string      `json:"resulted_at"`
+	Verified_by   string      `json:"verified_by"`
+	Verified_at   string      `json:"verified_at"`
+	Results       []LabResult `json:"results"`
+	Has_abnormal  bool        `json:"has_abnormal"`
+	Has_critical  bool        `json:"has_critical"`
+}
+
+// LabAlert is an abnormal result shown on the patient record
+type LabAlert struct {
+	Lab_order_id   int64   `json:"lab_order_id"`
+	Test_name      string  `json:"test_name"`
+	Component_name string  `json:"component_name"`
+	Value          float64 `json:"value"`
+	Unit           string  `json:"unit"`
+	Flag           string  `json:"flag"`
+	Status         string  `json:"status"` // resulted (not yet verified) or verified
+	Resulted_at    string  `json:"resulted_at"`
+}
@@ -0,0 +1,37 @@
+package patients
+
+type ObservationInput struct {
+	Observation_type string   `json:"observation_type"`
+	Value            *float64 `json:"value"`       // required, a pointer so a missing value is not stored as 0
+	Observed_at      string   `json:"observed_at"` // "2006-01-02 15:04:05", empty = now
+	Employee_id      string   `json:"employee_id"` // optional, who took the measurement
+	Note             string   `json:"note"`
+}
+
+type AddObservationsRequest struct {
+	Observations []ObservationInput `json:"observations"`
+}
+
+// Observation is one measurement with its unit and the reference range it was flagged against
+type Observation struct {
+	Observation_id   int64    `json:"observation_id"`
+	Observation_type string   `json:"observation_type"`
+	Display_name     string   `json:"display_name"`
+	Value            float64  `json:"value"`
+	Unit             string   `json:"unit"`
+	Observed_at      string   `json:"observed_at"`
+	Employee_id      string   `json:"employee_id"`
+	Encounter_id     *int64   `json:"encounter_id"` // set when recorded as part of an encounter
+	Note             string   `json:"note"`
+	Normal_low       *float64 `json:"normal_low"`
+	Normal_high      *float64 `json:"normal_high"`
+	Flag             string   `json:"flag"` // normal, low, high, critical_low, critical_high
+	Is_abnormal      bool     `json:"is_abnormal"`
+}
+
+type ObservationQuery struct {
+	Observation_type string // empty = every type
+	From             string // "2006-01-02", inclusive
+	To               string // "2006-01-02", inclusive
+	Abnormal_only    bool
+}
@@ -1,8 +1,8 @@
 package patients
 
 type PatientAppointment struct{
+Appointment_id int64 `json:"appointment_id"`
 Time string `json:"time"`
 Date string `json:"date"`
 Topic string `json:"topic"`
 }
-
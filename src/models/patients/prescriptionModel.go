@@ -0,0 +1,22 @@
+package patients
+
+type AddPrescriptionRequest struct {
+	Drug_id          string `json:"drug_id"`
+	Quantity         int    `json:"quantity"`
+	Instructions     string `json:"instructions"`
+	Prescribed_by    string `json:"prescribed_by"`    // employee_id
+	Encounter_id     *int64 `json:"encounter_id"`     // optional
+	Override_allergy bool   `json:"override_allergy"` // prescribe even though the allergy check found a direct match
+}
+
+type Prescription struct {
+	Prescription_id int64  `json:"prescription_id"`
+	Patient_id      string `json:"patient_id"`
+	Drug_id         string `json:"drug_id"`
+	Drug_name       string `json:"drug_name"`
+	Quantity        int    `json:"quantity"`
+	Instructions    string `json:"instructions"`
+	Prescribed_by   string `json:"prescribed_by"`
+	Encounter_id    *int64 `json:"encounter_id"`
+	Prescribed_at   string `json:"prescribed_at"`
+}
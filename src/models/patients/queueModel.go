@@ -0,0 +1,43 @@
+package patients
+
+type CheckInRequest struct {
+	Checked_in_by string `json:"checked_in_by"` // optional, employee at the front desk
+	Department_id string `json:"department_id"` // optional, defaults to the department of the appointment's employee
+}
+
+type CallNextRequest struct {
+	Employee_id string `json:"employee_id"`
+	Room        string `json:"room"` // optional, shown on the waiting room screen
+}
+
+// QueueEntry is one checked-in appointment in a department's waiting room
+type QueueEntry struct {
+	Checkin_id     int64  `json:"checkin_id"`
+	Appointment_id int64  `json:"appointment_id"`
+	Department_id  string `json:"department_id"`
+	Queue_date     string `json:"queue_date"`
+	Queue_number   int    `json:"queue_number"`
+	Status         string `json:"status"` // waiting, called, completed, no_show, cancelled
+	Patient_id     string `json:"patient_id"`
+	Patient_name   string `json:"patient_name"`
+	Appointment_at string `json:"appointment_at"`
+	Employee_id    string `json:"employee_id"`
+	Checked_in_at  string `json:"checked_in_at"`
+	Called_at      string `json:"called_at"`
+	Called_by      string `json:"called_by"`
+	Room           string `json:"room"`
+	Finished_at    string `json:"finished_at"`
+	Wait_minutes   int    `json:"wait_minutes"` // check-in to call, or to now while waiting
+}
+
+// DepartmentQueue is the live waiting room of a department on one day
+type DepartmentQueue struct {
+	Department_id        string       `json:"department_id"`
+	Department_name      string       `json:"department_name"`
+	Queue_date           string       `json:"queue_date"`
+	Waiting_count        int          `json:"waiting_count"`
+	Called_count         int          `json:"called_count"`
+	Average_wait_minutes float64      `json:"average_wait_minutes"` // check-in to call, over the patients called that day
+	Longest_wait_minutes int          `json:"longest_wait_minutes"` // among the patients still waiting
+	Entries              []QueueEntry `json:"entries"`
+}
@@ -0,0 +1,51 @@
+package patients
+
+import "github.com/NinePTH/GO_MVC-S/src/models/billing"
+
+// PatientRecordAccess is one entry of the audit of who viewed or exported a patient's record
+type PatientRecordAccess struct {
+	Accessed_by string `json:"accessed_by"`
+	Role        string `json:"role"`
+	Action      string `json:"action"` // view, export
+	Accessed_at string `json:"accessed_at"`
+}
+
+// RecordAppointment is an appointment in the record export, cancelled ones included
+type RecordAppointment struct {
+	Appointment_id      int64  `json:"appointment_id"`
+	Date                string `json:"date"` // YYYY-MM-DD
+	Time                string `json:"time"`
+	Topic               string `json:"topic"`
+	Employee_id         string `json:"employee_id"`
+	Doctor_name         string `json:"doctor_name"`
+	Status              string `json:"status"` // booked, cancelled
+	Cancelled_at        string `json:"cancelled_at"`
+	Cancellation_reason string `json:"cancellation_reason"`
+}
+
+// RecordCondition is a chronic disease with its catalog name and code
+type RecordCondition struct {
+	Disease_id   string `json:"disease_id"`
+	Disease_name string `json:"disease_name"`
+	Icd10_code   string `json:"icd10_code"`
+}
+
+// PatientRecordExport is the complete record of one patient, the machine-readable copy a patient is entitled to
+type PatientRecordExport struct {
+	Format_version     int                       `json:"format_version"`
+	Exported_at        string                    `json:"exported_at"`
+	Patient            GeneralPatientInformation `json:"patient"`
+	Emergency_contacts []EmergencyContact        `json:"emergency_contacts"`
+	Consents           []PatientConsent          `json:"consents"` // full history
+	Appointments       []RecordAppointment       `json:"appointments"`
+	Encounters         []Encounter               `json:"encounters"`
+	Conditions         []RecordCondition         `json:"conditions"`
+	Allergies          []DrugAllergyName         `json:"allergies"`
+	Prescriptions      []Prescription            `json:"prescriptions"`
+	Observations       []Observation             `json:"observations"`
+	Lab_orders         []LabOrder                `json:"lab_orders"`
+	Admissions         []Admission               `json:"admissions"`
+	Insurance_policies []InsurancePolicy         `json:"insurance_policies"`
+	Invoices           []billing.Invoice         `json:"invoices"`
+	Access_log         []PatientRecordAccess     `json:"access_log"` // newest first
+}
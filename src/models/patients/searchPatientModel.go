@@ -5,4 +5,19 @@ type SearchPatient struct {
 	Patient_id              string            `json:"patient_id"`
 	First_name             string            `json:"first_name"`
 	Last_name              string            `json:"last_name"`	
-}
\ No newline at end of file
+}
+
+// PatientSearchResult is one hit of the ranked search. Highlights holds the fields containing the query words, HTML
+// escaped with the matches wrapped in <mark></mark>
+type PatientSearchResult struct {
+	Patient_id     string            `json:"patient_id"`
+	First_name     string            `json:"first_name"`
+	Last_name      string            `json:"last_name"`
+	Date_of_birth  string            `json:"date_of_birth"` // YYYY-MM-DD
+	Gender         string            `json:"gender"`
+	Email          string            `json:"email"`
+	Phone_number   string            `json:"phone_number"`
+	Id_card_number string            `json:"id_card_number"`
+	Score          float64           `json:"score"` // 1 for an exact id / number / date of birth match
+	Highlights     map[string]string `json:"highlights"`
+}
@@ -0,0 +1,15 @@
+package models
+
+type Position struct {
+	Position_id   string `json:"position_id"`
+	Department_id string `json:"department_id"`
+	Position_name string `json:"position_name"`
+}
+
+type PositionResponse struct {
+	Position_id     string `json:"position_id"`
+	Position_name   string `json:"position_name"`
+	Department_id   string `json:"department_id"`
+	Department_name string `json:"department_name"`
+	Headcount       int    `json:"headcount"` // active employees holding this position
+}
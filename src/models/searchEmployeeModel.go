@@ -1,7 +1,18 @@
 package models
 
+// SearchEmployee is the employee search. Every filter that is set must match (AND), an empty filter matches everyone
 type SearchEmployee struct {
-	Employee_id              string            `json:"employee_id"`
-	First_name             string            `json:"first_name"`
-	Last_name              string            `json:"last_name"`	
-}
\ No newline at end of file
+	Employee_id   string   `json:"employee_id"`
+	First_name    string   `json:"first_name"` // part of the name, case-insensitive
+	Last_name     string   `json:"last_name"`
+	Department_id string   `json:"department_id"` // one id or several separated by commas
+	Position_id   string   `json:"position_id"`   // one id or several separated by commas
+	Work_status   string   `json:"work_status"`   // yes, no
+	Salary_min    *float64 `json:"salary_min"`
+	Salary_max    *float64 `json:"salary_max"`
+	Hired_from    string   `json:"hired_from"` // YYYY-MM-DD, inclusive
+	Hired_to      string   `json:"hired_to"`
+	Resigned_from string   `json:"resigned_from"` // resigned in this period, YYYY-MM-DD, inclusive
+	Resigned_to   string   `json:"resigned_to"`
+	Sort          string   `json:"sort"` // columns separated by commas, "-" for descending, e.g. "department_name,-salary"; default -employee_id
+}
@@ -0,0 +1,17 @@
+package models
+
+type Ward struct {
+	Ward_id       string `json:"ward_id"`
+	Ward_name     string `json:"ward_name"`
+	Department_id string `json:"department_id"`
+}
+
+type WardResponse struct {
+	Ward_id         string `json:"ward_id"`
+	Ward_name       string `json:"ward_name"`
+	Department_id   string `json:"department_id"`
+	Department_name string `json:"department_name"`
+	Total_beds      int    `json:"total_beds"`
+	Occupied_beds   int    `json:"occupied_beds"`
+	Available_beds  int    `json:"available_beds"`
+}
@@ -0,0 +1,35 @@
+package models
+
+// WebhookSubscription is an external endpoint notified of domain events. The secret is only returned when the subscription is created
+type WebhookSubscription struct {
+	Subscription_id int64    `json:"subscription_id"`
+	Url             string   `json:"url"`
+	Secret          string   `json:"secret,omitempty"`
+	Event_types     []string `json:"event_types"` // empty means every event type
+	Description     string   `json:"description"`
+	Is_active       bool     `json:"is_active"`
+	Created_at      string   `json:"created_at"`
+}
+
+type AddWebhookSubscriptionRequest struct {
+	Url         string   `json:"url"`
+	Secret      string   `json:"secret"` // optional, generated when empty
+	Event_types []string `json:"event_types"`
+	Description string   `json:"description"`
+}
+
+// WebhookDelivery is the delivery of one event to one subscription, with the outcome of the last attempt
+type WebhookDelivery struct {
+	Delivery_id      int64  `json:"delivery_id"`
+	Subscription_id  int64  `json:"subscription_id"`
+	Event_id         int64  `json:"event_id"`
+	Event_type       string `json:"event_type"`
+	Status           string `json:"status"` // pending, delivered, failed
+	Attempts         int    `json:"attempts"`
+	Next_attempt_at  string `json:"next_attempt_at"`
+	Last_status_code int    `json:"last_status_code"`
+	Last_error       string `json:"last_error"`
+	Response_body    string `json:"response_body"`
+	Created_at       string `json:"created_at"`
+	Delivered_at     string `json:"delivered_at"`
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func AdminRoutes(e *echo.Echo) {
+	protected := e.Group("/admin")
+	protected.Use(middlewares.JWTMiddleware())      // Apply JWT middleware (protected route)
+	protected.Use(middlewares.RoleMiddleware("HR")) // Operations endpoints are HR only
+
+	protected.GET("/jobs", controllers.GetJobs)                          // Background jobs, ?status=&type=&limit=
+	protected.GET("/jobs/stats", controllers.GetJobStats)                // Job counts per type and status
+	protected.GET("/jobs/:id", controllers.GetJob)                       // One job with its result or last error
+	protected.POST("/jobs", controllers.EnqueueJob)                      // Queue a job by hand
+	protected.POST("/jobs/:id/retry", controllers.RetryJob)              // Retry a dead or cancelled job
+	protected.POST("/jobs/:id/cancel", controllers.CancelJob)            // Cancel a queued job
+	protected.GET("/job-schedules", controllers.GetJobSchedules)         // Recurring jobs
+	protected.PUT("/job-schedules/:name", controllers.UpdateJobSchedule) // Change the interval or pause a recurring job
+
+	protected.GET("/events", controllers.GetDomainEvents)                             // Domain event outbox, ?type=&limit=
+	protected.GET("/webhooks", controllers.GetWebhookSubscriptions)                   // Webhook subscriptions
+	protected.POST("/webhooks", controllers.AddWebhookSubscription)                   // Subscribe an endpoint, returns the signing secret once
+	protected.PUT("/webhooks/:id", controllers.UpdateWebhookSubscription)             // Change url / event types or pause
+	protected.DELETE("/webhooks/:id", controllers.DeleteWebhookSubscription)          // Remove subscription and its delivery log
+	protected.GET("/webhooks/:id/deliveries", controllers.GetWebhookDeliveries)       // Delivery log, ?status=&limit=
+	protected.POST("/webhook-deliveries/:id/retry", controllers.RetryWebhookDelivery) // Retry a failed delivery
+
+	protected.POST("/import/:entity", controllers.ImportCSV) // Bulk CSV import of patients or employees, ?dry_run=true
+}
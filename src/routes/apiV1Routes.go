@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func APIV1Routes(e *echo.Echo) {
+	v1 := e.Group("/api/v1")
+	v1.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+
+	staff := middlewares.RoleMiddleware("HR", "medical_personnel")
+	hr := middlewares.RoleMiddleware("HR")
+
+	v1.GET("/patients", controllers.ListPatientsV1, staff)       // ?q= ranked search (name / email / phone / id card / date of birth), ?date_of_birth=, ?limit=&offset=
+	v1.POST("/patients", controllers.CreatePatientV1, staff)     // 201 with Location: /api/v1/patients/{id}
+	v1.GET("/patients/:id", controllers.GetPatientV1)            // Staff, or the patient themself; 404 when missing
+	v1.PATCH("/patients/:id", controllers.PatchPatientV1, staff) // application/merge-patch+json, returns the updated patient
+	v1.DELETE("/patients/:id", controllers.DeletePatientV1, hr)  // 204, hides the patient, their records are kept
+	v1.GET("/employees", controllers.ListEmployeesV1, staff)     // Filters and ?sort= of the employee search as query parameters
+	v1.POST("/employees", controllers.CreateEmployeeV1, hr)      // 201 with Location: /api/v1/employees/{id}
+	v1.GET("/employees/:id", controllers.GetEmployeeV1, staff)   // 404 when missing
+	v1.PATCH("/employees/:id", controllers.PatchEmployeeV1, hr)  // application/merge-patch+json, "resignation_date": null clears it
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func BillingRoutes(e *echo.Echo) {
+	protected := e.Group("/billing")
+	protected.Use(middlewares.JWTMiddleware(), middlewares.RoleMiddleware("HR", "medical_personnel")) // Apply JWT middleware (protected route), staff only
+
+	// The price list is maintained by HR
+	manage := middlewares.RoleMiddleware("HR")
+
+	protected.GET("/price", controllers.GetServicePrices)                        // Display price list
+	protected.POST("/price", controllers.AddServicePrice, manage)                // Add price list entry
+	protected.PUT("/price/:id", controllers.UpdateServicePrice, manage)          // Update price / insurance coverage
+	protected.POST("/patient/:id/charges/generate", controllers.GenerateCharges) // Capture charges from appointments, encounters, lab orders, prescriptions
+	protected.POST("/patient/:id/charges", controllers.AddManualCharge)          // Capture a charge by hand
+	protected.GET("/patient/:id/charges", controllers.GetPatientCharges)         // Display charges, ?unbilled=true
+	protected.POST("/patient/:id/invoices", controllers.CreateInvoice)           // Invoice all unbilled charges
+	protected.GET("/patient/:id/invoices", controllers.GetPatientInvoices)       // Display invoices with balances
+	protected.GET("/invoice/:id", controllers.GetInvoice)                        // Display invoice, ?format=csv to download
+	protected.POST("/invoice/:id/payments", controllers.AddPayment)              // Record payment by patient or insurer
+	protected.PUT("/invoice/:id/claim", controllers.UpdateClaimStatus)           // Move insurance claim along
+	protected.POST("/invoice/:id/void", controllers.VoidInvoice)                 // Void invoice without payments
+}
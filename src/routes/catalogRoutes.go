@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+func CatalogRoutes(e *echo.Echo) {
+	protected := e.Group("/catalog")
+	protected.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+
+	// Only medical personnel maintain the disease/drug catalogs
+	manage := middlewares.RoleMiddleware("medical_personnel")
+
+	protected.GET("/disease", controllers.SearchDiseases)                          // All diseases, or typeahead with ?q=&limit=
+	protected.GET("/disease/:id", controllers.GetDisease)                          // Display disease by id
+	protected.POST("/disease", controllers.AddDisease, manage)                     // Add disease
+	protected.PUT("/disease/:id", controllers.UpdateDisease, manage)               // Update disease name / ICD-10 code
+	protected.DELETE("/disease/:id", controllers.DeleteDisease, manage)            // Delete disease not recorded on any patient
+	protected.GET("/drug", controllers.SearchDrugs)                                // All drugs, or typeahead with ?q=&limit=
+	protected.GET("/drug/:id", controllers.GetDrug)                                // Display drug by id
+	protected.POST("/drug", controllers.AddDrug, manage)                           // Add drug
+	protected.PUT("/drug/:id", controllers.UpdateDrug, manage)                     // Update drug name / codes / class
+	protected.DELETE("/drug/:id", controllers.DeleteDrug, manage)                  // Delete drug not recorded on any patient
+	protected.GET("/drug-class", controllers.GetAllDrugClasses)                    // Display all drug classes
+	protected.POST("/drug-class", controllers.AddDrugClass, manage)                // Add drug class
+	protected.GET("/drug/:id/ingredients", controllers.GetDrugIngredients)         // Display active ingredients of a drug
+	protected.PUT("/drug/:id/ingredients", controllers.SetDrugIngredients, manage) // Replace active ingredients of a drug
+	protected.GET("/ingredient", controllers.GetAllIngredients)                    // Display all ingredients
+	protected.POST("/ingredient", controllers.AddIngredient, manage)               // Add ingredient
+	protected.GET("/cross-sensitivity", controllers.GetAllCrossSensitivities)      // Display cross-reacting drug class pairs
+	protected.POST("/cross-sensitivity", controllers.AddCrossSensitivity, manage)  // Record that two drug classes cross-react
+	protected.GET("/observation-type", controllers.GetObservationTypes)            // Observation types with units and reference ranges
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func ConsentRoutes(e *echo.Echo) {
+	protected := e.Group("/consent")
+	protected.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+
+	// Consent texts are published by HR
+	manage := middlewares.RoleMiddleware("HR")
+
+	protected.GET("/document", controllers.GetConsentDocuments)         // Consent texts with versions, ?type=
+	protected.POST("/document", controllers.AddConsentDocument, manage) // Publish a new version of a consent text
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+func DepartmentRoutes(e *echo.Echo) {
+	department := e.Group("/department")
+	department.Use(middlewares.JWTMiddleware())                                               // Apply JWT middleware (protected route)
+	department.GET("", controllers.GetAllDepartments)                                         // Display all departments with headcount
+	department.GET("/:id", controllers.GetDepartment)                                         // Display department by id
+	department.GET("/:id/employees", controllers.GetDepartmentEmployees)                      // Display employees of the department
+	department.POST("", controllers.AddDepartment, middlewares.RoleMiddleware("HR"))          // Add department
+	department.PUT("/:id", controllers.UpdateDepartment, middlewares.RoleMiddleware("HR"))    // Rename department
+	department.DELETE("/:id", controllers.DeleteDepartment, middlewares.RoleMiddleware("HR")) // Delete department without positions
+
+	position := e.Group("/position")
+	position.Use(middlewares.JWTMiddleware())                                             // Apply JWT middleware (protected route)
+	position.GET("", controllers.GetAllPositions)                                         // Display all positions, ?department_id= to filter
+	position.GET("/:id", controllers.GetPosition)                                         // Display position by id
+	position.POST("", controllers.AddPosition, middlewares.RoleMiddleware("HR"))          // Add position to a department
+	position.PUT("/:id", controllers.UpdatePosition, middlewares.RoleMiddleware("HR"))    // Rename or move position
+	position.DELETE("/:id", controllers.DeletePosition, middlewares.RoleMiddleware("HR")) // Delete position no active employee holds
+}
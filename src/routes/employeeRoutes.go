@@ -9,9 +9,11 @@ import (
 func EmployeeRoutes(e *echo.Echo) {
 	protected := e.Group("/employee")
 	protected.Use(middlewares.JWTMiddleware())                   // Apply JWT middleware (protected route)
-	protected.GET("", controllers.GetAllEmployee)                // Display all employee info
-	protected.GET("/:id", controllers.GetEmployee)               //Display employee info by id
-	protected.POST("/add-employee", controllers.AddEmployee)     //Add employee info
-	protected.PUT("/update-employee", controllers.UpdateEmployee) //Update Employee info
-	protected.POST("/search-employee", controllers.SearchEmployee) // Seacrh employee by id,firstname,lastname
+	protected.GET("", controllers.GetAllEmployee, middlewares.Deprecated("/api/v1/employees"))                // Display all employee info
+	protected.GET("/export", controllers.ExportEmployees, middlewares.RoleMiddleware("HR")) // Download as ?format=csv|ndjson|xlsx, ?columns= and the search filters
+	protected.GET("/:id", controllers.GetEmployee, middlewares.Deprecated("/api/v1/employees/:id"))               //Display employee info by id
+	protected.POST("/add-employee", controllers.AddEmployee, middlewares.Deprecated("/api/v1/employees"))     //Add employee info
+	protected.PUT("/update-employee", controllers.UpdateEmployee, middlewares.Deprecated("/api/v1/employees")) //Update Employee info
+	protected.POST("/search-employee", controllers.SearchEmployee, middlewares.Deprecated("/api/v1/employees")) // Search employees by id, names, department, position, work status, salary / hire / resignation ranges, with sort
+	protected.POST("/:id/offboard", controllers.OffboardEmployee, middlewares.RoleMiddleware("HR")) // Resign employee, disable login and reassign appointments
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func EventRoutes(e *echo.Echo) {
+	protected := e.Group("/events")
+	protected.Use(middlewares.TokenFromQuery()) // EventSource cannot send headers, accept ?access_token=
+	protected.Use(middlewares.JWTMiddleware())  // Apply JWT middleware (protected route)
+
+	protected.GET("", controllers.StreamEvents) // Server-Sent Events, ?topics=queue:<department_id>,schedule:<employee_id>,lab-results:<patient_id>
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FhirRoutes is the HL7 FHIR R4 read API for partner systems: Patient, Practitioner, PractitionerRole, Appointment,
+// AllergyIntolerance and Condition, each with read (/:type/:id) and search (/:type?name=...) returning a Bundle
+func FhirRoutes(e *echo.Echo) {
+	e.GET("/fhir/R4/metadata", controllers.GetFhirMetadata) // CapabilityStatement, no token needed
+
+	protected := e.Group("/fhir/R4")
+	protected.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+	protected.Use(middlewares.RoleMiddleware("HR", "medical_personnel"))
+
+	protected.GET("/:type", controllers.SearchFhirResources)  // Search, e.g. /Patient?name=som&birthdate=ge1990
+	protected.GET("/:type/:id", controllers.ReadFhirResource) // Read, e.g. /Patient/P001
+}
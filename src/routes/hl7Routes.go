@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HL7Routes is the HTTP side of the HL7 v2 interface, the MLLP listener (HL7_MLLP_ADDR) takes the same messages
+func HL7Routes(e *echo.Echo) {
+	protected := e.Group("/hl7")
+	protected.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+	protected.Use(middlewares.RoleMiddleware("HR", "medical_personnel"))
+
+	protected.POST("/adt", controllers.ReceiveHL7Message)        // ADT^A01 / A04 / A08 in the body, answers with the ACK
+	protected.GET("/patient/:id/adt", controllers.GetPatientADT) // Patient as ADT^A08 (or ?event=A04), needs data_sharing consent
+}
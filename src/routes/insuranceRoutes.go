@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func InsuranceRoutes(e *echo.Echo) {
+	protected := e.Group("/insurer")
+	protected.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+
+	// The insurer list is maintained by HR
+	manage := middlewares.RoleMiddleware("HR")
+
+	protected.GET("", controllers.GetInsurers)               // Display all insurers
+	protected.POST("", controllers.AddInsurer, manage)       // Add insurer
+	protected.PUT("/:id", controllers.UpdateInsurer, manage) // Update insurer contact / deactivate insurer
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func LabRoutes(e *echo.Echo) {
+	protected := e.Group("/lab")
+	protected.Use(middlewares.JWTMiddleware()) // Apply JWT middleware (protected route)
+
+	// Ordering, collecting, resulting and verifying are done by medical personnel
+	staff := middlewares.RoleMiddleware("medical_personnel")
+
+	protected.GET("/test", controllers.GetLabTests)                          // Lab test catalog with components and reference ranges
+	protected.POST("/test", controllers.AddLabTest, staff)                   // Add lab test with its components
+	protected.POST("/order", controllers.AddLabOrder, staff)                 // Order a test for a patient
+	protected.GET("/order/:id", controllers.GetLabOrder)                     // Display lab order with results
+	protected.POST("/order/:id/collect", controllers.CollectLabOrder, staff) // ordered -> collected
+	protected.POST("/order/:id/results", controllers.EnterLabResults, staff) // collected/resulted -> resulted
+	protected.POST("/order/:id/verify", controllers.VerifyLabOrder, staff)   // resulted -> verified
+	protected.POST("/order/:id/cancel", controllers.CancelLabOrder, staff)   // ordered/collected -> cancelled
+}
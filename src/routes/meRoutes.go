@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func MeRoutes(e *echo.Echo) {
+	protected := e.Group("/me")
+	protected.Use(middlewares.JWTMiddleware())           // Apply JWT middleware (protected route)
+	protected.Use(middlewares.RoleMiddleware("patient")) // The signed in patient's own data
+
+	protected.GET("/export", controllers.ExportMyRecord) // Copy of the whole record as ?format=json|zip
+}
@@ -10,11 +10,32 @@ import (
 func PatientRoutes(e *echo.Echo) {
 	protected := e.Group("/patient")
 	protected.Use(middlewares.JWTMiddleware())                                    // Apply JWT middleware (protected route)
-	protected.GET("", controllers.GetAllPatients)                                 // Display all patient info
-	protected.GET("/:id", controllers.GetPatient)                                 // Select patient info by patient_id
-	protected.PUT("/update-patient", controllers.UpdatePatient)                   // Update Patient info
-	protected.POST("/add-patient", controllers.AddPatient)                        // Add patient info
+	protected.GET("", controllers.GetAllPatients, middlewares.Deprecated("/api/v1/patients"))                                 // Display all patient info
+	protected.GET("/export", controllers.ExportPatients, middlewares.RoleMiddleware("HR", "medical_personnel")) // Download as ?format=csv|ndjson|xlsx, ?columns= and the search filters
+	protected.GET("/:id", controllers.GetPatient, middlewares.Deprecated("/api/v1/patients/:id"))                                 // Select patient info by patient_id
+	protected.PUT("/update-patient", controllers.UpdatePatient, middlewares.Deprecated("/api/v1/patients"))                   // Update Patient info
+	protected.POST("/add-patient", controllers.AddPatient, middlewares.Deprecated("/api/v1/patients"))                        // Add patient info
 	protected.POST("/add-patient-history", controllers.AddPatientHistory)         // Add patient history
 	protected.POST("/add-patient-appointment", controllers.AddPatientAppointment) // Add patient appointment
-	protected.POST("/search-patient", controllers.SearchPatient) // Seacrh patient by id,firstname,lastname
+	protected.PUT("/appointment/:id", controllers.MoveAppointment)                // Move appointment to a new date / time, reminders follow
+	protected.POST("/appointment/:id/cancel", controllers.CancelAppointment)      // Cancel appointment and its pending reminders
+	protected.GET("/appointment/:id/reminders", controllers.GetAppointmentReminders) // Reminders with delivery status
+	protected.POST("/appointment/:id/check-in", controllers.CheckInAppointment, middlewares.RoleMiddleware("HR", "medical_personnel")) // Patient arrived, returns the department queue number
+	protected.POST("/search-patient", controllers.SearchPatient, middlewares.Deprecated("/api/v1/patients")) // Seacrh patient by id,firstname,lastname
+	protected.GET("/search", controllers.SearchPatientsRanked, middlewares.RoleMiddleware("HR", "medical_personnel")) // Ranked search, ?q= name / email / phone / id card / date of birth, typos tolerated
+	protected.GET("/:id/allergy-check", controllers.CheckDrugAllergy, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))             // Check ?drug_id= against the patient's drug and class allergies
+	protected.GET("/:id/observations", controllers.GetPatientObservations, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))        // Vital signs / measurements, ?type=&from=&to=&abnormal=true
+	protected.POST("/:id/observations", controllers.AddObservations, middlewares.RoleMiddleware("medical_personnel")) // Record vital signs / measurements
+	protected.GET("/:id/lab-orders", controllers.GetPatientLabOrders, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))            // Lab orders with results, ?status=
+	protected.GET("/:id/admissions", controllers.GetPatientAdmissions, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))           // Inpatient stays with bed history
+	protected.GET("/:id/prescriptions", controllers.GetPatientPrescriptions, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))     // Prescriptions newest first
+	protected.POST("/:id/prescriptions", controllers.AddPrescription, middlewares.RoleMiddleware("medical_personnel")) // Prescribe a drug (checked against allergies)
+	protected.GET("/:id/insurance", controllers.GetPatientPolicies, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))              // Insurance policies, primary first, with is_active for today
+	protected.POST("/:id/insurance", controllers.AddInsurancePolicy, middlewares.RoleMiddleware("HR", "medical_personnel")) // Add insurance policy
+	protected.PUT("/:id/insurance/:policy_id", controllers.UpdateInsurancePolicy, middlewares.RoleMiddleware("HR", "medical_personnel")) // Update plan / coverage / limit / validity
+	protected.GET("/:id/eligibility", controllers.CheckCoverageEligibility, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))      // Insurance coverage on ?date= (default today)
+	protected.GET("/:id/export", controllers.ExportPatientRecord, middlewares.RoleMiddleware("HR", "medical_personnel")) // Complete record as ?format=json|zip, logged in the access audit
+	protected.GET("/:id/consents", controllers.GetPatientConsents, middlewares.PatientSelfOrRoleMiddleware("HR", "medical_personnel"))               // Current decision per consent type, ?history=true for all
+	protected.POST("/:id/consents", controllers.RecordConsent, middlewares.RoleMiddleware("HR", "medical_personnel")) // Record consent granted / refused
+	protected.POST("/:id/consents/:consent_id/revoke", controllers.RevokeConsent, middlewares.RoleMiddleware("HR", "medical_personnel")) // Revoke consent
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func QueueRoutes(e *echo.Echo) {
+	protected := e.Group("/queue")
+	protected.Use(middlewares.JWTMiddleware())                           // Apply JWT middleware (protected route)
+	protected.Use(middlewares.RoleMiddleware("HR", "medical_personnel")) // The waiting room is run by staff
+
+	// Patients are called and seen by clinicians
+	clinician := middlewares.RoleMiddleware("medical_personnel")
+
+	protected.GET("/department/:id", controllers.GetDepartmentQueue)                    // Live waiting room with wait times, ?date=&all=true
+	protected.POST("/department/:id/call-next", controllers.CallNextPatient, clinician) // Call the next waiting patient
+	protected.POST("/checkin/:id/complete", controllers.CompleteCheckIn, clinician)     // Called patient has been seen
+	protected.POST("/checkin/:id/no-show", controllers.MarkCheckInNoShow, clinician)    // Patient did not answer the call or left
+}
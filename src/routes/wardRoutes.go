@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/NinePTH/GO_MVC-S/src/controllers"
+	"github.com/NinePTH/GO_MVC-S/src/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func WardRoutes(e *echo.Echo) {
+	ward := e.Group("/ward")
+	ward.Use(middlewares.JWTMiddleware())                                                                     // Apply JWT middleware (protected route)
+	ward.GET("", controllers.GetWards)                                                                        // Display wards with bed counts, ?department_id= to filter
+	ward.GET("/occupancy", controllers.GetBedOccupancy)                                                       // Bed occupancy per department, ?department_id= to filter
+	ward.POST("", controllers.AddWard, middlewares.RoleMiddleware("HR"))                                      // Add ward to a department
+	ward.GET("/:id/beds", controllers.GetWardBeds)                                                            // Display beds of a ward with current patients
+	ward.POST("/:id/beds", controllers.AddBed, middlewares.RoleMiddleware("HR"))                              // Add bed to a ward
+	ward.PUT("/bed/:id/status", controllers.UpdateBedStatus, middlewares.RoleMiddleware("medical_personnel")) // Set a free bed to available / cleaning / maintenance
+
+	admission := e.Group("/admission")
+	admission.Use(middlewares.JWTMiddleware(), middlewares.RoleMiddleware("medical_personnel")) // Apply JWT middleware (protected route), medical personnel only
+	admission.GET("", controllers.GetCurrentAdmissions)                                         // Current inpatients, ?ward_id= or ?department_id= to filter
+	admission.POST("", controllers.AdmitPatient)                                                // Admit patient into a free bed
+	admission.GET("/:id", controllers.GetAdmission)                                             // Display admission with bed history
+	admission.POST("/:id/transfer", controllers.TransferPatient)                                // Move patient to another free bed
+	admission.POST("/:id/discharge", controllers.DischargePatient)                              // Discharge patient and free the bed
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+var admissionFields = []string{
+	"admission_id",
+	"patient_id",
+	"(SELECT first_name || ' ' || last_name FROM Patient WHERE Patient.patient_id = Admission.patient_id) AS patient_name",
+	"admitted_by",
+	"reason",
+	"admitted_at",
+	"discharged_by",
+	"discharged_at",
+	"discharge_note",
+}
+
+// lockAvailableBed locks the bed row, so two requests for the same bed are served one after the other, and checks it is free
+func lockAvailableBed(tx *sql.Tx, bedID int64) error {
+	bed, err := SelectDataTx(tx, "Bed", []string{"status"}, true, "bed_id = $1", []interface{}{bedID}, false, "", "", "FOR UPDATE")
+	if err != nil {
+		return err
+	}
+	if len(bed) == 0 {
+		return fmt.Errorf("bed not found")
+	}
+	if stringOrEmpty(bed[0]["status"]) != "available" {
+		return fmt.Errorf("bed is not available")
+	}
+	return nil
+}
+
+// assignBedTx opens a bed assignment and marks the bed occupied
+func assignBedTx(tx *sql.Tx, admissionID int64, bedID int64, employeeID string, reason string, at time.Time) error {
+	_, err := InsertDataTx(tx, "Bed_assignment", map[string]interface{}{
+		"admission_id": admissionID,
+		"bed_id":       bedID,
+		"assigned_by":  employeeID,
+		"assigned_at":  at,
+		"reason":       nullIfEmpty(reason),
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("bed is not available")
+		}
+		return fmt.Errorf("insert bed assignment failed: %w", err)
+	}
+
+	_, err = UpdateDataTx(tx, "Bed", map[string]interface{}{"status": "occupied"}, "bed_id = $1", []interface{}{bedID})
+	return err
+}
+
+// releaseBedTx closes the current bed assignment of an admission, the bed goes to cleaning before it can be used again
+func releaseBedTx(tx *sql.Tx, admissionID int64, at time.Time) error {
+	current, err := SelectDataTx(tx, "Bed_assignment", []string{"bed_assignment_id", "bed_id"}, true, "admission_id = $1 AND released_at IS NULL", []interface{}{admissionID}, false, "", "", "FOR UPDATE")
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return nil
+	}
+
+	_, err = UpdateDataTx(tx, "Bed_assignment", map[string]interface{}{"released_at": at}, "bed_assignment_id = $1", []interface{}{current[0]["bed_assignment_id"]})
+	if err != nil {
+		return err
+	}
+	_, err = UpdateDataTx(tx, "Bed", map[string]interface{}{"status": "cleaning"}, "bed_id = $1", []interface{}{current[0]["bed_id"]})
+	return err
+}
+
+// lockOpenAdmission locks an admission that has not been discharged yet
+func lockOpenAdmission(tx *sql.Tx, admissionID int64) (int64, error) {
+	admission, err := SelectDataTx(tx, "Admission", []string{"admission_id", "discharged_at"}, true, "admission_id = $1", []interface{}{admissionID}, false, "", "", "FOR UPDATE")
+	if err != nil {
+		return 0, err
+	}
+	if len(admission) == 0 {
+		return 0, fmt.Errorf("admission not found")
+	}
+	if admission[0]["discharged_at"] != nil {
+		return 0, fmt.Errorf("patient has already been discharged")
+	}
+	return admission[0]["admission_id"].(int64), nil
+}
+
+// AdmitPatient admits a patient into a free bed and returns the admission id. The patient row and the bed row are
+// locked in that order, and the partial unique indexes on Admission/Bed_assignment back this up at the database level
+func AdmitPatient(req patients.AdmitPatientRequest) (int64, error) {
+	if err := checkActiveEmployee(req.Admitted_by); err != nil {
+		return 0, err
+	}
+
+	var admissionID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		patient, err := SelectDataTx(tx, "Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{req.Patient_id}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(patient) == 0 {
+			return fmt.Errorf("Patient not found")
+		}
+
+		open, err := SelectDataTx(tx, "Admission", []string{"admission_id"}, true, "patient_id = $1 AND discharged_at IS NULL", []interface{}{req.Patient_id}, false, "", "", "")
+		if err != nil {
+			return err
+		}
+		if len(open) > 0 {
+			return fmt.Errorf("patient is already admitted")
+		}
+
+		if err := lockAvailableBed(tx, req.Bed_id); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		id, err := InsertDataReturningTx(tx, "Admission", map[string]interface{}{
+			"patient_id":  req.Patient_id,
+			"admitted_by": req.Admitted_by,
+			"reason":      req.Reason,
+			"admitted_at": now,
+		}, "admission_id")
+		if err != nil {
+			if isUniqueViolation(err) {
+				return fmt.Errorf("patient is already admitted")
+			}
+			return fmt.Errorf("insert admission failed: %w", err)
+		}
+		admissionID = id.(int64)
+
+		return assignBedTx(tx, admissionID, req.Bed_id, req.Admitted_by, "", now)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return admissionID, nil
+}
+
+// TransferPatient moves an admitted patient to another free bed
+func TransferPatient(admissionID int64, req patients.TransferPatientRequest) error {
+	if err := checkActiveEmployee(req.Employee_id); err != nil {
+		return err
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		id, err := lockOpenAdmission(tx, admissionID)
+		if err != nil {
+			return err
+		}
+
+		if err := lockAvailableBed(tx, req.Bed_id); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := releaseBedTx(tx, id, now); err != nil {
+			return err
+		}
+		return assignBedTx(tx, id, req.Bed_id, req.Employee_id, req.Reason, now)
+	})
+}
+
+// DischargePatient ends the admission and frees the bed
+func DischargePatient(admissionID int64, req patients.DischargePatientRequest) error {
+	if err := checkActiveEmployee(req.Employee_id); err != nil {
+		return err
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		id, err := lockOpenAdmission(tx, admissionID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := releaseBedTx(tx, id, now); err != nil {
+			return err
+		}
+
+		_, err = UpdateDataTx(tx, "Admission", map[string]interface{}{
+			"discharged_by":  req.Employee_id,
+			"discharged_at":  now,
+			"discharge_note": nullIfEmpty(req.Discharge_note),
+		}, "admission_id = $1", []interface{}{id})
+		return err
+	})
+}
+
+func GetAdmission(admissionID int64) (*patients.Admission, error) {
+	admissions, err := getAdmissions("admission_id = $1", []interface{}{admissionID})
+	if err != nil {
+		return nil, err
+	}
+	if len(admissions) == 0 {
+		return nil, fmt.Errorf("admission not found")
+	}
+	return &admissions[0], nil
+}
+
+// GetCurrentAdmissions lists patients who are in hospital now, optionally only those in one ward or department
+func GetCurrentAdmissions(wardID string, departmentID string) ([]patients.Admission, error) {
+	whereCon := "discharged_at IS NULL"
+	var args []interface{}
+	if wardID != "" {
+		args = append(args, wardID)
+		whereCon += fmt.Sprintf(" AND admission_id IN (SELECT ba.admission_id FROM Bed_assignment ba JOIN Bed b ON ba.bed_id = b.bed_id WHERE ba.released_at IS NULL AND b.ward_id = $%d)", len(args))
+	}
+	if departmentID != "" {
+		args = append(args, departmentID)
+		whereCon += fmt.Sprintf(" AND admission_id IN (SELECT ba.admission_id FROM Bed_assignment ba JOIN Bed b ON ba.bed_id = b.bed_id JOIN Ward w ON b.ward_id = w.ward_id WHERE ba.released_at IS NULL AND w.department_id = $%d)", len(args))
+	}
+	return getAdmissions(whereCon, args)
+}
+
+// GetPatientAdmissions returns every admission of a patient newest first
+func GetPatientAdmissions(patientID string) ([]patients.Admission, error) {
+	patient, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(patient) == 0 {
+		return nil, fmt.Errorf("Patient not found")
+	}
+	return getAdmissions("patient_id = $1", []interface{}{patientID})
+}
+
+func getAdmissions(whereCon string, args []interface{}) ([]patients.Admission, error) {
+	results, err := SelectData("Admission", admissionFields, true, whereCon, args, false, "", "", "ORDER BY admitted_at DESC, admission_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, row := range results {
+		ids = append(ids, row["admission_id"].(int64))
+	}
+	history, err := getBedAssignments(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	admissions := []patients.Admission{}
+	for _, row := range results {
+		admission := patients.Admission{
+			Admission_id:   row["admission_id"].(int64),
+			Patient_id:     row["patient_id"].(string),
+			Patient_name:   stringOrEmpty(row["patient_name"]),
+			Status:         "admitted",
+			Admitted_by:    row["admitted_by"].(string),
+			Reason:         row["reason"].(string),
+			Admitted_at:    timeOrEmpty(row["admitted_at"]),
+			Discharged_by:  stringOrEmpty(row["discharged_by"]),
+			Discharged_at:  timeOrEmpty(row["discharged_at"]),
+			Discharge_note: stringOrEmpty(row["discharge_note"]),
+			Bed_history:    history[row["admission_id"].(int64)],
+		}
+		if admission.Discharged_at != "" {
+			admission.Status = "discharged"
+		}
+		if admission.Bed_history == nil {
+			admission.Bed_history = []patients.BedAssignment{}
+		}
+		for i := range admission.Bed_history {
+			if admission.Bed_history[i].Released_at == "" {
+				admission.Current_bed = &admission.Bed_history[i]
+			}
+		}
+		admissions = append(admissions, admission)
+	}
+
+	return admissions, nil
+}
+
+// getBedAssignments loads the bed history of the given admissions keyed by admission id, oldest first
+func getBedAssignments(admissionIDs []int64) (map[int64][]patients.BedAssignment, error) {
+	history := map[int64][]patients.BedAssignment{}
+	if len(admissionIDs) == 0 {
+		return history, nil
+	}
+
+	fields := []string{
+		"Bed_assignment.admission_id",
+		"Bed.bed_id",
+		"Bed.ward_id",
+		"Ward.ward_name",
+		"Bed.bed_number",
+		"Bed_assignment.assigned_by",
+		"Bed_assignment.assigned_at",
+		"Bed_assignment.released_at",
+		"Bed_assignment.reason",
+	}
+	results, err := SelectData(
+		"Bed_assignment",
+		fields,
+		true,
+		"Bed_assignment.admission_id = ANY($1)",
+		[]interface{}{pq.Array(admissionIDs)},
+		true,
+		"Bed ON Bed_assignment.bed_id = Bed.bed_id JOIN Ward ON Bed.ward_id = Ward.ward_id",
+		"",
+		"ORDER BY Bed_assignment.assigned_at, Bed_assignment.bed_assignment_id")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range results {
+		admissionID := row["admission_id"].(int64)
+		history[admissionID] = append(history[admissionID], patients.BedAssignment{
+			Bed_id:      row["bed_id"].(int64),
+			Ward_id:     row["ward_id"].(string),
+			Ward_name:   row["ward_name"].(string),
+			Bed_number:  row["bed_number"].(string),
+			Assigned_by: row["assigned_by"].(string),
+			Assigned_at: timeOrEmpty(row["assigned_at"]),
+			Released_at: timeOrEmpty(row["released_at"]),
+			Reason:      stringOrEmpty(row["reason"]),
+		})
+	}
+
+	return history, nil
+}
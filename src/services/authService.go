@@ -112,7 +112,7 @@ func RegisterUser(username string, password string, role string, id string) (int
 }
 
 func AuthenticateUser(username string, password string) (*auth.Token, error) {
-	fields := []string{"user_id", "username", "password", "role"}
+	fields := []string{"user_id", "username", "password", "role", "is_active"}
 	whereCondition := "username =$1"
 	whereArgs := []interface{}{username}
 
@@ -134,15 +134,37 @@ func AuthenticateUser(username string, password string) (*auth.Token, error) {
 		return nil, errors.New("Invalid password")
 	}
 
+	if !user["is_active"].(bool) {
+		return nil, errors.New("Account is disabled")
+	}
+
+	// Employees who resigned or are no longer working cannot log in even if their account was never disabled
+	if role == "HR" || role == "medical_personnel" {
+		fields := []string{"work_status"}
+		employeeQueryResult, err := SelectData("Employee", fields, true, "user_id = $1", []interface{}{userId}, false, "", "", "")
+		if err != nil {
+			return nil, err
+		}
+
+		if len(employeeQueryResult) == 0 || string(employeeQueryResult[0]["work_status"].([]uint8)) != "yes" {
+			return nil, errors.New("Employee is no longer active")
+		}
+	}
+
 	if role == "patient" {
 		fields := []string{"patient_id"}
-		whereCondition = "user_id = $1"
+		whereCondition = "user_id = $1 AND " + patientNotDeleted
 		whereArgs = []interface{}{userId}
 		patientQueryResult, err := SelectData("Patient", fields, true, whereCondition, whereArgs, false, "", "","")
 		if err != nil {
 			return nil, err
 		}
 
+		// The patient record was deleted (or never linked to this account)
+		if len(patientQueryResult) == 0 {
+			return nil, errors.New("Patient record is no longer active")
+		}
+
 		patientId := patientQueryResult[0]["patient_id"].(string)
 
 		generateJWTParam := auth.GenerateJWTClaimsParams{
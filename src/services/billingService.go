@@ -0,0 +1,710 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/billing"
+)
+
+// Money is handled in cents (int64) so the insurance split and balances add up exactly,
+// NUMERIC columns are read and written as decimal strings
+
+// centsFromNumeric converts a NUMERIC column (returned as []byte by lib/pq) to cents, NULL becomes 0
+func centsFromNumeric(value interface{}) int64 {
+	raw, ok := value.([]byte)
+	if !ok {
+		return 0
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(f * 100))
+}
+
+func centsFromFloat(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func centsToNumeric(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func centsToFloat(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// insuranceShare is the part of amount the insurer pays, coverage is in hundredths of a percent (8000 = 80%)
+func insuranceShare(amount int64, coverage int64) int64 {
+	return (amount*coverage + 5000) / 10000
+}
+
+// splitInsurance is the insurer share of each invoice line: a line is covered at the lower of its price list coverage
+// and the policy coverage, and when the policy has an annual limit the shares stop at what is left of it (remaining)
+func splitInsurance(amounts []int64, coverages []int64, policyCoverage int64, limited bool, remaining int64) []int64 {
+	shares := make([]int64, len(amounts))
+	for i, amount := range amounts {
+		coverage := coverages[i]
+		if policyCoverage < coverage {
+			coverage = policyCoverage
+		}
+		shares[i] = insuranceShare(amount, coverage)
+		if limited {
+			if shares[i] > remaining {
+				shares[i] = remaining
+			}
+			remaining -= shares[i]
+		}
+	}
+	return shares
+}
+
+// chargeSource describes a kind of record charges are generated from. The query returns the records of a patient
+// that have no charge yet, with source_id, item_code, description, quantity and service_at columns
+type chargeSource struct {
+	sourceType string
+	itemType   string
+	table      string
+	fields     []string
+	whereCon   string
+}
+
+var chargeSources = []chargeSource{
+	{
+		// Appointments are charged once their date has come, unless cancelled
+		sourceType: "appointment",
+		itemType:   "appointment",
+		table:      "Patient_Appointment",
+		fields:     []string{"appointment_id AS source_id", "'' AS item_code", "'Appointment ' || to_char(date, 'YYYY-MM-DD') || ': ' || topic AS description", "1 AS quantity", "(date + time) AS service_at"},
+		whereCon:   "patient_id = $1 AND date <= CURRENT_DATE AND cancelled_at IS NULL AND NOT EXISTS (SELECT 1 FROM Charge WHERE Charge.source_type = 'appointment' AND Charge.source_id = Patient_Appointment.appointment_id)",
+	},
+	{
+		sourceType: "encounter",
+		itemType:   "encounter",
+		table:      "Medical_history",
+		fields:     []string{"medical_history_id AS source_id", "'' AS item_code", "'Consultation ' || to_char(date, 'YYYY-MM-DD') AS description", "1 AS quantity", "(date + time) AS service_at"},
+		whereCon:   "patient_id = $1 AND NOT EXISTS (SELECT 1 FROM Charge WHERE Charge.source_type = 'encounter' AND Charge.source_id = Medical_history.medical_history_id)",
+	},
+	{
+		// Lab tests are charged once the specimen has been collected, cancelled orders never are
+		sourceType: "lab_order",
+		itemType:   "lab_test",
+		table:      "Lab_order",
+		fields:     []string{"lab_order_id AS source_id", "lab_test_id AS item_code", "'Lab test: ' || (SELECT test_name FROM Lab_test WHERE Lab_test.lab_test_id = Lab_order.lab_test_id) AS description", "1 AS quantity", "collected_at AS service_at"},
+		whereCon:   "patient_id = $1 AND status IN ('collected', 'resulted', 'verified') AND NOT EXISTS (SELECT 1 FROM Charge WHERE Charge.source_type = 'lab_order' AND Charge.source_id = Lab_order.lab_order_id)",
+	},
+	{
+		sourceType: "prescription",
+		itemType:   "drug",
+		table:      "Prescription",
+		fields:     []string{"prescription_id AS source_id", "drug_id AS item_code", "'Medication: ' || (SELECT drug_name FROM drug WHERE drug.drug_id = Prescription.drug_id) AS description", "quantity", "prescribed_at AS service_at"},
+		whereCon:   "patient_id = $1 AND NOT EXISTS (SELECT 1 FROM Charge WHERE Charge.source_type = 'prescription' AND Charge.source_id = Prescription.prescription_id)",
+	},
+}
+
+var chargeFields = []string{
+	"charge_id", "patient_id", "item_type", "item_code", "source_type", "source_id", "description", "quantity",
+	"unit_price", "amount", "insurance_coverage", "charged_at", "invoice_id", "insurance_amount", "patient_amount",
+}
+
+func GetServicePrices() ([]billing.ServicePrice, error) {
+	fields := []string{"price_id", "item_type", "item_code", "description", "unit_price", "insurance_coverage"}
+	results, err := SelectData("Service_price", fields, false, "", nil, false, "", "", "ORDER BY item_type, item_code")
+	if err != nil {
+		return nil, err
+	}
+
+	prices := []billing.ServicePrice{}
+	for _, row := range results {
+		prices = append(prices, billing.ServicePrice{
+			Price_id:           row["price_id"].(int64),
+			Item_type:          stringOrEmpty(row["item_type"]),
+			Item_code:          row["item_code"].(string),
+			Description:        row["description"].(string),
+			Unit_price:         centsToFloat(centsFromNumeric(row["unit_price"])),
+			Insurance_coverage: centsToFloat(centsFromNumeric(row["insurance_coverage"])),
+		})
+	}
+
+	return prices, nil
+}
+
+func AddServicePrice(req billing.ServicePrice) (int64, error) {
+	id, err := InsertDataReturning("Service_price", map[string]interface{}{
+		"item_type":          req.Item_type,
+		"item_code":          req.Item_code,
+		"description":        req.Description,
+		"unit_price":         centsToNumeric(centsFromFloat(req.Unit_price)),
+		"insurance_coverage": centsToNumeric(centsFromFloat(req.Insurance_coverage)),
+	}, "price_id")
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("price already exists for this item")
+		}
+		return 0, err
+	}
+	return id.(int64), nil
+}
+
+// UpdateServicePrice changes a price list entry, charges already captured keep the price they were captured with
+func UpdateServicePrice(priceID int64, data map[string]interface{}) (int64, error) {
+	return UpdateData("Service_price", data, "price_id = $1", []interface{}{priceID})
+}
+
+// findServicePrice returns the price of an item, falling back to the default price of its type. nil when neither exists
+func findServicePrice(itemType string, itemCode string) (map[string]interface{}, error) {
+	results, err := SelectData("Service_price", []string{"unit_price", "insurance_coverage"}, true, "item_type = $1 AND item_code IN ($2, '')", []interface{}{itemType, itemCode}, false, "", "", "ORDER BY item_code DESC LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+func insertCharge(patientID string, itemType string, itemCode string, sourceType string, sourceID interface{}, description string, quantity int, unitPrice int64, coverage int64, chargedAt interface{}) (int64, error) {
+	data := map[string]interface{}{
+		"patient_id":         patientID,
+		"item_type":          itemType,
+		"item_code":          itemCode,
+		"source_type":        sourceType,
+		"source_id":          sourceID,
+		"description":        description,
+		"quantity":           quantity,
+		"unit_price":         centsToNumeric(unitPrice),
+		"amount":             centsToNumeric(unitPrice * int64(quantity)),
+		"insurance_coverage": centsToNumeric(coverage),
+	}
+	if chargedAt != nil {
+		data["charged_at"] = chargedAt
+	}
+
+	id, err := InsertDataReturning("Charge", data, "charge_id")
+	if err != nil {
+		return 0, err
+	}
+	return id.(int64), nil
+}
+
+// GenerateCharges captures a charge for every appointment, encounter, collected lab order and prescription of the patient
+// that has not been charged yet. Running it twice does not charge anything twice (Charge has UNIQUE (source_type, source_id))
+func GenerateCharges(patientID string) (*billing.GenerateChargesResponse, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	var createdIDs []int64
+	response := &billing.GenerateChargesResponse{Created: []billing.Charge{}, Skipped: []billing.SkippedSource{}}
+	for _, source := range chargeSources {
+		results, err := SelectData(source.table, source.fields, true, source.whereCon, []interface{}{patientID}, false, "", "", "ORDER BY source_id")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range results {
+			sourceID := row["source_id"].(int64)
+			itemCode := stringOrEmpty(row["item_code"])
+
+			price, err := findServicePrice(source.itemType, itemCode)
+			if err != nil {
+				return nil, err
+			}
+			if price == nil {
+				response.Skipped = append(response.Skipped, billing.SkippedSource{
+					Source_type: source.sourceType,
+					Source_id:   sourceID,
+					Reason:      fmt.Sprintf("no price for %s %s", source.itemType, itemCode),
+				})
+				continue
+			}
+
+			id, err := insertCharge(patientID, source.itemType, itemCode, source.sourceType, sourceID, stringOrEmpty(row["description"]), int(row["quantity"].(int64)),
+				centsFromNumeric(price["unit_price"]), centsFromNumeric(price["insurance_coverage"]), row["service_at"])
+			if err != nil {
+				// Another request charged the same record in the meantime
+				if isUniqueViolation(err) {
+					continue
+				}
+				return nil, fmt.Errorf("insert charge failed: %w", err)
+			}
+			createdIDs = append(createdIDs, id)
+		}
+	}
+
+	if len(createdIDs) > 0 {
+		created, err := getCharges("charge_id = ANY($1)", []interface{}{pq.Array(createdIDs)})
+		if err != nil {
+			return nil, err
+		}
+		response.Created = created
+	}
+
+	return response, nil
+}
+
+// AddManualCharge captures a charge that is not tied to a clinical record
+func AddManualCharge(patientID string, req billing.AddChargeRequest) (*billing.Charge, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	price, err := findServicePrice(req.Item_type, req.Item_code)
+	if err != nil {
+		return nil, err
+	}
+
+	var unitPrice, coverage int64
+	if price != nil {
+		unitPrice = centsFromNumeric(price["unit_price"])
+		coverage = centsFromNumeric(price["insurance_coverage"])
+	}
+	if req.Unit_price != nil {
+		unitPrice = centsFromFloat(*req.Unit_price)
+	} else if price == nil {
+		return nil, fmt.Errorf("no price for this item")
+	}
+
+	id, err := insertCharge(patientID, req.Item_type, req.Item_code, "manual", nil, req.Description, req.Quantity, unitPrice, coverage, nil)
+	if err != nil {
+		return nil, fmt.Errorf("insert charge failed: %w", err)
+	}
+
+	charges, err := getCharges("charge_id = $1", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	return &charges[0], nil
+}
+
+// GetPatientCharges returns the charges of a patient oldest first, unbilledOnly leaves out invoiced charges
+func GetPatientCharges(patientID string, unbilledOnly bool) ([]billing.Charge, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	whereCon := "patient_id = $1"
+	if unbilledOnly {
+		whereCon += " AND invoice_id IS NULL"
+	}
+	return getCharges(whereCon, []interface{}{patientID})
+}
+
+func getCharges(whereCon string, args []interface{}) ([]billing.Charge, error) {
+	results, err := SelectData("Charge", chargeFields, true, whereCon, args, false, "", "", "ORDER BY charged_at, charge_id")
+	if err != nil {
+		return nil, err
+	}
+
+	charges := []billing.Charge{}
+	for _, row := range results {
+		charge := billing.Charge{
+			Charge_id:          row["charge_id"].(int64),
+			Patient_id:         row["patient_id"].(string),
+			Item_type:          stringOrEmpty(row["item_type"]),
+			Item_code:          row["item_code"].(string),
+			Source_type:        row["source_type"].(string),
+			Description:        row["description"].(string),
+			Quantity:           int(row["quantity"].(int64)),
+			Unit_price:         centsToFloat(centsFromNumeric(row["unit_price"])),
+			Amount:             centsToFloat(centsFromNumeric(row["amount"])),
+			Insurance_coverage: centsToFloat(centsFromNumeric(row["insurance_coverage"])),
+			Charged_at:         timeOrEmpty(row["charged_at"]),
+		}
+		if sourceID, ok := row["source_id"].(int64); ok {
+			charge.Source_id = &sourceID
+		}
+		if invoiceID, ok := row["invoice_id"].(int64); ok {
+			charge.Invoice_id = &invoiceID
+			insuranceAmount := centsToFloat(centsFromNumeric(row["insurance_amount"]))
+			patientAmount := centsToFloat(centsFromNumeric(row["patient_amount"]))
+			charge.Insurance_amount = &insuranceAmount
+			charge.Patient_amount = &patientAmount
+		}
+		charges = append(charges, charge)
+	}
+
+	return charges, nil
+}
+
+// CreateInvoice puts every unbilled charge of the patient on a new invoice and splits each line between insurer and patient.
+// The insurer share is claimed on the primary policy valid today: each line is covered at the lower of the price list
+// coverage and the policy coverage, and the total stops at what is left of the policy's annual limit.
+// The patient row is locked so two invoices cannot pick up the same charges (nor both use up the same annual limit)
+func CreateInvoice(patientID string, req billing.CreateInvoiceRequest) (*billing.Invoice, error) {
+	if err := checkActiveEmployee(req.Issued_by); err != nil {
+		return nil, err
+	}
+
+	var invoiceID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		patient, err := SelectDataTx(tx, "Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(patient) == 0 {
+			return fmt.Errorf("Patient not found")
+		}
+
+		charges, err := SelectDataTx(tx, "Charge", []string{"charge_id", "amount", "insurance_coverage"}, true, "patient_id = $1 AND invoice_id IS NULL", []interface{}{patientID}, false, "", "", "ORDER BY charge_id FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(charges) == 0 {
+			return fmt.Errorf("no unbilled charges")
+		}
+
+		policies, err := getActivePoliciesTx(tx, patientID, time.Now().Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+		insured := len(policies) > 0
+
+		var policyID interface{}
+		var policyCoverage, remaining int64
+		var limited bool
+		if insured {
+			policyID = policies[0].Policy_id
+			policyCoverage = centsFromFloat(policies[0].Coverage_percent)
+			remaining, limited, err = policyLimitRemainingTx(tx, policies[0])
+			if err != nil {
+				return err
+			}
+		}
+
+		amounts := make([]int64, len(charges))
+		coverages := make([]int64, len(charges))
+		var total int64
+		for i, charge := range charges {
+			amounts[i] = centsFromNumeric(charge["amount"])
+			coverages[i] = centsFromNumeric(charge["insurance_coverage"])
+			total += amounts[i]
+		}
+		var insuranceShares []int64
+		if insured {
+			insuranceShares = splitInsurance(amounts, coverages, policyCoverage, limited, remaining)
+		} else {
+			insuranceShares = make([]int64, len(charges))
+		}
+		var insuranceTotal int64
+		for _, share := range insuranceShares {
+			insuranceTotal += share
+		}
+
+		claimStatus := "not_applicable"
+		if insuranceTotal > 0 {
+			claimStatus = "pending"
+		}
+
+		id, err := InsertDataReturningTx(tx, "Invoice", map[string]interface{}{
+			"patient_id":       patientID,
+			"issued_by":        req.Issued_by,
+			"insured":          insured,
+			"policy_id":        policyID,
+			"total_amount":     centsToNumeric(total),
+			"insurance_amount": centsToNumeric(insuranceTotal),
+			"patient_amount":   centsToNumeric(total - insuranceTotal),
+			"claim_status":     claimStatus,
+		}, "invoice_id")
+		if err != nil {
+			return fmt.Errorf("insert invoice failed: %w", err)
+		}
+		invoiceID = id.(int64)
+
+		for i, charge := range charges {
+			_, err := UpdateDataTx(tx, "Charge", map[string]interface{}{
+				"invoice_id":       invoiceID,
+				"insurance_amount": centsToNumeric(insuranceShares[i]),
+				"patient_amount":   centsToNumeric(amounts[i] - insuranceShares[i]),
+			}, "charge_id = $1", []interface{}{charge["charge_id"]})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetInvoice(invoiceID)
+}
+
+var invoiceFields = []string{
+	"invoice_id",
+	"patient_id",
+	"(SELECT first_name || ' ' || last_name FROM Patient WHERE Patient.patient_id = Invoice.patient_id) AS patient_name",
+	"issued_by",
+	"issued_at",
+	"insured",
+	"policy_id",
+	"total_amount",
+	"insurance_amount",
+	"patient_amount",
+	"claim_status",
+	"voided_at",
+	"(SELECT COALESCE(SUM(amount), 0) FROM Payment WHERE Payment.invoice_id = Invoice.invoice_id AND payer = 'patient') AS patient_paid",
+	"(SELECT COALESCE(SUM(amount), 0) FROM Payment WHERE Payment.invoice_id = Invoice.invoice_id AND payer = 'insurer') AS insurer_paid",
+}
+
+// invoiceBalances works out what is still owed by each payer. A rejected claim moves the insurance share to the patient
+func invoiceBalances(row map[string]interface{}) (patientBalance int64, insurerBalance int64) {
+	insuranceAmount := centsFromNumeric(row["insurance_amount"])
+	patientDue := centsFromNumeric(row["patient_amount"])
+	insurerDue := insuranceAmount
+	if stringOrEmpty(row["claim_status"]) == "rejected" {
+		patientDue += insuranceAmount - centsFromNumeric(row["insurer_paid"])
+		insurerDue = centsFromNumeric(row["insurer_paid"])
+	}
+	return patientDue - centsFromNumeric(row["patient_paid"]), insurerDue - centsFromNumeric(row["insurer_paid"])
+}
+
+func invoiceFromRow(row map[string]interface{}) billing.Invoice {
+	patientBalance, insurerBalance := invoiceBalances(row)
+	invoice := billing.Invoice{
+		Invoice_id:       row["invoice_id"].(int64),
+		Patient_id:       row["patient_id"].(string),
+		Patient_name:     stringOrEmpty(row["patient_name"]),
+		Issued_by:        row["issued_by"].(string),
+		Issued_at:        timeOrEmpty(row["issued_at"]),
+		Insured:          row["insured"].(bool),
+		Total_amount:     centsToFloat(centsFromNumeric(row["total_amount"])),
+		Insurance_amount: centsToFloat(centsFromNumeric(row["insurance_amount"])),
+		Patient_amount:   centsToFloat(centsFromNumeric(row["patient_amount"])),
+		Claim_status:     stringOrEmpty(row["claim_status"]),
+		Patient_paid:     centsToFloat(centsFromNumeric(row["patient_paid"])),
+		Insurer_paid:     centsToFloat(centsFromNumeric(row["insurer_paid"])),
+		Patient_balance:  centsToFloat(patientBalance),
+		Insurer_balance:  centsToFloat(insurerBalance),
+		Voided_at:        timeOrEmpty(row["voided_at"]),
+	}
+	if policyID, ok := row["policy_id"].(int64); ok {
+		invoice.Policy_id = &policyID
+	}
+
+	switch {
+	case invoice.Voided_at != "":
+		invoice.Status = "void"
+	case patientBalance+insurerBalance <= 0:
+		invoice.Status = "paid"
+	case invoice.Patient_paid > 0 || invoice.Insurer_paid > 0:
+		invoice.Status = "partially_paid"
+	default:
+		invoice.Status = "unpaid"
+	}
+
+	return invoice
+}
+
+// GetInvoice returns an invoice with its line items and payments
+func GetInvoice(invoiceID int64) (*billing.Invoice, error) {
+	results, err := SelectData("Invoice", invoiceFields, true, "invoice_id = $1", []interface{}{invoiceID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("invoice not found")
+	}
+
+	invoice := invoiceFromRow(results[0])
+
+	invoice.Lines, err = getCharges("invoice_id = $1", []interface{}{invoice.Invoice_id})
+	if err != nil {
+		return nil, err
+	}
+
+	paymentResults, err := SelectData("Payment", []string{"payment_id", "payer", "amount", "method", "reference", "paid_at", "received_by"}, true, "invoice_id = $1", []interface{}{invoice.Invoice_id}, false, "", "", "ORDER BY paid_at, payment_id")
+	if err != nil {
+		return nil, err
+	}
+	invoice.Payments = []billing.Payment{}
+	for _, row := range paymentResults {
+		invoice.Payments = append(invoice.Payments, billing.Payment{
+			Payment_id:  row["payment_id"].(int64),
+			Payer:       stringOrEmpty(row["payer"]),
+			Amount:      centsToFloat(centsFromNumeric(row["amount"])),
+			Method:      row["method"].(string),
+			Reference:   stringOrEmpty(row["reference"]),
+			Paid_at:     timeOrEmpty(row["paid_at"]),
+			Received_by: stringOrEmpty(row["received_by"]),
+		})
+	}
+
+	return &invoice, nil
+}
+
+// GetPatientInvoices lists the invoices of a patient newest first, without line items
+func GetPatientInvoices(patientID string) ([]billing.Invoice, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	results, err := SelectData("Invoice", invoiceFields, true, "patient_id = $1", []interface{}{patientID}, false, "", "", "ORDER BY issued_at DESC, invoice_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	invoices := []billing.Invoice{}
+	for _, row := range results {
+		invoices = append(invoices, invoiceFromRow(row))
+	}
+	return invoices, nil
+}
+
+// lockInvoice locks the invoice row and returns it with the payment totals. The totals are read by a second statement
+// after the lock is held, so they include payments committed by a request that held the lock before us
+func lockInvoice(tx *sql.Tx, invoiceID int64) (map[string]interface{}, error) {
+	locked, err := SelectDataTx(tx, "Invoice", []string{"invoice_id"}, true, "invoice_id = $1", []interface{}{invoiceID}, false, "", "", "FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if len(locked) == 0 {
+		return nil, fmt.Errorf("invoice not found")
+	}
+
+	results, err := SelectDataTx(tx, "Invoice", invoiceFields, true, "invoice_id = $1", []interface{}{locked[0]["invoice_id"]}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if results[0]["voided_at"] != nil {
+		return nil, fmt.Errorf("invoice is void")
+	}
+	return results[0], nil
+}
+
+// AddPayment records a payment by the patient or the insurer, a payment cannot exceed what that payer still owes
+func AddPayment(invoiceID int64, req billing.AddPaymentRequest) error {
+	if req.Received_by != "" {
+		if err := checkActiveEmployee(req.Received_by); err != nil {
+			return err
+		}
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		invoice, err := lockInvoice(tx, invoiceID)
+		if err != nil {
+			return err
+		}
+
+		claimStatus := stringOrEmpty(invoice["claim_status"])
+		if req.Payer == "insurer" && (claimStatus == "not_applicable" || claimStatus == "rejected") {
+			return fmt.Errorf("invoice has no open insurance claim")
+		}
+
+		patientBalance, insurerBalance := invoiceBalances(invoice)
+		balance := patientBalance
+		if req.Payer == "insurer" {
+			balance = insurerBalance
+		}
+		amount := centsFromFloat(req.Amount)
+		if amount > balance {
+			return fmt.Errorf("payment exceeds the outstanding balance")
+		}
+
+		_, err = InsertDataTx(tx, "Payment", map[string]interface{}{
+			"invoice_id":  invoice["invoice_id"],
+			"payer":       req.Payer,
+			"amount":      centsToNumeric(amount),
+			"method":      req.Method,
+			"reference":   nullIfEmpty(req.Reference),
+			"received_by": nullIfEmpty(req.Received_by),
+		})
+		if err != nil {
+			return fmt.Errorf("insert payment failed: %w", err)
+		}
+
+		// A payment from the insurer means the claim was accepted
+		if req.Payer == "insurer" && claimStatus != "approved" {
+			_, err = UpdateDataTx(tx, "Invoice", map[string]interface{}{"claim_status": "approved"}, "invoice_id = $1", []interface{}{invoice["invoice_id"]})
+		}
+		return err
+	})
+}
+
+// claimTransitions lists the claim statuses each status can move to
+var claimTransitions = map[string][]string{
+	"pending":   {"submitted", "rejected"},
+	"submitted": {"approved", "rejected"},
+}
+
+// UpdateClaimStatus moves the insurance claim of an invoice along pending -> submitted -> approved / rejected
+func UpdateClaimStatus(invoiceID int64, status string) error {
+	return WithTransaction(func(tx *sql.Tx) error {
+		invoice, err := lockInvoice(tx, invoiceID)
+		if err != nil {
+			return err
+		}
+
+		current := stringOrEmpty(invoice["claim_status"])
+		allowed := false
+		for _, next := range claimTransitions[current] {
+			if next == status {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("claim cannot move from %s to %s", current, status)
+		}
+		if status == "rejected" && centsFromNumeric(invoice["insurer_paid"]) > 0 {
+			return fmt.Errorf("claim cannot move from %s to %s", current, status)
+		}
+
+		_, err = UpdateDataTx(tx, "Invoice", map[string]interface{}{"claim_status": status}, "invoice_id = $1", []interface{}{invoice["invoice_id"]})
+		return err
+	})
+}
+
+// VoidInvoice cancels an invoice without payments. Its charges stay on it as they were billed (the audit trail of the
+// invoice), each one is copied to a new unbilled charge so it can be invoiced anew. A copy has source_type 'rebill' and
+// the id of the charge it copies as source_id, so UNIQUE (source_type, source_id) keeps a charge from being copied twice
+func VoidInvoice(invoiceID int64) error {
+	return WithTransaction(func(tx *sql.Tx) error {
+		invoice, err := lockInvoice(tx, invoiceID)
+		if err != nil {
+			return err
+		}
+		if centsFromNumeric(invoice["patient_paid"])+centsFromNumeric(invoice["insurer_paid"]) > 0 {
+			return fmt.Errorf("invoice has payments")
+		}
+
+		_, err = UpdateDataTx(tx, "Invoice", map[string]interface{}{"voided_at": time.Now()}, "invoice_id = $1", []interface{}{invoice["invoice_id"]})
+		if err != nil {
+			return err
+		}
+
+		charges, err := SelectDataTx(tx, "Charge", []string{"charge_id", "patient_id", "item_type", "item_code", "description", "quantity", "unit_price", "amount", "insurance_coverage", "charged_at"}, true, "invoice_id = $1", []interface{}{invoice["invoice_id"]}, false, "", "", "ORDER BY charge_id")
+		if err != nil {
+			return err
+		}
+		for _, charge := range charges {
+			_, err := InsertDataTx(tx, "Charge", map[string]interface{}{
+				"patient_id":         charge["patient_id"],
+				"item_type":          stringOrEmpty(charge["item_type"]),
+				"item_code":          charge["item_code"],
+				"source_type":        "rebill",
+				"source_id":          charge["charge_id"],
+				"description":        charge["description"],
+				"quantity":           charge["quantity"],
+				"unit_price":         stringOrEmpty(charge["unit_price"]),
+				"amount":             stringOrEmpty(charge["amount"]),
+				"insurance_coverage": stringOrEmpty(charge["insurance_coverage"]),
+				"charged_at":         charge["charged_at"],
+			})
+			if err != nil {
+				return fmt.Errorf("copy charge failed: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCentsFromNumeric(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  int64
+	}{
+		{"whole amount", []byte("150"), 15000},
+		{"two decimals", []byte("1234.56"), 123456},
+		{"one decimal", []byte("0.5"), 50},
+		{"rounds binary float error", []byte("0.29"), 29},
+		{"negative", []byte("-12.34"), -1234},
+		{"NULL", nil, 0},
+		{"not numeric", []byte("abc"), 0},
+		{"not bytes", "12.00", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := centsFromNumeric(tt.value); got != tt.want {
+				t.Errorf("centsFromNumeric(%v) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCentsFromFloat(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   int64
+	}{
+		{0, 0},
+		{80, 8000},
+		{19.99, 1999},
+		{0.1 + 0.2, 30},
+		{-2.5, -250},
+	}
+	for _, tt := range tests {
+		if got := centsFromFloat(tt.amount); got != tt.want {
+			t.Errorf("centsFromFloat(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestCentsToNumeric(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{50, "0.50"},
+		{123456, "1234.56"},
+		{-5, "-0.05"},
+		{-1234, "-12.34"},
+	}
+	for _, tt := range tests {
+		if got := centsToNumeric(tt.cents); got != tt.want {
+			t.Errorf("centsToNumeric(%d) = %q, want %q", tt.cents, got, tt.want)
+		}
+		if back := centsFromNumeric([]byte(tt.want)); back != tt.cents {
+			t.Errorf("centsFromNumeric(%q) = %d, want %d", tt.want, back, tt.cents)
+		}
+	}
+}
+
+func TestInsuranceShare(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		coverage int64
+		want     int64
+	}{
+		{"full coverage", 12345, 10000, 12345},
+		{"no coverage", 12345, 0, 0},
+		{"80 percent", 50000, 8000, 40000},
+		{"rounds half up", 1, 5000, 1},
+		{"rounds down", 333, 3333, 111},
+		{"fractional percent", 10000, 3750, 3750},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := insuranceShare(tt.amount, tt.coverage); got != tt.want {
+				t.Errorf("insuranceShare(%d, %d) = %d, want %d", tt.amount, tt.coverage, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitInsurance(t *testing.T) {
+	tests := []struct {
+		name           string
+		amounts        []int64
+		coverages      []int64
+		policyCoverage int64
+		limited        bool
+		remaining      int64
+		want           []int64
+	}{
+		{
+			name:           "price list coverage below the policy",
+			amounts:        []int64{10000, 20000},
+			coverages:      []int64{5000, 10000},
+			policyCoverage: 8000,
+			want:           []int64{5000, 16000},
+		},
+		{
+			name:           "policy without coverage",
+			amounts:        []int64{10000},
+			coverages:      []int64{10000},
+			policyCoverage: 0,
+			want:           []int64{0},
+		},
+		{
+			name:           "annual limit not reached",
+			amounts:        []int64{10000, 10000},
+			coverages:      []int64{10000, 10000},
+			policyCoverage: 10000,
+			limited:        true,
+			remaining:      50000,
+			want:           []int64{10000, 10000},
+		},
+		{
+			name:           "annual limit used up on the second line",
+			amounts:        []int64{10000, 10000, 10000},
+			coverages:      []int64{10000, 10000, 10000},
+			policyCoverage: 8000,
+			limited:        true,
+			remaining:      12000,
+			want:           []int64{8000, 4000, 0},
+		},
+		{
+			name:           "annual limit already used up",
+			amounts:        []int64{10000},
+			coverages:      []int64{10000},
+			policyCoverage: 10000,
+			limited:        true,
+			remaining:      0,
+			want:           []int64{0},
+		},
+		{
+			name:           "no lines",
+			amounts:        []int64{},
+			coverages:      []int64{},
+			policyCoverage: 10000,
+			want:           []int64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitInsurance(tt.amounts, tt.coverages, tt.policyCoverage, tt.limited, tt.remaining)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitInsurance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/catalog"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// UnknownCatalogIdError is returned when a request references ids (disease_id, drug_id, drug_class_id, ...) that are not in the catalog
+type UnknownCatalogIdError struct {
+	Field string
+	Ids   []string
+}
+
+func (e *UnknownCatalogIdError) Error() string {
+	return fmt.Sprintf("unknown %s: %s", e.Field, strings.Join(e.Ids, ", "))
+}
+
+var diseaseColumns = []string{"disease_id", "disease_name", "icd10_code"}
+
+var drugColumns = []string{
+	"drug_id",
+	"drug_name",
+	"atc_code",
+	"rxnorm_code",
+	"drug_class_id",
+	"(SELECT class_name FROM Drug_class WHERE Drug_class.drug_class_id = drug.drug_class_id) AS drug_class_name",
+}
+
+func diseaseFromRow(row map[string]interface{}) catalog.Disease {
+	return catalog.Disease{
+		Disease_id:   row["disease_id"].(string),
+		Disease_name: row["disease_name"].(string),
+		Icd10_code:   stringOrEmpty(row["icd10_code"]),
+	}
+}
+
+func drugFromRow(row map[string]interface{}) catalog.DrugResponse {
+	return catalog.DrugResponse{
+		Drug_id:         row["drug_id"].(string),
+		Drug_name:       row["drug_name"].(string),
+		Atc_code:        stringOrEmpty(row["atc_code"]),
+		Rxnorm_code:     stringOrEmpty(row["rxnorm_code"]),
+		Drug_class_id:   stringOrEmpty(row["drug_class_id"]),
+		Drug_class_name: stringOrEmpty(row["drug_class_name"]),
+	}
+}
+
+// ============ Disease ============
+
+// SearchDiseases returns the whole catalog when query is empty, otherwise a typeahead match on name, ICD-10 code or id
+// (name/code prefix matches are ranked before matches in the middle of the name)
+func SearchDiseases(query string, limit int) ([]catalog.Disease, error) {
+	where := false
+	whereCondition := ""
+	var args []interface{}
+	orderAndLimit := "ORDER BY disease_id"
+
+	if query != "" {
+		where = true
+		whereCondition = "disease_name ILIKE '%' || $2 || '%' OR icd10_code ILIKE $2 || '%' OR disease_id = upper($1)"
+		args = []interface{}{query, escapeLike(query)}
+		orderAndLimit = fmt.Sprintf("ORDER BY (lower(disease_name) LIKE lower($2) || '%%' OR icd10_code ILIKE $2 || '%%') DESC, disease_name LIMIT %d", limit)
+	}
+
+	results, err := SelectData("Disease", diseaseColumns, where, whereCondition, args, false, "", "", orderAndLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	diseases := []catalog.Disease{}
+	for _, row := range results {
+		diseases = append(diseases, diseaseFromRow(row))
+	}
+
+	return diseases, nil
+}
+
+func GetDisease(id string) (*catalog.Disease, error) {
+	results, err := SelectData("Disease", diseaseColumns, true, "disease_id = $1", []interface{}{id}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("disease not found")
+	}
+
+	disease := diseaseFromRow(results[0])
+	return &disease, nil
+}
+
+func AddDisease(req catalog.Disease) (int64, error) {
+	data := map[string]interface{}{
+		"disease_id":   req.Disease_id,
+		"disease_name": req.Disease_name,
+		"icd10_code":   nullIfEmpty(req.Icd10_code),
+	}
+
+	return InsertData("Disease", data)
+}
+
+func UpdateDisease(id string, data map[string]interface{}) (int64, error) {
+	return UpdateData("Disease", data, "disease_id = $1", []interface{}{id})
+}
+
+// DeleteDisease refuses to delete a disease that is recorded on patients (the FK would cascade and erase their records)
+func DeleteDisease(id string) (int64, error) {
+	used, err := SelectData("Patient_chronic_disease", []string{"id"}, true, "disease_id = $1", []interface{}{id}, false, "", "", "LIMIT 1")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(used) > 0 {
+		return 0, fmt.Errorf("disease is recorded on patients")
+	}
+
+	used, err = SelectData("Encounter_diagnosis", []string{"medical_history_id"}, true, "disease_id = $1", []interface{}{id}, false, "", "", "LIMIT 1")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(used) > 0 {
+		return 0, fmt.Errorf("disease is recorded on patients")
+	}
+
+	return DeleteData("Disease", "disease_id = $1", []interface{}{id})
+}
+
+// ============ Drug ============
+
+// SearchDrugs works like SearchDiseases and also matches ATC/RxNorm codes and the drug class name
+func SearchDrugs(query string, limit int) ([]catalog.DrugResponse, error) {
+	where := false
+	whereCondition := ""
+	var args []interface{}
+	orderAndLimit := "ORDER BY drug_id"
+
+	if query != "" {
+		where = true
+		whereCondition = "drug_name ILIKE '%' || $2 || '%' OR atc_code ILIKE $2 || '%' OR rxnorm_code = $1 OR drug_id = upper($1)" +
+			" OR drug_class_id IN (SELECT drug_class_id FROM Drug_class WHERE class_name ILIKE $2 || '%')"
+		args = []interface{}{query, escapeLike(query)}
+		orderAndLimit = fmt.Sprintf("ORDER BY (lower(drug_name) LIKE lower($2) || '%%') DESC, drug_name LIMIT %d", limit)
+	}
+
+	results, err := SelectData("drug", drugColumns, where, whereCondition, args, false, "", "", orderAndLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	drugs := []catalog.DrugResponse{}
+	for _, row := range results {
+		drugs = append(drugs, drugFromRow(row))
+	}
+
+	return drugs, nil
+}
+
+func GetDrug(id string) (*catalog.DrugResponse, error) {
+	results, err := SelectData("drug", drugColumns, true, "drug_id = $1", []interface{}{id}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("drug not found")
+	}
+
+	drug := drugFromRow(results[0])
+	return &drug, nil
+}
+
+func AddDrug(req catalog.Drug) (int64, error) {
+	if req.Drug_class_id != "" {
+		if err := checkDrugClassExists(req.Drug_class_id); err != nil {
+			return 0, err
+		}
+	}
+
+	data := map[string]interface{}{
+		"drug_id":       req.Drug_id,
+		"drug_name":     req.Drug_name,
+		"atc_code":      nullIfEmpty(req.Atc_code),
+		"rxnorm_code":   nullIfEmpty(req.Rxnorm_code),
+		"drug_class_id": nullIfEmpty(req.Drug_class_id),
+	}
+
+	return InsertData("drug", data)
+}
+
+func UpdateDrug(id string, data map[string]interface{}) (int64, error) {
+	if drugClassID, ok := data["drug_class_id"].(string); ok {
+		if err := checkDrugClassExists(drugClassID); err != nil {
+			return 0, err
+		}
+	}
+
+	return UpdateData("drug", data, "drug_id = $1", []interface{}{id})
+}
+
+// DeleteDrug refuses to delete a drug that patients are recorded as allergic to
+func DeleteDrug(id string) (int64, error) {
+	used, err := SelectData("Patient_drug_allergy", []string{"id"}, true, "drug_id = $1", []interface{}{id}, false, "", "", "LIMIT 1")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(used) > 0 {
+		return 0, fmt.Errorf("drug is recorded on patients")
+	}
+
+	return DeleteData("drug", "drug_id = $1", []interface{}{id})
+}
+
+// ============ Drug class ============
+
+func GetAllDrugClasses() ([]catalog.DrugClass, error) {
+	results, err := SelectData("Drug_class", []string{"drug_class_id", "class_name"}, false, "", nil, false, "", "", "ORDER BY drug_class_id")
+	if err != nil {
+		return nil, err
+	}
+
+	classes := []catalog.DrugClass{}
+	for _, row := range results {
+		classes = append(classes, catalog.DrugClass{
+			Drug_class_id: row["drug_class_id"].(string),
+			Class_name:    row["class_name"].(string),
+		})
+	}
+
+	return classes, nil
+}
+
+func AddDrugClass(req catalog.DrugClass) (int64, error) {
+	data := map[string]interface{}{
+		"drug_class_id": req.Drug_class_id,
+		"class_name":    req.Class_name,
+	}
+
+	return InsertData("Drug_class", data)
+}
+
+func checkDrugClassExists(id string) error {
+	results, err := SelectData("Drug_class", []string{"drug_class_id"}, true, "drug_class_id = $1", []interface{}{id}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		return fmt.Errorf("drug class not found")
+	}
+
+	return nil
+}
+
+// ============ Ingredient ============
+
+func GetAllIngredients() ([]catalog.DrugIngredient, error) {
+	results, err := SelectData("Drug_ingredient", []string{"ingredient_id", "ingredient_name"}, false, "", nil, false, "", "", "ORDER BY ingredient_id")
+	if err != nil {
+		return nil, err
+	}
+
+	ingredients := []catalog.DrugIngredient{}
+	for _, row := range results {
+		ingredients = append(ingredients, catalog.DrugIngredient{
+			Ingredient_id:   row["ingredient_id"].(string),
+			Ingredient_name: row["ingredient_name"].(string),
+		})
+	}
+
+	return ingredients, nil
+}
+
+func AddIngredient(req catalog.DrugIngredient) (int64, error) {
+	data := map[string]interface{}{
+		"ingredient_id":   req.Ingredient_id,
+		"ingredient_name": req.Ingredient_name,
+	}
+
+	return InsertData("Drug_ingredient", data)
+}
+
+func GetDrugIngredients(drugID string) ([]catalog.DrugIngredient, error) {
+	if _, err := GetDrug(drugID); err != nil {
+		return nil, err
+	}
+
+	results, err := SelectData(
+		"Drug_ingredient_link",
+		[]string{"Drug_ingredient.ingredient_id", "Drug_ingredient.ingredient_name"},
+		true,
+		"Drug_ingredient_link.drug_id = $1",
+		[]interface{}{drugID},
+		true,
+		"Drug_ingredient ON Drug_ingredient_link.ingredient_id = Drug_ingredient.ingredient_id",
+		"",
+		"ORDER BY Drug_ingredient.ingredient_id")
+	if err != nil {
+		return nil, err
+	}
+
+	ingredients := []catalog.DrugIngredient{}
+	for _, row := range results {
+		ingredients = append(ingredients, catalog.DrugIngredient{
+			Ingredient_id:   row["ingredient_id"].(string),
+			Ingredient_name: row["ingredient_name"].(string),
+		})
+	}
+
+	return ingredients, nil
+}
+
+// SetDrugIngredients replaces the ingredient list of a drug
+func SetDrugIngredients(drugID string, ingredientIDs []string) error {
+	if _, err := GetDrug(drugID); err != nil {
+		return err
+	}
+
+	unknown, err := findUnknownIds("Drug_ingredient", "ingredient_id", ingredientIDs)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return &UnknownCatalogIdError{Field: "ingredient_id", Ids: unknown}
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		if _, err := DeleteDataTx(tx, "Drug_ingredient_link", "drug_id = $1", []interface{}{drugID}); err != nil {
+			return err
+		}
+		for _, ingredientID := range ingredientIDs {
+			if _, err := InsertDataTx(tx, "Drug_ingredient_link", map[string]interface{}{"drug_id": drugID, "ingredient_id": ingredientID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ============ Cross-sensitivity ============
+
+func GetAllCrossSensitivities() ([]catalog.DrugClassCrossSensitivity, error) {
+	results, err := SelectData("Drug_class_cross_sensitivity", []string{"drug_class_id", "related_class_id", "note"}, false, "", nil, false, "", "", "ORDER BY drug_class_id, related_class_id")
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := []catalog.DrugClassCrossSensitivity{}
+	for _, row := range results {
+		pairs = append(pairs, catalog.DrugClassCrossSensitivity{
+			Drug_class_id:    row["drug_class_id"].(string),
+			Related_class_id: row["related_class_id"].(string),
+			Note:             stringOrEmpty(row["note"]),
+		})
+	}
+
+	return pairs, nil
+}
+
+// AddCrossSensitivity records that two classes cross-react. The pair is symmetric and stored once
+func AddCrossSensitivity(req catalog.DrugClassCrossSensitivity) (int64, error) {
+	unknown, err := findUnknownIds("Drug_class", "drug_class_id", []string{req.Drug_class_id, req.Related_class_id})
+	if err != nil {
+		return 0, err
+	}
+	if len(unknown) > 0 {
+		return 0, &UnknownCatalogIdError{Field: "drug_class_id", Ids: unknown}
+	}
+
+	existing, err := SelectData("Drug_class_cross_sensitivity", []string{"drug_class_id"}, true,
+		"(drug_class_id = $1 AND related_class_id = $2) OR (drug_class_id = $2 AND related_class_id = $1)",
+		[]interface{}{req.Drug_class_id, req.Related_class_id}, false, "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
+		return 0, fmt.Errorf("cross-sensitivity already recorded")
+	}
+
+	data := map[string]interface{}{
+		"drug_class_id":    req.Drug_class_id,
+		"related_class_id": req.Related_class_id,
+		"note":             nullIfEmpty(req.Note),
+	}
+
+	return InsertData("Drug_class_cross_sensitivity", data)
+}
+
+// ============ Validation ============
+
+// findUnknownIds returns the ids that are not present in table.column
+func findUnknownIds(table string, column string, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	results, err := SelectData(table, []string{column}, true, column+" = ANY($1)", []interface{}{pq.Array(ids)}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, row := range results {
+		known[row[column].(string)] = true
+	}
+
+	var unknown []string
+	for _, id := range ids {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+
+	return unknown, nil
+}
+
+// ValidatePatientCatalogIds checks every disease_id, drug_id and drug_class_id of an AddPatient/UpdatePatient request against the catalog
+// before anything is written, so the client gets an UnknownCatalogIdError instead of a foreign key error halfway through
+func ValidatePatientCatalogIds(req *patients.AddPatientRequest, skipBlank bool) error {
+	var diseaseIDs []string
+	for _, chronic := range req.PatientChronicDisease {
+		if skipBlank && !isValidString(chronic.DiseaseID) {
+			continue
+		}
+		diseaseIDs = append(diseaseIDs, chronic.DiseaseID)
+	}
+
+	unknown, err := findUnknownIds("Disease", "disease_id", diseaseIDs)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return &UnknownCatalogIdError{Field: "disease_id", Ids: unknown}
+	}
+
+	// An allergy names either a drug class or a drug
+	var drugIDs []string
+	var drugClassIDs []string
+	for _, allergy := range req.PatientDrugAllergy {
+		if isValidString(allergy.DrugClassID) {
+			drugClassIDs = append(drugClassIDs, allergy.DrugClassID)
+			continue
+		}
+		if skipBlank && !isValidString(allergy.DrugID) {
+			continue
+		}
+		drugIDs = append(drugIDs, allergy.DrugID)
+	}
+
+	unknown, err = findUnknownIds("drug", "drug_id", drugIDs)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return &UnknownCatalogIdError{Field: "drug_id", Ids: unknown}
+	}
+
+	unknown, err = findUnknownIds("Drug_class", "drug_class_id", drugClassIDs)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return &UnknownCatalogIdError{Field: "drug_class_id", Ids: unknown}
+	}
+
+	return nil
+}
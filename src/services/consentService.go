@@ -0,0 +1,304 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/lib/pq"
+)
+
+// Consent types, they match the consent_type enum
+const (
+	ConsentTreatment          = "treatment"
+	ConsentDataSharing        = "data_sharing"
+	ConsentResearch           = "research"
+	ConsentCommunicationEmail = "communication_email"
+	ConsentCommunicationSMS   = "communication_sms"
+	ConsentCommunicationPhone = "communication_phone"
+)
+
+var consentTypes = map[string]bool{
+	ConsentTreatment:          true,
+	ConsentDataSharing:        true,
+	ConsentResearch:           true,
+	ConsentCommunicationEmail: true,
+	ConsentCommunicationSMS:   true,
+	ConsentCommunicationPhone: true,
+}
+
+// IsValidConsentType reports whether consentType fits the consent_type enum
+func IsValidConsentType(consentType string) bool {
+	return consentTypes[consentType]
+}
+
+// ConsentRequiredError is returned by RequireConsent when the patient has not granted (or has revoked) the consent
+type ConsentRequiredError struct {
+	Patient_id   string
+	Consent_type string
+}
+
+func (e *ConsentRequiredError) Error() string {
+	return fmt.Sprintf("patient %s has not granted %s consent", e.Patient_id, e.Consent_type)
+}
+
+// consentGrantedCondition is the SQL condition "the patient in patientColumn currently grants consentType". It is meant to be
+// added to the WHERE clause of exports and notification queries so patients without consent are never selected.
+// consentType must be one of the constants above, it is not a bind parameter
+func consentGrantedCondition(patientColumn string, consentType string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM Patient_consent pc WHERE pc.patient_id = %s AND pc.consent_type = '%s' AND pc.granted AND pc.revoked_at IS NULL AND pc.superseded_at IS NULL)", patientColumn, consentType)
+}
+
+// HasConsent reports whether the patient's current decision on consentType is a grant. No decision counts as no consent
+func HasConsent(patientID string, consentType string) (bool, error) {
+	results, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+consentGrantedCondition("Patient.patient_id", consentType), []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0, nil
+}
+
+// RequireConsent is the enforcement hook for single-patient actions: it returns a ConsentRequiredError unless the patient grants consentType
+func RequireConsent(patientID string, consentType string) error {
+	ok, err := HasConsent(patientID, consentType)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &ConsentRequiredError{Patient_id: patientID, Consent_type: consentType}
+	}
+	return nil
+}
+
+// FilterPatientsWithConsent is the enforcement hook for bulk actions: it keeps the patient ids that grant consentType, in their original order
+func FilterPatientsWithConsent(patientIDs []string, consentType string) ([]string, error) {
+	if len(patientIDs) == 0 {
+		return []string{}, nil
+	}
+
+	results, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = ANY($1) AND "+consentGrantedCondition("Patient.patient_id", consentType), []interface{}{pq.Array(patientIDs)}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	granted := map[string]bool{}
+	for _, row := range results {
+		granted[row["patient_id"].(string)] = true
+	}
+	allowed := []string{}
+	for _, id := range patientIDs {
+		if granted[id] {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+func GetConsentDocuments(consentType string) ([]patients.ConsentDocument, error) {
+	var results []map[string]interface{}
+	var err error
+	if consentType != "" {
+		results, err = SelectData("Consent_document", []string{"*"}, true, "consent_type = $1", []interface{}{consentType}, false, "", "", "ORDER BY consent_type, effective_from DESC")
+	} else {
+		results, err = SelectData("Consent_document", []string{"*"}, false, "", nil, false, "", "", "ORDER BY consent_type, effective_from DESC")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	documents := []patients.ConsentDocument{}
+	for _, row := range results {
+		documents = append(documents, patients.ConsentDocument{
+			Consent_type:   stringOrEmpty(row["consent_type"]),
+			Version:        row["version"].(string),
+			Title:          row["title"].(string),
+			Content:        row["content"].(string),
+			Effective_from: row["effective_from"].(time.Time).Format("2006-01-02"),
+		})
+	}
+	return documents, nil
+}
+
+// AddConsentDocument publishes a new version of a consent text. Decisions already recorded keep the version they were signed on
+func AddConsentDocument(req patients.ConsentDocument) error {
+	data := map[string]interface{}{
+		"consent_type": req.Consent_type,
+		"version":      req.Version,
+		"title":        req.Title,
+		"content":      req.Content,
+	}
+	if req.Effective_from != "" {
+		data["effective_from"] = req.Effective_from
+	}
+
+	_, err := InsertData("Consent_document", data)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("consent version already exists")
+	}
+	return err
+}
+
+var patientConsentFields = []string{
+	"consent_id",
+	"patient_id",
+	"consent_type",
+	"version",
+	"granted",
+	"signed_at",
+	"recorded_by",
+	"note",
+	"superseded_at",
+	"revoked_at",
+	"revoked_by",
+	"revocation_reason",
+}
+
+func patientConsentFromRow(row map[string]interface{}) patients.PatientConsent {
+	consent := patients.PatientConsent{
+		Consent_id:        row["consent_id"].(int64),
+		Patient_id:        row["patient_id"].(string),
+		Consent_type:      stringOrEmpty(row["consent_type"]),
+		Version:           row["version"].(string),
+		Granted:           row["granted"].(bool),
+		Signed_at:         timeOrEmpty(row["signed_at"]),
+		Recorded_by:       stringOrEmpty(row["recorded_by"]),
+		Note:              stringOrEmpty(row["note"]),
+		Superseded_at:     timeOrEmpty(row["superseded_at"]),
+		Revoked_at:        timeOrEmpty(row["revoked_at"]),
+		Revoked_by:        stringOrEmpty(row["revoked_by"]),
+		Revocation_reason: stringOrEmpty(row["revocation_reason"]),
+	}
+
+	switch {
+	case consent.Revoked_at != "":
+		consent.Status = "revoked"
+	case consent.Superseded_at != "":
+		consent.Status = "superseded"
+	case consent.Granted:
+		consent.Status = "granted"
+	default:
+		consent.Status = "refused"
+	}
+	return consent
+}
+
+// GetPatientConsents returns the patient's current decision on each consent type, or every decision ever recorded when history is true
+func GetPatientConsents(patientID string, history bool) ([]patients.PatientConsent, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	whereCon := "patient_id = $1"
+	if !history {
+		whereCon += " AND revoked_at IS NULL AND superseded_at IS NULL"
+	}
+	results, err := SelectData("Patient_consent", patientConsentFields, true, whereCon, []interface{}{patientID}, false, "", "", "ORDER BY consent_type, signed_at DESC, consent_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	consents := []patients.PatientConsent{}
+	for _, row := range results {
+		consents = append(consents, patientConsentFromRow(row))
+	}
+	return consents, nil
+}
+
+// RecordConsent stores a patient's decision (grant or refusal) on a consent type. The current decision on the same type,
+// if any, is marked superseded in the same transaction; the patient row is locked so two decisions cannot both become current
+func RecordConsent(patientID string, req patients.RecordConsentRequest) (int64, error) {
+	if err := checkActiveEmployee(req.Recorded_by); err != nil {
+		return 0, err
+	}
+
+	var consentID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		patient, err := SelectDataTx(tx, "Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(patient) == 0 {
+			return fmt.Errorf("Patient not found")
+		}
+
+		version := req.Version
+		if version == "" {
+			latest, err := SelectDataTx(tx, "Consent_document", []string{"version"}, true, "consent_type = $1 AND effective_from <= CURRENT_DATE", []interface{}{req.Consent_type}, false, "", "", "ORDER BY effective_from DESC LIMIT 1")
+			if err != nil {
+				return err
+			}
+			if len(latest) == 0 {
+				return fmt.Errorf("consent version not found")
+			}
+			version = latest[0]["version"].(string)
+		} else {
+			document, err := SelectDataTx(tx, "Consent_document", []string{"version"}, true, "consent_type = $1 AND version = $2", []interface{}{req.Consent_type, version}, false, "", "", "")
+			if err != nil {
+				return err
+			}
+			if len(document) == 0 {
+				return fmt.Errorf("consent version not found")
+			}
+		}
+
+		_, err = UpdateDataTx(tx, "Patient_consent", map[string]interface{}{"superseded_at": time.Now()}, "patient_id = $1 AND consent_type = $2 AND revoked_at IS NULL AND superseded_at IS NULL", []interface{}{patientID, req.Consent_type})
+		if err != nil {
+			return err
+		}
+
+		data := map[string]interface{}{
+			"patient_id":   patientID,
+			"consent_type": req.Consent_type,
+			"version":      version,
+			"granted":      *req.Granted,
+			"recorded_by":  req.Recorded_by,
+			"note":         nullIfEmpty(req.Note),
+		}
+		if req.Signed_at != "" {
+			data["signed_at"] = req.Signed_at
+		}
+		id, err := InsertDataReturningTx(tx, "Patient_consent", data, "consent_id")
+		if err != nil {
+			return fmt.Errorf("insert consent failed: %w", err)
+		}
+		consentID = id.(int64)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return consentID, nil
+}
+
+// RevokeConsent withdraws the patient's current decision. After revocation the patient has no consent of that type
+// until a new one is recorded
+func RevokeConsent(patientID string, consentID int64, req patients.RevokeConsentRequest) error {
+	if err := checkActiveEmployee(req.Revoked_by); err != nil {
+		return err
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		results, err := SelectDataTx(tx, "Patient_consent", []string{"revoked_at", "superseded_at"}, true, "patient_id = $1 AND consent_id = $2", []interface{}{patientID, consentID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("consent not found")
+		}
+		if results[0]["revoked_at"] != nil {
+			return fmt.Errorf("consent is already revoked")
+		}
+		if results[0]["superseded_at"] != nil {
+			return fmt.Errorf("consent has been superseded")
+		}
+
+		_, err = UpdateDataTx(tx, "Patient_consent", map[string]interface{}{
+			"revoked_at":        time.Now(),
+			"revoked_by":        req.Revoked_by,
+			"revocation_reason": nullIfEmpty(req.Reason),
+		}, "consent_id = $1", []interface{}{consentID})
+		return err
+	})
+}
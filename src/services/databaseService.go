@@ -1,13 +1,52 @@
 package services
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+	"github.com/lib/pq"
 	"github.com/NinePTH/GO_MVC-S/src/utils/databaseConnector"
 )
 
+// dbExecutor is implemented by both *sql.DB and *sql.Tx, so every helper below can run inside or outside a transaction
+type dbExecutor interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// WithTransaction runs fn inside a transaction. It commits when fn returns nil and rolls back otherwise
+func WithTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := databaseConnector.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			fmt.Println("Rollback failed:", rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // select distinct,etc.
 func SelectData(table string, fields []string, where bool, whereCon string, whereArgs []interface{}, join bool, joinTable string, joinCondition string,orderAndLimit string) ([]map[string]interface{}, error) {
+	return selectData(databaseConnector.DB, table, fields, where, whereCon, whereArgs, join, joinTable, joinCondition, orderAndLimit)
+}
+
+// SelectDataTx is SelectData inside a transaction (orderAndLimit may also carry a locking clause such as FOR UPDATE)
+func SelectDataTx(tx *sql.Tx, table string, fields []string, where bool, whereCon string, whereArgs []interface{}, join bool, joinTable string, joinCondition string, orderAndLimit string) ([]map[string]interface{}, error) {
+	return selectData(tx, table, fields, where, whereCon, whereArgs, join, joinTable, joinCondition, orderAndLimit)
+}
+
+// selectQuery builds the SELECT statement of SelectData and StreamData
+func selectQuery(table string, fields []string, where bool, whereCon string, join bool, joinTable string, joinCondition string, orderAndLimit string) string {
 	var query string = "SELECT "
 
 	// Add fields to SELECT
@@ -37,13 +76,19 @@ func SelectData(table string, fields []string, where bool, whereCon string, wher
 	// Add ORDER BY and LIMIT if provided
 	if orderAndLimit != "" {
 		query += " " + orderAndLimit
-	} 
+	}
+
+	return query
+}
+
+func selectData(db dbExecutor, table string, fields []string, where bool, whereCon string, whereArgs []interface{}, join bool, joinTable string, joinCondition string, orderAndLimit string) ([]map[string]interface{}, error) {
+	query := selectQuery(table, fields, where, whereCon, join, joinTable, joinCondition, orderAndLimit)
 
 	// Log the query
 	fmt.Println("Executing query:", query)
 
 	// Execute the query
-	rows, err := databaseConnector.DB.Query(query, whereArgs...)
+	rows, err := db.Query(query, whereArgs...)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +139,52 @@ func SelectData(table string, fields []string, where bool, whereCon string, wher
 	return results, nil
 }
 
+// StreamData runs the same SELECT as SelectData but hands the rows to fn one at a time instead of collecting them,
+// so exports of whole tables keep memory flat. It stops at the first error of fn or when ctx is cancelled
+func StreamData(ctx context.Context, table string, fields []string, where bool, whereCon string, whereArgs []interface{}, join bool, joinTable string, joinCondition string, orderAndLimit string, fn func(row map[string]interface{}) error) error {
+	query := selectQuery(table, fields, where, whereCon, join, joinTable, joinCondition, orderAndLimit)
+	fmt.Println("Executing query:", query)
+
+	rows, err := databaseConnector.DB.QueryContext(ctx, query, whereArgs...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePointers := make([]interface{}, len(columns))
+	for i := range values {
+		valuePointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(valuePointers...); err != nil {
+			return err
+		}
+		rowMap := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			rowMap[column] = values[i]
+		}
+		if err := fn(rowMap); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func UpdateData(table string, data map[string]interface{}, condition string, conditionValues []interface{}) (int64, error) {
+	return updateData(databaseConnector.DB, table, data, condition, conditionValues)
+}
+
+func UpdateDataTx(tx *sql.Tx, table string, data map[string]interface{}, condition string, conditionValues []interface{}) (int64, error) {
+	return updateData(tx, table, data, condition, conditionValues)
+}
+
+func updateData(db dbExecutor, table string, data map[string]interface{}, condition string, conditionValues []interface{}) (int64, error) {
 	var setClauses []string
 	var values []interface{}
 	// Start by appending the values for condition
@@ -114,7 +204,7 @@ func UpdateData(table string, data map[string]interface{}, condition string, con
 	fmt.Println("With values:", values)
 
 	// Prepare the statement
-	stmt, err := databaseConnector.DB.Prepare(query)
+	stmt, err := db.Prepare(query)
 	if err != nil {
 		return 0, err
 	}
@@ -137,6 +227,14 @@ func UpdateData(table string, data map[string]interface{}, condition string, con
 
 
 func InsertData(table string, data map[string]interface{}) (int64, error) {
+	return insertData(databaseConnector.DB, table, data)
+}
+
+func InsertDataTx(tx *sql.Tx, table string, data map[string]interface{}) (int64, error) {
+	return insertData(tx, table, data)
+}
+
+func insertData(db dbExecutor, table string, data map[string]interface{}) (int64, error) {
 	var columns []string
 	var placeholders []string
 	var values []interface{}
@@ -157,7 +255,7 @@ func InsertData(table string, data map[string]interface{}) (int64, error) {
 	fmt.Println("Executing query:", query)
 
 	// Prepare the statement
-	stmt, err := databaseConnector.DB.Prepare(query)
+	stmt, err := db.Prepare(query)
 	if err != nil {
 		return 0, err
 	}
@@ -178,12 +276,58 @@ func InsertData(table string, data map[string]interface{}) (int64, error) {
 	return rowsAffected, nil
 }
 
+// InsertDataReturning inserts one row and returns the value of returningColumn (e.g. a SERIAL id) of the new row
+func InsertDataReturning(table string, data map[string]interface{}, returningColumn string) (interface{}, error) {
+	return insertDataReturning(databaseConnector.DB, table, data, returningColumn)
+}
+
+func InsertDataReturningTx(tx *sql.Tx, table string, data map[string]interface{}, returningColumn string) (interface{}, error) {
+	return insertDataReturning(tx, table, data, returningColumn)
+}
+
+func insertDataReturning(db dbExecutor, table string, data map[string]interface{}, returningColumn string) (interface{}, error) {
+	var columns []string
+	var placeholders []string
+	var values []interface{}
+
+	for column, value := range data {
+		columns = append(columns, column)
+		values = append(values, value)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(placeholders)+1))
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
+		table,
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "),
+		returningColumn,
+	)
+
+	fmt.Println("Executing query:", query)
+
+	var returned interface{}
+	if err := db.QueryRow(query, values...).Scan(&returned); err != nil {
+		return nil, err
+	}
+
+	return returned, nil
+}
+
 func DeleteData(table string, condition string, conditionValues []interface{}) (int64, error) {
+	return deleteData(databaseConnector.DB, table, condition, conditionValues)
+}
+
+func DeleteDataTx(tx *sql.Tx, table string, condition string, conditionValues []interface{}) (int64, error) {
+	return deleteData(tx, table, condition, conditionValues)
+}
+
+func deleteData(db dbExecutor, table string, condition string, conditionValues []interface{}) (int64, error) {
 	query := fmt.Sprintf("DELETE FROM %s WHERE %s", table, condition)
 	fmt.Println("Executing query:", query)
 
 	// Prepare the statement
-	stmt, err := databaseConnector.DB.Prepare(query)
+	stmt, err := db.Prepare(query)
 	if err != nil {
 		return 0, err
 	}
@@ -201,3 +345,48 @@ func DeleteData(table string, condition string, conditionValues []interface{}) (
 
 	return rowsAffected, nil
 }
+
+// stringOrEmpty converts a nullable text/enum column value to string, NULL becomes ""
+func stringOrEmpty(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// timeOrEmpty formats a nullable TIMESTAMP column as "2006-01-02 15:04:05", NULL becomes ""
+func timeOrEmpty(value interface{}) string {
+	t, ok := value.(time.Time)
+	if !ok {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// nullIfEmpty is the opposite of stringOrEmpty, used when writing optional columns
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint or unique index, the last line of defence against concurrent writers
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// likeEscaper escapes the LIKE/ILIKE wildcards so user input only matches literally (backslash is the default escape character)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike returns value with %, _ and \ escaped for use in a LIKE/ILIKE pattern
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
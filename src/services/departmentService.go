@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+)
+
+// Active employees per department, used as a sub-select so departments without employees still show up
+const departmentHeadcountColumn = "(SELECT COUNT(*) FROM Employee JOIN Position p ON Employee.position_id = p.position_id WHERE p.department_id = Department.department_id AND Employee.work_status = 'yes') AS headcount"
+const departmentPositionCountColumn = "(SELECT COUNT(*) FROM Position p WHERE p.department_id = Department.department_id) AS position_count"
+
+func departmentFromRow(row map[string]interface{}) models.DepartmentResponse {
+	return models.DepartmentResponse{
+		Department_id:   row["department_id"].(string),
+		Department_name: row["department_name"].(string),
+		Position_count:  int(row["position_count"].(int64)),
+		Headcount:       int(row["headcount"].(int64)),
+	}
+}
+
+func GetAllDepartments() ([]models.DepartmentResponse, error) {
+	fields := []string{"department_id", "department_name", departmentPositionCountColumn, departmentHeadcountColumn}
+	results, err := SelectData("Department", fields, false, "", nil, false, "", "", "ORDER BY department_id")
+	if err != nil {
+		return nil, err
+	}
+
+	departments := []models.DepartmentResponse{}
+	for _, row := range results {
+		departments = append(departments, departmentFromRow(row))
+	}
+
+	return departments, nil
+}
+
+func GetDepartment(id string) (*models.DepartmentResponse, error) {
+	fields := []string{"department_id", "department_name", departmentPositionCountColumn, departmentHeadcountColumn}
+	results, err := SelectData("Department", fields, true, "department_id = $1", []interface{}{id}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("department not found")
+	}
+
+	department := departmentFromRow(results[0])
+	return &department, nil
+}
+
+func AddDepartment(req models.Department) (int64, error) {
+	data := map[string]interface{}{
+		"department_id":   req.Department_id,
+		"department_name": req.Department_name,
+	}
+
+	id, err := InsertData("Department", data)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("department already exists")
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func UpdateDepartment(id string, data map[string]interface{}) (int64, error) {
+	return UpdateData("Department", data, "department_id = $1", []interface{}{id})
+}
+
+// DeleteDepartment only deletes empty departments, positions and wards must be moved or deleted first
+// (Position has ON DELETE CASCADE, so deleting a department with positions would silently drop them)
+func DeleteDepartment(id string) (int64, error) {
+	positions, err := SelectData("Position", []string{"position_id"}, true, "department_id = $1", []interface{}{id}, false, "", "", "LIMIT 1")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(positions) > 0 {
+		return 0, fmt.Errorf("department still has positions")
+	}
+
+	wards, err := SelectData("Ward", []string{"ward_id"}, true, "department_id = $1", []interface{}{id}, false, "", "", "LIMIT 1")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(wards) > 0 {
+		return 0, fmt.Errorf("department still has wards")
+	}
+
+	return DeleteData("Department", "department_id = $1", []interface{}{id})
+}
+
+// GetDepartmentEmployees lists employees of every position in the department using the same join as GetAllEmployee
+func GetDepartmentEmployees(id string) ([]models.EmployeeResponse, error) {
+	if _, err := GetDepartment(id); err != nil {
+		return nil, err
+	}
+
+	results, err := SelectData(
+		"Employee",
+		employeeResponseColumns,
+		true,
+		"Department.department_id = $1",
+		[]interface{}{id},
+		true,
+		employeeJoinTables,
+		"",
+		"ORDER BY employee_id DESC",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	employees := []models.EmployeeResponse{}
+	for _, row := range results {
+		employees = append(employees, employeeFromRow(row))
+	}
+
+	return employees, nil
+}
+
+func checkDepartmentExists(id string) error {
+	results, err := SelectData("Department", []string{"department_id"}, true, "department_id = $1", []interface{}{id}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		return fmt.Errorf("department not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+)
+
+// Domain event types published to webhooks
+const (
+	EventPatientCreated    = "patient.created"
+	EventPatientUpdated    = "patient.updated"
+	EventPatientDeleted    = "patient.deleted"
+	EventAppointmentBooked = "appointment.booked"
+	EventEmployeeCreated   = "employee.created"
+)
+
+var domainEventTypes = map[string]bool{
+	EventPatientCreated:    true,
+	EventPatientUpdated:    true,
+	EventPatientDeleted:    true,
+	EventAppointmentBooked: true,
+	EventEmployeeCreated:   true,
+}
+
+// IsValidDomainEventType reports whether eventType is one of the event types above
+func IsValidDomainEventType(eventType string) bool {
+	return domainEventTypes[eventType]
+}
+
+// recordDomainEventTx writes an event to the outbox in the caller's transaction: the event exists if and only if
+// the change commits. The webhook dispatcher picks it up afterwards
+func recordDomainEventTx(tx *sql.Tx, eventType string, aggregateType string, aggregateID string, patientID string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("invalid %s payload: %w", eventType, err)
+	}
+
+	_, err = InsertDataTx(tx, "Outbox_event", map[string]interface{}{
+		"event_type":     eventType,
+		"aggregate_type": aggregateType,
+		"aggregate_id":   aggregateID,
+		"patient_id":     nullIfEmpty(patientID),
+		"payload":        string(raw),
+		"occurred_at":    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("record %s event failed: %w", eventType, err)
+	}
+	return nil
+}
+
+// recordPatientEventTx records patient.created, patient.updated or patient.deleted with the patient's demographics as
+// stored in tx (a deleted patient's row is still there)
+func recordPatientEventTx(tx *sql.Tx, eventType string, patientID string, changedFields []string) error {
+	results, err := SelectDataTx(tx, "Patient", []string{"patient_id", "first_name", "last_name", "gender", "date_of_birth", "email", "phone_number"}, true,
+		"patient_id = $1", []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("Patient not found")
+	}
+
+	row := results[0]
+	event := models.PatientEvent{
+		Patient_id:     row["patient_id"].(string),
+		First_name:     stringOrEmpty(row["first_name"]),
+		Last_name:      stringOrEmpty(row["last_name"]),
+		Gender:         stringOrEmpty(row["gender"]),
+		Email:          stringOrEmpty(row["email"]),
+		Phone_number:   stringOrEmpty(row["phone_number"]),
+		Changed_fields: changedFields,
+	}
+	if dateOfBirth, ok := row["date_of_birth"].(time.Time); ok {
+		event.Date_of_birth = dateOfBirth.Format("2006-01-02")
+	}
+	return recordDomainEventTx(tx, eventType, "patient", patientID, patientID, event)
+}
+
+func recordAppointmentBookedTx(tx *sql.Tx, event models.AppointmentBookedEvent) error {
+	return recordDomainEventTx(tx, EventAppointmentBooked, "appointment", fmt.Sprint(event.Appointment_id), event.Patient_id, event)
+}
+
+func recordEmployeeCreatedTx(tx *sql.Tx, event models.EmployeeCreatedEvent) error {
+	return recordDomainEventTx(tx, EventEmployeeCreated, "employee", event.Employee_id, "", event)
+}
+
+func domainEventFromRow(row map[string]interface{}) models.DomainEvent {
+	return models.DomainEvent{
+		Event_id:       row["event_id"].(int64),
+		Event_type:     row["event_type"].(string),
+		Aggregate_type: row["aggregate_type"].(string),
+		Aggregate_id:   row["aggregate_id"].(string),
+		Patient_id:     stringOrEmpty(row["patient_id"]),
+		Payload:        json.RawMessage(row["payload"].([]byte)),
+		Occurred_at:    timeOrEmpty(row["occurred_at"]),
+		Dispatched_at:  timeOrEmpty(row["dispatched_at"]),
+	}
+}
+
+// GetDomainEvents lists outbox events newest first, filtered by event type when given
+func GetDomainEvents(eventType string, limit int) ([]models.DomainEvent, error) {
+	var results []map[string]interface{}
+	var err error
+	orderAndLimit := fmt.Sprintf("ORDER BY event_id DESC LIMIT %d", limit)
+	if eventType != "" {
+		results, err = SelectData("Outbox_event", []string{"*"}, true, "event_type = $1", []interface{}{eventType}, false, "", "", orderAndLimit)
+	} else {
+		results, err = SelectData("Outbox_event", []string{"*"}, false, "", nil, false, "", "", orderAndLimit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.DomainEvent{}
+	for _, row := range results {
+		events = append(events, domainEventFromRow(row))
+	}
+	return events, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+var allergySeverities = map[string]bool{"mild": true, "moderate": true, "severe": true, "life_threatening": true}
+
+// IsValidAllergySeverity reports whether severity fits the allergy_severity enum, empty means "not recorded"
+func IsValidAllergySeverity(severity string) bool {
+	return severity == "" || allergySeverities[severity]
+}
+
+// drugAllergyRow builds the Patient_drug_allergy insert for one allergy, an allergy is either to a drug or to a drug class
+func drugAllergyRow(patientID string, allergy patients.DrugAllergyName) map[string]interface{} {
+	row := map[string]interface{}{
+		"patient_id":    patientID,
+		"severity":      nullIfEmpty(allergy.Severity),
+		"reaction_type": nullIfEmpty(allergy.ReactionType),
+	}
+
+	if isValidString(allergy.DrugClassID) {
+		row["drug_class_id"] = allergy.DrugClassID
+	} else {
+		row["drug_id"] = allergy.DrugID
+	}
+
+	return row
+}
+
+// getPatientsDrugAllergies returns the allergies shown in GetPatientResponse, keyed by patient id. Like the chronic disease
+// list drug_id holds the drug name for drug level allergies; class level allergies carry the class id and its drug_class_name
+func getPatientsDrugAllergies(patientIDs []string) (map[string][]patients.DrugAllergyName, error) {
+	fields := []string{
+		"patient_id",
+		"(SELECT drug_name FROM drug WHERE drug.drug_id = patient_drug_allergy.drug_id) AS drug_name",
+		"drug_class_id",
+		"(SELECT class_name FROM Drug_class WHERE Drug_class.drug_class_id = patient_drug_allergy.drug_class_id) AS class_name",
+		"severity",
+		"reaction_type",
+	}
+	results, err := SelectData("patient_drug_allergy", fields, true, "patient_id = ANY($1)", []interface{}{pq.Array(patientIDs)}, false, "", "", "ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	drugAllergies := map[string][]patients.DrugAllergyName{}
+	for _, row := range results {
+		patientID := row["patient_id"].(string)
+		drugAllergies[patientID] = append(drugAllergies[patientID], patients.DrugAllergyName{
+			DrugID:        stringOrEmpty(row["drug_name"]),
+			DrugClassID:   stringOrEmpty(row["drug_class_id"]),
+			DrugClassName: stringOrEmpty(row["class_name"]),
+			Severity:      stringOrEmpty(row["severity"]),
+			ReactionType:  stringOrEmpty(row["reaction_type"]),
+		})
+	}
+
+	return drugAllergies, nil
+}
+
+// CheckDrugAllergy compares a drug against every allergy of the patient and reports
+//   - direct matches: same drug, a drug sharing an active ingredient, or an allergy recorded on the drug's class
+//   - cross-sensitivity: an allergic drug of the same class, or an allergy whose class cross-reacts with the drug's class
+func CheckDrugAllergy(patientID string, drugID string) (*patients.AllergyCheckResponse, error) {
+	patientResult, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(patientResult) == 0 {
+		return nil, fmt.Errorf("Patient not found")
+	}
+
+	drug, err := GetDrug(drugID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &patients.AllergyCheckResponse{
+		Patient_id:      patientID,
+		Drug_id:         drug.Drug_id,
+		Drug_name:       drug.Drug_name,
+		Drug_class_name: drug.Drug_class_name,
+		Matches:         []patients.AllergyMatch{},
+	}
+
+	// Ingredients of the checked drug
+	ingredientResults, err := SelectData("Drug_ingredient_link", []string{"ingredient_id"}, true, "drug_id = $1", []interface{}{drugID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	var ingredientIDs []string
+	for _, row := range ingredientResults {
+		ingredientIDs = append(ingredientIDs, row["ingredient_id"].(string))
+	}
+
+	// Classes that cross-react with the checked drug's class (pairs are stored once, so look both ways)
+	relatedClasses := map[string]string{}
+	if drug.Drug_class_id != "" {
+		crossResults, err := SelectData(
+			"Drug_class_cross_sensitivity",
+			[]string{"drug_class_id", "related_class_id", "note"},
+			true,
+			"drug_class_id = $1 OR related_class_id = $1",
+			[]interface{}{drug.Drug_class_id},
+			false, "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range crossResults {
+			other := row["related_class_id"].(string)
+			if other == drug.Drug_class_id {
+				other = row["drug_class_id"].(string)
+			}
+			relatedClasses[other] = stringOrEmpty(row["note"])
+		}
+	}
+
+	// Patient allergies with the class of the allergic drug (or the class of a class level allergy)
+	// and whether the allergic drug shares an ingredient with the checked drug
+	allergyClass := "COALESCE(patient_drug_allergy.drug_class_id, (SELECT drug_class_id FROM drug WHERE drug.drug_id = patient_drug_allergy.drug_id))"
+	fields := []string{
+		"drug_id",
+		"(SELECT drug_name FROM drug WHERE drug.drug_id = patient_drug_allergy.drug_id) AS drug_name",
+		allergyClass + " AS class_id",
+		"(SELECT class_name FROM Drug_class WHERE Drug_class.drug_class_id = " + allergyClass + ") AS class_name",
+		"severity",
+		"reaction_type",
+		"EXISTS (SELECT 1 FROM Drug_ingredient_link l WHERE l.drug_id = patient_drug_allergy.drug_id AND l.ingredient_id = ANY($2)) AS shares_ingredient",
+	}
+	allergyResults, err := SelectData("patient_drug_allergy", fields, true, "patient_id = $1", []interface{}{patientID, pq.Array(ingredientIDs)}, false, "", "", "ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range allergyResults {
+		allergyDrugID := stringOrEmpty(row["drug_id"])
+		classID := stringOrEmpty(row["class_id"])
+		match := patients.AllergyMatch{
+			Allergy_drug_id:    allergyDrugID,
+			Allergy_drug_name:  stringOrEmpty(row["drug_name"]),
+			Allergy_class_id:   classID,
+			Allergy_class_name: stringOrEmpty(row["class_name"]),
+			Severity:           stringOrEmpty(row["severity"]),
+			Reaction_type:      stringOrEmpty(row["reaction_type"]),
+		}
+
+		crossNote, crossReacts := relatedClasses[classID]
+
+		switch {
+		case allergyDrugID == drugID:
+			match.Match_type = "direct"
+			match.Detail = "Patient is allergic to this drug"
+		case allergyDrugID != "" && row["shares_ingredient"].(bool):
+			match.Match_type = "shared_ingredient"
+			match.Detail = fmt.Sprintf("%s contains an active ingredient of %s", drug.Drug_name, match.Allergy_drug_name)
+		case allergyDrugID == "" && classID != "" && classID == drug.Drug_class_id:
+			match.Match_type = "drug_class"
+			match.Detail = fmt.Sprintf("Patient is allergic to the whole %s class", match.Allergy_class_name)
+		case allergyDrugID != "" && classID != "" && classID == drug.Drug_class_id:
+			match.Match_type = "same_class"
+			match.Detail = fmt.Sprintf("%s and %s are both %s", drug.Drug_name, match.Allergy_drug_name, match.Allergy_class_name)
+		case classID != "" && crossReacts:
+			match.Match_type = "cross_sensitivity"
+			match.Detail = crossNote
+			if match.Detail == "" {
+				match.Detail = fmt.Sprintf("%s cross-reacts with %s", drug.Drug_class_name, match.Allergy_class_name)
+			}
+		default:
+			continue
+		}
+
+		if match.Match_type == "cross_sensitivity" || match.Match_type == "same_class" {
+			response.Has_cross = true
+		} else {
+			response.Has_direct = true
+		}
+		response.Matches = append(response.Matches, match)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// ValidateEmergencyContacts checks the emergency contacts of an AddPatient/UpdatePatient request and fills in
+// missing priorities, in list order, with the lowest numbers not taken by an explicit priority. Priorities must be
+// unique per patient
+func ValidateEmergencyContacts(contacts []patients.EmergencyContact) error {
+	seen := map[int]bool{}
+	for i := range contacts {
+		contact := &contacts[i]
+		if contact.Contact_name == "" || contact.Relationship == "" || contact.Phone_number == "" {
+			return fmt.Errorf("patient_emergency_contacts[%d] must have contact_name, relationship and phone_number", i)
+		}
+		if len(contact.Contact_name) > 100 || len(contact.Relationship) > 30 || len(contact.Phone_number) > 15 || len(contact.Email) > 50 {
+			return fmt.Errorf("patient_emergency_contacts[%d] has a field that is too long", i)
+		}
+		if contact.Priority < 0 {
+			return fmt.Errorf("patient_emergency_contacts[%d].priority must be greater than 0", i)
+		}
+		if contact.Priority == 0 {
+			continue
+		}
+		if seen[contact.Priority] {
+			return fmt.Errorf("patient_emergency_contacts[%d].priority %d is used twice", i, contact.Priority)
+		}
+		seen[contact.Priority] = true
+	}
+
+	next := 1
+	for i := range contacts {
+		if contacts[i].Priority != 0 {
+			continue
+		}
+		for seen[next] {
+			next++
+		}
+		contacts[i].Priority = next
+		seen[next] = true
+	}
+	return nil
+}
+
+// replaceEmergencyContactsTx swaps the patient's emergency contacts for the given list in the caller's transaction,
+// so a failed insert does not leave the patient without any contact
+func replaceEmergencyContactsTx(tx *sql.Tx, patientID string, contacts []patients.EmergencyContact) error {
+	if _, err := DeleteDataTx(tx, "Patient_emergency_contact", "patient_id = $1", []interface{}{patientID}); err != nil {
+		return fmt.Errorf("failed to delete emergency contacts: %v", err)
+	}
+
+	for _, contact := range contacts {
+		_, err := InsertDataTx(tx, "Patient_emergency_contact", map[string]interface{}{
+			"patient_id":       patientID,
+			"contact_name":     contact.Contact_name,
+			"relationship":     contact.Relationship,
+			"phone_number":     contact.Phone_number,
+			"email":            nullIfEmpty(contact.Email),
+			"priority":         contact.Priority,
+			"consent_to_share": contact.Consent_to_share,
+		})
+		if err != nil {
+			return fmt.Errorf("insert emergency contact failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// getPatientsEmergencyContacts returns the emergency contacts of each of the patients in priority order, keyed by patient id
+func getPatientsEmergencyContacts(patientIDs []string) (map[string][]patients.EmergencyContact, error) {
+	results, err := SelectData("Patient_emergency_contact", []string{"*"}, true, "patient_id = ANY($1)", []interface{}{pq.Array(patientIDs)}, false, "", "", "ORDER BY priority")
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := map[string][]patients.EmergencyContact{}
+	for _, patientID := range patientIDs {
+		contacts[patientID] = []patients.EmergencyContact{}
+	}
+	for _, row := range results {
+		patientID := row["patient_id"].(string)
+		contacts[patientID] = append(contacts[patientID], patients.EmergencyContact{
+			Contact_id:       row["contact_id"].(int64),
+			Contact_name:     row["contact_name"].(string),
+			Relationship:     row["relationship"].(string),
+			Phone_number:     row["phone_number"].(string),
+			Email:            stringOrEmpty(row["email"]),
+			Priority:         int(row["priority"].(int64)),
+			Consent_to_share: row["consent_to_share"].(bool),
+		})
+	}
+	return contacts, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/lib/pq"
+)
+
+// EmployeeSearchError is a filter or sort of the employee search that cannot be applied
+type EmployeeSearchError struct {
+	Message string
+}
+
+func (e *EmployeeSearchError) Error() string {
+	return e.Message
+}
+
+// employeeSortColumns are the columns the employee search can sort by, on the Employee / Position / Department join
+var employeeSortColumns = map[string]string{
+	"employee_id":      "Employee.employee_id",
+	"first_name":       "Employee.first_name",
+	"last_name":        "Employee.last_name",
+	"position_name":    "Position.position_name",
+	"department_name":  "Department.department_name",
+	"salary":           "Employee.salary",
+	"hire_date":        "Employee.hire_date",
+	"resignation_date": "Employee.resignation_date",
+	"work_status":      "Employee.work_status",
+}
+
+// splitSearchIds reads a filter holding one id or several separated by commas
+func splitSearchIds(value string) []string {
+	ids := []string{}
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// employeeSearchWhere is the WHERE clause of the employee search: employeeSearchCondition on id and names, then the
+// advanced filters that are set, everything combined with AND
+func employeeSearchWhere(req models.SearchEmployee) (string, []interface{}, error) {
+	whereCon := employeeSearchCondition
+	args := []interface{}{req.Employee_id, req.First_name, req.Last_name}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		whereCon += " AND " + fmt.Sprintf(condition, fmt.Sprintf("$%d", len(args)))
+	}
+
+	if ids := splitSearchIds(req.Department_id); len(ids) > 0 {
+		add("Department.department_id = ANY(%s)", pq.Array(ids))
+	}
+	if ids := splitSearchIds(req.Position_id); len(ids) > 0 {
+		add("Employee.position_id = ANY(%s)", pq.Array(ids))
+	}
+	if req.Work_status != "" {
+		if req.Work_status != "yes" && req.Work_status != "no" {
+			return "", nil, &EmployeeSearchError{Message: "work_status must be yes or no"}
+		}
+		add("Employee.work_status = %s", req.Work_status)
+	}
+
+	if req.Salary_min != nil && req.Salary_max != nil && *req.Salary_min > *req.Salary_max {
+		return "", nil, &EmployeeSearchError{Message: "salary_min must not be greater than salary_max"}
+	}
+	if req.Salary_min != nil {
+		add("Employee.salary >= %s", *req.Salary_min)
+	}
+	if req.Salary_max != nil {
+		add("Employee.salary <= %s", *req.Salary_max)
+	}
+
+	dates := []struct {
+		field     string
+		value     string
+		condition string
+	}{
+		{"hired_from", req.Hired_from, "Employee.hire_date >= %s::date"},
+		{"hired_to", req.Hired_to, "Employee.hire_date <= %s::date"},
+		{"resigned_from", req.Resigned_from, "Employee.resignation_date >= %s::date"},
+		{"resigned_to", req.Resigned_to, "Employee.resignation_date <= %s::date"},
+	}
+	for _, date := range dates {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date.value); err != nil {
+			return "", nil, &EmployeeSearchError{Message: date.field + " must be YYYY-MM-DD"}
+		}
+		add(date.condition, date.value)
+	}
+	return whereCon, args, nil
+}
+
+// employeeSearchOrder turns the sort of the search ("department_name,-salary") into its ORDER BY clause. The employee
+// id is always the last key so pages are stable
+func employeeSearchOrder(sort string) (string, error) {
+	if strings.TrimSpace(sort) == "" {
+		return "ORDER BY Employee.employee_id DESC", nil
+	}
+
+	keys := []string{}
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		direction := "ASC"
+		if strings.HasPrefix(key, "-") {
+			direction = "DESC"
+			key = key[1:]
+		}
+		column, ok := employeeSortColumns[key]
+		if !ok {
+			return "", &EmployeeSearchError{Message: fmt.Sprintf("cannot sort by %q", key)}
+		}
+		if column == "Employee.resignation_date" {
+			direction += " NULLS LAST"
+		}
+		keys = append(keys, column+" "+direction)
+	}
+	return "ORDER BY " + strings.Join(keys, ", ") + ", Employee.employee_id", nil
+}
+
+// EmployeeSearchFromQuery reads the employee search from query parameters named like the JSON fields (used by the export)
+func EmployeeSearchFromQuery(query url.Values) (models.SearchEmployee, error) {
+	req := models.SearchEmployee{
+		Employee_id:   query.Get("employee_id"),
+		First_name:    query.Get("first_name"),
+		Last_name:     query.Get("last_name"),
+		Department_id: query.Get("department_id"),
+		Position_id:   query.Get("position_id"),
+		Work_status:   query.Get("work_status"),
+		Hired_from:    query.Get("hired_from"),
+		Hired_to:      query.Get("hired_to"),
+		Resigned_from: query.Get("resigned_from"),
+		Resigned_to:   query.Get("resigned_to"),
+		Sort:          query.Get("sort"),
+	}
+	for _, bound := range []struct {
+		field string
+		value **float64
+	}{{"salary_min", &req.Salary_min}, {"salary_max", &req.Salary_max}} {
+		if raw := query.Get(bound.field); raw != "" {
+			salary, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return req, &EmployeeSearchError{Message: bound.field + " must be a number"}
+			}
+			*bound.value = &salary
+		}
+	}
+	return req, nil
+}
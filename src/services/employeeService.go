@@ -2,98 +2,59 @@ package services
 
 import (
 	"database/sql" // เพิ่มการ import
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/lib/pq"
 )
-func GetEmployeeSearch(id string,first_name string,last_name string) ([]models.EmployeeResponse, error) {
-	selectedColumns := []string{
-		"Employee.employee_id",
-		"Employee.first_name",
-		"Employee.last_name",
-		"Position.position_name",
-		"Employee.phone_number",
-		"Department.department_name",
-		"Employee.salary",
-		"Employee.email",
-		"Employee.hire_date",
-		"Employee.resignation_date",
-		"Employee.work_status",
+
+// employeeSearchCondition is the employee search filter, shared with the exports: $1 exact employee id, $2 / $3 part of
+// the first / last name, an empty value matches everyone
+const employeeSearchCondition = "($1 = '' OR employee_id = $1) AND ($2 = '' OR first_name ILIKE '%' || $2 || '%') AND ($3 = '' OR last_name ILIKE '%' || $3 || '%')"
+
+// GetEmployeeSearch returns the employees matching every filter of req that is set, in the order of req.Sort
+func GetEmployeeSearch(req models.SearchEmployee) ([]models.EmployeeResponse, error) {
+	whereCon, args, err := employeeSearchWhere(req)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := employeeSearchOrder(req.Sort)
+	if err != nil {
+		return nil, err
 	}
-	joinTables := "Position ON employee.position_id = position.position_id JOIN Department ON position.department_id = department.department_id"
 
 	results, err := SelectData(
-		"Employee",      // main table
-		selectedColumns, // columns to select
-		true,           // ไม่มี WHERE
-		"($1 = '' OR employee_id = $1) AND ($2 = '' OR first_name ILIKE '%' || $2 || '%') AND ($3 = '' OR last_name ILIKE '%' || $3 || '%')",              // เงื่อนไข WHERE ว่าง
-		[]interface{}{id,first_name,last_name},             // ไม่มี args
-		true,            // ใช้ JOIN
-		joinTables,      // joinTables ที่รวม INNER JOIN ไว้แล้ว
-		"",              // joinCondition เว้นว่าง
-		"ORDER BY employee_id DESC",
+		"Employee",              // main table
+		employeeResponseColumns, // columns to select
+		true,                    // มี WHERE
+		whereCon,                // id, names and the advanced filters
+		args,
+		true,               // ใช้ JOIN
+		employeeJoinTables, // joinTables ที่รวม INNER JOIN ไว้แล้ว
+		"",                 // joinCondition เว้นว่าง
+		orderBy,
 	)
-
 	if err != nil {
 		return nil, err
 	}
 
-	var employees []models.EmployeeResponse
-
+	employees := []models.EmployeeResponse{}
 	for _, row := range results {
-		// จัดการกับ resignation_date ที่อาจเป็น NULL
-		var resignationDate sql.NullTime
-		if row["resignation_date"] != nil {
-			resignationDate = sql.NullTime{Time: row["resignation_date"].(time.Time), Valid: true}
-		}
-
-		// ตรวจสอบ resignation_date ว่ามีค่าเป็น "0001-01-01T00:00:00Z" หรือไม่
-		if resignationDate.Valid && resignationDate.Time.Year() == 1 && resignationDate.Time.Month() == 1 && resignationDate.Time.Day() == 1 {
-			resignationDate.Valid = false // ถ้าเป็นค่า default ให้ถือว่าเป็น NULL
-		}
-
-		// แปลง salary ให้เป็น float64
-		salary := parseSalary(row["salary"])
-
-		// แปลง work_status ให้เป็น string
-		workStatus := string(row["work_status"].([]byte))
-
-		// ตรวจสอบ resignation_date และถ้า NULL หรือค่ามาตรฐานให้เปลี่ยนเป็นข้อความ
-		var resignationDateStr string
-		if resignationDate.Valid {
-			// ถ้า resignation_date มีค่า, format เป็น YYYY-MM-DD
-			resignationDateStr = resignationDate.Time.Format("2006-01-02")
-		} else {
-			resignationDateStr = "Not resigned yet" // ถ้าไม่มีการลาออก
-		}
-
-		// แปลง hire_date เป็น string
-		hireDate := row["hire_date"].(time.Time).Format("2006-01-02")
-
-		// สร้าง struct ของ Employee
-		employee := models.EmployeeResponse{
-			Employee_id:      fmt.Sprintf("%v", row["employee_id"]),
-			First_name:       fmt.Sprintf("%v", row["first_name"]),
-			Last_name:        fmt.Sprintf("%v", row["last_name"]),
-			Position_name:    fmt.Sprintf("%v", row["position_name"]),
-			Phone_number:     fmt.Sprintf("%v", row["phone_number"]),
-			Department_name:  fmt.Sprintf("%v", row["department_name"]),
-			Salary:           salary, // salary ที่แปลงแล้ว
-			Email:            fmt.Sprintf("%v", row["email"]),
-			Hire_date:        hireDate,           // แปลง hire_date เป็นรูปแบบที่ต้องการ
-			Resignation_date: resignationDateStr, // เปลี่ยนเป็นข้อความตามที่ต้องการ
-			Work_status:      workStatus,         // work_status ที่แปลงแล้ว
-		}
-
-		employees = append(employees, employee)
-		fmt.Println(employee)
+		employees = append(employees, employeeFromRow(row))
 	}
 
 	return employees, nil
 }
 
 func UpdateEmployee(id string, data map[string]interface{}) (int64, error) {
+	if positionID, ok := data["position_id"].(string); ok {
+		if err := checkPositionExists(positionID); err != nil {
+			return 0, err
+		}
+	}
+
 	table := "Employee"
 	condition := "employee_id = $1"
 	conditionValues := []interface{}{id}
@@ -106,9 +67,56 @@ func UpdateEmployee(id string, data map[string]interface{}) (int64, error) {
 	return rowsAffected, nil
 }
 
+// ValidateNewEmployee checks the fields AddEmployee needs
+func ValidateNewEmployee(req models.EmployeeInsert) error {
+	if req.Employee_id == "" || req.First_name == "" || req.Last_name == "" ||
+		req.Position_id == "" || req.Phone_number == "" ||
+		req.Email == "" || req.Hire_date == "" || req.Work_status == "" || req.Salary == 0 {
+		return fmt.Errorf("All fields are required")
+	}
+	return nil
+}
+
+// EmployeeInsertData maps an EmployeeInsert onto the Employee columns for AddEmployee
+func EmployeeInsertData(req models.EmployeeInsert) map[string]interface{} {
+	data := map[string]interface{}{
+		"employee_id":      req.Employee_id,
+		"first_name":       req.First_name,
+		"last_name":        req.Last_name,
+		"position_id":      req.Position_id,
+		"phone_number":     req.Phone_number,
+		"salary":           req.Salary,
+		"email":            req.Email,
+		"hire_date":        req.Hire_date,
+		"resignation_date": nil,
+		"work_status":      req.Work_status,
+	}
+
+	if req.Resignation_date != "" {
+		data["resignation_date"] = req.Resignation_date
+	}
+	return data
+}
+
 func AddEmployee(data map[string]interface{}) (int64, error) {
-	table := "Employee"
-	rowsAffected, err := InsertData(table, data)
+	if err := checkPositionExists(fmt.Sprintf("%v", data["position_id"])); err != nil {
+		return 0, err
+	}
+
+	// The employee and its employee.created event commit together
+	var rowsAffected int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		rowsAffected, err = addEmployeeTx(tx, data)
+		return err
+	})
+	if isUniqueViolation(err) {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "employee_pkey" {
+			return 0, fmt.Errorf("employee already exists")
+		}
+		return 0, fmt.Errorf("email, phone number or name already belongs to another employee")
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -116,39 +124,35 @@ func AddEmployee(data map[string]interface{}) (int64, error) {
 	return rowsAffected, nil
 }
 
-func GetEmployee(employeeID string) (*models.EmployeeResponse, error) {
-	fields := []string{
-		"Employee.employee_id",
-		"Employee.first_name",
-		"Employee.last_name",
-		"Position.position_name",
-		"Employee.phone_number",
-		"Department.department_name",
-		"Employee.salary",
-		"Employee.email",
-		"Employee.hire_date",
-		"Employee.resignation_date",
-		"Employee.work_status",
+// addEmployeeTx inserts the employee and records employee.created in the caller's transaction, shared by AddEmployee and the CSV import
+func addEmployeeTx(tx *sql.Tx, data map[string]interface{}) (int64, error) {
+	rowsAffected, err := InsertDataTx(tx, "Employee", data)
+	if err != nil {
+		return 0, err
 	}
-	// กำหนด joinTables แบบ JOIN statement
-	joinTables := "Position ON employee.position_id = position.position_id JOIN Department ON position.department_id = department.department_id"
 
-	// WHERE clause + arguments
-	whereCondition := "Employee.employee_id = $1"
-	args := []interface{}{employeeID}
+	return rowsAffected, recordEmployeeCreatedTx(tx, models.EmployeeCreatedEvent{
+		Employee_id: fmt.Sprintf("%v", data["employee_id"]),
+		First_name:  fmt.Sprintf("%v", data["first_name"]),
+		Last_name:   fmt.Sprintf("%v", data["last_name"]),
+		Position_id: fmt.Sprintf("%v", data["position_id"]),
+		Email:       fmt.Sprintf("%v", data["email"]),
+		Hire_date:   fmt.Sprintf("%v", data["hire_date"]),
+	})
+}
 
+func GetEmployee(employeeID string) (*models.EmployeeResponse, error) {
 	results, err := SelectData(
-		"Employee",     // main table
-		fields,         // []string เช่น []{"Employee.name", "Department.name", "Position.title"}
-		true,           // where
-		whereCondition, // เช่น "Employee.salary > ?"
-		args,           // []interface{}{50000}
-		true,           // join
-		joinTables,     // joinTable ที่รวม INNER JOIN ไว้
-		"",             // joinCondition เว้นว่างเพราะรวมไว้แล้ว
+		"Employee",
+		employeeResponseColumns,
+		true,
+		"Employee.employee_id = $1",
+		[]interface{}{employeeID},
+		true,
+		employeeJoinTables, // joinTable ที่รวม INNER JOIN ไว้
+		"",
 		"",
 	)
-
 	if err != nil {
 		return nil, err
 	}
@@ -157,126 +161,179 @@ func GetEmployee(employeeID string) (*models.EmployeeResponse, error) {
 		return nil, fmt.Errorf("employee not found")
 	}
 
-	row := results[0]
+	employee := employeeFromRow(results[0])
+	return &employee, nil
+}
 
-	// แปลง resignation_date
-	var resignationDateStr string
-	if row["resignation_date"] == nil {
-		resignationDateStr = "Not resigned yet"
-	} else {
-		date := row["resignation_date"].(time.Time)
-		if date.IsZero() || date.Year() == 1 {
-			resignationDateStr = "Not resigned yet"
-		} else {
-			resignationDateStr = date.Format("2006-01-02")
-		}
+func GetAllEmployee() ([]models.EmployeeResponse, error) {
+	results, err := SelectData(
+		"Employee",              // main table
+		employeeResponseColumns, // columns to select
+		false,                   // ไม่มี WHERE
+		"",                      // เงื่อนไข WHERE ว่าง
+		nil,                     // ไม่มี args
+		true,                    // ใช้ JOIN
+		employeeJoinTables,      // joinTables ที่รวม INNER JOIN ไว้แล้ว
+		"",                      // joinCondition เว้นว่าง
+		"ORDER BY employee_id DESC",
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	salary := parseSalary(row["salary"])
-	workStatus := string(row["work_status"].([]byte))
-	hireDate := row["hire_date"].(time.Time).Format("2006-01-02")
-
-	employee := &models.EmployeeResponse{
-		Employee_id:      fmt.Sprintf("%v", row["employee_id"]),
-		First_name:       fmt.Sprintf("%v", row["first_name"]),
-		Last_name:        fmt.Sprintf("%v", row["last_name"]),
-		Position_name:    fmt.Sprintf("%v", row["position_name"]),
-		Phone_number:     fmt.Sprintf("%v", row["phone_number"]),
-		Department_name:  fmt.Sprintf("%v", row["department_name"]),
-		Salary:           salary,
-		Email:            fmt.Sprintf("%v", row["email"]),
-		Hire_date:        hireDate,
-		Resignation_date: resignationDateStr,
-		Work_status:      workStatus,
+	employees := []models.EmployeeResponse{}
+	for _, row := range results {
+		employees = append(employees, employeeFromRow(row))
 	}
 
-	return employee, nil
+	return employees, nil
 }
 
-func GetAllEmployee() ([]models.EmployeeResponse, error) {
-	selectedColumns := []string{
-		"Employee.employee_id",
-		"Employee.first_name",
-		"Employee.last_name",
-		"Position.position_name",
-		"Employee.phone_number",
-		"Department.department_name",
-		"Employee.salary",
-		"Employee.email",
-		"Employee.hire_date",
-		"Employee.resignation_date",
-		"Employee.work_status",
+// OffboardEmployee ends an employee's employment and everything tied to it in one transaction:
+// resignation data, their login (disabled + outstanding tokens revoked), their future appointments and an Employee_offboarding log row
+func OffboardEmployee(employeeID string, req models.EmployeeOffboardRequest, performedBy string) (*models.EmployeeOffboardResponse, error) {
+	if req.Resignation_date != "" {
+		if _, err := time.Parse("2006-01-02", req.Resignation_date); err != nil {
+			return nil, fmt.Errorf("resignation_date must be in YYYY-MM-DD format")
+		}
 	}
-	joinTables := "Position ON employee.position_id = position.position_id JOIN Department ON position.department_id = department.department_id"
-
-	results, err := SelectData(
-		"Employee",      // main table
-		selectedColumns, // columns to select
-		false,           // ไม่มี WHERE
-		"",              // เงื่อนไข WHERE ว่าง
-		nil,             // ไม่มี args
-		true,            // ใช้ JOIN
-		joinTables,      // joinTables ที่รวม INNER JOIN ไว้แล้ว
-		"",              // joinCondition เว้นว่าง
-		"ORDER BY employee_id DESC",
-	)
 
-	if err != nil {
-		return nil, err
+	if req.Reassign_to == employeeID {
+		return nil, fmt.Errorf("cannot reassign appointments to the employee being offboarded")
 	}
 
-	var employees []models.EmployeeResponse
+	response := &models.EmployeeOffboardResponse{
+		Employee_id:   employeeID,
+		Reassigned_to: req.Reassign_to,
+	}
 
-	for _, row := range results {
-		// จัดการกับ resignation_date ที่อาจเป็น NULL
-		var resignationDate sql.NullTime
-		if row["resignation_date"] != nil {
-			resignationDate = sql.NullTime{Time: row["resignation_date"].(time.Time), Valid: true}
+	err := WithTransaction(func(tx *sql.Tx) error {
+		// Lock the employee row so two offboardings of the same person cannot run at once
+		results, err := SelectDataTx(tx, "Employee", []string{"employee_id", "user_id", "resignation_date"}, true, "employee_id = $1", []interface{}{employeeID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("employee not found")
 		}
+		employee := results[0]
 
-		// ตรวจสอบ resignation_date ว่ามีค่าเป็น "0001-01-01T00:00:00Z" หรือไม่
-		if resignationDate.Valid && resignationDate.Time.Year() == 1 && resignationDate.Time.Month() == 1 && resignationDate.Time.Day() == 1 {
-			resignationDate.Valid = false // ถ้าเป็นค่า default ให้ถือว่าเป็น NULL
+		previous, err := SelectDataTx(tx, "Employee_offboarding", []string{"offboarding_id"}, true, "employee_id = $1", []interface{}{employeeID}, false, "", "", "")
+		if err != nil {
+			return err
+		}
+		if len(previous) > 0 {
+			return fmt.Errorf("employee has already been offboarded")
 		}
 
-		// แปลง salary ให้เป็น float64
-		salary := parseSalary(row["salary"])
+		// Keep a resignation date that was already recorded through UpdateEmployee unless a new one is given
+		resignationDate := req.Resignation_date
+		if resignationDate == "" {
+			if employee["resignation_date"] != nil {
+				resignationDate = employee["resignation_date"].(time.Time).Format("2006-01-02")
+			} else {
+				resignationDate = time.Now().Format("2006-01-02")
+			}
+		}
+		response.Resignation_date = resignationDate
+
+		var reassignTo interface{} // nil = leave the appointments without an employee
+		if req.Reassign_to != "" {
+			replacement, err := SelectDataTx(tx, "Employee", []string{"employee_id"}, true, "employee_id = $1 AND work_status = 'yes'", []interface{}{req.Reassign_to}, false, "", "", "")
+			if err != nil {
+				return err
+			}
+			if len(replacement) == 0 {
+				return fmt.Errorf("reassign_to employee not found or not active")
+			}
+			reassignTo = req.Reassign_to
+		}
 
-		// แปลง work_status ให้เป็น string
-		workStatus := string(row["work_status"].([]byte))
+		_, err = UpdateDataTx(tx, "Employee", map[string]interface{}{
+			"resignation_date": resignationDate,
+			"work_status":      "no",
+		}, "employee_id = $1", []interface{}{employeeID})
+		if err != nil {
+			return err
+		}
 
-		// ตรวจสอบ resignation_date และถ้า NULL หรือค่ามาตรฐานให้เปลี่ยนเป็นข้อความ
-		var resignationDateStr string
-		if resignationDate.Valid {
-			// ถ้า resignation_date มีค่า, format เป็น YYYY-MM-DD
-			resignationDateStr = resignationDate.Time.Format("2006-01-02")
-		} else {
-			resignationDateStr = "Not resigned yet" // ถ้าไม่มีการลาออก
+		// Disable the linked account and revoke every token issued before now
+		if employee["user_id"] != nil {
+			_, err = UpdateDataTx(tx, "Users", map[string]interface{}{
+				"is_active":         false,
+				"tokens_revoked_at": time.Now().UTC(), // TIMESTAMP column, read back as UTC by checkTokenRevocation
+			}, "user_id = $1", []interface{}{employee["user_id"]})
+			if err != nil {
+				return err
+			}
+			response.Account_disabled = true
 		}
 
-		// แปลง hire_date เป็น string
-		hireDate := row["hire_date"].(time.Time).Format("2006-01-02")
-
-		// สร้าง struct ของ Employee
-		employee := models.EmployeeResponse{
-			Employee_id:      fmt.Sprintf("%v", row["employee_id"]),
-			First_name:       fmt.Sprintf("%v", row["first_name"]),
-			Last_name:        fmt.Sprintf("%v", row["last_name"]),
-			Position_name:    fmt.Sprintf("%v", row["position_name"]),
-			Phone_number:     fmt.Sprintf("%v", row["phone_number"]),
-			Department_name:  fmt.Sprintf("%v", row["department_name"]),
-			Salary:           salary, // salary ที่แปลงแล้ว
-			Email:            fmt.Sprintf("%v", row["email"]),
-			Hire_date:        hireDate,           // แปลง hire_date เป็นรูปแบบที่ต้องการ
-			Resignation_date: resignationDateStr, // เปลี่ยนเป็นข้อความตามที่ต้องการ
-			Work_status:      workStatus,         // work_status ที่แปลงแล้ว
+		reassigned, err := UpdateDataTx(tx, "Patient_Appointment", map[string]interface{}{"employee_id": reassignTo},
+			"employee_id = $1 AND (date > CURRENT_DATE OR (date = CURRENT_DATE AND time > CURRENT_TIME))", []interface{}{employeeID})
+		if err != nil {
+			return err
 		}
+		response.Appointments_reassigned = reassigned
+
+		_, err = InsertDataTx(tx, "Employee_offboarding", map[string]interface{}{
+			"employee_id":             employeeID,
+			"resignation_date":        resignationDate,
+			"reason":                  req.Reason,
+			"reassigned_to":           reassignTo,
+			"appointments_reassigned": reassigned,
+			"account_disabled":        response.Account_disabled,
+			"performed_by":            performedBy,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		employees = append(employees, employee)
-		fmt.Println(employee)
+	return response, nil
+}
+
+// Columns and JOIN of every query that returns models.EmployeeResponse (GetEmployee, GetAllEmployee, GetEmployeeSearch, department employees)
+var employeeResponseColumns = []string{
+	"Employee.employee_id",
+	"Employee.first_name",
+	"Employee.last_name",
+	"Position.position_name",
+	"Employee.phone_number",
+	"Department.department_name",
+	"Employee.salary",
+	"Employee.email",
+	"Employee.hire_date",
+	"Employee.resignation_date",
+	"Employee.work_status",
+}
+
+const employeeJoinTables = "Position ON employee.position_id = position.position_id JOIN Department ON position.department_id = department.department_id"
+
+// แปลง row ที่ select ด้วย employeeResponseColumns เป็น EmployeeResponse
+func employeeFromRow(row map[string]interface{}) models.EmployeeResponse {
+	resignationDateStr := "Not resigned yet"
+	if row["resignation_date"] != nil {
+		date := row["resignation_date"].(time.Time)
+		if !date.IsZero() && date.Year() != 1 {
+			resignationDateStr = date.Format("2006-01-02")
+		}
 	}
 
-	return employees, nil
+	return models.EmployeeResponse{
+		Employee_id:      fmt.Sprintf("%v", row["employee_id"]),
+		First_name:       fmt.Sprintf("%v", row["first_name"]),
+		Last_name:        fmt.Sprintf("%v", row["last_name"]),
+		Position_name:    fmt.Sprintf("%v", row["position_name"]),
+		Phone_number:     fmt.Sprintf("%v", row["phone_number"]),
+		Department_name:  fmt.Sprintf("%v", row["department_name"]),
+		Salary:           parseSalary(row["salary"]),
+		Email:            fmt.Sprintf("%v", row["email"]),
+		Hire_date:        row["hire_date"].(time.Time).Format("2006-01-02"),
+		Resignation_date: resignationDateStr,
+		Work_status:      string(row["work_status"].([]byte)),
+	}
 }
 
 // ใช้แปลง salary เป็น float64
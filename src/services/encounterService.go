@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// validateEncounter checks the references of an encounter before anything is written
+func validateEncounter(req patients.AddPatientHistory) error {
+	if req.Employee_id != "" {
+		if err := checkActiveEmployee(req.Employee_id); err != nil {
+			return err
+		}
+	}
+
+	// Vitals are stored as observations, so they are checked against the plausible range of their observation type
+	err := validateObservations(encounterVitalObservations(req.Vitals), func(_ int, input patients.ObservationInput) string {
+		return "vitals." + input.Observation_type
+	})
+	if err != nil {
+		return err
+	}
+
+	primaryCount := 0
+	var diseaseIDs []string
+	listed := map[string]bool{}
+	for _, diagnosis := range req.Diagnoses {
+		// (medical_history_id, disease_id) is the key of Encounter_diagnosis
+		if listed[diagnosis.Disease_id] {
+			return fmt.Errorf("a disease can only be diagnosed once per encounter")
+		}
+		listed[diagnosis.Disease_id] = true
+		diseaseIDs = append(diseaseIDs, diagnosis.Disease_id)
+		if diagnosis.Is_primary {
+			primaryCount++
+		}
+	}
+	if primaryCount > 1 {
+		return fmt.Errorf("only one diagnosis can be primary")
+	}
+
+	unknown, err := findUnknownIds("Disease", "disease_id", diseaseIDs)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return &UnknownCatalogIdError{Field: "disease_id", Ids: unknown}
+	}
+
+	return nil
+}
+
+// checkActiveEmployee fails unless the employee exists and still works here
+func checkActiveEmployee(employeeID string) error {
+	employee, err := SelectData("Employee", []string{"employee_id"}, true, "employee_id = $1 AND work_status = 'yes'", []interface{}{employeeID}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+	if len(employee) == 0 {
+		return fmt.Errorf("employee not found or not active")
+	}
+	return nil
+}
+
+// getPatientsEncounters returns the encounters of each of the patients newest first, keyed by patient id (an empty list
+// for a patient without encounters). Diagnoses and vitals are loaded for all of the patients at once
+func getPatientsEncounters(patientIDs []string) (map[string][]patients.Encounter, error) {
+	fields := []string{
+		"medical_history_id",
+		"patient_id",
+		"date",
+		"time",
+		"employee_id",
+		"(SELECT first_name || ' ' || last_name FROM Employee WHERE Employee.employee_id = Medical_history.employee_id) AS clinician_name",
+		"chief_complaint",
+		"plan",
+		"detail",
+	}
+	results, err := SelectData("Medical_history", fields, true, "patient_id = ANY($1)", []interface{}{pq.Array(patientIDs)}, false, "", "", "ORDER BY date DESC, time DESC, medical_history_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	diagnoses, err := getPatientsEncounterDiagnoses(patientIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	vitals, err := getPatientsEncounterVitals(patientIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	encounters := map[string][]patients.Encounter{}
+	for _, patientID := range patientIDs {
+		encounters[patientID] = []patients.Encounter{}
+	}
+	for _, row := range results {
+		encounterID := row["medical_history_id"].(int64)
+		patientID := row["patient_id"].(string)
+		encounters[patientID] = append(encounters[patientID], patients.Encounter{
+			Encounter_id:    encounterID,
+			Date:            row["date"].(time.Time).Format("02-01-2006"),
+			Time:            row["time"].(time.Time).Format("15:04:05"),
+			Employee_id:     stringOrEmpty(row["employee_id"]),
+			Clinician_name:  stringOrEmpty(row["clinician_name"]),
+			Chief_complaint: stringOrEmpty(row["chief_complaint"]),
+			Vitals:          vitals[encounterID],
+			Diagnoses:       diagnoses[encounterID],
+			Plan:            stringOrEmpty(row["plan"]),
+			Notes:           row["detail"].(string),
+		})
+	}
+
+	return encounters, nil
+}
+
+// getPatientsEncounterDiagnoses loads the diagnoses of all encounters of the patients in one query, keyed by encounter id
+func getPatientsEncounterDiagnoses(patientIDs []string) (map[int64][]patients.EncounterDiagnosis, error) {
+	fields := []string{
+		"Encounter_diagnosis.medical_history_id",
+		"Disease.disease_id",
+		"Disease.disease_name",
+		"Disease.icd10_code",
+		"Encounter_diagnosis.is_primary",
+	}
+	results, err := SelectData(
+		"Encounter_diagnosis",
+		fields,
+		true,
+		"Encounter_diagnosis.medical_history_id IN (SELECT medical_history_id FROM Medical_history WHERE patient_id = ANY($1))",
+		[]interface{}{pq.Array(patientIDs)},
+		true,
+		"Disease ON Encounter_diagnosis.disease_id = Disease.disease_id",
+		"",
+		"ORDER BY Encounter_diagnosis.is_primary DESC, Disease.disease_name")
+	if err != nil {
+		return nil, err
+	}
+
+	diagnoses := map[int64][]patients.EncounterDiagnosis{}
+	for _, row := range results {
+		encounterID := row["medical_history_id"].(int64)
+		diagnoses[encounterID] = append(diagnoses[encounterID], patients.EncounterDiagnosis{
+			Disease_id:   row["disease_id"].(string),
+			Disease_name: row["disease_name"].(string),
+			Icd10_code:   stringOrEmpty(row["icd10_code"]),
+			Is_primary:   row["is_primary"].(bool),
+		})
+	}
+
+	return diagnoses, nil
+}
+
+// floatOrNil converts a nullable NUMERIC column (returned as []byte by lib/pq), NULL becomes nil
+func floatOrNil(value interface{}) *float64 {
+	raw, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/utils/eventbus"
+)
+
+// Real-time topics. Each is followed as a whole ("queue") or for one id ("queue:D001")
+const (
+	TopicQueue      = "queue"       // queue:<department_id>, waiting room changes
+	TopicSchedule   = "schedule"    // schedule:<employee_id>, appointments of a doctor
+	TopicLabResults = "lab-results" // lab-results:<patient_id>, lab results entered and verified
+)
+
+// TopicAccessError is returned by CheckTopicAccess when the role may not follow the topic
+type TopicAccessError struct {
+	Topic string
+}
+
+func (e *TopicAccessError) Error() string {
+	return fmt.Sprintf("not allowed to follow topic %s", e.Topic)
+}
+
+// CheckTopicAccess validates a topic and checks that a user with role (and patientID for patients) may follow it.
+// Staff follow queues and schedules; lab results are for clinicians, and for patients on their own topic only
+func CheckTopicAccess(role string, patientID string, topic string) error {
+	parts := strings.Split(topic, ":")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] == "") {
+		return fmt.Errorf("invalid topic %s", topic)
+	}
+
+	switch parts[0] {
+	case TopicQueue, TopicSchedule:
+		if role == "HR" || role == "medical_personnel" {
+			return nil
+		}
+	case TopicLabResults:
+		if role == "medical_personnel" {
+			return nil
+		}
+		if role == "patient" && len(parts) == 2 && parts[1] == patientID && patientID != "" {
+			return nil
+		}
+	default:
+		return fmt.Errorf("invalid topic %s", topic)
+	}
+	return &TopicAccessError{Topic: topic}
+}
+
+// The publish helpers are called after the transaction has committed, so subscribers never see a change that was rolled back
+
+func publishQueueEvent(eventType string, entry *patients.QueueEntry) {
+	eventbus.Publish(TopicQueue+":"+entry.Department_id, eventType, entry)
+}
+
+func publishScheduleEvent(employeeID string, eventType string, data map[string]interface{}) {
+	if employeeID == "" {
+		return
+	}
+	eventbus.Publish(TopicSchedule+":"+employeeID, eventType, data)
+}
+
+func publishLabResultEvent(patientID string, eventType string, data map[string]interface{}) {
+	eventbus.Publish(TopicLabResults+":"+patientID, eventType, data)
+}
+
+func appointmentEventData(appointmentID int64, patientID string, employeeID string, date string, clock string) map[string]interface{} {
+	return map[string]interface{}{
+		"appointment_id": appointmentID,
+		"patient_id":     patientID,
+		"employee_id":    employeeID,
+		"date":           date,
+		"time":           clock,
+	}
+}
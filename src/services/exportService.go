@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exports of the patient and employee lists. They take the filters of the search APIs, the rows come from StreamData
+// one at a time so an export of the whole table does not hold it in memory. Patient exports only include patients who
+// agreed to data sharing (consent registry)
+
+// ExportRequestError is returned before any row is read when the columns or filters of an export are invalid
+type ExportRequestError struct {
+	Message string
+}
+
+func (e *ExportRequestError) Error() string {
+	return e.Message
+}
+
+// exportColumn is one column of an export: the SQL expression selected AS its name and how its value is written
+type exportColumn struct {
+	name string
+	expr string
+	kind string // text, int, number, date
+}
+
+type exportSpec struct {
+	table     string
+	joinTable string
+	columns   []exportColumn
+	filters   []string // query parameters, in the order of the $n of condition
+	condition string
+	where     func(query url.Values) (string, []interface{}, string, error) // instead of filters / condition when the search has its own parser, with its ORDER BY ("" for orderBy)
+	orderBy   string
+	key       string // id of the row, handed to fn with its values
+}
+
+var exportEntities = map[string]exportSpec{
+	"patients": {
+		table: "Patient",
+		columns: []exportColumn{
+			{"patient_id", "Patient.patient_id", "text"},
+			{"first_name", "Patient.first_name", "text"},
+			{"last_name", "Patient.last_name", "text"},
+			{"age", "Patient.age", "int"},
+			{"gender", "Patient.gender", "text"},
+			{"date_of_birth", "Patient.date_of_birth", "date"},
+			{"blood_type", "Patient.blood_type", "text"},
+			{"email", "Patient.email", "text"},
+			{"health_insurance", patientHealthInsuranceColumn, "text"},
+			{"address", "Patient.address", "text"},
+			{"phone_number", "Patient.phone_number", "text"},
+			{"id_card_number", "Patient.id_card_number", "text"},
+			{"ongoing_treatment", "Patient.ongoing_treatment", "text"},
+			{"unhealthy_habits", "Patient.unhealthy_habits", "text"},
+			{"chronic_disease_ids", "(SELECT string_agg(disease_id, ';' ORDER BY disease_id) FROM Patient_chronic_disease pcd WHERE pcd.patient_id = Patient.patient_id)", "text"},
+			{"drug_allergy_ids", "(SELECT string_agg(drug_id, ';' ORDER BY drug_id) FROM Patient_drug_allergy pda WHERE pda.patient_id = Patient.patient_id AND pda.drug_id IS NOT NULL)", "text"},
+			{"drug_class_allergy_ids", "(SELECT string_agg(drug_class_id, ';' ORDER BY drug_class_id) FROM Patient_drug_allergy pda WHERE pda.patient_id = Patient.patient_id AND pda.drug_class_id IS NOT NULL)", "text"},
+		},
+		filters:   []string{"patient_id", "first_name", "last_name"},
+		condition: patientSearchCondition + " AND " + patientNotDeleted + " AND " + consentGrantedCondition("Patient.patient_id", ConsentDataSharing),
+		orderBy:   "ORDER BY Patient.patient_id",
+		key:       "Patient.patient_id",
+	},
+	"employees": {
+		table:     "Employee",
+		joinTable: "Position ON employee.position_id = position.position_id JOIN Department ON position.department_id = department.department_id",
+		columns: []exportColumn{
+			{"employee_id", "Employee.employee_id", "text"},
+			{"first_name", "Employee.first_name", "text"},
+			{"last_name", "Employee.last_name", "text"},
+			{"position_id", "Employee.position_id", "text"},
+			{"position_name", "Position.position_name", "text"},
+			{"department_id", "Department.department_id", "text"},
+			{"department_name", "Department.department_name", "text"},
+			{"phone_number", "Employee.phone_number", "text"},
+			{"salary", "Employee.salary", "number"},
+			{"email", "Employee.email", "text"},
+			{"hire_date", "Employee.hire_date", "date"},
+			{"resignation_date", "Employee.resignation_date", "date"},
+			{"work_status", "Employee.work_status", "text"},
+		},
+		where:   employeeExportWhere,
+		orderBy: "ORDER BY Employee.employee_id",
+		key:     "Employee.employee_id",
+	},
+}
+
+// employeeExportWhere applies the filters of the employee search (department, position, salary and date ranges, ...)
+// and its ?sort=, without one the export keeps the roster order
+func employeeExportWhere(query url.Values) (string, []interface{}, string, error) {
+	req, err := EmployeeSearchFromQuery(query)
+	if err != nil {
+		return "", nil, "", err
+	}
+	whereCon, args, err := employeeSearchWhere(req)
+	if err != nil {
+		return "", nil, "", err
+	}
+	orderBy := ""
+	if strings.TrimSpace(req.Sort) != "" {
+		if orderBy, err = employeeSearchOrder(req.Sort); err != nil {
+			return "", nil, "", err
+		}
+	}
+	return whereCon, args, orderBy, nil
+}
+
+// ExportColumns lists the columns of an entity's export in their default order
+func ExportColumns(entity string) []string {
+	columns := []string{}
+	for _, column := range exportEntities[entity].columns {
+		columns = append(columns, column.name)
+	}
+	return columns
+}
+
+// ExportRows streams the rows of entity matching the search filters in query (e.g. patient_id, first_name, last_name)
+// to fn, with the id of the row and the values of columns in that order (all columns when empty). Values are strings,
+// int64 or float64, dates are YYYY-MM-DD and a missing value is nil
+func ExportRows(ctx context.Context, entity string, columns []string, query url.Values, fn func(key string, values []interface{}) error) error {
+	spec := exportEntities[entity]
+	if len(columns) == 0 {
+		columns = ExportColumns(entity)
+	}
+
+	byName := map[string]exportColumn{}
+	for _, column := range spec.columns {
+		byName[column.name] = column
+	}
+	selected := []exportColumn{}
+	fields := []string{spec.key + " AS export_key"}
+	for _, name := range columns {
+		column, ok := byName[name]
+		if !ok {
+			return &ExportRequestError{Message: fmt.Sprintf("unknown column %q, the columns are %s", name, strings.Join(ExportColumns(entity), ", "))}
+		}
+		selected = append(selected, column)
+		fields = append(fields, column.expr+" AS export_"+column.name)
+	}
+
+	whereCon, args, orderBy := spec.condition, []interface{}{}, ""
+	if spec.where != nil {
+		var err error
+		if whereCon, args, orderBy, err = spec.where(query); err != nil {
+			return &ExportRequestError{Message: err.Error()}
+		}
+	} else {
+		for _, filter := range spec.filters {
+			args = append(args, strings.TrimSpace(query.Get(filter)))
+		}
+	}
+	if orderBy == "" {
+		orderBy = spec.orderBy
+	}
+
+	return StreamData(ctx, spec.table, fields, true, whereCon, args, spec.joinTable != "", spec.joinTable, "", orderBy, func(row map[string]interface{}) error {
+		values := make([]interface{}, len(selected))
+		for i, column := range selected {
+			values[i] = exportValue(row["export_"+column.name], column.kind)
+		}
+		return fn(row["export_key"].(string), values)
+	})
+}
+
+// exportValue turns a value scanned by lib/pq (enums and NUMERIC come back as []byte) into the value written to the file
+func exportValue(value interface{}, kind string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return v.Format("2006-01-02")
+	case []byte:
+		if kind == "number" {
+			if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+				return f
+			}
+		}
+		return string(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,681 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/fhir"
+	"github.com/lib/pq"
+)
+
+const FhirVersion = "4.0.1"
+
+// Code systems of the FHIR resources. The urn:hospital ones are our own ids, the others are the standard terminologies
+const (
+	fhirPatientIDSystem  = "urn:hospital:patient-id"
+	fhirNationalIDSystem = "urn:hospital:national-id" // id_card_number
+	fhirEmployeeIDSystem = "urn:hospital:employee-id"
+	fhirPositionSystem   = "urn:hospital:position"
+	fhirDepartmentSystem = "urn:hospital:department"
+	fhirDrugSystem       = "urn:hospital:drug"
+	fhirDrugClassSystem  = "urn:hospital:drug-class"
+	fhirDiseaseSystem    = "urn:hospital:disease"
+	fhirICD10System      = "http://hl7.org/fhir/sid/icd-10"
+	fhirATCSystem        = "http://www.whocc.no/atc"
+	fhirRxNormSystem     = "http://www.nlm.nih.gov/research/umls/rxnorm"
+)
+
+// FhirSearchError is returned for an invalid search parameter value, or for an unknown parameter with Prefer: handling=strict
+type FhirSearchError struct {
+	Message string
+}
+
+func (e *FhirSearchError) Error() string {
+	return e.Message
+}
+
+// fhirQuery collects the WHERE conditions of a search, each search parameter ANDs one condition
+type fhirQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add appends a condition, each $? in it stands for the next of values
+func (q *fhirQuery) add(condition string, values ...interface{}) {
+	for _, value := range values {
+		q.args = append(q.args, value)
+		condition = strings.Replace(condition, "$?", fmt.Sprintf("$%d", len(q.args)), 1)
+	}
+	q.conditions = append(q.conditions, condition)
+}
+
+type fhirSearchParam struct {
+	kind  string // token, string, date, reference, as listed in the CapabilityStatement
+	apply func(q *fhirQuery, modifier string, value string) error
+}
+
+// fhirResourceSpec maps a FHIR resource type onto a table
+type fhirResourceSpec struct {
+	table         string
+	fields        []string
+	idColumn      string
+	patientColumn string // set for patient data, only patients who agreed to data sharing (and were not deleted) are returned
+	order         string
+	params        map[string]fhirSearchParam
+	toResource    func(row map[string]interface{}) interface{}
+}
+
+// tokenParam matches column against a comma separated list of codes, a system| prefix is ignored
+func tokenParam(column string) fhirSearchParam {
+	return fhirSearchParam{kind: "token", apply: func(q *fhirQuery, modifier string, value string) error {
+		if modifier != "" {
+			return &FhirSearchError{Message: "modifier :" + modifier + " is not supported on token parameters"}
+		}
+		codes := []string{}
+		for _, code := range strings.Split(value, ",") {
+			if i := strings.LastIndex(code, "|"); i >= 0 {
+				code = code[i+1:]
+			}
+			codes = append(codes, code)
+		}
+		q.add(column+"::text = ANY($?)", pq.Array(codes))
+		return nil
+	}}
+}
+
+// stringParam matches any of columns, case-insensitive starts-with by default, :exact and :contains as in the FHIR spec
+func stringParam(columns ...string) fhirSearchParam {
+	return fhirSearchParam{kind: "string", apply: func(q *fhirQuery, modifier string, value string) error {
+		escaped := escapeLike(value)
+		operator, pattern := "ILIKE", escaped+"%"
+		switch modifier {
+		case "":
+		case "contains":
+			pattern = "%" + escaped + "%"
+		case "exact":
+			operator, pattern = "=", value
+		default:
+			return &FhirSearchError{Message: "modifier :" + modifier + " is not supported on string parameters"}
+		}
+
+		matches, values := []string{}, []interface{}{}
+		for _, column := range columns {
+			matches = append(matches, column+" "+operator+" $?")
+			values = append(values, pattern)
+		}
+		q.add("("+strings.Join(matches, " OR ")+")", values...)
+		return nil
+	}}
+}
+
+// dateParam compares a DATE column with [prefix]YYYY[-MM[-DD]], the value covers the whole year, month or day
+func dateParam(column string) fhirSearchParam {
+	return fhirSearchParam{kind: "date", apply: func(q *fhirQuery, modifier string, value string) error {
+		if modifier != "" {
+			return &FhirSearchError{Message: "modifier :" + modifier + " is not supported on date parameters"}
+		}
+
+		prefix := "eq"
+		if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+			prefix, value = value[:2], value[2:]
+		}
+
+		var start, end time.Time
+		var err error
+		switch len(value) {
+		case len("2006"):
+			start, err = time.Parse("2006", value)
+			end = start.AddDate(1, 0, 0)
+		case len("2006-01"):
+			start, err = time.Parse("2006-01", value)
+			end = start.AddDate(0, 1, 0)
+		case len("2006-01-02"):
+			start, err = time.Parse("2006-01-02", value)
+			end = start.AddDate(0, 0, 1)
+		default:
+			err = fmt.Errorf("invalid date")
+		}
+		if err != nil {
+			return &FhirSearchError{Message: "date must be YYYY, YYYY-MM or YYYY-MM-DD, optionally prefixed with eq, ne, lt, le, gt or ge"}
+		}
+		from, to := start.Format("2006-01-02"), end.Format("2006-01-02")
+
+		switch prefix {
+		case "eq":
+			q.add(column+" >= $?::date", from)
+			q.add(column+" < $?::date", to)
+		case "ne":
+			q.add("NOT ("+column+" >= $?::date AND "+column+" < $?::date)", from, to)
+		case "lt":
+			q.add(column+" < $?::date", from)
+		case "le":
+			q.add(column+" < $?::date", to)
+		case "gt":
+			q.add(column+" >= $?::date", to)
+		case "ge":
+			q.add(column+" >= $?::date", from)
+		default:
+			return &FhirSearchError{Message: "date prefix " + prefix + " is not supported, use eq, ne, lt, le, gt or ge"}
+		}
+		return nil
+	}}
+}
+
+// referenceParam matches column against "ResourceType/id" or a bare id
+func referenceParam(column string, resourceType string) fhirSearchParam {
+	return fhirSearchParam{kind: "reference", apply: func(q *fhirQuery, modifier string, value string) error {
+		if modifier != "" && modifier != resourceType {
+			return &FhirSearchError{Message: "this parameter only references " + resourceType}
+		}
+		if i := strings.LastIndex(value, "/"); i >= 0 {
+			if !strings.HasSuffix(value[:i], resourceType) {
+				return &FhirSearchError{Message: "this parameter only references " + resourceType}
+			}
+			value = value[i+1:]
+		}
+		q.add(column+"::text = $?", value)
+		return nil
+	}}
+}
+
+// activeParam is the active=true|false token, condition is the SQL for "active"
+func activeParam(condition string) fhirSearchParam {
+	return fhirSearchParam{kind: "token", apply: func(q *fhirQuery, modifier string, value string) error {
+		switch value {
+		case "true":
+			q.add(condition)
+		case "false":
+			q.add("NOT (" + condition + ")")
+		default:
+			return &FhirSearchError{Message: "active must be true or false"}
+		}
+		return nil
+	}}
+}
+
+// identifierParam matches [system|]value, each system is one column. Without a system any column may match
+func identifierParam(columns map[string]string) fhirSearchParam {
+	return fhirSearchParam{kind: "token", apply: func(q *fhirQuery, modifier string, value string) error {
+		if modifier != "" {
+			return &FhirSearchError{Message: "modifier :" + modifier + " is not supported on token parameters"}
+		}
+		system, hasSystem := "", false
+		if i := strings.Index(value, "|"); i >= 0 {
+			system, value, hasSystem = value[:i], value[i+1:], true
+		}
+
+		matches, values := []string{}, []interface{}{}
+		for columnSystem, column := range columns {
+			if !hasSystem || columnSystem == system {
+				matches = append(matches, column+" = $?")
+				values = append(values, value)
+			}
+		}
+		if len(matches) == 0 {
+			q.add("FALSE") // unknown system
+			return nil
+		}
+		sort.Strings(matches)
+		q.add("("+strings.Join(matches, " OR ")+")", values...)
+		return nil
+	}}
+}
+
+func fhirHumanName(firstName string, lastName string) []fhir.HumanName {
+	return []fhir.HumanName{{Use: "official", Text: firstName + " " + lastName, Family: lastName, Given: []string{firstName}}}
+}
+
+func fhirTelecom(phoneNumber string, email string) []fhir.ContactPoint {
+	telecom := []fhir.ContactPoint{}
+	if phoneNumber != "" {
+		telecom = append(telecom, fhir.ContactPoint{System: "phone", Value: phoneNumber})
+	}
+	if email != "" {
+		telecom = append(telecom, fhir.ContactPoint{System: "email", Value: email})
+	}
+	return telecom
+}
+
+func fhirDate(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("2006-01-02")
+	}
+	return ""
+}
+
+// fhirPatientReference is the patient of a clinical resource, rows carry patient_id and patient_name
+func fhirPatientReference(row map[string]interface{}) fhir.Reference {
+	return fhir.Reference{Reference: "Patient/" + row["patient_id"].(string), Display: stringOrEmpty(row["patient_name"])}
+}
+
+const fhirPatientNameField = "(SELECT first_name || ' ' || last_name FROM Patient p WHERE p.patient_id = %s.patient_id) AS patient_name"
+
+// fhirAppointmentStatus derives the FHIR status from the cancellation and the check-in of the appointment
+const fhirAppointmentStatus = `CASE WHEN Patient_Appointment.cancelled_at IS NOT NULL THEN 'cancelled' ELSE COALESCE((SELECT CASE ac.status ` +
+	`WHEN 'waiting' THEN 'arrived' WHEN 'called' THEN 'checked-in' WHEN 'completed' THEN 'fulfilled' WHEN 'no_show' THEN 'noshow' END ` +
+	`FROM Appointment_checkin ac WHERE ac.appointment_id = Patient_Appointment.appointment_id), 'booked') END`
+
+// fhirAllergyCriticality maps allergy_severity onto the FHIR criticality, NULL when the severity is unknown
+const fhirAllergyCriticality = `CASE Patient_drug_allergy.severity WHEN 'severe' THEN 'high' WHEN 'life_threatening' THEN 'high' WHEN 'mild' THEN 'low' WHEN 'moderate' THEN 'low' END`
+
+var fhirResources = map[string]fhirResourceSpec{
+	"Patient": {
+		table:         "Patient",
+		fields:        []string{"patient_id", "first_name", "last_name", "date_of_birth", "gender", "email", "address", "phone_number", "id_card_number"},
+		idColumn:      "Patient.patient_id",
+		patientColumn: "Patient.patient_id",
+		order:         "ORDER BY patient_id",
+		params: map[string]fhirSearchParam{
+			"_id":        tokenParam("Patient.patient_id"),
+			"identifier": identifierParam(map[string]string{fhirPatientIDSystem: "Patient.patient_id", fhirNationalIDSystem: "Patient.id_card_number"}),
+			"name":       stringParam("first_name", "last_name"),
+			"family":     stringParam("last_name"),
+			"given":      stringParam("first_name"),
+			"birthdate":  dateParam("date_of_birth"),
+			"gender":     tokenParam("gender"),
+		},
+		toResource: func(row map[string]interface{}) interface{} {
+			patientID := row["patient_id"].(string)
+			return fhir.Patient{
+				Resource_type: "Patient",
+				Id:            patientID,
+				Identifier: []fhir.Identifier{
+					{Use: "usual", System: fhirPatientIDSystem, Value: patientID},
+					{Use: "official", System: fhirNationalIDSystem, Value: stringOrEmpty(row["id_card_number"])},
+				},
+				Active:     true,
+				Name:       fhirHumanName(stringOrEmpty(row["first_name"]), stringOrEmpty(row["last_name"])),
+				Telecom:    fhirTelecom(stringOrEmpty(row["phone_number"]), stringOrEmpty(row["email"])),
+				Gender:     stringOrEmpty(row["gender"]),
+				Birth_date: fhirDate(row["date_of_birth"]),
+				Address:    []fhir.Address{{Text: stringOrEmpty(row["address"])}},
+			}
+		},
+	},
+	"Practitioner": {
+		table:    "Employee",
+		fields:   []string{"employee_id", "first_name", "last_name", "phone_number", "email", "work_status"},
+		idColumn: "Employee.employee_id",
+		order:    "ORDER BY employee_id",
+		params: map[string]fhirSearchParam{
+			"_id":        tokenParam("Employee.employee_id"),
+			"identifier": identifierParam(map[string]string{fhirEmployeeIDSystem: "Employee.employee_id"}),
+			"name":       stringParam("first_name", "last_name"),
+			"family":     stringParam("last_name"),
+			"given":      stringParam("first_name"),
+			"active":     activeParam("Employee.work_status = 'yes'"),
+		},
+		toResource: func(row map[string]interface{}) interface{} {
+			employeeID := row["employee_id"].(string)
+			return fhir.Practitioner{
+				Resource_type: "Practitioner",
+				Id:            employeeID,
+				Identifier:    []fhir.Identifier{{Use: "official", System: fhirEmployeeIDSystem, Value: employeeID}},
+				Active:        stringOrEmpty(row["work_status"]) == "yes",
+				Name:          fhirHumanName(stringOrEmpty(row["first_name"]), stringOrEmpty(row["last_name"])),
+				Telecom:       fhirTelecom(stringOrEmpty(row["phone_number"]), stringOrEmpty(row["email"])),
+			}
+		},
+	},
+	"PractitionerRole": {
+		table: "Employee",
+		fields: []string{
+			"employee_id",
+			"first_name",
+			"last_name",
+			"work_status",
+			"hire_date",
+			"resignation_date",
+			"position_id",
+			"(SELECT position_name FROM Position WHERE Position.position_id = Employee.position_id) AS position_name",
+			"(SELECT department_id FROM Position WHERE Position.position_id = Employee.position_id) AS department_id",
+			"(SELECT department_name FROM Position JOIN Department ON Position.department_id = Department.department_id WHERE Position.position_id = Employee.position_id) AS department_name",
+		},
+		idColumn: "Employee.employee_id",
+		order:    "ORDER BY employee_id",
+		params: map[string]fhirSearchParam{
+			"_id":          tokenParam("Employee.employee_id"),
+			"practitioner": referenceParam("Employee.employee_id", "Practitioner"),
+			"role":         tokenParam("Employee.position_id"),
+			"specialty":    tokenParam("(SELECT department_id FROM Position WHERE Position.position_id = Employee.position_id)"),
+			"active":       activeParam("Employee.work_status = 'yes'"),
+		},
+		toResource: func(row map[string]interface{}) interface{} {
+			employeeID := row["employee_id"].(string)
+			role := fhir.PractitionerRole{
+				Resource_type: "PractitionerRole",
+				Id:            employeeID,
+				Active:        stringOrEmpty(row["work_status"]) == "yes",
+				Period:        &fhir.Period{Start: fhirDate(row["hire_date"]), End: fhirDate(row["resignation_date"])},
+				Practitioner: fhir.Reference{
+					Reference: "Practitioner/" + employeeID,
+					Display:   stringOrEmpty(row["first_name"]) + " " + stringOrEmpty(row["last_name"]),
+				},
+			}
+			if positionID := stringOrEmpty(row["position_id"]); positionID != "" {
+				role.Code = []fhir.CodeableConcept{{
+					Coding: []fhir.Coding{{System: fhirPositionSystem, Code: positionID, Display: stringOrEmpty(row["position_name"])}},
+					Text:   stringOrEmpty(row["position_name"]),
+				}}
+			}
+			if departmentID := stringOrEmpty(row["department_id"]); departmentID != "" {
+				role.Specialty = []fhir.CodeableConcept{{
+					Coding: []fhir.Coding{{System: fhirDepartmentSystem, Code: departmentID, Display: stringOrEmpty(row["department_name"])}},
+					Text:   stringOrEmpty(row["department_name"]),
+				}}
+			}
+			return role
+		},
+	},
+	"Appointment": {
+		table: "Patient_Appointment",
+		fields: []string{
+			"appointment_id",
+			"patient_id",
+			"employee_id",
+			"date",
+			"time",
+			"topic",
+			"cancellation_reason",
+			fhirAppointmentStatus + " AS fhir_status",
+			fmt.Sprintf(fhirPatientNameField, "Patient_Appointment"),
+			"(SELECT first_name || ' ' || last_name FROM Employee e WHERE e.employee_id = Patient_Appointment.employee_id) AS employee_name",
+		},
+		idColumn:      "Patient_Appointment.appointment_id",
+		patientColumn: "Patient_Appointment.patient_id",
+		order:         "ORDER BY date, time, appointment_id",
+		params: map[string]fhirSearchParam{
+			"_id":          tokenParam("Patient_Appointment.appointment_id"),
+			"patient":      referenceParam("Patient_Appointment.patient_id", "Patient"),
+			"practitioner": referenceParam("Patient_Appointment.employee_id", "Practitioner"),
+			"date":         dateParam("Patient_Appointment.date"),
+			"status":       tokenParam("(" + fhirAppointmentStatus + ")"),
+		},
+		toResource: func(row map[string]interface{}) interface{} {
+			appointment := fhir.Appointment{
+				Resource_type: "Appointment",
+				Id:            fmt.Sprint(row["appointment_id"]),
+				Status:        stringOrEmpty(row["fhir_status"]),
+				Description:   stringOrEmpty(row["topic"]),
+				Start:         appointmentStartFromRow(row).Format(time.RFC3339),
+				Participant:   []fhir.AppointmentParticipant{{Actor: fhirPatientReference(row), Status: "accepted"}},
+			}
+			if employeeID := stringOrEmpty(row["employee_id"]); employeeID != "" {
+				appointment.Participant = append(appointment.Participant, fhir.AppointmentParticipant{
+					Actor:  fhir.Reference{Reference: "Practitioner/" + employeeID, Display: stringOrEmpty(row["employee_name"])},
+					Status: "accepted",
+				})
+			}
+			if reason := stringOrEmpty(row["cancellation_reason"]); reason != "" {
+				appointment.Cancelation_reason = &fhir.CodeableConcept{Text: reason}
+			}
+			return appointment
+		},
+	},
+	"AllergyIntolerance": {
+		table: "Patient_drug_allergy",
+		fields: []string{
+			"id",
+			"patient_id",
+			"drug_id",
+			"drug_class_id",
+			"severity",
+			"reaction_type",
+			fhirAllergyCriticality + " AS criticality",
+			"(SELECT drug_name FROM drug WHERE drug.drug_id = Patient_drug_allergy.drug_id) AS drug_name",
+			"(SELECT atc_code FROM drug WHERE drug.drug_id = Patient_drug_allergy.drug_id) AS atc_code",
+			"(SELECT rxnorm_code FROM drug WHERE drug.drug_id = Patient_drug_allergy.drug_id) AS rxnorm_code",
+			"(SELECT class_name FROM Drug_class WHERE Drug_class.drug_class_id = Patient_drug_allergy.drug_class_id) AS class_name",
+			fmt.Sprintf(fhirPatientNameField, "Patient_drug_allergy"),
+		},
+		idColumn:      "Patient_drug_allergy.id",
+		patientColumn: "Patient_drug_allergy.patient_id",
+		order:         "ORDER BY patient_id, id",
+		params: map[string]fhirSearchParam{
+			"_id":         tokenParam("Patient_drug_allergy.id"),
+			"patient":     referenceParam("Patient_drug_allergy.patient_id", "Patient"),
+			"criticality": tokenParam("(" + fhirAllergyCriticality + ")"),
+		},
+		toResource: func(row map[string]interface{}) interface{} {
+			allergy := fhir.AllergyIntolerance{
+				Resource_type: "AllergyIntolerance",
+				Id:            fmt.Sprint(row["id"]),
+				Clinical_status: fhir.CodeableConcept{Coding: []fhir.Coding{{
+					System: "http://terminology.hl7.org/CodeSystem/allergyintolerance-clinical", Code: "active",
+				}}},
+				Type:        "allergy",
+				Category:    []string{"medication"},
+				Criticality: stringOrEmpty(row["criticality"]),
+				Patient:     fhirPatientReference(row),
+			}
+
+			if drugID := stringOrEmpty(row["drug_id"]); drugID != "" {
+				name := stringOrEmpty(row["drug_name"])
+				allergy.Code.Text = name
+				allergy.Code.Coding = []fhir.Coding{{System: fhirDrugSystem, Code: drugID, Display: name}}
+				if atcCode := stringOrEmpty(row["atc_code"]); atcCode != "" {
+					allergy.Code.Coding = append(allergy.Code.Coding, fhir.Coding{System: fhirATCSystem, Code: atcCode, Display: name})
+				}
+				if rxnormCode := stringOrEmpty(row["rxnorm_code"]); rxnormCode != "" {
+					allergy.Code.Coding = append(allergy.Code.Coding, fhir.Coding{System: fhirRxNormSystem, Code: rxnormCode, Display: name})
+				}
+			} else {
+				name := stringOrEmpty(row["class_name"])
+				allergy.Code.Text = name
+				allergy.Code.Coding = []fhir.Coding{{System: fhirDrugClassSystem, Code: stringOrEmpty(row["drug_class_id"]), Display: name}}
+			}
+
+			// A reaction needs a manifestation, so it is only given when the reaction type was recorded
+			if reactionType := stringOrEmpty(row["reaction_type"]); reactionType != "" {
+				severity := stringOrEmpty(row["severity"])
+				if severity == "life_threatening" {
+					severity = "severe"
+				}
+				allergy.Reaction = []fhir.AllergyReaction{{Manifestation: []fhir.CodeableConcept{{Text: reactionType}}, Severity: severity}}
+			}
+			return allergy
+		},
+	},
+	"Condition": {
+		table: "Patient_chronic_disease",
+		fields: []string{
+			"id",
+			"patient_id",
+			"disease_id",
+			"(SELECT disease_name FROM Disease WHERE Disease.disease_id = Patient_chronic_disease.disease_id) AS disease_name",
+			"(SELECT icd10_code FROM Disease WHERE Disease.disease_id = Patient_chronic_disease.disease_id) AS icd10_code",
+			fmt.Sprintf(fhirPatientNameField, "Patient_chronic_disease"),
+		},
+		idColumn:      "Patient_chronic_disease.id",
+		patientColumn: "Patient_chronic_disease.patient_id",
+		order:         "ORDER BY patient_id, id",
+		params: map[string]fhirSearchParam{
+			"_id":     tokenParam("Patient_chronic_disease.id"),
+			"patient": referenceParam("Patient_chronic_disease.patient_id", "Patient"),
+			"code": identifierParam(map[string]string{
+				fhirDiseaseSystem: "Patient_chronic_disease.disease_id",
+				fhirICD10System:   "(SELECT icd10_code FROM Disease WHERE Disease.disease_id = Patient_chronic_disease.disease_id)",
+			}),
+		},
+		toResource: func(row map[string]interface{}) interface{} {
+			name := stringOrEmpty(row["disease_name"])
+			condition := fhir.Condition{
+				Resource_type: "Condition",
+				Id:            fmt.Sprint(row["id"]),
+				Clinical_status: fhir.CodeableConcept{Coding: []fhir.Coding{{
+					System: "http://terminology.hl7.org/CodeSystem/condition-clinical", Code: "active",
+				}}},
+				Category: []fhir.CodeableConcept{{Coding: []fhir.Coding{{
+					System: "http://terminology.hl7.org/CodeSystem/condition-category", Code: "problem-list-item", Display: "Problem List Item",
+				}}}},
+				Code: fhir.CodeableConcept{
+					Coding: []fhir.Coding{{System: fhirDiseaseSystem, Code: stringOrEmpty(row["disease_id"]), Display: name}},
+					Text:   name,
+				},
+				Subject: fhirPatientReference(row),
+			}
+			if icd10Code := stringOrEmpty(row["icd10_code"]); icd10Code != "" {
+				condition.Code.Coding = append(condition.Code.Coding, fhir.Coding{System: fhirICD10System, Code: icd10Code, Display: name})
+			}
+			return condition
+		},
+	},
+}
+
+// IsFhirResourceType reports whether the /fhir/R4 API serves resourceType
+func IsFhirResourceType(resourceType string) bool {
+	_, ok := fhirResources[resourceType]
+	return ok
+}
+
+// fhirWhere is the WHERE clause of a search, patient data is limited to the patients who agreed to data sharing and
+// were not deleted
+func fhirWhere(spec fhirResourceSpec, q *fhirQuery) string {
+	conditions := append([]string{}, q.conditions...)
+	if spec.patientColumn != "" {
+		conditions = append(conditions, consentGrantedCondition(spec.patientColumn, ConsentDataSharing), patientNotDeletedCondition(spec.patientColumn))
+	}
+	if len(conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// SearchFhirResources runs a FHIR search and returns one page of Bundle entries with the total number of matches. The fullUrl of
+// an entry is relative ("Patient/P001"), the controller prefixes the server base.
+// params are the search parameters without the result parameters (_count, _offset, _format); unknown ones are ignored
+// unless strict is set, as the FHIR spec asks for the default lenient handling
+func SearchFhirResources(resourceType string, params url.Values, count int, offset int, strict bool) ([]fhir.BundleEntry, int, error) {
+	spec := fhirResources[resourceType]
+
+	names := []string{}
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names) // stable placeholder numbering, so the same search always sends the same SQL
+
+	q := &fhirQuery{}
+	for _, name := range names {
+		paramName, modifier, _ := strings.Cut(name, ":")
+		param, ok := spec.params[paramName]
+		if !ok {
+			if strict {
+				return nil, 0, &FhirSearchError{Message: "unknown search parameter " + name + " for " + resourceType}
+			}
+			continue
+		}
+		for _, value := range params[name] {
+			if value == "" {
+				continue
+			}
+			if err := param.apply(q, modifier, value); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	where := fhirWhere(spec, q)
+	countResults, err := SelectData(spec.table, []string{"COUNT(*) AS total"}, true, where, q.args, false, "", "", "")
+	if err != nil {
+		return nil, 0, err
+	}
+	total := int(countResults[0]["total"].(int64))
+
+	entries := []fhir.BundleEntry{}
+	if count == 0 || offset >= total {
+		return entries, total, nil
+	}
+
+	results, err := SelectData(spec.table, spec.fields, true, where, q.args, false, "", "", fmt.Sprintf("%s LIMIT %d OFFSET %d", spec.order, count, offset))
+	if err != nil {
+		return nil, 0, err
+	}
+	idField := spec.idColumn[strings.Index(spec.idColumn, ".")+1:]
+	for _, row := range results {
+		entries = append(entries, fhir.BundleEntry{
+			Full_url: resourceType + "/" + fmt.Sprint(row[idField]),
+			Resource: spec.toResource(row),
+			Search:   fhir.BundleEntrySearch{Mode: "match"},
+		})
+	}
+	return entries, total, nil
+}
+
+// ReadFhirResource returns one resource by id. A patient who has not agreed to data sharing is not found, as are their records
+func ReadFhirResource(resourceType string, id string) (interface{}, error) {
+	spec := fhirResources[resourceType]
+
+	q := &fhirQuery{}
+	q.add(spec.idColumn+"::text = $?", id)
+	results, err := SelectData(spec.table, spec.fields, true, fhirWhere(spec, q), q.args, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("resource not found")
+	}
+	return spec.toResource(results[0]), nil
+}
+
+// FhirPatientIDs are the ids of the patients whose data the resources hold, for the patient access audit. Practitioners
+// hold none
+func FhirPatientIDs(resources ...interface{}) []string {
+	ids := []string{}
+	addReference := func(ref fhir.Reference) {
+		if id, ok := strings.CutPrefix(ref.Reference, "Patient/"); ok {
+			ids = append(ids, id)
+		}
+	}
+	for _, resource := range resources {
+		switch r := resource.(type) {
+		case fhir.Patient:
+			ids = append(ids, r.Id)
+		case fhir.AllergyIntolerance:
+			addReference(r.Patient)
+		case fhir.Condition:
+			addReference(r.Subject)
+		case fhir.Appointment:
+			for _, participant := range r.Participant {
+				addReference(participant.Actor)
+			}
+		}
+	}
+	return ids
+}
+
+// GetFhirCapabilityStatement describes the API for GET /fhir/R4/metadata, built from the same tables as the searches
+func GetFhirCapabilityStatement() fhir.CapabilityStatement {
+	resourceTypes := []string{}
+	for resourceType := range fhirResources {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+
+	rest := fhir.CapabilityRest{Mode: "server", Resource: []fhir.CapabilityResource{}}
+	for _, resourceType := range resourceTypes {
+		spec := fhirResources[resourceType]
+		resource := fhir.CapabilityResource{
+			Type:         resourceType,
+			Interaction:  []fhir.CapabilityInteraction{{Code: "read"}, {Code: "search-type"}},
+			Search_param: []fhir.CapabilitySearchParam{},
+		}
+		for name, param := range spec.params {
+			resource.Search_param = append(resource.Search_param, fhir.CapabilitySearchParam{Name: name, Type: param.kind})
+		}
+		sort.Slice(resource.Search_param, func(i, j int) bool { return resource.Search_param[i].Name < resource.Search_param[j].Name })
+		rest.Resource = append(rest.Resource, resource)
+	}
+
+	return fhir.CapabilityStatement{
+		Resource_type: "CapabilityStatement",
+		Status:        "active",
+		Date:          time.Now().Format("2006-01-02"),
+		Kind:          "instance",
+		Fhir_version:  FhirVersion,
+		Format:        []string{"json"},
+		Rest:          []fhir.CapabilityRest{rest},
+	}
+}
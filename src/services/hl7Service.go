@@ -0,0 +1,409 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/utils/hl7"
+)
+
+// HL7 v2 settings, from the environment:
+//
+//	HL7_MLLP_ADDR             address of the MLLP listener for inbound ADT messages, e.g. ":2575" (on 127.0.0.1 when no
+//	                          host is given, "0.0.0.0:2575" listens on every interface). Empty (the default) leaves it off
+//	HL7_MLLP_ALLOWED_IPS      IP addresses and CIDR ranges the listener takes connections from, comma separated,
+//	                          default "127.0.0.1,::1". MLLP has no authentication, so this is what keeps other hosts out
+//	HL7_MLLP_MAX_CONNECTIONS  most connections open at once, default 10
+//	HL7_APPLICATION           our application in MSH-3 of the messages we send, default HOSPITAL_BACKEND
+//	HL7_FACILITY              our facility in MSH-4, default HOSPITAL
+var (
+	hl7MLLPAllowedIPs     = "127.0.0.1,::1"
+	hl7MLLPMaxConnections = 10
+	hl7Application        = "HOSPITAL_BACKEND"
+	hl7Facility           = "HOSPITAL"
+	hl7Sequence           uint32
+)
+
+// hl7DefaultText fills the NOT NULL patient columns an ADT message has no field for, when it creates a patient
+const hl7DefaultText = "not recorded"
+
+// HL7 LOINC codes read from OBX for the blood type: ABO group, and ABO + Rh group
+var hl7BloodTypeCodes = map[string]bool{"883-9": true, "882-1": true}
+
+func loadHL7Settings() {
+	if value := os.Getenv("HL7_MLLP_ALLOWED_IPS"); value != "" {
+		hl7MLLPAllowedIPs = value
+	}
+	if value := os.Getenv("HL7_MLLP_MAX_CONNECTIONS"); value != "" {
+		if connections, err := strconv.Atoi(value); err == nil && connections > 0 {
+			hl7MLLPMaxConnections = connections
+		}
+	}
+	if value := os.Getenv("HL7_APPLICATION"); value != "" {
+		hl7Application = value
+	}
+	if value := os.Getenv("HL7_FACILITY"); value != "" {
+		hl7Facility = value
+	}
+}
+
+// StartHL7Listener starts the MLLP listener when HL7_MLLP_ADDR is set. Every message is answered with its ACK
+func StartHL7Listener() {
+	loadHL7Settings()
+
+	addr := os.Getenv("HL7_MLLP_ADDR")
+	if addr == "" {
+		return
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		fmt.Println("HL7 MLLP listener not started:", err)
+		return
+	}
+	if host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+	allowed, err := hl7.ParseAllowList(hl7MLLPAllowedIPs)
+	if err != nil {
+		fmt.Println("HL7 MLLP listener not started: HL7_MLLP_ALLOWED_IPS:", err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println("HL7 MLLP listener not started:", err)
+		return
+	}
+	fmt.Printf("HL7 MLLP listener on %s, allowing %s, at most %d connections\n", listener.Addr(), hl7MLLPAllowedIPs, hl7MLLPMaxConnections)
+
+	server := &hl7.Server{Handle: HandleHL7Message, Allowed: allowed, MaxConnections: hl7MLLPMaxConnections}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			fmt.Println("HL7 MLLP listener stopped:", err)
+		}
+	}()
+}
+
+// hl7ControlID numbers the messages we send (MSH-10): time stamp plus a rolling counter, at most 20 characters
+func hl7ControlID(now time.Time) string {
+	return fmt.Sprintf("%s%03d", now.Format("20060102150405"), atomic.AddUint32(&hl7Sequence, 1)%1000)
+}
+
+// HandleHL7Message processes one inbound message and returns the acknowledgement to send back: AA when the patient was
+// saved, AE with ERR segments when the message could not be applied, AR when it is not a message we take
+func HandleHL7Message(raw string) string {
+	now := time.Now()
+
+	msg, err := hl7.Parse(raw)
+	if err != nil {
+		fmt.Println("HL7 message rejected:", err)
+		return hl7Ack(nil, now, &hl7.Error{Code: hl7.ErrSegmentSequence, Message: err.Error()})
+	}
+
+	patientID, errs := ProcessADTMessage(msg)
+	if len(errs) > 0 {
+		fmt.Println("HL7 message", msg.ControlID(), "not applied:", errs[0])
+	} else {
+		fmt.Println("HL7 message", msg.ControlID(), "applied to patient", patientID)
+	}
+	return hl7Ack(msg, now, errs...)
+}
+
+// hl7Ack builds the ACK, naming us as the sender when the message did not say who it was for
+func hl7Ack(msg *hl7.Message, now time.Time, errs ...*hl7.Error) string {
+	ack := hl7.Ack(msg, hl7ControlID(now), now, errs...)
+	msh := ack.Segments[0]
+	if msh.Field(3) == "" {
+		msh.Fields[3] = ack.Delimiters.Escape(hl7Application)
+		msh.Fields[4] = ack.Delimiters.Escape(hl7Facility)
+	}
+	return ack.String()
+}
+
+// ProcessADTMessage applies an ADT^A01 (admit), A04 (register) or A08 (update) message to the Patient table through
+// AddPatient / UpdatePatient. A01 and A04 create the patient or update them when the id is known, A08 only updates.
+// An update changes the fields the message carries and leaves the rest (and the clinical lists) as they are
+func ProcessADTMessage(msg *hl7.Message) (string, []*hl7.Error) {
+	messageType, trigger := msg.Type()
+	if trigger == "" {
+		trigger = msg.Get("EVN", 1, 1)
+	}
+	if messageType != "ADT" {
+		return "", []*hl7.Error{{Code: hl7.ErrUnsupportedMessage, Segment: "MSH", Field: 9, Message: "only ADT messages are accepted"}}
+	}
+	if trigger != "A01" && trigger != "A04" && trigger != "A08" {
+		return "", []*hl7.Error{{Code: hl7.ErrUnsupportedEvent, Segment: "MSH", Field: 9, Message: "only A01, A04 and A08 events are accepted"}}
+	}
+
+	pid, ok := msg.Segment("PID")
+	if !ok {
+		return "", []*hl7.Error{{Code: hl7.ErrSegmentSequence, Segment: "PID", Message: "PID segment is required"}}
+	}
+	patient, errs := patientFromPID(msg, pid)
+	if len(errs) > 0 {
+		return patient.Patient_id, errs
+	}
+
+	existing, err := SelectData("Patient", []string{"patient_id", "deleted_at IS NOT NULL AS deleted"}, true, "patient_id = $1", []interface{}{patient.Patient_id}, false, "", "", "")
+	if err != nil {
+		return patient.Patient_id, []*hl7.Error{hl7InternalError(err)}
+	}
+	if len(existing) > 0 && existing[0]["deleted"].(bool) {
+		return patient.Patient_id, []*hl7.Error{{Code: hl7.ErrUnknownKey, Segment: "PID", Field: 3, Message: "patient " + patient.Patient_id + " was deleted"}}
+	}
+
+	if len(existing) == 0 {
+		if trigger == "A08" {
+			return patient.Patient_id, []*hl7.Error{{Code: hl7.ErrUnknownKey, Segment: "PID", Field: 3, Message: "patient " + patient.Patient_id + " is not registered"}}
+		}
+		return patient.Patient_id, addPatientFromADT(patient)
+	}
+	return patient.Patient_id, updatePatientFromADT(patient)
+}
+
+func hl7InternalError(err error) *hl7.Error {
+	if isUniqueViolation(err) {
+		return &hl7.Error{Code: hl7.ErrDuplicateKey, Segment: "PID", Field: 3, Message: "another patient has the same name, email or id card number"}
+	}
+	// the database error stays in our log, the sender only learns that the message was not applied
+	fmt.Println("HL7 message not applied:", err)
+	return &hl7.Error{Code: hl7.ErrInternal, Message: "internal error, the message was not applied"}
+}
+
+func addPatientFromADT(patient patients.GeneralPatientInformation) []*hl7.Error {
+	required := []struct {
+		value   string
+		segment string
+		field   int
+		name    string
+	}{
+		{patient.Id_card_number, "PID", 3, "national id (identifier type NI)"},
+		{patient.First_name, "PID", 5, "given name"},
+		{patient.Last_name, "PID", 5, "family name"},
+		{patient.Date_of_birth, "PID", 7, "date of birth"},
+		{patient.Gender, "PID", 8, "administrative sex"},
+		{patient.Address, "PID", 11, "address"},
+		{patient.Phone_number, "PID", 13, "phone number"},
+		{patient.Email, "PID", 13, "email"},
+		{patient.Blood_type, "OBX", 5, "blood type (OBX with LOINC 883-9)"},
+	}
+	errs := []*hl7.Error{}
+	for _, field := range required {
+		if field.value == "" {
+			errs = append(errs, &hl7.Error{Code: hl7.ErrRequiredFieldMissing, Segment: field.segment, Field: field.field, Message: field.name + " is required to register a patient"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	patient.Ongoing_treatment = hl7DefaultText
+	patient.Unhealthy_habits = hl7DefaultText
+	if err := AddPatient(patients.AddPatientRequest{Patient: patient}); err != nil {
+		return []*hl7.Error{hl7InternalError(err)}
+	}
+	return nil
+}
+
+func updatePatientFromADT(patient patients.GeneralPatientInformation) []*hl7.Error {
+	// An ADT message has neither chronic diseases nor drug allergies, nil lists leave the current ones as they are
+	req := patients.AddPatientRequest{Patient: patient}
+
+	if _, err := UpdatePatient(&req); err != nil {
+		if err.Error() == "Patient not found" {
+			return []*hl7.Error{{Code: hl7.ErrUnknownKey, Segment: "PID", Field: 3, Message: "patient " + patient.Patient_id + " is not registered"}}
+		}
+		return []*hl7.Error{hl7InternalError(err)}
+	}
+	return nil
+}
+
+// patientFromPID maps PID (and the blood type OBX) onto the patient columns, fields the message leaves empty stay ""
+func patientFromPID(msg *hl7.Message, pid hl7.Segment) (patients.GeneralPatientInformation, []*hl7.Error) {
+	d := msg.Delimiters
+	patient := patients.GeneralPatientInformation{}
+	errs := []*hl7.Error{}
+
+	// PID-3 identifiers: the medical record number (MR, or an untyped id) is our patient_id, the national id (NI, NN...) the id card number
+	for _, repetition := range d.Repetitions(pid.Field(3)) {
+		id, idType := d.Component(repetition, 1), d.Component(repetition, 5)
+		switch {
+		case idType == "MR" || idType == "PI" || (idType == "" && patient.Patient_id == ""):
+			patient.Patient_id = id
+		case idType == "NI" || strings.HasPrefix(idType, "NN"):
+			patient.Id_card_number = id
+		}
+	}
+	if patient.Id_card_number == "" {
+		patient.Id_card_number = d.Component(pid.Field(19), 1)
+	}
+	if patient.Patient_id == "" {
+		return patient, []*hl7.Error{{Code: hl7.ErrRequiredFieldMissing, Segment: "PID", Field: 3, Message: "patient identifier (type MR) is required"}}
+	}
+	if len(patient.Patient_id) > 4 {
+		errs = append(errs, &hl7.Error{Code: hl7.ErrDataType, Segment: "PID", Field: 3, Message: "patient identifier must be at most 4 characters"})
+	}
+	if len(patient.Id_card_number) > 13 {
+		errs = append(errs, &hl7.Error{Code: hl7.ErrDataType, Segment: "PID", Field: 3, Message: "national id must be at most 13 characters"})
+	}
+
+	// PID-5 family^given, the family name may carry subcomponents (surname&prefix...)
+	family := d.Component(pid.Field(5), 1)
+	if i := strings.IndexByte(family, d.SubcomponentSep); i >= 0 {
+		family = family[:i]
+	}
+	patient.Last_name = family
+	patient.First_name = d.Component(pid.Field(5), 2)
+
+	if raw := d.Component(pid.Field(7), 1); raw != "" {
+		dateOfBirth, err := time.Parse("20060102", raw[:min(len(raw), 8)])
+		if err != nil {
+			errs = append(errs, &hl7.Error{Code: hl7.ErrDataType, Segment: "PID", Field: 7, Message: "date of birth must be YYYYMMDD"})
+		} else {
+			patient.Date_of_birth = dateOfBirth.Format("2006-01-02")
+			patient.Age = ageOn(dateOfBirth, time.Now())
+		}
+	}
+
+	switch d.Component(pid.Field(8), 1) {
+	case "":
+	case "M":
+		patient.Gender = "male"
+	case "F":
+		patient.Gender = "female"
+	default:
+		errs = append(errs, &hl7.Error{Code: hl7.ErrTableValueNotFound, Segment: "PID", Field: 8, Message: "administrative sex must be M or F"})
+	}
+
+	// PID-11 street^other^city^state^zip^country as one line
+	if repetitions := d.Repetitions(pid.Field(11)); len(repetitions) > 0 {
+		parts := []string{}
+		for n := 1; n <= 6; n++ {
+			part := strings.ReplaceAll(d.Component(repetitions[0], n), string(d.SubcomponentSep), " ")
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		patient.Address = strings.Join(parts, ", ")
+	}
+
+	// PID-13 home and PID-14 business telecom: the email is the Internet / NET repetition, the phone the first other one
+	for _, field := range []int{13, 14} {
+		for _, repetition := range d.Repetitions(pid.Field(field)) {
+			if d.Component(repetition, 3) == "Internet" || d.Component(repetition, 2) == "NET" {
+				if patient.Email == "" {
+					patient.Email = d.Component(repetition, 4)
+				}
+				continue
+			}
+			number := d.Component(repetition, 1)
+			if number == "" {
+				number = d.Component(repetition, 12) // unformatted number, v2.5
+			}
+			if number == "" {
+				number = d.Component(repetition, 6) + d.Component(repetition, 7)
+			}
+			if digits := onlyDigits(number); digits != "" && patient.Phone_number == "" {
+				patient.Phone_number = digits
+			}
+		}
+	}
+	if len(patient.Phone_number) > 15 {
+		errs = append(errs, &hl7.Error{Code: hl7.ErrDataType, Segment: "PID", Field: 13, Message: "phone number must be at most 15 digits"})
+	}
+
+	for _, obx := range msg.SegmentsNamed("OBX") {
+		if !hl7BloodTypeCodes[d.Component(obx.Field(3), 1)] {
+			continue
+		}
+		value := strings.ToUpper(strings.TrimSpace(d.Component(obx.Field(5), 1)))
+		switch {
+		case strings.HasPrefix(value, "AB"):
+			patient.Blood_type = "AB"
+		case strings.HasPrefix(value, "A"), strings.HasPrefix(value, "B"), strings.HasPrefix(value, "O"):
+			patient.Blood_type = value[:1]
+		default:
+			errs = append(errs, &hl7.Error{Code: hl7.ErrTableValueNotFound, Segment: "OBX", Field: 5, Message: "blood type must be A, B, AB or O"})
+		}
+	}
+
+	return patient, errs
+}
+
+func onlyDigits(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ageOn is the age in whole years on day now
+func ageOn(dateOfBirth time.Time, now time.Time) int {
+	age := now.Year() - dateOfBirth.Year()
+	if now.Month() < dateOfBirth.Month() || (now.Month() == dateOfBirth.Month() && now.Day() < dateOfBirth.Day()) {
+		age--
+	}
+	return age
+}
+
+// BuildPatientADT serializes the patient as an ADT^A04 or ADT^A08 message for other hospital systems. The message leaves
+// this system, so the patient must grant data_sharing consent (a ConsentRequiredError otherwise)
+func BuildPatientADT(patientID string, trigger string) (string, error) {
+	results, err := SelectData("Patient", []string{"patient_id", "first_name", "last_name", "date_of_birth", "gender", "blood_type", "email", "address", "phone_number", "id_card_number"},
+		true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("Patient not found")
+	}
+	if err := RequireConsent(patientID, ConsentDataSharing); err != nil {
+		return "", err
+	}
+
+	row := results[0]
+	d := hl7.DefaultDelimiters
+	now := time.Now()
+
+	sex := "U"
+	switch stringOrEmpty(row["gender"]) {
+	case "male":
+		sex = "M"
+	case "female":
+		sex = "F"
+	}
+	dateOfBirth := ""
+	if t, ok := row["date_of_birth"].(time.Time); ok {
+		dateOfBirth = t.Format("20060102")
+	}
+
+	msg := hl7.NewMessage(d.Escape(hl7Application), d.Escape(hl7Facility), "", "", now.Format("20060102150405"), "",
+		d.Join("ADT", trigger, "ADT_A01"), hl7ControlID(now), "P", "2.5")
+	msg.Add("EVN", trigger, now.Format("20060102150405"))
+	msg.Add("PID",
+		"1", // PID-1 set id
+		"",
+		d.Join(patientID, "", "", hl7Facility, "MR")+string(d.RepetitionSep)+d.Join(stringOrEmpty(row["id_card_number"]), "", "", "", "NI"),
+		"",
+		d.Join(stringOrEmpty(row["last_name"]), stringOrEmpty(row["first_name"])),
+		"",
+		dateOfBirth,
+		sex,
+		"", "",
+		d.Join(stringOrEmpty(row["address"])),
+		"",
+		d.Join(stringOrEmpty(row["phone_number"]), "PRN", "PH")+string(d.RepetitionSep)+d.Join("", "NET", "Internet", stringOrEmpty(row["email"])),
+	)
+	msg.Add("PV1", "1", "N") // no visit, PV1-2 patient class "not applicable"
+	msg.Add("OBX", "1", "CWE", d.Join("883-9", "ABO group [Type] in Blood", "LN"), "", stringOrEmpty(row["blood_type"]), "", "", "", "", "", "F")
+	return msg.String(), nil
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/lib/pq"
+)
+
+// Bulk import of patients and employees from CSV. Every row goes through the validation and the insert of the single
+// record endpoints (ValidateNewPatient + addPatientTx, ValidateNewEmployee + addEmployeeTx). The valid rows are written
+// in one transaction, each inside a savepoint so a row the database refuses (a duplicate email, an unknown gender...)
+// is reported and skipped without losing the others. A dry run takes the same path and rolls back at the end, so it
+// reports exactly what an import would do
+
+const importMaxRows = 5000
+
+// ImportFileError is returned when the file as a whole cannot be imported: not CSV, missing or unknown columns, too many rows
+type ImportFileError struct {
+	Message string
+}
+
+func (e *ImportFileError) Error() string {
+	return e.Message
+}
+
+var errImportDryRun = errors.New("dry run")
+
+// importSpec describes the CSV layout of an entity. columns maps every accepted column to whether it is required,
+// newRow turns one CSV row into its writer or the reason the row is invalid
+type importSpec struct {
+	columns  map[string]bool
+	idColumn string
+	newRow   func(values map[string]string) (func(tx *sql.Tx) error, error)
+}
+
+var importEntities = map[string]func() importSpec{
+	"patients":  patientImportSpec,
+	"employees": employeeImportSpec,
+}
+
+// IsImportEntity reports whether entity (patients, employees) can be imported
+func IsImportEntity(entity string) bool {
+	_, ok := importEntities[entity]
+	return ok
+}
+
+// ImportColumns lists the columns of an entity's CSV file, required ones first
+func ImportColumns(entity string) []string {
+	spec := importEntities[entity]()
+	columns := []string{}
+	for column := range spec.columns {
+		columns = append(columns, column)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if spec.columns[columns[i]] != spec.columns[columns[j]] {
+			return spec.columns[columns[i]]
+		}
+		return columns[i] < columns[j]
+	})
+	return columns
+}
+
+// splitImportList reads a list cell, ids separated by ";"
+func splitImportList(cell string) []string {
+	items := []string{}
+	for _, item := range strings.Split(cell, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// patientImportSpec is the patient file: the AddPatient fields, age may be left out (it is computed from date_of_birth),
+// chronic diseases and drug / drug class allergies are ";" separated ids
+func patientImportSpec() importSpec {
+	columns := map[string]bool{"age": false, "chronic_disease_ids": false, "drug_allergy_ids": false, "drug_class_allergy_ids": false}
+	for _, column := range []string{"patient_id", "first_name", "last_name", "gender", "date_of_birth", "blood_type", "email", "address", "phone_number", "id_card_number", "ongoing_treatment", "unhealthy_habits"} {
+		columns[column] = true
+	}
+
+	return importSpec{columns: columns, idColumn: "patient_id", newRow: func(values map[string]string) (func(tx *sql.Tx) error, error) {
+		req := patients.AddPatientRequest{Patient: patients.GeneralPatientInformation{
+			Patient_id:        values["patient_id"],
+			First_name:        values["first_name"],
+			Last_name:         values["last_name"],
+			Gender:            values["gender"],
+			Date_of_birth:     values["date_of_birth"],
+			Blood_type:        values["blood_type"],
+			Email:             values["email"],
+			Address:           values["address"],
+			Phone_number:      values["phone_number"],
+			Id_card_number:    values["id_card_number"],
+			Ongoing_treatment: values["ongoing_treatment"],
+			Unhealthy_habits:  values["unhealthy_habits"],
+		}}
+
+		if values["date_of_birth"] != "" {
+			dateOfBirth, err := time.Parse("2006-01-02", values["date_of_birth"])
+			if err != nil {
+				return nil, fmt.Errorf("date_of_birth must be YYYY-MM-DD")
+			}
+			req.Patient.Age = ageOn(dateOfBirth, time.Now())
+		}
+		if raw := values["age"]; raw != "" {
+			age, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("age must be a whole number")
+			}
+			req.Patient.Age = age
+		}
+
+		for _, id := range splitImportList(values["chronic_disease_ids"]) {
+			req.PatientChronicDisease = append(req.PatientChronicDisease, patients.ChronicDiseaseName{DiseaseID: id})
+		}
+		for _, id := range splitImportList(values["drug_allergy_ids"]) {
+			req.PatientDrugAllergy = append(req.PatientDrugAllergy, patients.DrugAllergyName{DrugID: id})
+		}
+		for _, id := range splitImportList(values["drug_class_allergy_ids"]) {
+			req.PatientDrugAllergy = append(req.PatientDrugAllergy, patients.DrugAllergyName{DrugClassID: id})
+		}
+
+		if err := ValidateNewPatient(&req); err != nil {
+			return nil, err
+		}
+		if err := ValidatePatientCatalogIds(&req, true); err != nil {
+			return nil, err
+		}
+		return func(tx *sql.Tx) error {
+			return addPatientTx(tx, req)
+		}, nil
+	}}
+}
+
+// employeeImportSpec is the employee file: the AddEmployee fields, work_status defaults to yes
+func employeeImportSpec() importSpec {
+	columns := map[string]bool{"resignation_date": false, "work_status": false}
+	for _, column := range []string{"employee_id", "first_name", "last_name", "position_id", "phone_number", "salary", "email", "hire_date"} {
+		columns[column] = true
+	}
+	positions := map[string]error{} // a file usually repeats a handful of positions
+
+	return importSpec{columns: columns, idColumn: "employee_id", newRow: func(values map[string]string) (func(tx *sql.Tx) error, error) {
+		req := models.EmployeeInsert{
+			Employee_id:      values["employee_id"],
+			First_name:       values["first_name"],
+			Last_name:        values["last_name"],
+			Position_id:      values["position_id"],
+			Phone_number:     values["phone_number"],
+			Email:            values["email"],
+			Hire_date:        values["hire_date"],
+			Resignation_date: values["resignation_date"],
+			Work_status:      values["work_status"],
+		}
+		if req.Work_status == "" {
+			req.Work_status = "yes"
+		}
+		if raw := values["salary"]; raw != "" {
+			salary, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("salary must be a number")
+			}
+			req.Salary = salary
+		}
+		for _, column := range []string{"hire_date", "resignation_date"} {
+			if values[column] != "" {
+				if _, err := time.Parse("2006-01-02", values[column]); err != nil {
+					return nil, fmt.Errorf("%s must be YYYY-MM-DD", column)
+				}
+			}
+		}
+
+		if err := ValidateNewEmployee(req); err != nil {
+			return nil, err
+		}
+		positionErr, checked := positions[req.Position_id]
+		if !checked {
+			positionErr = checkPositionExists(req.Position_id)
+			positions[req.Position_id] = positionErr
+		}
+		if positionErr != nil {
+			return nil, positionErr
+		}
+
+		data := EmployeeInsertData(req)
+		return func(tx *sql.Tx) error {
+			_, err := addEmployeeTx(tx, data)
+			return err
+		}, nil
+	}}
+}
+
+// importRowMessage is the row error shown to the user, database errors carry their detail (e.g. which key already exists)
+func importRowMessage(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Detail != "" {
+		return pqErr.Message + ": " + pqErr.Detail
+	}
+	return err.Error()
+}
+
+type importRow struct {
+	line  int
+	id    string
+	write func(tx *sql.Tx) error
+}
+
+// ImportCSV imports the rows of a CSV file (with a header line) of patients or employees, see the specs above for the columns
+func ImportCSV(entity string, r io.Reader, dryRun bool) (*models.ImportResult, error) {
+	spec := importEntities[entity]()
+	result := &models.ImportResult{Entity: entity, Dry_run: dryRun, Errors: []models.ImportRowError{}}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // a short row is a row error, not a file error
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, &ImportFileError{Message: "the file is empty"}
+	}
+	if err != nil {
+		return nil, &ImportFileError{Message: "not a valid CSV file: " + err.Error()}
+	}
+	seenColumns := map[string]bool{}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+		if _, ok := spec.columns[header[i]]; !ok {
+			return nil, &ImportFileError{Message: fmt.Sprintf("unknown column %q, the columns are %s", header[i], strings.Join(ImportColumns(entity), ", "))}
+		}
+		if seenColumns[header[i]] {
+			return nil, &ImportFileError{Message: fmt.Sprintf("column %q appears twice", header[i])}
+		}
+		seenColumns[header[i]] = true
+	}
+	for column, required := range spec.columns {
+		if required && !seenColumns[column] {
+			return nil, &ImportFileError{Message: fmt.Sprintf("missing column %q", column)}
+		}
+	}
+
+	rowError := func(line int, id string, err error) {
+		result.Errors = append(result.Errors, models.ImportRowError{Line: line, Id: id, Error: importRowMessage(err)})
+	}
+
+	rows := []importRow{}
+	firstLine := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &ImportFileError{Message: "not a valid CSV file: " + err.Error()}
+		}
+		line, _ := reader.FieldPos(0)
+
+		result.Total_rows++
+		if result.Total_rows > importMaxRows {
+			return nil, &ImportFileError{Message: fmt.Sprintf("a file may hold at most %d rows, split it", importMaxRows)}
+		}
+		if len(record) != len(header) {
+			rowError(line, "", fmt.Errorf("the row has %d fields, the header has %d", len(record), len(header)))
+			continue
+		}
+
+		values := map[string]string{}
+		for i, column := range header {
+			values[column] = strings.TrimSpace(record[i])
+		}
+		id := values[spec.idColumn]
+		if first, ok := firstLine[id]; ok && id != "" {
+			rowError(line, id, fmt.Errorf("%s %s is already on line %d", spec.idColumn, id, first))
+			continue
+		}
+		firstLine[id] = line
+
+		write, err := spec.newRow(values)
+		if err != nil {
+			rowError(line, id, err)
+			continue
+		}
+		rows = append(rows, importRow{line: line, id: id, write: write})
+	}
+
+	err = WithTransaction(func(tx *sql.Tx) error {
+		for _, row := range rows {
+			if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+				return err
+			}
+			if err := row.write(tx); err != nil {
+				if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); rollbackErr != nil {
+					return rollbackErr
+				}
+				rowError(row.line, row.id, err)
+				continue
+			}
+			if _, err := tx.Exec("RELEASE SAVEPOINT import_row"); err != nil {
+				return err
+			}
+			result.Valid_rows++
+		}
+		if dryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportDryRun) {
+		return nil, err
+	}
+
+	if !dryRun {
+		result.Imported_rows = result.Valid_rows
+	}
+	result.Failed_rows = len(result.Errors)
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Line < result.Errors[j].Line })
+	return result, nil
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/billing"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/utils/databaseConnector"
+)
+
+// patientHealthInsuranceColumn derives the old Patient.health_insurance yes/no value from the policies valid today,
+// so the general patient information keeps its shape
+const patientHealthInsuranceColumn = `CASE WHEN EXISTS (SELECT 1 FROM Insurance_policy ip JOIN Insurer i ON ip.insurer_id = i.insurer_id
+	WHERE ip.patient_id = Patient.patient_id AND i.is_active AND ip.valid_from <= CURRENT_DATE AND (ip.valid_to IS NULL OR ip.valid_to >= CURRENT_DATE))
+	THEN 'yes' ELSE 'no' END AS health_insurance`
+
+var insurancePolicyFields = []string{
+	"ip.policy_id",
+	"ip.patient_id",
+	"ip.insurer_id",
+	"i.insurer_name",
+	"ip.policy_number",
+	"ip.plan_name",
+	"ip.coverage_percent",
+	"ip.annual_limit",
+	"ip.valid_from",
+	"ip.valid_to",
+	"ip.priority",
+	"(i.is_active AND ip.valid_from <= CURRENT_DATE AND (ip.valid_to IS NULL OR ip.valid_to >= CURRENT_DATE)) AS is_active",
+}
+
+const insurancePolicyJoin = "Insurer i ON ip.insurer_id = i.insurer_id"
+
+func GetInsurers() ([]billing.Insurer, error) {
+	results, err := SelectData("Insurer", []string{"*"}, false, "", nil, false, "", "", "ORDER BY insurer_id")
+	if err != nil {
+		return nil, err
+	}
+
+	insurers := []billing.Insurer{}
+	for _, row := range results {
+		insurers = append(insurers, billing.Insurer{
+			Insurer_id:   row["insurer_id"].(string),
+			Insurer_name: row["insurer_name"].(string),
+			Phone_number: stringOrEmpty(row["phone_number"]),
+			Email:        stringOrEmpty(row["email"]),
+			Is_active:    row["is_active"].(bool),
+		})
+	}
+	return insurers, nil
+}
+
+func AddInsurer(req billing.Insurer) error {
+	existing, err := SelectData("Insurer", []string{"insurer_id"}, true, "insurer_id = $1", []interface{}{req.Insurer_id}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("insurer already exists")
+	}
+
+	_, err = InsertData("Insurer", map[string]interface{}{
+		"insurer_id":   req.Insurer_id,
+		"insurer_name": req.Insurer_name,
+		"phone_number": nullIfEmpty(req.Phone_number),
+		"email":        nullIfEmpty(req.Email),
+		"is_active":    true,
+	})
+	if isUniqueViolation(err) {
+		return fmt.Errorf("insurer name already exists")
+	}
+	return err
+}
+
+func UpdateInsurer(insurerID string, data map[string]interface{}) (int64, error) {
+	rowsAffected, err := UpdateData("Insurer", data, "insurer_id = $1", []interface{}{insurerID})
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("insurer name already exists")
+	}
+	return rowsAffected, err
+}
+
+func insurancePolicyFromRow(row map[string]interface{}) patients.InsurancePolicy {
+	policy := patients.InsurancePolicy{
+		Policy_id:        row["policy_id"].(int64),
+		Patient_id:       row["patient_id"].(string),
+		Insurer_id:       row["insurer_id"].(string),
+		Insurer_name:     row["insurer_name"].(string),
+		Policy_number:    row["policy_number"].(string),
+		Plan_name:        stringOrEmpty(row["plan_name"]),
+		Coverage_percent: centsToFloat(centsFromNumeric(row["coverage_percent"])),
+		Valid_from:       row["valid_from"].(time.Time).Format("2006-01-02"),
+		Priority:         int(row["priority"].(int64)),
+		Is_active:        row["is_active"].(bool),
+	}
+	if row["annual_limit"] != nil {
+		limit := centsToFloat(centsFromNumeric(row["annual_limit"]))
+		policy.Annual_limit = &limit
+	}
+	if validTo, ok := row["valid_to"].(time.Time); ok {
+		policy.Valid_to = validTo.Format("2006-01-02")
+	}
+	return policy
+}
+
+// GetPatientPolicies lists every policy of the patient, including expired ones, primary first
+func GetPatientPolicies(patientID string) ([]patients.InsurancePolicy, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	results, err := SelectData("Insurance_policy ip", insurancePolicyFields, true, "ip.patient_id = $1", []interface{}{patientID}, true, insurancePolicyJoin, "", "ORDER BY ip.priority, ip.valid_from DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []patients.InsurancePolicy{}
+	for _, row := range results {
+		policies = append(policies, insurancePolicyFromRow(row))
+	}
+	return policies, nil
+}
+
+func AddInsurancePolicy(patientID string, req patients.AddInsurancePolicyRequest) (int64, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return 0, err
+	}
+
+	insurer, err := SelectData("Insurer", []string{"is_active"}, true, "insurer_id = $1", []interface{}{req.Insurer_id}, false, "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if len(insurer) == 0 {
+		return 0, fmt.Errorf("insurer not found")
+	}
+	if !insurer[0]["is_active"].(bool) {
+		return 0, fmt.Errorf("insurer is not active")
+	}
+
+	priority := req.Priority
+	if priority == 0 {
+		priority = 1
+	}
+	data := map[string]interface{}{
+		"patient_id":       patientID,
+		"insurer_id":       req.Insurer_id,
+		"policy_number":    req.Policy_number,
+		"plan_name":        nullIfEmpty(req.Plan_name),
+		"coverage_percent": fmt.Sprintf("%.2f", req.Coverage_percent),
+		"valid_from":       req.Valid_from,
+		"valid_to":         nullIfEmpty(req.Valid_to),
+		"priority":         priority,
+	}
+	if req.Annual_limit != nil {
+		data["annual_limit"] = fmt.Sprintf("%.2f", *req.Annual_limit)
+	}
+
+	id, err := InsertDataReturning("Insurance_policy", data, "policy_id")
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("policy number already exists for this insurer")
+		}
+		return 0, err
+	}
+	return id.(int64), nil
+}
+
+// UpdateInsurancePolicy changes the plan, coverage or validity of one of the patient's policies.
+// Invoices already issued keep the split they were issued with
+func UpdateInsurancePolicy(patientID string, policyID int64, data map[string]interface{}) error {
+	results, err := SelectData("Insurance_policy", []string{"valid_from"}, true, "patient_id = $1 AND policy_id = $2", []interface{}{patientID, policyID}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("policy not found")
+	}
+	if validTo, ok := data["valid_to"].(string); ok && validTo < results[0]["valid_from"].(time.Time).Format("2006-01-02") {
+		return fmt.Errorf("valid_to must not be before valid_from")
+	}
+
+	_, err = UpdateData("Insurance_policy", data, "policy_id = $1", []interface{}{policyID})
+	return err
+}
+
+// getActivePolicies returns the patient's policies valid on date (YYYY-MM-DD) with an active insurer, primary first
+func getActivePolicies(patientID string, date string) ([]patients.InsurancePolicy, error) {
+	return getActivePoliciesOn(databaseConnector.DB, patientID, date)
+}
+
+// getActivePoliciesTx is getActivePolicies inside a transaction
+func getActivePoliciesTx(tx *sql.Tx, patientID string, date string) ([]patients.InsurancePolicy, error) {
+	return getActivePoliciesOn(tx, patientID, date)
+}
+
+// getPatientsActivePolicies returns the policies of each of the patients valid on date (YYYY-MM-DD), primary first, keyed
+// by patient id
+func getPatientsActivePolicies(patientIDs []string, date string) (map[string][]patients.InsurancePolicy, error) {
+	whereCon := "ip.patient_id = ANY($1) AND i.is_active AND ip.valid_from <= $2::date AND (ip.valid_to IS NULL OR ip.valid_to >= $2::date)"
+	results, err := SelectData("Insurance_policy ip", insurancePolicyFields, true, whereCon, []interface{}{pq.Array(patientIDs), date}, true, insurancePolicyJoin, "", "ORDER BY ip.priority, ip.policy_id")
+	if err != nil {
+		return nil, err
+	}
+
+	policies := map[string][]patients.InsurancePolicy{}
+	for _, patientID := range patientIDs {
+		policies[patientID] = []patients.InsurancePolicy{}
+	}
+	for _, row := range results {
+		policy := insurancePolicyFromRow(row)
+		policies[policy.Patient_id] = append(policies[policy.Patient_id], policy)
+	}
+	return policies, nil
+}
+
+func getActivePoliciesOn(db dbExecutor, patientID string, date string) ([]patients.InsurancePolicy, error) {
+	whereCon := "ip.patient_id = $1 AND i.is_active AND ip.valid_from <= $2::date AND (ip.valid_to IS NULL OR ip.valid_to >= $2::date)"
+	results, err := selectData(db, "Insurance_policy ip", insurancePolicyFields, true, whereCon, []interface{}{patientID, date}, true, insurancePolicyJoin, "", "ORDER BY ip.priority, ip.policy_id")
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []patients.InsurancePolicy{}
+	for _, row := range results {
+		policies = append(policies, insurancePolicyFromRow(row))
+	}
+	return policies, nil
+}
+
+// CheckCoverageEligibility tells whether the patient is covered on date (YYYY-MM-DD) and by which policy.
+// When not covered, Reason says why so the front desk can ask for an updated card. date is checked here rather than left
+// to the ::date casts, an invalid one is an error of the request and not of the database
+func CheckCoverageEligibility(patientID string, date string) (*patients.CoverageEligibility, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	eligibility := &patients.CoverageEligibility{Patient_id: patientID, Date: date}
+	active, err := getActivePolicies(patientID, date)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) > 0 {
+		eligibility.Eligible = true
+		eligibility.Policy = &active[0]
+		return eligibility, nil
+	}
+
+	fields := []string{
+		"COUNT(*) AS policies",
+		"COUNT(*) FILTER (WHERE ip.valid_from <= $2::date AND (ip.valid_to IS NULL OR ip.valid_to >= $2::date)) AS valid_on_date",
+	}
+	results, err := SelectData("Insurance_policy ip", fields, true, "ip.patient_id = $1", []interface{}{patientID, date}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case results[0]["policies"].(int64) == 0:
+		eligibility.Reason = "patient has no insurance policy"
+	case results[0]["valid_on_date"].(int64) > 0:
+		eligibility.Reason = "insurer of the policy valid on this date is not active"
+	default:
+		eligibility.Reason = "no insurance policy valid on this date"
+	}
+	return eligibility, nil
+}
+
+// policyLimitRemainingTx returns how much of the policy's annual limit is left this calendar year, counting the insurance
+// share of every invoice claimed on it that is neither void nor rejected. ok is false when the policy has no limit
+func policyLimitRemainingTx(tx *sql.Tx, policy patients.InsurancePolicy) (remaining int64, ok bool, err error) {
+	if policy.Annual_limit == nil {
+		return 0, false, nil
+	}
+
+	whereCon := "policy_id = $1 AND voided_at IS NULL AND claim_status <> 'rejected' AND date_trunc('year', issued_at) = date_trunc('year', NOW())"
+	results, err := SelectDataTx(tx, "Invoice", []string{"COALESCE(SUM(insurance_amount), 0) AS used"}, true, whereCon, []interface{}{policy.Policy_id}, false, "", "", "")
+	if err != nil {
+		return 0, false, err
+	}
+
+	remaining = centsFromFloat(*policy.Annual_limit) - centsFromNumeric(results[0]["used"])
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true, nil
+}
@@ -0,0 +1,609 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+)
+
+// JobHandler runs one job. The result (may be nil) is stored as JSON on the job; an error makes the job retry
+// with backoff until max_attempts, after which it is dead (dead-letter) and waits for an admin retry
+type JobHandler func(payload json.RawMessage) (interface{}, error)
+
+// JobOptions tune an enqueued job, the zero value runs it now with the default attempts
+type JobOptions struct {
+	Run_at       time.Time
+	Max_attempts int
+	Priority     int
+	Unique_key   string // at most one queued or running job per key
+}
+
+// Job runner settings, overridden from the environment by StartJobRunner:
+//
+//	JOB_WORKERS        number of worker goroutines
+//	JOB_POLL_INTERVAL  how often idle workers and the scheduler look for work, e.g. "2s"
+//	JOB_LOCK_TIMEOUT   a running job whose worker has not refreshed its lock for this long is considered abandoned
+//	                   and requeued, e.g. "10m". Workers refresh the lock every third of it while the handler runs
+//	JOB_RETENTION      finished jobs older than this are deleted by the cleanup job, e.g. "72h"
+var (
+	jobWorkers      = 4
+	jobPollInterval = 2 * time.Second
+	jobLockTimeout  = 10 * time.Minute
+	jobRetention    = 72 * time.Hour
+	jobBaseBackoff  = 10 * time.Second
+	jobMaxBackoff   = time.Hour
+)
+
+var (
+	jobHandlersMu sync.RWMutex
+	jobHandlers   = map[string]JobHandler{}
+	jobSchedules  = map[string]models.JobSchedule{}
+)
+
+// RegisterJobHandler makes handler run the jobs of jobType. Handlers are registered before StartJobRunner, usually in init
+func RegisterJobHandler(jobType string, handler JobHandler) {
+	jobHandlersMu.Lock()
+	defer jobHandlersMu.Unlock()
+	jobHandlers[jobType] = handler
+}
+
+func getJobHandler(jobType string) (JobHandler, bool) {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+	handler, ok := jobHandlers[jobType]
+	return handler, ok
+}
+
+// IsRegisteredJobType reports whether a handler exists for jobType
+func IsRegisteredJobType(jobType string) bool {
+	_, ok := getJobHandler(jobType)
+	return ok
+}
+
+// RegisterJobSchedule declares a recurring job. StartJobRunner creates its Job_schedule row when missing;
+// an existing row keeps the interval and active flag set through the admin endpoint
+func RegisterJobSchedule(name string, jobType string, interval time.Duration) {
+	jobHandlersMu.Lock()
+	defer jobHandlersMu.Unlock()
+	jobSchedules[name] = models.JobSchedule{
+		Schedule_name:    name,
+		Job_type:         jobType,
+		Interval_seconds: int(interval.Seconds()),
+	}
+}
+
+func init() {
+	RegisterJobHandler("jobs.cleanup", cleanupFinishedJobs)
+	RegisterJobSchedule("jobs-cleanup", "jobs.cleanup", 24*time.Hour)
+}
+
+// exponentialBackoff is base, 2*base, 4*base, ... for attempts 1, 2, 3, ..., capped at max
+func exponentialBackoff(base time.Duration, max time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func jobData(jobType string, payload interface{}, opts JobOptions) (map[string]interface{}, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job payload: %w", err)
+	}
+	if payload == nil {
+		raw = []byte("{}")
+	}
+
+	data := map[string]interface{}{
+		"job_type": jobType,
+		"payload":  string(raw),
+		"priority": opts.Priority,
+		"run_at":   time.Now(),
+	}
+	if !opts.Run_at.IsZero() {
+		data["run_at"] = opts.Run_at
+	}
+	if opts.Max_attempts > 0 {
+		data["max_attempts"] = opts.Max_attempts
+	}
+	if opts.Unique_key != "" {
+		data["unique_key"] = opts.Unique_key
+	}
+	return data, nil
+}
+
+// EnqueueJob adds a job to the queue and returns its id
+func EnqueueJob(jobType string, payload interface{}, opts JobOptions) (int64, error) {
+	data, err := jobData(jobType, payload, opts)
+	if err != nil {
+		return 0, err
+	}
+	id, err := InsertDataReturning("Job", data, "job_id")
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("a job with the same unique key is already queued")
+		}
+		return 0, err
+	}
+	return id.(int64), nil
+}
+
+// EnqueueJobTx is EnqueueJob inside a transaction, the job only becomes visible to workers when tx commits
+func EnqueueJobTx(tx *sql.Tx, jobType string, payload interface{}, opts JobOptions) (int64, error) {
+	data, err := jobData(jobType, payload, opts)
+	if err != nil {
+		return 0, err
+	}
+	id, err := InsertDataReturningTx(tx, "Job", data, "job_id")
+	if err != nil {
+		return 0, err
+	}
+	return id.(int64), nil
+}
+
+func loadJobSettings() {
+	if raw := os.Getenv("JOB_WORKERS"); raw != "" {
+		if workers, err := strconv.Atoi(raw); err == nil && workers > 0 {
+			jobWorkers = workers
+		}
+	}
+	durations := map[string]*time.Duration{
+		"JOB_POLL_INTERVAL": &jobPollInterval,
+		"JOB_LOCK_TIMEOUT":  &jobLockTimeout,
+		"JOB_RETENTION":     &jobRetention,
+	}
+	for name, target := range durations {
+		if raw := os.Getenv(name); raw != "" {
+			if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+				*target = value
+			}
+		}
+	}
+}
+
+// StartJobRunner starts the worker pool and the scheduler in the background. Every server instance can run it,
+// jobs and schedules are claimed with FOR UPDATE SKIP LOCKED so each runs once
+func StartJobRunner() {
+	loadJobSettings()
+	if err := syncJobSchedules(); err != nil {
+		fmt.Println("jobs: could not create job schedules:", err)
+	}
+
+	hostname, _ := os.Hostname()
+	for i := 1; i <= jobWorkers; i++ {
+		go jobWorker(fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), i))
+	}
+	go jobScheduler()
+	fmt.Printf("jobs: %d workers, polling every %s\n", jobWorkers, jobPollInterval)
+}
+
+// syncJobSchedules creates the Job_schedule rows of the schedules registered in code
+func syncJobSchedules() error {
+	jobHandlersMu.RLock()
+	schedules := make([]models.JobSchedule, 0, len(jobSchedules))
+	for _, schedule := range jobSchedules {
+		schedules = append(schedules, schedule)
+	}
+	jobHandlersMu.RUnlock()
+
+	for _, schedule := range schedules {
+		existing, err := SelectData("Job_schedule", []string{"schedule_name"}, true, "schedule_name = $1", []interface{}{schedule.Schedule_name}, false, "", "", "")
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+		_, err = InsertData("Job_schedule", map[string]interface{}{
+			"schedule_name":    schedule.Schedule_name,
+			"job_type":         schedule.Job_type,
+			"interval_seconds": schedule.Interval_seconds,
+			"next_run_at":      time.Now(),
+		})
+		if err != nil && !isUniqueViolation(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobWorker runs jobs one after the other, it sleeps for the poll interval when the queue is empty
+func jobWorker(workerID string) {
+	for {
+		job, err := claimJob(workerID)
+		if err != nil {
+			fmt.Println("jobs: claim failed:", err)
+			time.Sleep(jobPollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(jobPollInterval)
+			continue
+		}
+		runJob(workerID, job)
+	}
+}
+
+type claimedJob struct {
+	id          int64
+	jobType     string
+	payload     json.RawMessage
+	attempts    int
+	maxAttempts int
+}
+
+// claimJob marks the next due job running for workerID and returns it, nil when nothing is due
+func claimJob(workerID string) (*claimedJob, error) {
+	var job *claimedJob
+	err := WithTransaction(func(tx *sql.Tx) error {
+		now := time.Now()
+		results, err := SelectDataTx(tx, "Job", []string{"job_id", "job_type", "payload", "attempts", "max_attempts"}, true,
+			"status = 'queued' AND run_at <= $1", []interface{}{now}, false, "", "", "ORDER BY priority DESC, run_at, job_id LIMIT 1 FOR UPDATE SKIP LOCKED")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return nil
+		}
+
+		row := results[0]
+		job = &claimedJob{
+			id:          row["job_id"].(int64),
+			jobType:     row["job_type"].(string),
+			payload:     json.RawMessage(row["payload"].([]byte)),
+			attempts:    int(row["attempts"].(int64)) + 1,
+			maxAttempts: int(row["max_attempts"].(int64)),
+		}
+		_, err = UpdateDataTx(tx, "Job", map[string]interface{}{
+			"status":     "running",
+			"attempts":   job.attempts,
+			"locked_by":  workerID,
+			"locked_at":  now,
+			"started_at": now,
+		}, "job_id = $1", []interface{}{job.id})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// runJob runs a claimed job and records the outcome. The final update only applies while the job is still locked by
+// this worker, so a job the reaper gave to another worker is not overwritten
+func runJob(workerID string, job *claimedJob) {
+	stopHeartbeat := startJobHeartbeat(workerID, job.id)
+	result, err := callJobHandler(job)
+	stopHeartbeat()
+
+	data := map[string]interface{}{"locked_by": nil, "locked_at": nil}
+	now := time.Now()
+	switch {
+	case err == nil:
+		data["status"] = "succeeded"
+		data["finished_at"] = now
+		if result != nil {
+			if raw, marshalErr := json.Marshal(result); marshalErr == nil {
+				data["result"] = string(raw)
+			}
+		}
+	case job.attempts >= job.maxAttempts:
+		data["status"] = "dead"
+		data["finished_at"] = now
+		data["last_error"] = err.Error()
+		fmt.Printf("jobs: job %d (%s) is dead after %d attempts: %v\n", job.id, job.jobType, job.attempts, err)
+	default:
+		data["status"] = "queued"
+		data["run_at"] = now.Add(exponentialBackoff(jobBaseBackoff, jobMaxBackoff, job.attempts))
+		data["last_error"] = err.Error()
+	}
+
+	rowsAffected, updateErr := UpdateData("Job", data, "job_id = $1 AND status = 'running' AND locked_by = $2", []interface{}{job.id, workerID})
+	if updateErr != nil {
+		fmt.Printf("jobs: could not record outcome of job %d: %v\n", job.id, updateErr)
+	} else if rowsAffected == 0 {
+		fmt.Printf("jobs: job %d is no longer locked by %s, its outcome is dropped\n", job.id, workerID)
+	}
+}
+
+// startJobHeartbeat refreshes locked_at of the job every third of the lock timeout while its handler runs, so the reaper
+// only requeues the jobs of a worker that stopped and not the long ones. The returned func stops the heartbeat
+func startJobHeartbeat(workerID string, jobID int64) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobLockTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := UpdateData("Job", map[string]interface{}{"locked_at": time.Now()}, "job_id = $1 AND status = 'running' AND locked_by = $2", []interface{}{jobID, workerID})
+				if err != nil {
+					fmt.Printf("jobs: heartbeat of job %d failed: %v\n", jobID, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// callJobHandler runs the handler of the job, a panic becomes an error so the worker survives
+func callJobHandler(job *claimedJob) (result interface{}, err error) {
+	handler, ok := getJobHandler(job.jobType)
+	if !ok {
+		return nil, fmt.Errorf("no handler registered for job type %s", job.jobType)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(job.payload)
+}
+
+// jobScheduler enqueues due scheduled jobs and requeues abandoned ones every poll interval
+func jobScheduler() {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := enqueueDueSchedules(); err != nil {
+			fmt.Println("jobs: scheduler failed:", err)
+		}
+		if err := reapAbandonedJobs(); err != nil {
+			fmt.Println("jobs: reaper failed:", err)
+		}
+	}
+}
+
+// enqueueDueSchedules enqueues one job per due schedule, unless the previous run is still queued or running
+func enqueueDueSchedules() error {
+	return WithTransaction(func(tx *sql.Tx) error {
+		now := time.Now()
+		schedules, err := SelectDataTx(tx, "Job_schedule", []string{"schedule_name", "job_type", "payload", "interval_seconds"}, true,
+			"is_active AND next_run_at <= $1", []interface{}{now}, false, "", "", "FOR UPDATE SKIP LOCKED")
+		if err != nil {
+			return err
+		}
+
+		for _, schedule := range schedules {
+			name := schedule["schedule_name"].(string)
+			uniqueKey := "schedule:" + name
+
+			// The schedule row is locked, so no other instance can enqueue this key between the check and the insert
+			open, err := SelectDataTx(tx, "Job", []string{"job_id"}, true, "unique_key = $1 AND status IN ('queued', 'running')", []interface{}{uniqueKey}, false, "", "", "")
+			if err != nil {
+				return err
+			}
+			if len(open) == 0 {
+				_, err = InsertDataTx(tx, "Job", map[string]interface{}{
+					"job_type":   schedule["job_type"].(string),
+					"payload":    string(schedule["payload"].([]byte)),
+					"run_at":     now,
+					"unique_key": uniqueKey,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			interval := time.Duration(schedule["interval_seconds"].(int64)) * time.Second
+			_, err = UpdateDataTx(tx, "Job_schedule", map[string]interface{}{
+				"next_run_at": now.Add(interval),
+				"last_run_at": now,
+			}, "schedule_name = $1", []interface{}{name})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reapAbandonedJobs gives running jobs whose worker stopped (crash, restart) back to the queue, or to the dead-letter
+// state when they have used all their attempts. A live worker keeps locked_at fresh (startJobHeartbeat), so a job is
+// only stale once its heartbeat stopped
+func reapAbandonedJobs() error {
+	staleBefore := time.Now().Add(-jobLockTimeout)
+	_, err := UpdateData("Job", map[string]interface{}{
+		"status":      "dead",
+		"finished_at": time.Now(),
+		"last_error":  "worker stopped while running the job",
+		"locked_by":   nil,
+		"locked_at":   nil,
+	}, "status = 'running' AND locked_at < $1 AND attempts >= max_attempts", []interface{}{staleBefore})
+	if err != nil {
+		return err
+	}
+
+	_, err = UpdateData("Job", map[string]interface{}{
+		"status":     "queued",
+		"last_error": "worker stopped while running the job",
+		"locked_by":  nil,
+		"locked_at":  nil,
+	}, "status = 'running' AND locked_at < $1", []interface{}{staleBefore})
+	return err
+}
+
+// cleanupFinishedJobs deletes succeeded and cancelled jobs older than the retention, dead jobs are kept for inspection
+func cleanupFinishedJobs(payload json.RawMessage) (interface{}, error) {
+	deleted, err := DeleteData("Job", "status IN ('succeeded', 'cancelled') AND finished_at < $1", []interface{}{time.Now().Add(-jobRetention)})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"deleted": deleted}, nil
+}
+
+func jobFromRow(row map[string]interface{}) models.Job {
+	job := models.Job{
+		Job_id:       row["job_id"].(int64),
+		Job_type:     row["job_type"].(string),
+		Payload:      json.RawMessage(row["payload"].([]byte)),
+		Status:       stringOrEmpty(row["status"]),
+		Priority:     int(row["priority"].(int64)),
+		Run_at:       timeOrEmpty(row["run_at"]),
+		Attempts:     int(row["attempts"].(int64)),
+		Max_attempts: int(row["max_attempts"].(int64)),
+		Unique_key:   stringOrEmpty(row["unique_key"]),
+		Last_error:   stringOrEmpty(row["last_error"]),
+		Locked_by:    stringOrEmpty(row["locked_by"]),
+		Created_at:   timeOrEmpty(row["created_at"]),
+		Started_at:   timeOrEmpty(row["started_at"]),
+		Finished_at:  timeOrEmpty(row["finished_at"]),
+	}
+	if result, ok := row["result"].([]byte); ok {
+		job.Result = json.RawMessage(result)
+	}
+	return job
+}
+
+// GetJobs lists jobs newest first, filtered by status and job type when given
+func GetJobs(status string, jobType string, limit int) ([]models.Job, error) {
+	whereCon := "TRUE"
+	args := []interface{}{}
+	if status != "" {
+		args = append(args, status)
+		whereCon += fmt.Sprintf(" AND status::text = $%d", len(args))
+	}
+	if jobType != "" {
+		args = append(args, jobType)
+		whereCon += fmt.Sprintf(" AND job_type = $%d", len(args))
+	}
+
+	results, err := SelectData("Job", []string{"*"}, true, whereCon, args, false, "", "", fmt.Sprintf("ORDER BY job_id DESC LIMIT %d", limit))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []models.Job{}
+	for _, row := range results {
+		jobs = append(jobs, jobFromRow(row))
+	}
+	return jobs, nil
+}
+
+func GetJob(jobID int64) (*models.Job, error) {
+	results, err := SelectData("Job", []string{"*"}, true, "job_id = $1", []interface{}{jobID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("job not found")
+	}
+	job := jobFromRow(results[0])
+	return &job, nil
+}
+
+// GetJobStats counts jobs per type and status, for a quick look at queue depth and dead-letter size
+func GetJobStats() ([]models.JobStats, error) {
+	results, err := SelectData("Job", []string{"job_type", "status", "COUNT(*) AS count"}, false, "", nil, false, "", "", "GROUP BY job_type, status ORDER BY job_type, status")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []models.JobStats{}
+	for _, row := range results {
+		stats = append(stats, models.JobStats{
+			Job_type: row["job_type"].(string),
+			Status:   stringOrEmpty(row["status"]),
+			Count:    row["count"].(int64),
+		})
+	}
+	return stats, nil
+}
+
+// RetryJob puts a dead or cancelled job back in the queue with a fresh set of attempts
+func RetryJob(jobID int64) error {
+	return WithTransaction(func(tx *sql.Tx) error {
+		results, err := SelectDataTx(tx, "Job", []string{"status"}, true, "job_id = $1", []interface{}{jobID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("job not found")
+		}
+		status := stringOrEmpty(results[0]["status"])
+		if status != "dead" && status != "cancelled" {
+			return fmt.Errorf("only dead or cancelled jobs can be retried, job is %s", status)
+		}
+
+		_, err = UpdateDataTx(tx, "Job", map[string]interface{}{
+			"status":      "queued",
+			"attempts":    0,
+			"run_at":      time.Now(),
+			"finished_at": nil,
+		}, "job_id = $1", []interface{}{jobID})
+		if isUniqueViolation(err) {
+			return fmt.Errorf("a job with the same unique key is already queued")
+		}
+		return err
+	})
+}
+
+// CancelJob cancels a job that has not started yet
+func CancelJob(jobID int64) error {
+	rowsAffected, err := UpdateData("Job", map[string]interface{}{
+		"status":      "cancelled",
+		"finished_at": time.Now(),
+	}, "job_id = $1 AND status = 'queued'", []interface{}{jobID})
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		if _, err := GetJob(jobID); err != nil {
+			return err
+		}
+		return fmt.Errorf("only queued jobs can be cancelled")
+	}
+	return nil
+}
+
+func GetJobSchedules() ([]models.JobSchedule, error) {
+	results, err := SelectData("Job_schedule", []string{"*"}, false, "", nil, false, "", "", "ORDER BY schedule_name")
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []models.JobSchedule{}
+	for _, row := range results {
+		schedules = append(schedules, models.JobSchedule{
+			Schedule_name:    row["schedule_name"].(string),
+			Job_type:         row["job_type"].(string),
+			Payload:          json.RawMessage(row["payload"].([]byte)),
+			Interval_seconds: int(row["interval_seconds"].(int64)),
+			Next_run_at:      timeOrEmpty(row["next_run_at"]),
+			Last_run_at:      timeOrEmpty(row["last_run_at"]),
+			Is_active:        row["is_active"].(bool),
+		})
+	}
+	return schedules, nil
+}
+
+func UpdateJobSchedule(name string, data map[string]interface{}) (int64, error) {
+	return UpdateData("Job_schedule", data, "schedule_name = $1", []interface{}{name})
+}
+
+// GetJobTypes lists the job types that have a handler
+func GetJobTypes() []string {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+
+	types := make([]string, 0, len(jobHandlers))
+	for jobType := range jobHandlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
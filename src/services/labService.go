@@ -0,0 +1,555 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/catalog"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// LabOrderStatusError is returned when a lab order is not in a status that allows the requested step
+type LabOrderStatusError struct {
+	Action string
+	Status string
+}
+
+func (e *LabOrderStatusError) Error() string {
+	return fmt.Sprintf("cannot %s a lab order that is %s", e.Action, e.Status)
+}
+
+var labOrderFields = []string{
+	"Lab_order.lab_order_id",
+	"Lab_order.patient_id",
+	"Lab_order.lab_test_id",
+	"Lab_test.test_name",
+	"Lab_test.specimen_type",
+	"Lab_order.ordered_by",
+	"Lab_order.medical_history_id",
+	"Lab_order.priority",
+	"Lab_order.status",
+	"Lab_order.note",
+	"Lab_order.ordered_at",
+	"Lab_order.specimen_id",
+	"Lab_order.collected_by",
+	"Lab_order.collected_at",
+	"Lab_order.resulted_by",
+	"Lab_order.resulted_at",
+	"Lab_order.verified_by",
+	"Lab_order.verified_at",
+}
+
+const labOrderJoin = "Lab_test ON Lab_order.lab_test_id = Lab_test.lab_test_id"
+
+// GetLabTests returns the lab test catalog with the components of every test
+func GetLabTests() ([]catalog.LabTest, error) {
+	results, err := SelectData("Lab_test", []string{"lab_test_id", "test_name", "specimen_type", "loinc_code"}, false, "", nil, false, "", "", "ORDER BY lab_test_id")
+	if err != nil {
+		return nil, err
+	}
+
+	components, err := getLabTestComponents("")
+	if err != nil {
+		return nil, err
+	}
+
+	labTests := []catalog.LabTest{}
+	for _, row := range results {
+		labTestID := row["lab_test_id"].(string)
+		labTests = append(labTests, catalog.LabTest{
+			Lab_test_id:   labTestID,
+			Test_name:     row["test_name"].(string),
+			Specimen_type: row["specimen_type"].(string),
+			Loinc_code:    stringOrEmpty(row["loinc_code"]),
+			Components:    components[labTestID],
+		})
+	}
+
+	return labTests, nil
+}
+
+// getLabTestComponents loads components keyed by lab test id, labTestID = "" loads every test
+func getLabTestComponents(labTestID string) (map[string][]catalog.LabTestComponent, error) {
+	fields := []string{"component_id", "lab_test_id", "component_name", "unit", "normal_low", "normal_high", "critical_low", "critical_high"}
+	var results []map[string]interface{}
+	var err error
+	if labTestID == "" {
+		results, err = SelectData("Lab_test_component", fields, false, "", nil, false, "", "", "ORDER BY component_id")
+	} else {
+		results, err = SelectData("Lab_test_component", fields, true, "lab_test_id = $1", []interface{}{labTestID}, false, "", "", "ORDER BY component_id")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	components := map[string][]catalog.LabTestComponent{}
+	for _, row := range results {
+		testID := row["lab_test_id"].(string)
+		components[testID] = append(components[testID], catalog.LabTestComponent{
+			Component_id:   row["component_id"].(int64),
+			Component_name: row["component_name"].(string),
+			Unit:           row["unit"].(string),
+			Normal_low:     floatOrNil(row["normal_low"]),
+			Normal_high:    floatOrNil(row["normal_high"]),
+			Critical_low:   floatOrNil(row["critical_low"]),
+			Critical_high:  floatOrNil(row["critical_high"]),
+		})
+	}
+
+	return components, nil
+}
+
+// AddLabTest adds a test and its components in one transaction
+func AddLabTest(labTest catalog.LabTest) error {
+	existing, err := SelectData("Lab_test", []string{"lab_test_id"}, true, "lab_test_id = $1", []interface{}{labTest.Lab_test_id}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("lab test already exists")
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		_, err := InsertDataTx(tx, "Lab_test", map[string]interface{}{
+			"lab_test_id":   labTest.Lab_test_id,
+			"test_name":     labTest.Test_name,
+			"specimen_type": labTest.Specimen_type,
+			"loinc_code":    nullIfEmpty(labTest.Loinc_code),
+		})
+		if err != nil {
+			return fmt.Errorf("insert lab test failed: %w", err)
+		}
+
+		for _, component := range labTest.Components {
+			_, err := InsertDataTx(tx, "Lab_test_component", map[string]interface{}{
+				"lab_test_id":    labTest.Lab_test_id,
+				"component_name": component.Component_name,
+				"unit":           component.Unit,
+				"normal_low":     component.Normal_low,
+				"normal_high":    component.Normal_high,
+				"critical_low":   component.Critical_low,
+				"critical_high":  component.Critical_high,
+			})
+			if err != nil {
+				return fmt.Errorf("insert lab test component failed: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// AddLabOrder places an order for a patient and returns the new lab order id
+func AddLabOrder(req patients.AddLabOrderRequest) (int64, error) {
+	patientResult, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{req.Patient_id}, false, "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if len(patientResult) == 0 {
+		return 0, fmt.Errorf("Patient not found")
+	}
+
+	labTest, err := SelectData("Lab_test", []string{"lab_test_id"}, true, "lab_test_id = $1", []interface{}{req.Lab_test_id}, false, "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if len(labTest) == 0 {
+		return 0, fmt.Errorf("lab test not found")
+	}
+
+	if err := checkActiveEmployee(req.Ordered_by); err != nil {
+		return 0, err
+	}
+
+	if req.Encounter_id != nil {
+		encounter, err := SelectData("Medical_history", []string{"medical_history_id"}, true, "medical_history_id = $1 AND patient_id = $2", []interface{}{*req.Encounter_id, req.Patient_id}, false, "", "", "")
+		if err != nil {
+			return 0, err
+		}
+		if len(encounter) == 0 {
+			return 0, fmt.Errorf("encounter not found for this patient")
+		}
+	}
+
+	priority := req.Priority
+	if priority == "" {
+		priority = "routine"
+	}
+
+	id, err := InsertDataReturning("Lab_order", map[string]interface{}{
+		"patient_id":         req.Patient_id,
+		"lab_test_id":        req.Lab_test_id,
+		"ordered_by":         req.Ordered_by,
+		"medical_history_id": req.Encounter_id,
+		"priority":           priority,
+		"note":               nullIfEmpty(req.Note),
+	}, "lab_order_id")
+	if err != nil {
+		return 0, fmt.Errorf("insert lab order failed: %w", err)
+	}
+
+	return id.(int64), nil
+}
+
+// GetLabOrder returns one order with its results
+func GetLabOrder(labOrderID int64) (*patients.LabOrder, error) {
+	results, err := SelectData("Lab_order", labOrderFields, true, "Lab_order.lab_order_id = $1", []interface{}{labOrderID}, true, labOrderJoin, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("lab order not found")
+	}
+
+	order := labOrderFromRow(results[0])
+	labResults, err := getLabResults("Lab_result.lab_order_id = $1", []interface{}{order.Lab_order_id})
+	if err != nil {
+		return nil, err
+	}
+	setLabOrderResults(&order, labResults[order.Lab_order_id])
+
+	return &order, nil
+}
+
+// GetPatientLabOrders returns the orders of a patient newest first, status = "" returns every status
+func GetPatientLabOrders(patientID string, status string) ([]patients.LabOrder, error) {
+	patientResult, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(patientResult) == 0 {
+		return nil, fmt.Errorf("Patient not found")
+	}
+
+	whereCon := "Lab_order.patient_id = $1"
+	args := []interface{}{patientID}
+	if status != "" {
+		whereCon += " AND Lab_order.status = $2"
+		args = append(args, status)
+	}
+
+	results, err := SelectData("Lab_order", labOrderFields, true, whereCon, args, true, labOrderJoin, "", "ORDER BY Lab_order.ordered_at DESC, Lab_order.lab_order_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	labResults, err := getLabResults("Lab_result.lab_order_id IN (SELECT lab_order_id FROM Lab_order WHERE patient_id = $1)", []interface{}{patientID})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []patients.LabOrder{}
+	for _, row := range results {
+		order := labOrderFromRow(row)
+		setLabOrderResults(&order, labResults[order.Lab_order_id])
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// lockLabOrder locks the order row for a status change and checks that its status allows the action
+func lockLabOrder(tx *sql.Tx, labOrderID int64, action string, allowed ...string) (map[string]interface{}, error) {
+	results, err := SelectDataTx(tx, "Lab_order", []string{"lab_order_id", "patient_id", "lab_test_id", "status", "resulted_by"}, true, "lab_order_id = $1", []interface{}{labOrderID}, false, "", "", "FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("lab order not found")
+	}
+
+	status := stringOrEmpty(results[0]["status"])
+	for _, s := range allowed {
+		if status == s {
+			return results[0], nil
+		}
+	}
+	return nil, &LabOrderStatusError{Action: action, Status: status}
+}
+
+// CollectLabOrder records that the specimen was taken
+func CollectLabOrder(labOrderID int64, req patients.CollectLabOrderRequest) error {
+	if err := checkActiveEmployee(req.Employee_id); err != nil {
+		return err
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		if _, err := lockLabOrder(tx, labOrderID, "collect", "ordered"); err != nil {
+			return err
+		}
+		_, err := UpdateDataTx(tx, "Lab_order", map[string]interface{}{
+			"status":       "collected",
+			"specimen_id":  nullIfEmpty(req.Specimen_id),
+			"collected_by": req.Employee_id,
+			"collected_at": time.Now(),
+		}, "lab_order_id = $1", []interface{}{labOrderID})
+		return err
+	})
+}
+
+// EnterLabResults stores a value for every component of the test and flags it against the component's ranges.
+// Results can be entered again until the order is verified, the new values replace the old ones
+func EnterLabResults(labOrderID int64, req patients.EnterLabResultsRequest) error {
+	if err := checkActiveEmployee(req.Employee_id); err != nil {
+		return err
+	}
+
+	var order map[string]interface{}
+	err := WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		order, err = lockLabOrder(tx, labOrderID, "enter results for", "collected", "resulted")
+		if err != nil {
+			return err
+		}
+		labTestID := order["lab_test_id"].(string)
+
+		components, err := getLabTestComponents(labTestID)
+		if err != nil {
+			return err
+		}
+		componentsByID := map[int64]catalog.LabTestComponent{}
+		for _, component := range components[labTestID] {
+			componentsByID[component.Component_id] = component
+		}
+
+		var unknown []string
+		entered := map[int64]bool{}
+		for _, result := range req.Results {
+			if _, ok := componentsByID[result.Component_id]; !ok {
+				unknown = append(unknown, fmt.Sprint(result.Component_id))
+			}
+			entered[result.Component_id] = result.Value != nil
+		}
+		if len(unknown) > 0 {
+			return &UnknownCatalogIdError{Field: "component_id", Ids: unknown}
+		}
+
+		var missing []string
+		for _, component := range components[labTestID] {
+			if !entered[component.Component_id] {
+				missing = append(missing, component.Component_name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("missing results for: %s", strings.Join(missing, ", "))
+		}
+
+		if _, err := DeleteDataTx(tx, "Lab_result", "lab_order_id = $1", []interface{}{order["lab_order_id"]}); err != nil {
+			return err
+		}
+
+		for _, result := range req.Results {
+			component := componentsByID[result.Component_id]
+			_, err := InsertDataTx(tx, "Lab_result", map[string]interface{}{
+				"lab_order_id": order["lab_order_id"],
+				"component_id": result.Component_id,
+				"value":        *result.Value,
+				"unit":         component.Unit,
+				"normal_low":   component.Normal_low,
+				"normal_high":  component.Normal_high,
+				"flag":         observationFlag(*result.Value, component.Normal_low, component.Normal_high, component.Critical_low, component.Critical_high),
+			})
+			if err != nil {
+				return fmt.Errorf("insert lab result failed: %w", err)
+			}
+		}
+
+		_, err = UpdateDataTx(tx, "Lab_order", map[string]interface{}{
+			"status":      "resulted",
+			"resulted_by": req.Employee_id,
+			"resulted_at": time.Now(),
+		}, "lab_order_id = $1", []interface{}{order["lab_order_id"]})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	publishLabResultEvent(order["patient_id"].(string), "lab.resulted", labOrderEventData(order, "resulted"))
+	return nil
+}
+
+// VerifyLabOrder releases the results. The verifier has to be someone other than the employee who entered them
+func VerifyLabOrder(labOrderID int64, req patients.VerifyLabOrderRequest) error {
+	if err := checkActiveEmployee(req.Employee_id); err != nil {
+		return err
+	}
+
+	var order map[string]interface{}
+	err := WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		order, err = lockLabOrder(tx, labOrderID, "verify", "resulted")
+		if err != nil {
+			return err
+		}
+		if stringOrEmpty(order["resulted_by"]) == req.Employee_id {
+			return fmt.Errorf("results must be verified by a different employee")
+		}
+
+		_, err = UpdateDataTx(tx, "Lab_order", map[string]interface{}{
+			"status":      "verified",
+			"verified_by": req.Employee_id,
+			"verified_at": time.Now(),
+		}, "lab_order_id = $1", []interface{}{order["lab_order_id"]})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	publishLabResultEvent(order["patient_id"].(string), "lab.verified", labOrderEventData(order, "verified"))
+	return nil
+}
+
+// labOrderEventData identifies the order in a lab result event, clients fetch the values through the lab order endpoint
+func labOrderEventData(order map[string]interface{}, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"lab_order_id": order["lab_order_id"],
+		"patient_id":   order["patient_id"],
+		"lab_test_id":  order["lab_test_id"],
+		"status":       status,
+	}
+}
+
+// CancelLabOrder cancels an order that has no results yet
+func CancelLabOrder(labOrderID int64) error {
+	return WithTransaction(func(tx *sql.Tx) error {
+		order, err := lockLabOrder(tx, labOrderID, "cancel", "ordered", "collected")
+		if err != nil {
+			return err
+		}
+
+		_, err = UpdateDataTx(tx, "Lab_order", map[string]interface{}{
+			"status":       "cancelled",
+			"cancelled_at": time.Now(),
+		}, "lab_order_id = $1", []interface{}{order["lab_order_id"]})
+		return err
+	})
+}
+
+// getPatientsLabAlerts returns the abnormal results of the resulted and verified orders of each of the patients, newest
+// first, keyed by patient id
+func getPatientsLabAlerts(patientIDs []string) (map[string][]patients.LabAlert, error) {
+	fields := []string{
+		"Lab_order.patient_id",
+		"Lab_order.lab_order_id",
+		"Lab_test.test_name",
+		"Lab_test_component.component_name",
+		"Lab_result.value",
+		"Lab_result.unit",
+		"Lab_result.flag",
+		"Lab_order.status",
+		"Lab_order.resulted_at",
+	}
+	results, err := SelectData(
+		"Lab_result",
+		fields,
+		true,
+		"Lab_order.patient_id = ANY($1) AND Lab_order.status IN ('resulted', 'verified') AND Lab_result.flag <> 'normal'",
+		[]interface{}{pq.Array(patientIDs)},
+		true,
+		"Lab_order ON Lab_result.lab_order_id = Lab_order.lab_order_id JOIN Lab_test ON Lab_order.lab_test_id = Lab_test.lab_test_id JOIN Lab_test_component ON Lab_result.component_id = Lab_test_component.component_id",
+		"",
+		"ORDER BY Lab_order.resulted_at DESC, Lab_result.lab_result_id")
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := map[string][]patients.LabAlert{}
+	for _, patientID := range patientIDs {
+		alerts[patientID] = []patients.LabAlert{}
+	}
+	for _, row := range results {
+		patientID := row["patient_id"].(string)
+		alerts[patientID] = append(alerts[patientID], patients.LabAlert{
+			Lab_order_id:   row["lab_order_id"].(int64),
+			Test_name:      row["test_name"].(string),
+			Component_name: row["component_name"].(string),
+			Value:          *floatOrNil(row["value"]),
+			Unit:           row["unit"].(string),
+			Flag:           row["flag"].(string),
+			Status:         stringOrEmpty(row["status"]),
+			Resulted_at:    timeOrEmpty(row["resulted_at"]),
+		})
+	}
+
+	return alerts, nil
+}
+
+// getLabResults loads results matching whereCon keyed by lab order id
+func getLabResults(whereCon string, args []interface{}) (map[int64][]patients.LabResult, error) {
+	fields := []string{
+		"Lab_result.lab_order_id",
+		"Lab_result.component_id",
+		"Lab_test_component.component_name",
+		"Lab_result.value",
+		"Lab_result.unit",
+		"Lab_result.normal_low",
+		"Lab_result.normal_high",
+		"Lab_result.flag",
+	}
+	results, err := SelectData("Lab_result", fields, true, whereCon, args, true, "Lab_test_component ON Lab_result.component_id = Lab_test_component.component_id", "", "ORDER BY Lab_result.component_id")
+	if err != nil {
+		return nil, err
+	}
+
+	labResults := map[int64][]patients.LabResult{}
+	for _, row := range results {
+		orderID := row["lab_order_id"].(int64)
+		flag := row["flag"].(string)
+		labResults[orderID] = append(labResults[orderID], patients.LabResult{
+			Component_id:   row["component_id"].(int64),
+			Component_name: row["component_name"].(string),
+			Value:          *floatOrNil(row["value"]),
+			Unit:           row["unit"].(string),
+			Normal_low:     floatOrNil(row["normal_low"]),
+			Normal_high:    floatOrNil(row["normal_high"]),
+			Flag:           flag,
+			Is_abnormal:    flag != "normal",
+		})
+	}
+
+	return labResults, nil
+}
+
+func setLabOrderResults(order *patients.LabOrder, results []patients.LabResult) {
+	order.Results = []patients.LabResult{}
+	for _, result := range results {
+		order.Results = append(order.Results, result)
+		if result.Is_abnormal {
+			order.Has_abnormal = true
+		}
+		if strings.HasPrefix(result.Flag, "critical") {
+			order.Has_critical = true
+		}
+	}
+}
+
+func labOrderFromRow(row map[string]interface{}) patients.LabOrder {
+	order := patients.LabOrder{
+		Lab_order_id:  row["lab_order_id"].(int64),
+		Patient_id:    row["patient_id"].(string),
+		Lab_test_id:   row["lab_test_id"].(string),
+		Test_name:     row["test_name"].(string),
+		Specimen_type: row["specimen_type"].(string),
+		Ordered_by:    row["ordered_by"].(string),
+		Priority:      stringOrEmpty(row["priority"]),
+		Status:        stringOrEmpty(row["status"]),
+		Note:          stringOrEmpty(row["note"]),
+		Ordered_at:    timeOrEmpty(row["ordered_at"]),
+		Specimen_id:   stringOrEmpty(row["specimen_id"]),
+		Collected_by:  stringOrEmpty(row["collected_by"]),
+		Collected_at:  timeOrEmpty(row["collected_at"]),
+		Resulted_by:   stringOrEmpty(row["resulted_by"]),
+		Resulted_at:   timeOrEmpty(row["resulted_at"]),
+		Verified_by:   stringOrEmpty(row["verified_by"]),
+		Verified_at:   timeOrEmpty(row["verified_at"]),
+	}
+	if encounterID, ok := row["medical_history_id"].(int64); ok {
+		order.Encounter_id = &encounterID
+	}
+	return order
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/catalog"
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// ObservationRangeError is returned when a measured value is outside the plausible range of its observation type
+type ObservationRangeError struct {
+	Field string
+	Min   float64
+	Max   float64
+}
+
+func (e *ObservationRangeError) Error() string {
+	return fmt.Sprintf("%s must be between %g and %g", e.Field, e.Min, e.Max)
+}
+
+var observationFields = []string{
+	"Observation.observation_id",
+	"Observation.observation_type",
+	"Observation_type.display_name",
+	"Observation.value",
+	"Observation_type.unit",
+	"Observation.observed_at",
+	"Observation.employee_id",
+	"Observation.medical_history_id",
+	"Observation.note",
+	"Observation_type.normal_low",
+	"Observation_type.normal_high",
+	"Observation_type.critical_low",
+	"Observation_type.critical_high",
+}
+
+const observationJoin = "Observation_type ON Observation.observation_type = Observation_type.observation_type"
+
+// GetObservationTypes returns every observation type with its unit and reference ranges
+func GetObservationTypes() ([]catalog.ObservationType, error) {
+	fields := []string{"observation_type", "display_name", "unit", "normal_low", "normal_high", "critical_low", "critical_high", "valid_min", "valid_max"}
+	results, err := SelectData("Observation_type", fields, false, "", nil, false, "", "", "ORDER BY observation_type")
+	if err != nil {
+		return nil, err
+	}
+
+	observationTypes := []catalog.ObservationType{}
+	for _, row := range results {
+		observationTypes = append(observationTypes, catalog.ObservationType{
+			Observation_type: row["observation_type"].(string),
+			Display_name:     row["display_name"].(string),
+			Unit:             row["unit"].(string),
+			Normal_low:       floatOrNil(row["normal_low"]),
+			Normal_high:      floatOrNil(row["normal_high"]),
+			Critical_low:     floatOrNil(row["critical_low"]),
+			Critical_high:    floatOrNil(row["critical_high"]),
+			Valid_min:        *floatOrNil(row["valid_min"]),
+			Valid_max:        *floatOrNil(row["valid_max"]),
+		})
+	}
+
+	return observationTypes, nil
+}
+
+// validateObservations checks that every type exists and every value is plausible for its type.
+// fieldName builds the name reported in errors for the i-th observation
+func validateObservations(inputs []patients.ObservationInput, fieldName func(i int, input patients.ObservationInput) string) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	observationTypes, err := GetObservationTypes()
+	if err != nil {
+		return err
+	}
+	typesByCode := map[string]catalog.ObservationType{}
+	for _, observationType := range observationTypes {
+		typesByCode[observationType.Observation_type] = observationType
+	}
+
+	var unknown []string
+	for _, input := range inputs {
+		if _, ok := typesByCode[input.Observation_type]; !ok {
+			unknown = append(unknown, input.Observation_type)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownCatalogIdError{Field: "observation_type", Ids: unknown}
+	}
+
+	for i, input := range inputs {
+		observationType := typesByCode[input.Observation_type]
+		if input.Value == nil {
+			return fmt.Errorf("%s is required", fieldName(i, input))
+		}
+		if *input.Value < observationType.Valid_min || *input.Value > observationType.Valid_max {
+			return &ObservationRangeError{Field: fieldName(i, input), Min: observationType.Valid_min, Max: observationType.Valid_max}
+		}
+	}
+
+	return nil
+}
+
+// encounterVitalObservations turns the vitals of an encounter into observations, vitals that were not measured are skipped
+func encounterVitalObservations(v patients.EncounterVitals) []patients.ObservationInput {
+	var inputs []patients.ObservationInput
+	addInt := func(observationType string, value *int) {
+		if value != nil {
+			measured := float64(*value)
+			inputs = append(inputs, patients.ObservationInput{Observation_type: observationType, Value: &measured})
+		}
+	}
+
+	addInt("systolic_bp", v.Systolic_bp)
+	addInt("diastolic_bp", v.Diastolic_bp)
+	addInt("heart_rate", v.Heart_rate)
+	addInt("respiratory_rate", v.Respiratory_rate)
+	if v.Temperature != nil {
+		inputs = append(inputs, patients.ObservationInput{Observation_type: "temperature", Value: v.Temperature})
+	}
+	addInt("spo2", v.Spo2)
+
+	return inputs
+}
+
+// insertObservationsTx writes observations of one patient. encounterID is nil for observations taken outside an encounter
+func insertObservationsTx(tx *sql.Tx, patientID string, inputs []patients.ObservationInput, encounterID interface{}) ([]int64, error) {
+	var ids []int64
+	for _, input := range inputs {
+		data := map[string]interface{}{
+			"patient_id":         patientID,
+			"observation_type":   input.Observation_type,
+			"value":              *input.Value,
+			"employee_id":        nullIfEmpty(input.Employee_id),
+			"medical_history_id": encounterID,
+			"note":               nullIfEmpty(input.Note),
+		}
+		if input.Observed_at != "" {
+			data["observed_at"] = input.Observed_at
+		}
+
+		id, err := InsertDataReturningTx(tx, "Observation", data, "observation_id")
+		if err != nil {
+			return nil, fmt.Errorf("insert observation failed: %w", err)
+		}
+		ids = append(ids, id.(int64))
+	}
+	return ids, nil
+}
+
+// AddObservations records a batch of measurements for a patient in one transaction and returns the new observation ids
+func AddObservations(patientID string, req patients.AddObservationsRequest) ([]int64, error) {
+	patientResult, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(patientResult) == 0 {
+		return nil, fmt.Errorf("Patient not found")
+	}
+
+	checked := map[string]bool{}
+	for _, input := range req.Observations {
+		if input.Employee_id == "" || checked[input.Employee_id] {
+			continue
+		}
+		if err := checkActiveEmployee(input.Employee_id); err != nil {
+			return nil, err
+		}
+		checked[input.Employee_id] = true
+	}
+
+	err = validateObservations(req.Observations, func(i int, _ patients.ObservationInput) string {
+		return fmt.Sprintf("observations[%d].value", i)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	err = WithTransaction(func(tx *sql.Tx) error {
+		ids, err = insertObservationsTx(tx, patientID, req.Observations, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetPatientObservations returns the time series of a patient oldest first, optionally narrowed by type, date range and abnormal flag
+func GetPatientObservations(patientID string, query patients.ObservationQuery) ([]patients.Observation, error) {
+	patientResult, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(patientResult) == 0 {
+		return nil, fmt.Errorf("Patient not found")
+	}
+
+	whereCon := "Observation.patient_id = $1"
+	args := []interface{}{patientID}
+	if query.Observation_type != "" {
+		args = append(args, query.Observation_type)
+		whereCon += fmt.Sprintf(" AND Observation.observation_type = $%d", len(args))
+	}
+	if query.From != "" {
+		args = append(args, query.From)
+		whereCon += fmt.Sprintf(" AND Observation.observed_at >= $%d::date", len(args))
+	}
+	if query.To != "" {
+		// "to" is a whole day, so compare against the start of the next day
+		args = append(args, query.To)
+		whereCon += fmt.Sprintf(" AND Observation.observed_at < $%d::date + 1", len(args))
+	}
+
+	results, err := SelectData("Observation", observationFields, true, whereCon, args, true, observationJoin, "", "ORDER BY Observation.observed_at, Observation.observation_id")
+	if err != nil {
+		return nil, err
+	}
+
+	observations := []patients.Observation{}
+	for _, row := range results {
+		observation := observationFromRow(row)
+		if query.Abnormal_only && !observation.Is_abnormal {
+			continue
+		}
+		observations = append(observations, observation)
+	}
+
+	return observations, nil
+}
+
+// getPatientsLatestVitals returns the most recent observation of each type of each of the patients for GetPatientResponse,
+// keyed by patient id
+func getPatientsLatestVitals(patientIDs []string) (map[string][]patients.Observation, error) {
+	latest := "Observation.observation_id IN (SELECT DISTINCT ON (patient_id, observation_type) observation_id FROM Observation WHERE patient_id = ANY($1) ORDER BY patient_id, observation_type, observed_at DESC, observation_id DESC)"
+	fields := append([]string{"Observation.patient_id"}, observationFields...)
+	results, err := SelectData("Observation", fields, true, latest, []interface{}{pq.Array(patientIDs)}, true, observationJoin, "", "ORDER BY Observation.observation_type")
+	if err != nil {
+		return nil, err
+	}
+
+	observations := map[string][]patients.Observation{}
+	for _, patientID := range patientIDs {
+		observations[patientID] = []patients.Observation{}
+	}
+	for _, row := range results {
+		patientID := row["patient_id"].(string)
+		observations[patientID] = append(observations[patientID], observationFromRow(row))
+	}
+
+	return observations, nil
+}
+
+// getPatientsEncounterVitals loads the vitals of all encounters of the patients in one query, keyed by encounter id
+func getPatientsEncounterVitals(patientIDs []string) (map[int64]patients.EncounterVitals, error) {
+	results, err := SelectData(
+		"Observation",
+		[]string{"medical_history_id", "observation_type", "value"},
+		true,
+		"patient_id = ANY($1) AND medical_history_id IS NOT NULL",
+		[]interface{}{pq.Array(patientIDs)},
+		false, "", "",
+		"ORDER BY observation_id")
+	if err != nil {
+		return nil, err
+	}
+
+	vitals := map[int64]patients.EncounterVitals{}
+	for _, row := range results {
+		encounterID := row["medical_history_id"].(int64)
+		value := floatOrNil(row["value"])
+		if value == nil {
+			continue
+		}
+		rounded := int(*value + 0.5)
+
+		v := vitals[encounterID]
+		switch row["observation_type"].(string) {
+		case "systolic_bp":
+			v.Systolic_bp = &rounded
+		case "diastolic_bp":
+			v.Diastolic_bp = &rounded
+		case "heart_rate":
+			v.Heart_rate = &rounded
+		case "respiratory_rate":
+			v.Respiratory_rate = &rounded
+		case "temperature":
+			v.Temperature = value
+		case "spo2":
+			v.Spo2 = &rounded
+		}
+		vitals[encounterID] = v
+	}
+
+	return vitals, nil
+}
+
+func observationFromRow(row map[string]interface{}) patients.Observation {
+	value := *floatOrNil(row["value"])
+	normalLow := floatOrNil(row["normal_low"])
+	normalHigh := floatOrNil(row["normal_high"])
+	flag := observationFlag(value, normalLow, normalHigh, floatOrNil(row["critical_low"]), floatOrNil(row["critical_high"]))
+
+	observation := patients.Observation{
+		Observation_id:   row["observation_id"].(int64),
+		Observation_type: row["observation_type"].(string),
+		Display_name:     row["display_name"].(string),
+		Value:            value,
+		Unit:             row["unit"].(string),
+		Observed_at:      row["observed_at"].(time.Time).Format("2006-01-02 15:04:05"),
+		Employee_id:      stringOrEmpty(row["employee_id"]),
+		Note:             stringOrEmpty(row["note"]),
+		Normal_low:       normalLow,
+		Normal_high:      normalHigh,
+		Flag:             flag,
+		Is_abnormal:      flag != "normal",
+	}
+	if encounterID, ok := row["medical_history_id"].(int64); ok {
+		observation.Encounter_id = &encounterID
+	}
+
+	return observation
+}
+
+// observationFlag grades a value against the reference ranges of its type, critical limits win over normal limits
+func observationFlag(value float64, normalLow, normalHigh, criticalLow, criticalHigh *float64) string {
+	switch {
+	case criticalLow != nil && value < *criticalLow:
+		return "critical_low"
+	case criticalHigh != nil && value > *criticalHigh:
+		return "critical_high"
+	case normalLow != nil && value < *normalLow:
+		return "low"
+	case normalHigh != nil && value > *normalHigh:
+		return "high"
+	}
+	return "normal"
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"database/sql"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// Ranked patient search over one query string: full-text (prefix) matching on names and email so "john do" finds
+// John Doe, trigram word similarity for typos ("jonh"), exact patient id / id card / phone and prefixes of the numbers,
+// and a date of birth written as YYYY-MM-DD, DD-MM-YYYY or DD/MM/YYYY. The indexes are in create.sql
+
+// patientSearchSimilarity is the pg_trgm word similarity a name or email needs to count as a typo of the query
+const patientSearchSimilarity = "0.3"
+
+const patientSearchVector = "to_tsvector('simple', Patient.first_name || ' ' || Patient.last_name || ' ' || Patient.email)"
+
+const patientFullName = "(Patient.first_name || ' ' || Patient.last_name)"
+
+// $1 query, $2 tsquery (prefix terms), $3 digits of the query, $4 date in the query, $5 date_of_birth filter
+var patientSearchMatch = strings.Join([]string{
+	"Patient.patient_id = upper($1)",
+	"($3 <> '' AND (Patient.phone_number LIKE $3 || '%' OR Patient.id_card_number LIKE $3 || '%'))",
+	"($2 <> '' AND " + patientSearchVector + " @@ to_tsquery('simple', $2))",
+	"$1 <% " + patientFullName,
+	"$1 <% Patient.email",
+	"Patient.date_of_birth = $4::date",
+}, " OR ")
+
+// patientSearchScore ranks exact matches first (1), then number prefixes (0.8), full-text matches (0.6 + rank) and typos
+var patientSearchScore = `GREATEST(
+	CASE WHEN Patient.patient_id = upper($1) OR ($3 <> '' AND $3 IN (Patient.phone_number, Patient.id_card_number)) OR Patient.date_of_birth = $4::date THEN 1 ELSE 0 END,
+	CASE WHEN $3 <> '' AND (Patient.phone_number LIKE $3 || '%' OR Patient.id_card_number LIKE $3 || '%') THEN 0.8 ELSE 0 END,
+	CASE WHEN $2 <> '' AND ` + patientSearchVector + ` @@ to_tsquery('simple', $2) THEN 0.6 + ts_rank(` + patientSearchVector + `, to_tsquery('simple', $2)) ELSE 0 END,
+	word_similarity($1, ` + patientFullName + `) * 0.9,
+	word_similarity($1, Patient.email) * 0.7
+)::float8 AS score`
+
+// patientSearchTerms splits a query into lower case words of letters and digits. Combining marks (Thai vowels and tone
+// marks above and below a consonant) are part of a word
+func patientSearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// patientSearchDate reads a date of birth typed in the search box
+func patientSearchDate(query string) interface{} {
+	for _, layout := range []string{"2006-01-02", "02-01-2006", "02/01/2006"} {
+		if date, err := time.Parse(layout, strings.TrimSpace(query)); err == nil {
+			return date.Format("2006-01-02")
+		}
+	}
+	return nil
+}
+
+// SearchPatients returns up to limit patients matching query, best first and skipping the first offset, with the
+// matching parts of their fields highlighted. dateOfBirth (YYYY-MM-DD, optional) narrows the results; with an empty
+// query it is the only criterion, with neither every patient is listed by id
+func SearchPatients(query string, dateOfBirth string, limit int, offset int) ([]patients.PatientSearchResult, error) {
+	query = strings.TrimSpace(query)
+	terms := patientSearchTerms(query)
+
+	prefixTerms := []string{}
+	for _, term := range terms {
+		prefixTerms = append(prefixTerms, term+":*")
+	}
+	digits := onlyDigits(query)
+	if len(digits) < 3 {
+		digits = "" // one or two digits would match half the phone book
+	}
+	var dobFilter interface{}
+	if dateOfBirth != "" {
+		dobFilter = dateOfBirth
+	}
+	args := []interface{}{query, strings.Join(prefixTerms, " & "), digits, patientSearchDate(query), dobFilter}
+
+	whereCon := patientNotDeleted + " AND ($5::date IS NULL OR Patient.date_of_birth = $5::date)"
+	if query != "" {
+		whereCon += " AND (" + patientSearchMatch + ")"
+	}
+	fields := []string{"Patient.patient_id", "Patient.first_name", "Patient.last_name", "Patient.date_of_birth", "Patient.gender", "Patient.email", "Patient.phone_number", "Patient.id_card_number", patientSearchScore}
+
+	var results []map[string]interface{}
+	err := WithTransaction(func(tx *sql.Tx) error {
+		// The <% operator uses the trigram index, its threshold is a setting rather than a bind parameter
+		if _, err := tx.Exec("SET LOCAL pg_trgm.word_similarity_threshold = " + patientSearchSimilarity); err != nil {
+			return err
+		}
+		var err error
+		results, err = SelectDataTx(tx, "Patient", fields, true, whereCon, args, false, "", "", "ORDER BY score DESC, Patient.patient_id LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []patients.PatientSearchResult{}
+	for _, row := range results {
+		match := patients.PatientSearchResult{
+			Patient_id:     row["patient_id"].(string),
+			First_name:     row["first_name"].(string),
+			Last_name:      row["last_name"].(string),
+			Date_of_birth:  row["date_of_birth"].(time.Time).Format("2006-01-02"),
+			Gender:         stringOrEmpty(row["gender"]),
+			Email:          row["email"].(string),
+			Phone_number:   row["phone_number"].(string),
+			Id_card_number: row["id_card_number"].(string),
+			Score:          row["score"].(float64),
+			Highlights:     map[string]string{},
+		}
+		marks := terms
+		if digits != "" {
+			marks = append(append([]string{}, terms...), digits)
+		}
+		for field, value := range map[string]string{
+			"patient_id":     match.Patient_id,
+			"first_name":     match.First_name,
+			"last_name":      match.Last_name,
+			"email":          match.Email,
+			"phone_number":   match.Phone_number,
+			"id_card_number": match.Id_card_number,
+		} {
+			if highlighted, ok := highlightTerms(value, marks); ok {
+				match.Highlights[field] = highlighted
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// highlightTerms HTML-escapes value and wraps every case-insensitive occurrence of the terms in <mark></mark>.
+// A mark never splits a character from its combining marks, an occurrence is widened to the whole characters.
+// ok is false when no term occurs in value (e.g. the row matched on a typo)
+func highlightTerms(value string, terms []string) (string, bool) {
+	runes := []rune(value)
+	lower := []rune(strings.ToLower(value))
+	if len(lower) != len(runes) {
+		lower = runes // lower casing changed the length, match case-sensitively instead of misplacing marks
+	}
+
+	marked := make([]bool, len(runes))
+	found := false
+	for _, term := range terms {
+		needle := []rune(term)
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == term {
+				start, end := i, i+len(needle)
+				for start > 0 && unicode.IsMark(runes[start]) {
+					start--
+				}
+				for end < len(runes) && unicode.IsMark(runes[end]) {
+					end++
+				}
+				for j := start; j < end; j++ {
+					marked[j] = true
+				}
+				found = true
+			}
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			segment = "<mark>" + segment + "</mark>"
+		}
+		out.WriteString(segment)
+		i = j
+	}
+	return out.String(), true
+}
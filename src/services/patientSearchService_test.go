@@ -0,0 +1,54 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPatientSearchTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"lower cases words", "Somchai Jaidee", []string{"somchai", "jaidee"}},
+		{"splits on punctuation", "O'Brien, 081-234", []string{"o", "brien", "081", "234"}},
+		{"keeps thai combining marks", "กิ่งแก้ว  สมใจ", []string{"กิ่งแก้ว", "สมใจ"}},
+		{"empty", "  ", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patientSearchTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patientSearchTerms(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightTerms(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		terms  []string
+		want   string
+		wantOk bool
+	}{
+		{"case insensitive", "Somchai", []string{"som"}, "<mark>Som</mark>chai", true},
+		{"every occurrence, adjacent ones merged", "Anna Banana", []string{"an"}, "<mark>An</mark>na B<mark>anan</mark>a", true},
+		{"overlapping terms merge", "anna", []string{"an", "nn"}, "<mark>ann</mark>a", true},
+		{"escapes html", "<b>Ann", []string{"ann"}, "&lt;b&gt;<mark>Ann</mark>", true},
+		{"no occurrence", "Somchai", []string{"xyz"}, "", false},
+		{"empty term ignored", "Somchai", []string{""}, "", false},
+		{"widens to trailing combining marks", "กิ่งแก้ว", []string{"ก"}, "<mark>กิ่</mark>งแ<mark>ก้</mark>ว", true},
+		{"widens back to the base character", "กิ่งแก้ว", []string{"ิ่ง"}, "<mark>กิ่ง</mark>แก้ว", true},
+		{"case sensitive when lower casing changes the length", "İstanbul", []string{"stan"}, "İ<mark>stan</mark>bul", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := highlightTerms(tt.value, tt.terms)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("highlightTerms(%q, %q) = %q, %v, want %q, %v", tt.value, tt.terms, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 
 	//"strings"
 	"time"
 
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
 	"github.com/NinePTH/GO_MVC-S/src/models/patients"
 )
 
@@ -15,191 +19,171 @@ func isValidString(s string) bool {
 	return s != "" && strings.ToLower(s) != "undefined" && strings.ToLower(s) != "null"
 }
 
-func GetPatientSearch(id string, first_name string, last_name string) ([]patients.GetPatientResponse, error) {
-	table := "Patient"
-	fields := []string{"*"}
+// patientNotDeleted keeps the patients removed by DeletePatient out of a query on Patient. Their row and everything
+// linked to it stay for billing and the audit
+const patientNotDeleted = "Patient.deleted_at IS NULL"
 
-	results, err := SelectData(table, fields, true, "($1 = '' OR patient_id = $1) AND ($2 = '' OR first_name ILIKE '%' || $2 || '%') AND ($3 = '' OR last_name ILIKE '%' || $3 || '%')", []interface{}{id, first_name, last_name}, false, "", "", "ORDER BY patient_id DESC")
+// patientNotDeletedCondition is patientNotDeleted for a query on a table whose column references Patient
+func patientNotDeletedCondition(column string) string {
+	return "NOT EXISTS (SELECT 1 FROM Patient dp WHERE dp.patient_id = " + column + " AND dp.deleted_at IS NOT NULL)"
+}
 
+// checkPatientExists returns "Patient not found" (the message GetPatient uses) when there is no such patient
+func checkPatientExists(patientID string) error {
+	results, err := SelectData("Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
 	if err != nil {
-		return nil, err
+		return err
 	}
-
 	if len(results) == 0 {
-		return nil, fmt.Errorf("Patient not found")
+		return fmt.Errorf("Patient not found")
 	}
+	return nil
+}
 
-	var patientResponses []patients.GetPatientResponse
-
-	for _, row := range results {
-		patient_id := row["patient_id"].(string)
-		patient := patients.GeneralPatientInformation{
-			Patient_id:        patient_id,
-			First_name:        row["first_name"].(string),
-			Last_name:         row["last_name"].(string),
-			Age:               int(row["age"].(int64)),
-			Date_of_birth:     row["date_of_birth"].(time.Time).Format("02-01-2006"),
-			Gender:            string(row["gender"].([]uint8)),
-			Blood_type:        string(row["blood_type"].([]uint8)),
-			Email:             row["email"].(string),
-			Health_insurance:  string(row["health_insurance"].([]uint8)),
-			Address:           row["address"].(string),
-			Phone_number:      row["phone_number"].(string),
-			Id_card_number:    row["id_card_number"].(string),
-			Ongoing_treatment: row["ongoing_treatment"].(string),
-			Unhealthy_habits:  row["unhealthy_habits"].(string),
-		}
-
-		// Medical History
-		table = "Medical_history"
-		fields = []string{"*"}
-		whereCondition := "patient_id = $1"
-		args := []interface{}{patient_id}
-		medicalResults, err := SelectData(table, fields, true, whereCondition, args, false, "", "", "")
-		if err != nil {
-			return nil, err
-		}
-		var medical_history []patients.MedicalHistory
-		for _, row := range medicalResults {
-			details := row["detail"].(string)
-			date := row["date"].(time.Time).Format("02-01-2006")
-			time := row["time"].(time.Time).Format("15:04:05")
-
-			medical_history = append(medical_history, patients.MedicalHistory{
-				Details: details,
-				Date:    date,
-				Time:    time,
-			})
-		}
-
-		// Chronic diseases (With JOIN)
-		table = "patient_chronic_disease"
-		jointables := "disease ON patient_chronic_disease.disease_id = disease.disease_id"
-		fields = []string{"disease_name"}
-		whereCondition = "patient_id = $1"
-		args = []interface{}{patient_id}
-		chronicResults, err := SelectData(table, fields, true, whereCondition, args, true, jointables, "", "")
-		if err != nil {
-			return nil, err
-		}
-		var chronicDiseases []patients.ChronicDiseaseName
-		for _, row := range chronicResults {
-			chronicDiseases = append(chronicDiseases, patients.ChronicDiseaseName{
-				DiseaseID: row["disease_name"].(string),
-			})
-		}
-
-		// Drug allergies
-		table = "patient_drug_allergy"
-		jointables = "drug ON patient_drug_allergy.drug_id = drug.drug_id"
-		whereCondition = "patient_id = $1"
-		fields = []string{"drug_name"}
-		args = []interface{}{patient_id}
-		allergyResults, err := SelectData(table,
-			fields,
-			true,
-			whereCondition,
-			args,
-			true,
-			jointables,
-			"",
-			"")
-		if err != nil {
-			return nil, err
-		}
-		var drugAllergies []patients.DrugAllergyName
-		for _, row := range allergyResults {
-			drugAllergies = append(drugAllergies, patients.DrugAllergyName{
-				DrugID: row["drug_name"].(string),
-			})
-		}
-
-		// Patient_appointment (Select only 1 latest appointment)
-		table = "patient_appointment"
-		fields = []string{"*"}
-		args = []interface{}{patient_id}
-		appointmentResults, err := SelectData(
-			table,
-			fields,
-			true,
-			"patient_id = $1",
-			args,
-			false,
-			"",
-			"",
-			"ORDER BY date DESC, time DESC LIMIT 1")
+// patientSearchCondition is the patient search filter, shared with the exports: $1 exact patient id, $2 / $3 part of the
+// first / last name, an empty value matches everyone
+const patientSearchCondition = "($1 = '' OR patient_id = $1) AND ($2 = '' OR first_name ILIKE '%' || $2 || '%') AND ($3 = '' OR last_name ILIKE '%' || $3 || '%')"
 
-		if err != nil {
-			return nil, err
-		}
+func GetPatientSearch(id string, first_name string, last_name string) ([]patients.GetPatientResponse, error) {
+	table := "Patient"
+	fields := []string{"*", patientHealthInsuranceColumn}
 
-		var patient_appointment patients.PatientAppointment
+	results, err := SelectData(table, fields, true, patientSearchCondition+" AND "+patientNotDeleted, []interface{}{id, first_name, last_name}, false, "", "", "ORDER BY patient_id DESC")
 
-		if len(appointmentResults) == 0 {
-			patient_appointment = patients.PatientAppointment{}
-		} else {
-			patient_appointment = patients.PatientAppointment{
-				Time:  appointmentResults[0]["time"].(time.Time).Format("15:04:05"),
-				Date:  appointmentResults[0]["date"].(time.Time).Format("02-01-2006"),
-				Topic: appointmentResults[0]["topic"].(string),
-			}
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		// รวมร่าง json response = patient_model + medical_history + Patient_appointment + patient_chronicdisease + patientdrug_allerygy
-		response := patients.GetPatientResponse{
-			PatientGeneralInfo:    patient,
-			PatientAppointment:    patient_appointment,
-			PatientMedicalHistory: medical_history,
-			PatientChronicDisease: chronicDiseases,
-			PatientDrugAllergy:    drugAllergies,
-		}
-		patientResponses = append(patientResponses, response)
+	if len(results) == 0 {
+		return nil, fmt.Errorf("Patient not found")
 	}
 
-	return patientResponses, nil
+	return buildPatientResponses(results)
 }
 
-func AddPatientAppointment(req patients.AddPatientAppointment) error {
+// AddPatientAppointment books an appointment after checking the patient's insurance on the appointment date.
+// The covering policy is stored with the appointment; with Require_insurance an uncovered booking is refused.
+// Reminders are queued in the same transaction. It returns the new appointment id and the number of reminders queued
+func AddPatientAppointment(req patients.AddPatientAppointment) (int64, int, *patients.CoverageEligibility, error) {
 	// log ข้อมูลที่รับเข้ามา
 	fmt.Printf("Received AddPatientRequest: %+v\n", req)
 
+	start, err := ParseAppointmentStart(req.Date, req.Time)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid appointment date or time")
+	}
+
+	eligibility, err := CheckCoverageEligibility(req.Patient_id, req.Date)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if req.Require_insurance && !eligibility.Eligible {
+		return 0, 0, eligibility, fmt.Errorf("patient is not covered on the appointment date")
+	}
+
 	patientMap := map[string]interface{}{
 		"patient_id": req.Patient_id,
 		"time":       req.Time,
 		"date":       req.Date,
 		"topic":      req.Topic,
 	}
+	if req.Employee_id != "" {
+		patientMap["employee_id"] = req.Employee_id
+	}
+	if eligibility.Policy != nil {
+		patientMap["policy_id"] = eligibility.Policy.Policy_id
+	}
 
 	fmt.Printf("Inserting patient: %+v\n", patientMap)
 
-	// Insert to patient table
-	table := "patient_appointment"
-	_, err := InsertData(table, patientMap)
+	var appointmentID int64
+	var reminders int
+	err = WithTransaction(func(tx *sql.Tx) error {
+		// Insert to patient table
+		table := "patient_appointment"
+		id, err := InsertDataReturningTx(tx, table, patientMap, "appointment_id")
+		if err != nil {
+			return fmt.Errorf("insert patient failed: %w", err)
+		}
+		appointmentID = id.(int64)
+
+		reminders, err = scheduleAppointmentRemindersTx(tx, appointmentID, req.Patient_id, start)
+		if err != nil {
+			return err
+		}
+
+		return recordAppointmentBookedTx(tx, models.AppointmentBookedEvent{
+			Appointment_id: appointmentID,
+			Patient_id:     req.Patient_id,
+			Employee_id:    req.Employee_id,
+			Date:           start.Format("2006-01-02"),
+			Time:           start.Format("15:04:05"),
+			Topic:          req.Topic,
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("insert patient failed: %w", err)
+		return 0, 0, nil, err
 	}
-	return nil
+
+	publishScheduleEvent(req.Employee_id, "appointment.created", appointmentEventData(appointmentID, req.Patient_id, req.Employee_id, start.Format("2006-01-02"), start.Format("15:04:05")))
+	return appointmentID, reminders, eligibility, nil
 }
-func AddPatientHistory(req patients.AddPatientHistory) error {
+
+// AddPatientHistory creates a clinical encounter: the Medical_history row (notes, plan, attending employee),
+// its diagnosis codes and its vitals (as observations), in one transaction. It returns the new encounter id
+func AddPatientHistory(req patients.AddPatientHistory) (int64, error) {
 	// log ข้อมูลที่รับเข้ามา
 	fmt.Printf("Received AddPatientRequest: %+v\n", req)
 
+	if err := validateEncounter(req); err != nil {
+		return 0, err
+	}
+
 	patientMap := map[string]interface{}{
-		"patient_id": req.Patient_id,
-		"detail":     req.Detail,
-		"time":       req.Time,
-		"date":       req.Date,
+		"patient_id":      req.Patient_id,
+		"detail":          req.Detail,
+		"time":            req.Time,
+		"date":            req.Date,
+		"employee_id":     nullIfEmpty(req.Employee_id),
+		"chief_complaint": nullIfEmpty(req.Chief_complaint),
+		"plan":            nullIfEmpty(req.Plan),
 	}
 
 	fmt.Printf("Inserting patient: %+v\n", patientMap)
 
-	// Insert to patient table
-	table := "Medical_history"
-	_, err := InsertData(table, patientMap)
+	var encounterID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		id, err := InsertDataReturningTx(tx, "Medical_history", patientMap, "medical_history_id")
+		if err != nil {
+			return fmt.Errorf("insert patient failed: %w", err)
+		}
+		encounterID = id.(int64)
+
+		for _, diagnosis := range req.Diagnoses {
+			_, err := InsertDataTx(tx, "Encounter_diagnosis", map[string]interface{}{
+				"medical_history_id": encounterID,
+				"disease_id":         diagnosis.Disease_id,
+				"is_primary":         diagnosis.Is_primary,
+			})
+			if err != nil {
+				return fmt.Errorf("insert diagnosis failed: %w", err)
+			}
+		}
+
+		// Vitals join the patient's observation time series, timed at the encounter
+		vitals := encounterVitalObservations(req.Vitals)
+		for i := range vitals {
+			vitals[i].Observed_at = req.Date + " " + req.Time
+			vitals[i].Employee_id = req.Employee_id
+		}
+		_, err = insertObservationsTx(tx, req.Patient_id, vitals, encounterID)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("insert patient failed: %w", err)
+		return 0, err
 	}
-	return nil
+
+	return encounterID, nil
 }
 
 func DeleteByPatientID(table string, patientID string) error {
@@ -213,23 +197,40 @@ func DeleteByPatientID(table string, patientID string) error {
 	return nil
 }
 
+func deleteByPatientIDTx(tx *sql.Tx, table string, patientID string) error {
+	rowsAffected, err := DeleteDataTx(tx, table, "patient_id = $1", []interface{}{patientID})
+	if err != nil {
+		return fmt.Errorf("failed to delete from %s: %w", table, err)
+	}
+	fmt.Printf("Deleted %d rows from %s where patient_id = %s\n", rowsAffected, table, patientID)
+	return nil
+}
+
+// UpdatePatient updates the patient and replaces their chronic diseases, drug allergies and emergency contacts in one
+// transaction, together with the patient.updated event. A nil list is left as it is, an empty one clears it
 func UpdatePatient(req *patients.AddPatientRequest) (int64, error) {
 	patientID := req.Patient.Patient_id
 	if patientID == "" {
 		return 0, fmt.Errorf("missing patient_id")
 	}
 
+	// เช็ค disease_id / drug_id กับ catalog ก่อน เพราะด้านล่างลบของเก่าก่อน insert ใหม่
+	if err := ValidatePatientCatalogIds(req, false); err != nil {
+		return 0, err
+	}
+
 	// เตรียมข้อมูลที่จะ update
 	data := make(map[string]interface{})
+	changedFields := []string{}
 	addIfNotEmpty := func(key, value string) {
 		if value != "" {
 			data[key] = value
+			changedFields = append(changedFields, key)
 		}
 	}
 
 	addIfNotEmpty("first_name", req.Patient.First_name)
 	addIfNotEmpty("last_name", req.Patient.Last_name)
-	addIfNotEmpty("health_insurance", req.Patient.Health_insurance)
 	addIfNotEmpty("date_of_birth", req.Patient.Date_of_birth)
 	addIfNotEmpty("gender", req.Patient.Gender)
 	addIfNotEmpty("blood_type", req.Patient.Blood_type)
@@ -243,6 +244,16 @@ func UpdatePatient(req *patients.AddPatientRequest) (int64, error) {
 	// เช็กค่า 'age' ว่ามีการส่งมาหรือไม่
 	if req.Patient.Age != 0 { // ใช้ค่า default 0 เช็กว่ามีการส่งมาหรือไม่
 		data["age"] = fmt.Sprintf("%v", req.Patient.Age)
+		changedFields = append(changedFields, "age")
+	}
+	if req.PatientChronicDisease != nil {
+		changedFields = append(changedFields, "chronic_diseases")
+	}
+	if req.PatientDrugAllergy != nil {
+		changedFields = append(changedFields, "drug_allergies")
+	}
+	if req.PatientEmergencyContacts != nil {
+		changedFields = append(changedFields, "emergency_contacts")
 	}
 
 	table := "Patient"
@@ -251,76 +262,124 @@ func UpdatePatient(req *patients.AddPatientRequest) (int64, error) {
 
 	var totalRowsAffected int64 = 0
 
-	// อัปเดตข้อมูล Patient
-	if len(data) > 0 {
-		rowsAffected, err := UpdateData(table, data, condition, conditionValues)
+	err := WithTransaction(func(tx *sql.Tx) error {
+		patient, err := SelectDataTx(tx, table, []string{"patient_id"}, true, condition+" AND "+patientNotDeleted, conditionValues, false, "", "", "FOR UPDATE")
 		if err != nil {
-			return 0, err
+			return err
 		}
-		totalRowsAffected += rowsAffected
-	}
-
-	// ============ Chronic Diseases ============
-	if len(req.PatientChronicDisease) > 0 {
-		table := "patient_chronic_disease"
-		// ลบของเก่า
-		if err := DeleteByPatientID(table, patientID); err != nil {
-			return totalRowsAffected, fmt.Errorf("failed to delete chronic diseases: %v", err)
+		if len(patient) == 0 {
+			return fmt.Errorf("Patient not found")
 		}
 
-		// Insert ใหม่
-		for _, chronic := range req.PatientChronicDisease {
-			chronicMap := map[string]interface{}{
-				"patient_id": patientID,
-				"disease_id": chronic.DiseaseID,
-			}
-			_, err := InsertData(table, chronicMap)
+		// อัปเดตข้อมูล Patient
+		if len(data) > 0 {
+			rowsAffected, err := UpdateDataTx(tx, table, data, condition, conditionValues)
 			if err != nil {
-				return totalRowsAffected, fmt.Errorf("insert chronic disease failed: %v", err)
+				return err
 			}
-			totalRowsAffected++ // นับเพิ่มทีละ insert
-		}
-	} else if len(req.PatientChronicDisease) == 0 {
-		table := "patient_chronic_disease"
-		// ลบของเก่า
-		if err := DeleteByPatientID(table, patientID); err != nil {
-			return totalRowsAffected, fmt.Errorf("failed to delete chronic diseases: %v", err)
+			totalRowsAffected += rowsAffected
 		}
-	}
 
-	// ============ Drug allergy ============
-	if len(req.PatientDrugAllergy) > 0 {
-		table := "patient_drug_allergy"
-		// ลบของเก่า
-		if err := DeleteByPatientID(table, patientID); err != nil {
-			return totalRowsAffected, fmt.Errorf("failed to delete drug allergy: %v", err)
+		// ============ Chronic Diseases ============
+		// ไม่ส่งมา = ไม่แตะของเดิม, ส่งมา = ลบของเก่า แล้ว insert ใหม่ (ส่ง [] มา = ลบทั้งหมด)
+		if req.PatientChronicDisease != nil {
+			if err := deleteByPatientIDTx(tx, "patient_chronic_disease", patientID); err != nil {
+				return fmt.Errorf("failed to delete chronic diseases: %v", err)
+			}
+			for _, chronic := range req.PatientChronicDisease {
+				chronicMap := map[string]interface{}{
+					"patient_id": patientID,
+					"disease_id": chronic.DiseaseID,
+				}
+				_, err := InsertDataTx(tx, "patient_chronic_disease", chronicMap)
+				if err != nil {
+					return fmt.Errorf("insert chronic disease failed: %v", err)
+				}
+				totalRowsAffected++ // นับเพิ่มทีละ insert
+			}
 		}
 
-		// Insert ใหม่
-		for _, drug := range req.PatientDrugAllergy {
-			drugMap := map[string]interface{}{
-				"patient_id": patientID,
-				"drug_id":    drug.DrugID,
+		// ============ Drug allergy ============
+		// ไม่ส่งมา = ไม่แตะของเดิม, ส่ง [] มา = ลบทั้งหมด
+		if req.PatientDrugAllergy != nil {
+			if err := deleteByPatientIDTx(tx, "patient_drug_allergy", patientID); err != nil {
+				return fmt.Errorf("failed to delete drug allergy: %v", err)
 			}
-			_, err := InsertData(table, drugMap)
-			if err != nil {
-				return totalRowsAffected, fmt.Errorf("insert drug allergy failed: %v", err)
+			for _, drug := range req.PatientDrugAllergy {
+				_, err := InsertDataTx(tx, "patient_drug_allergy", drugAllergyRow(patientID, drug))
+				if err != nil {
+					return fmt.Errorf("insert drug allergy failed: %v", err)
+				}
+				totalRowsAffected++ // นับเพิ่มทีละ insert
 			}
-			totalRowsAffected++ // นับเพิ่มทีละ insert
 		}
-	} else if len(req.PatientDrugAllergy) == 0 {
-		table := "patient_drug_allergy"
-		// ลบของเก่า
-		if err := DeleteByPatientID(table, patientID); err != nil {
-			return totalRowsAffected, fmt.Errorf("failed to delete drug allergy: %v", err)
+
+		// ============ Emergency contacts ============
+		// ไม่ส่งมา = ไม่แตะของเดิม, ส่ง [] มา = ลบทั้งหมด
+		if req.PatientEmergencyContacts != nil {
+			if err := replaceEmergencyContactsTx(tx, patientID, req.PatientEmergencyContacts); err != nil {
+				return err
+			}
+			totalRowsAffected += int64(len(req.PatientEmergencyContacts))
 		}
+
+		return recordPatientEventTx(tx, EventPatientUpdated, patientID, changedFields)
+	})
+	if err != nil {
+		return 0, err
 	}
 	return totalRowsAffected, nil
 }
 
+// ValidateNewPatient checks an AddPatientRequest before AddPatient: every patient field is filled, an allergy names a drug
+// or a drug class with a known severity, and the emergency contacts are valid (missing priorities are filled in)
+func ValidateNewPatient(req *patients.AddPatientRequest) error {
+	p := req.Patient
+	if p.Patient_id == "" || p.First_name == "" || p.Last_name == "" || p.Age == 0 || p.Gender == "" || p.Date_of_birth == "" || p.Blood_type == "" || p.Email == "" || p.Address == "" || p.Phone_number == "" || p.Id_card_number == "" || p.Ongoing_treatment == "" || p.Unhealthy_habits == "" {
+		return fmt.Errorf("All patient fields must be provided")
+	}
+
+	if err := validateDrugAllergies(req.PatientDrugAllergy); err != nil {
+		return err
+	}
+
+	// Age must not be negative
+	if p.Age < 0 {
+		return fmt.Errorf("Invalid Age Value")
+	}
+
+	return ValidateEmergencyContacts(req.PatientEmergencyContacts)
+}
+
+// validateDrugAllergies checks that every allergy names a drug or a drug class (not both) with a known severity
+func validateDrugAllergies(allergies []patients.DrugAllergyName) error {
+	for i, allergy := range allergies {
+		if allergy.DrugID != "" && allergy.DrugClassID != "" {
+			return fmt.Errorf("patient_drug_allergy[%d] must have either drug_id or drug_class_id, not both", i)
+		}
+		if !IsValidAllergySeverity(allergy.Severity) {
+			return fmt.Errorf("patient_drug_allergy[%d].severity must be one of mild, moderate, severe, life_threatening", i)
+		}
+	}
+	return nil
+}
+
+// AddPatient inserts the patient with their chronic diseases, drug allergies and emergency contacts in one transaction,
+// together with the patient.created event
 func AddPatient(req patients.AddPatientRequest) error {
 	fmt.Printf("Received AddPatientRequest: %+v\n", req)
 
+	if err := ValidatePatientCatalogIds(&req, true); err != nil {
+		return err
+	}
+
+	return WithTransaction(func(tx *sql.Tx) error {
+		return addPatientTx(tx, req)
+	})
+}
+
+// addPatientTx writes a validated AddPatientRequest in the caller's transaction, shared by AddPatient and the CSV import
+func addPatientTx(tx *sql.Tx, req patients.AddPatientRequest) error {
 	p := req.Patient
 	patientMap := map[string]interface{}{
 		"patient_id":        p.Patient_id,
@@ -331,7 +390,6 @@ func AddPatient(req patients.AddPatientRequest) error {
 		"date_of_birth":     p.Date_of_birth,
 		"blood_type":        p.Blood_type,
 		"email":             p.Email,
-		"health_insurance":  p.Health_insurance,
 		"address":           p.Address,
 		"phone_number":      p.Phone_number,
 		"id_card_number":    p.Id_card_number,
@@ -339,11 +397,9 @@ func AddPatient(req patients.AddPatientRequest) error {
 		"unhealthy_habits":  p.Unhealthy_habits,
 	}
 
-	fmt.Printf("Inserting patient: %+v\n", patientMap)
-
 	// Insert to patient table
 	table := "patient"
-	_, err := InsertData(table, patientMap)
+	_, err := InsertDataTx(tx, table, patientMap)
 	if err != nil {
 		return fmt.Errorf("insert patient failed: %w", err)
 	}
@@ -357,7 +413,7 @@ func AddPatient(req patients.AddPatientRequest) error {
 			"patient_id": p.Patient_id,
 			"disease_id": chronic.DiseaseID,
 		}
-		_, err := InsertData("patient_chronic_disease", chronicMap)
+		_, err := InsertDataTx(tx, "patient_chronic_disease", chronicMap)
 		if err != nil {
 			return fmt.Errorf("insert chronic disease failed: %w", err)
 		}
@@ -365,27 +421,30 @@ func AddPatient(req patients.AddPatientRequest) error {
 
 	// Insert to drug allergies table
 	for _, allergy := range req.PatientDrugAllergy {
-		if !isValidString(allergy.DrugID) {
-			continue // ข้ามถ้า disease_id ว่าง, undefined, หรือ null
-		}
-		allergyMap := map[string]interface{}{
-			"patient_id": p.Patient_id,
-			"drug_id":    allergy.DrugID,
+		if !isValidString(allergy.DrugID) && !isValidString(allergy.DrugClassID) {
+			continue // ข้ามถ้า drug_id และ drug_class_id ว่าง, undefined, หรือ null
 		}
-		_, err := InsertData("patient_drug_allergy", allergyMap)
+		_, err := InsertDataTx(tx, "patient_drug_allergy", drugAllergyRow(p.Patient_id, allergy))
 		if err != nil {
 			return fmt.Errorf("insert drug allergy failed: %w", err)
 		}
 	}
 
-	return nil
+	// Insert to emergency contacts table
+	if len(req.PatientEmergencyContacts) > 0 {
+		if err := replaceEmergencyContactsTx(tx, p.Patient_id, req.PatientEmergencyContacts); err != nil {
+			return err
+		}
+	}
+
+	return recordPatientEventTx(tx, EventPatientCreated, p.Patient_id, nil)
 }
 
 func GetPatient(id string) (*patients.GetPatientResponse, error) {
 	table := "Patient"
-	fields := []string{"*"}
+	fields := []string{"*", patientHealthInsuranceColumn}
 
-	result, err := SelectData(table, fields, true, "patient_id = $1", []interface{}{id}, false, "", "", "")
+	result, err := SelectData(table, fields, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{id}, false, "", "", "")
 
 	if err != nil {
 		return nil, err
@@ -395,278 +454,235 @@ func GetPatient(id string) (*patients.GetPatientResponse, error) {
 		return nil, fmt.Errorf("Patient not found")
 	}
 
-	patient_id := result[0]["patient_id"].(string)
-	first_name := result[0]["first_name"].(string)
-	last_name := result[0]["last_name"].(string)
-	age := int(result[0]["age"].(int64))
-	gender := string(result[0]["gender"].([]uint8))
-	date_of_birth := string(result[0]["date_of_birth"].(time.Time).Format("02-01-2006"))
-	blood_type := string(result[0]["blood_type"].([]uint8))
-	email := result[0]["email"].(string)
-	health_insurance := string(result[0]["health_insurance"].([]uint8))
-	address := result[0]["address"].(string)
-	phone_number := result[0]["phone_number"].(string)
-	id_card_number := result[0]["id_card_number"].(string)
-	ongoing_treatment := result[0]["ongoing_treatment"].(string)
-	unhealthy_habits := result[0]["unhealthy_habits"].(string)
-
-	var patient = patients.GeneralPatientInformation{
-		Patient_id:        patient_id,
-		First_name:        first_name,
-		Last_name:         last_name,
-		Age:               age,
-		Gender:            gender,
-		Date_of_birth:     date_of_birth,
-		Blood_type:        blood_type,
-		Email:             email,
-		Health_insurance:  health_insurance,
-		Address:           address,
-		Phone_number:      phone_number,
-		Id_card_number:    id_card_number,
-		Ongoing_treatment: ongoing_treatment,
-		Unhealthy_habits:  unhealthy_habits,
+	responses, err := buildPatientResponses(result)
+	if err != nil {
+		return nil, err
 	}
+	return &responses[0], nil
+}
 
-	// Medical History
-	table = "Medical_history"
-	fields = []string{"*"}
-	whereCondition := "patient_id = $1"
-	args := []interface{}{patient_id}
-	medicalResults, err := SelectData(table, fields, true, whereCondition, args, false, "", "", "")
+func GetAllPatients() ([]patients.GetPatientResponse, error) {
+	table := "patient"
+	fields := []string{"*", patientHealthInsuranceColumn}
+	results, err := SelectData(table, fields, true, patientNotDeleted, nil, false, "", "", "ORDER BY patient_id DESC")
 	if err != nil {
 		return nil, err
 	}
-	var medical_history []patients.MedicalHistory
-	for _, row := range medicalResults {
-		details := row["detail"].(string)
-		date := row["date"].(time.Time).Format("02-01-2006")
-		time := row["time"].(time.Time).Format("15:04:05")
-
-		medical_history = append(medical_history, patients.MedicalHistory{
-			Details: details,
-			Date:    date,
-			Time:    time,
-		})
+	if len(results) == 0 {
+		return nil, nil
 	}
 
-	// Chronic diseases (With INNER JOIN)
-	table = "patient_chronic_disease"
-	jointables := "disease ON patient_chronic_disease.disease_id = disease.disease_id"
-	fields = []string{"disease_name"}
-	whereCondition = "patient_id = $1"
-	args = []interface{}{patient_id}
-	chronicResults, err := SelectData(table, fields, true, whereCondition, args, true, jointables, "", "")
+	return buildPatientResponses(results)
+}
+
+// buildPatientResponses turns Patient rows (with patientHealthInsuranceColumn) into GetPatientResponses, in the order of
+// the rows. Every section is loaded for all the patients in one query, so a list costs the same number of queries as
+// a single patient
+func buildPatientResponses(rows []map[string]interface{}) ([]patients.GetPatientResponse, error) {
+	patientIDs := make([]string, len(rows))
+	for i, row := range rows {
+		patientIDs[i] = row["patient_id"].(string)
+	}
+
+	// Medical History
+	medicalResults, err := SelectData("Medical_history", []string{"patient_id", "detail", "date", "time"}, true, "patient_id = ANY($1)", []interface{}{pq.Array(patientIDs)}, false, "", "", "ORDER BY date, time, medical_history_id")
 	if err != nil {
 		return nil, err
 	}
-	var chronicDiseases []patients.ChronicDiseaseName
-	for _, row := range chronicResults {
-		chronicDiseases = append(chronicDiseases, patients.ChronicDiseaseName{
-			DiseaseID: row["disease_name"].(string),
+	medicalHistories := map[string][]patients.MedicalHistory{}
+	for _, row := range medicalResults {
+		patientID := row["patient_id"].(string)
+		medicalHistories[patientID] = append(medicalHistories[patientID], patients.MedicalHistory{
+			Details: row["detail"].(string),
+			Date:    row["date"].(time.Time).Format("02-01-2006"),
+			Time:    row["time"].(time.Time).Format("15:04:05"),
 		})
 	}
 
-	// Drug allergies
-	table = "patient_drug_allergy"
-	jointables = "drug ON patient_drug_allergy.drug_id = drug.drug_id"
-	whereCondition = "patient_id = $1"
-	fields = []string{"drug_name"}
-	args = []interface{}{patient_id}
-	allergyResults, err := SelectData(table,
-		fields,
+	// Chronic diseases (With INNER JOIN)
+	chronicResults, err := SelectData(
+		"patient_chronic_disease",
+		[]string{"patient_chronic_disease.patient_id", "disease_name"},
 		true,
-		whereCondition,
-		args,
+		"patient_chronic_disease.patient_id = ANY($1)",
+		[]interface{}{pq.Array(patientIDs)},
 		true,
-		jointables,
+		"disease ON patient_chronic_disease.disease_id = disease.disease_id",
 		"",
 		"")
 	if err != nil {
 		return nil, err
 	}
-	var drugAllergies []patients.DrugAllergyName
-	for _, row := range allergyResults {
-		drugAllergies = append(drugAllergies, patients.DrugAllergyName{
-			DrugID: row["drug_name"].(string),
+	chronicDiseases := map[string][]patients.ChronicDiseaseName{}
+	for _, row := range chronicResults {
+		patientID := row["patient_id"].(string)
+		chronicDiseases[patientID] = append(chronicDiseases[patientID], patients.ChronicDiseaseName{
+			DiseaseID: row["disease_name"].(string),
 		})
 	}
 
-	// Patient_appointment (Select only 1 latest appointment)
-	table = "patient_appointment"
-	fields = []string{"*"}
-	args = []interface{}{patient_id}
-	appointmentResults, err := SelectData(
-		table,
-		fields,
-		true,
-		"patient_id = $1",
-		args,
-		false,
-		"",
-		"",
-		"ORDER BY date DESC, time DESC LIMIT 1")
+	// Encounters (newest first, with clinician name and diagnoses)
+	encounters, err := getPatientsEncounters(patientIDs)
+	if err != nil {
+		return nil, err
+	}
 
+	// Latest value of each vital sign / measurement
+	latestVitals, err := getPatientsLatestVitals(patientIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	var patient_appointment patients.PatientAppointment
+	// Abnormal lab results
+	labAlerts, err := getPatientsLabAlerts(patientIDs)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(appointmentResults) == 0 {
-		patient_appointment = patients.PatientAppointment{}
-	} else {
-		patient_appointment = patients.PatientAppointment{
-			Time:  appointmentResults[0]["time"].(time.Time).Format("15:04:05"),
-			Date:  appointmentResults[0]["date"].(time.Time).Format("02-01-2006"),
-			Topic: appointmentResults[0]["topic"].(string),
-		}
+	// Insurance policies valid today
+	activeCoverage, err := getPatientsActivePolicies(patientIDs, time.Now().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
 	}
 
-	// รวมร่าง json response = patient_model + medical_history + patient_chronicdisease + patientdrug_allerygy
-	response := patients.GetPatientResponse{
-		PatientGeneralInfo:    patient,
-		PatientAppointment:    patient_appointment,
-		PatientMedicalHistory: medical_history,
-		PatientChronicDisease: chronicDiseases,
-		PatientDrugAllergy:    drugAllergies,
+	// Emergency contacts / next-of-kin
+	emergencyContacts, err := getPatientsEmergencyContacts(patientIDs)
+	if err != nil {
+		return nil, err
 	}
-	return &response, nil
-}
 
-func GetAllPatients() ([]patients.GetPatientResponse, error) {
-	table := "patient"
-	fields := []string{"*"}
-	results, err := SelectData(table, fields, false, "", nil, false, "", "", "ORDER BY patient_id DESC")
+	// Drug allergies (drug level and class level)
+	drugAllergies, err := getPatientsDrugAllergies(patientIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	var patientResponses []patients.GetPatientResponse
-
-	for _, row := range results {
-		patient_id := row["patient_id"].(string)
-		patient := patients.GeneralPatientInformation{
-			Patient_id:        patient_id,
-			First_name:        row["first_name"].(string),
-			Last_name:         row["last_name"].(string),
-			Age:               int(row["age"].(int64)),
-			Date_of_birth:     row["date_of_birth"].(time.Time).Format("02-01-2006"),
-			Gender:            string(row["gender"].([]uint8)),
-			Blood_type:        string(row["blood_type"].([]uint8)),
-			Email:             row["email"].(string),
-			Health_insurance:  string(row["health_insurance"].([]uint8)),
-			Address:           row["address"].(string),
-			Phone_number:      row["phone_number"].(string),
-			Id_card_number:    row["id_card_number"].(string),
-			Ongoing_treatment: row["ongoing_treatment"].(string),
-			Unhealthy_habits:  row["unhealthy_habits"].(string),
-		}
+	// Patient_appointment (Select only 1 latest appointment of each patient)
+	appointmentResults, err := SelectData(
+		"patient_appointment",
+		[]string{"DISTINCT ON (patient_id) patient_id", "appointment_id", "time", "date", "topic"},
+		true,
+		"patient_id = ANY($1) AND cancelled_at IS NULL",
+		[]interface{}{pq.Array(patientIDs)},
+		false,
+		"",
+		"",
+		"ORDER BY patient_id, date DESC, time DESC")
+	if err != nil {
+		return nil, err
+	}
+	appointments := map[string]patients.PatientAppointment{}
+	for _, row := range appointmentResults {
+		appointments[row["patient_id"].(string)] = patients.PatientAppointment{
+			Appointment_id: row["appointment_id"].(int64),
+			Time:           row["time"].(time.Time).Format("15:04:05"),
+			Date:           row["date"].(time.Time).Format("02-01-2006"),
+			Topic:          row["topic"].(string),
+		}
+	}
+
+	// รวมร่าง json response = patient_model + medical_history + Patient_appointment + patient_chronicdisease + patientdrug_allerygy
+	responses := make([]patients.GetPatientResponse, 0, len(rows))
+	for _, row := range rows {
+		patientID := row["patient_id"].(string)
+		responses = append(responses, patients.GetPatientResponse{
+			PatientGeneralInfo:       patientGeneralInformationFromRow(row),
+			PatientAppointment:       appointments[patientID],
+			PatientMedicalHistory:    medicalHistories[patientID],
+			PatientEncounters:        encounters[patientID],
+			PatientLatestVitals:      latestVitals[patientID],
+			PatientLabAlerts:         labAlerts[patientID],
+			PatientActiveCoverage:    activeCoverage[patientID],
+			PatientChronicDisease:    chronicDiseases[patientID],
+			PatientDrugAllergy:       drugAllergies[patientID],
+			PatientEmergencyContacts: emergencyContacts[patientID],
+		})
+	}
+	return responses, nil
+}
 
-		// Medical History
-		table = "Medical_history"
-		fields = []string{"*"}
-		whereCondition := "patient_id = $1"
-		args := []interface{}{patient_id}
-		medicalResults, err := SelectData(table, fields, true, whereCondition, args, false, "", "", "")
-		if err != nil {
-			return nil, err
-		}
-		var medical_history []patients.MedicalHistory
-		for _, row := range medicalResults {
-			details := row["detail"].(string)
-			date := row["date"].(time.Time).Format("02-01-2006")
-			time := row["time"].(time.Time).Format("15:04:05")
-
-			medical_history = append(medical_history, patients.MedicalHistory{
-				Details: details,
-				Date:    date,
-				Time:    time,
-			})
-		}
+func patientGeneralInformationFromRow(row map[string]interface{}) patients.GeneralPatientInformation {
+	return patients.GeneralPatientInformation{
+		Patient_id:        row["patient_id"].(string),
+		First_name:        row["first_name"].(string),
+		Last_name:         row["last_name"].(string),
+		Age:               int(row["age"].(int64)),
+		Date_of_birth:     row["date_of_birth"].(time.Time).Format("02-01-2006"),
+		Gender:            string(row["gender"].([]uint8)),
+		Blood_type:        string(row["blood_type"].([]uint8)),
+		Email:             row["email"].(string),
+		Health_insurance:  row["health_insurance"].(string),
+		Address:           row["address"].(string),
+		Phone_number:      row["phone_number"].(string),
+		Id_card_number:    row["id_card_number"].(string),
+		Ongoing_treatment: row["ongoing_treatment"].(string),
+		Unhealthy_habits:  row["unhealthy_habits"].(string),
+	}
+}
 
-		// Chronic diseases (With JOIN)
-		table = "patient_chronic_disease"
-		jointables := "disease ON patient_chronic_disease.disease_id = disease.disease_id"
-		fields = []string{"disease_name"}
-		whereCondition = "patient_id = $1"
-		args = []interface{}{patient_id}
-		chronicResults, err := SelectData(table, fields, true, whereCondition, args, true, jointables, "", "")
+// DeletePatient hides the patient from every read (deleted_at, see patientNotDeleted) and records patient.deleted in the
+// same transaction. Nothing is removed: invoices, clinical records, consents and the access audit must outlive the record.
+// The appointments still to come (or waiting in the queue) are cancelled like CancelAppointment does, with their reminders
+// and check-ins
+func DeletePatient(patientID string) error {
+	var appointments []map[string]interface{}
+	checkinIDs := []int64{}
+	err := WithTransaction(func(tx *sql.Tx) error {
+		patient, err := SelectDataTx(tx, "Patient", []string{"patient_id"}, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "FOR UPDATE")
 		if err != nil {
-			return nil, err
+			return err
 		}
-		var chronicDiseases []patients.ChronicDiseaseName
-		for _, row := range chronicResults {
-			chronicDiseases = append(chronicDiseases, patients.ChronicDiseaseName{
-				DiseaseID: row["disease_name"].(string),
-			})
+		if len(patient) == 0 {
+			return fmt.Errorf("Patient not found")
 		}
 
-		// Drug allergies
-		table = "patient_drug_allergy"
-		jointables = "drug ON patient_drug_allergy.drug_id = drug.drug_id"
-		whereCondition = "patient_id = $1"
-		fields = []string{"drug_name"}
-		args = []interface{}{patient_id}
-		allergyResults, err := SelectData(table,
-			fields,
-			true,
-			whereCondition,
-			args,
-			true,
-			jointables,
-			"",
-			"")
-		if err != nil {
-			return nil, err
+		now := time.Now()
+		if _, err := UpdateDataTx(tx, "Patient", map[string]interface{}{"deleted_at": now}, "patient_id = $1", []interface{}{patientID}); err != nil {
+			return err
 		}
-		var drugAllergies []patients.DrugAllergyName
-		for _, row := range allergyResults {
-			drugAllergies = append(drugAllergies, patients.DrugAllergyName{
-				DrugID: row["drug_name"].(string),
-			})
-		}
-
-		// Patient_appointment (Select only 1 latest appointment)
-		table = "patient_appointment"
-		fields = []string{"*"}
-		args = []interface{}{patient_id}
-		appointmentResults, err := SelectData(
-			table,
-			fields,
-			true,
-			"patient_id = $1",
-			args,
-			false,
-			"",
-			"",
-			"ORDER BY date DESC, time DESC LIMIT 1")
 
+		appointments, err = SelectDataTx(tx, "Patient_Appointment", []string{"appointment_id", "patient_id", "employee_id", "date", "time"}, true,
+			"patient_id = $1 AND cancelled_at IS NULL AND ((date + time) >= $2 OR EXISTS (SELECT 1 FROM Appointment_checkin ac WHERE ac.appointment_id = Patient_Appointment.appointment_id AND ac.status = 'waiting'))",
+			[]interface{}{patientID, now}, false, "", "", "FOR UPDATE")
 		if err != nil {
-			return nil, err
-		}
-		
-		var patient_appointment patients.PatientAppointment
-
-		if len(appointmentResults) == 0 {
-			patient_appointment = patients.PatientAppointment{}
-		} else {
-			patient_appointment = patients.PatientAppointment{
-				Time:  appointmentResults[0]["time"].(time.Time).Format("15:04:05"),
-				Date:  appointmentResults[0]["date"].(time.Time).Format("02-01-2006"),
-				Topic: appointmentResults[0]["topic"].(string),
+			return err
+		}
+		for _, appointment := range appointments {
+			appointmentID := appointment["appointment_id"].(int64)
+			_, err := UpdateDataTx(tx, "Patient_Appointment", map[string]interface{}{
+				"cancelled_at":        now,
+				"cancellation_reason": "patient deleted",
+			}, "appointment_id = $1", []interface{}{appointmentID})
+			if err != nil {
+				return err
+			}
+			if _, err := cancelAppointmentRemindersTx(tx, appointmentID); err != nil {
+				return err
+			}
+			checkinID, err := cancelAppointmentCheckInTx(tx, appointmentID)
+			if err != nil {
+				return err
+			}
+			if checkinID != 0 {
+				checkinIDs = append(checkinIDs, checkinID)
 			}
 		}
 
-		// รวมร่าง json response = patient_model + medical_history + Patient_appointment + patient_chronicdisease + patientdrug_allerygy
-		response := patients.GetPatientResponse{
-			PatientGeneralInfo:    patient,
-			PatientAppointment:    patient_appointment,
-			PatientMedicalHistory: medical_history,
-			PatientChronicDisease: chronicDiseases,
-			PatientDrugAllergy:    drugAllergies,
-		}
-		patientResponses = append(patientResponses, response)
+		return recordPatientEventTx(tx, EventPatientDeleted, patientID, nil)
+	})
+	if err != nil {
+		return err
 	}
 
-	return patientResponses, nil
+	for _, appointment := range appointments {
+		start := appointmentStartFromRow(appointment)
+		employeeID := stringOrEmpty(appointment["employee_id"])
+		publishScheduleEvent(employeeID, "appointment.cancelled", appointmentEventData(appointment["appointment_id"].(int64), patientID, employeeID, start.Format("2006-01-02"), start.Format("15:04:05")))
+	}
+	for _, checkinID := range checkinIDs {
+		if entry, err := getQueueEntry(checkinID); err == nil {
+			publishQueueEvent("queue.cancelled", entry)
+		}
+	}
+	return nil
 }
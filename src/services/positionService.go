@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+)
+
+var positionResponseColumns = []string{
+	"Position.position_id",
+	"Position.position_name",
+	"Department.department_id",
+	"Department.department_name",
+	"(SELECT COUNT(*) FROM Employee WHERE Employee.position_id = Position.position_id AND Employee.work_status = 'yes') AS headcount",
+}
+
+const positionJoinTables = "Department ON position.department_id = department.department_id"
+
+func positionFromRow(row map[string]interface{}) models.PositionResponse {
+	return models.PositionResponse{
+		Position_id:     row["position_id"].(string),
+		Position_name:   row["position_name"].(string),
+		Department_id:   row["department_id"].(string),
+		Department_name: row["department_name"].(string),
+		Headcount:       int(row["headcount"].(int64)),
+	}
+}
+
+// GetAllPositions lists every position, or only the positions of departmentID when it is not empty
+func GetAllPositions(departmentID string) ([]models.PositionResponse, error) {
+	results, err := SelectData(
+		"Position",
+		positionResponseColumns,
+		true,
+		"($1 = '' OR Position.department_id = $1)",
+		[]interface{}{departmentID},
+		true,
+		positionJoinTables,
+		"",
+		"ORDER BY position_id",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := []models.PositionResponse{}
+	for _, row := range results {
+		positions = append(positions, positionFromRow(row))
+	}
+
+	return positions, nil
+}
+
+func GetPosition(id string) (*models.PositionResponse, error) {
+	results, err := SelectData("Position", positionResponseColumns, true, "Position.position_id = $1", []interface{}{id}, true, positionJoinTables, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("position not found")
+	}
+
+	position := positionFromRow(results[0])
+	return &position, nil
+}
+
+func AddPosition(req models.Position) (int64, error) {
+	if err := checkDepartmentExists(req.Department_id); err != nil {
+		return 0, err
+	}
+
+	data := map[string]interface{}{
+		"position_id":   req.Position_id,
+		"department_id": req.Department_id,
+		"position_name": req.Position_name,
+	}
+
+	return InsertData("Position", data)
+}
+
+func UpdatePosition(id string, data map[string]interface{}) (int64, error) {
+	if departmentID, ok := data["department_id"].(string); ok {
+		if err := checkDepartmentExists(departmentID); err != nil {
+			return 0, err
+		}
+	}
+
+	return UpdateData("Position", data, "position_id = $1", []interface{}{id})
+}
+
+// DeletePosition refuses to delete a position that active employees still hold
+// (Employee.position_id is ON DELETE SET NULL and those employees would drop out of every employee listing)
+func DeletePosition(id string) (int64, error) {
+	holders, err := SelectData("Employee", []string{"employee_id"}, true, "position_id = $1 AND work_status = 'yes'", []interface{}{id}, false, "", "", "LIMIT 1")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(holders) > 0 {
+		return 0, fmt.Errorf("position is held by active employees")
+	}
+
+	return DeleteData("Position", "position_id = $1", []interface{}{id})
+}
+
+func checkPositionExists(id string) error {
+	results, err := SelectData("Position", []string{"position_id"}, true, "position_id = $1", []interface{}{id}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		return fmt.Errorf("position not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// AllergyConflictError is returned when a prescribed drug directly matches an allergy of the patient and the prescriber did not override it
+type AllergyConflictError struct {
+	Check *patients.AllergyCheckResponse
+}
+
+func (e *AllergyConflictError) Error() string {
+	return "patient is allergic to this drug"
+}
+
+// AddPrescription prescribes a drug after running the allergy check, it returns the new prescription id together with
+// the check so cross-sensitivity warnings can be shown even when the prescription goes through
+func AddPrescription(patientID string, req patients.AddPrescriptionRequest) (int64, *patients.AllergyCheckResponse, error) {
+	check, err := CheckDrugAllergy(patientID, req.Drug_id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := checkActiveEmployee(req.Prescribed_by); err != nil {
+		return 0, nil, err
+	}
+
+	if req.Encounter_id != nil {
+		encounter, err := SelectData("Medical_history", []string{"medical_history_id"}, true, "medical_history_id = $1 AND patient_id = $2", []interface{}{*req.Encounter_id, patientID}, false, "", "", "")
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(encounter) == 0 {
+			return 0, nil, fmt.Errorf("encounter not found for this patient")
+		}
+	}
+
+	if check.Has_direct && !req.Override_allergy {
+		return 0, nil, &AllergyConflictError{Check: check}
+	}
+
+	id, err := InsertDataReturning("Prescription", map[string]interface{}{
+		"patient_id":         patientID,
+		"drug_id":            req.Drug_id,
+		"quantity":           req.Quantity,
+		"instructions":       nullIfEmpty(req.Instructions),
+		"prescribed_by":      req.Prescribed_by,
+		"medical_history_id": req.Encounter_id,
+	}, "prescription_id")
+	if err != nil {
+		return 0, nil, fmt.Errorf("insert prescription failed: %w", err)
+	}
+
+	return id.(int64), check, nil
+}
+
+// GetPatientPrescriptions returns the prescriptions of a patient newest first
+func GetPatientPrescriptions(patientID string) ([]patients.Prescription, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+
+	fields := []string{
+		"Prescription.prescription_id",
+		"Prescription.patient_id",
+		"Prescription.drug_id",
+		"drug.drug_name",
+		"Prescription.quantity",
+		"Prescription.instructions",
+		"Prescription.prescribed_by",
+		"Prescription.medical_history_id",
+		"Prescription.prescribed_at",
+	}
+	results, err := SelectData("Prescription", fields, true, "Prescription.patient_id = $1", []interface{}{patientID}, true, "drug ON Prescription.drug_id = drug.drug_id", "", "ORDER BY Prescription.prescribed_at DESC, Prescription.prescription_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	prescriptions := []patients.Prescription{}
+	for _, row := range results {
+		prescription := patients.Prescription{
+			Prescription_id: row["prescription_id"].(int64),
+			Patient_id:      row["patient_id"].(string),
+			Drug_id:         row["drug_id"].(string),
+			Drug_name:       row["drug_name"].(string),
+			Quantity:        int(row["quantity"].(int64)),
+			Instructions:    stringOrEmpty(row["instructions"]),
+			Prescribed_by:   row["prescribed_by"].(string),
+			Prescribed_at:   timeOrEmpty(row["prescribed_at"]),
+		}
+		if encounterID, ok := row["medical_history_id"].(int64); ok {
+			prescription.Encounter_id = &encounterID
+		}
+		prescriptions = append(prescriptions, prescription)
+	}
+
+	return prescriptions, nil
+}
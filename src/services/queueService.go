@@ -0,0 +1,310 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+// Department of the employee an appointment is booked with
+const appointmentDepartmentColumn = "(SELECT p.department_id FROM Employee e JOIN Position p ON e.position_id = p.position_id WHERE e.employee_id = Patient_Appointment.employee_id) AS department_id"
+
+var queueEntryFields = []string{
+	"Appointment_checkin.checkin_id",
+	"Appointment_checkin.appointment_id",
+	"Appointment_checkin.department_id",
+	"Appointment_checkin.queue_date",
+	"Appointment_checkin.queue_number",
+	"Appointment_checkin.status",
+	"Appointment_checkin.checked_in_at",
+	"Appointment_checkin.called_at",
+	"Appointment_checkin.called_by",
+	"Appointment_checkin.room",
+	"Appointment_checkin.finished_at",
+	"Patient_Appointment.patient_id",
+	"Patient_Appointment.date",
+	"Patient_Appointment.time",
+	"Patient_Appointment.employee_id",
+	"(SELECT first_name || ' ' || last_name FROM Patient WHERE Patient.patient_id = Patient_Appointment.patient_id) AS patient_name",
+}
+
+func queueEntryFromRow(row map[string]interface{}, now time.Time) patients.QueueEntry {
+	entry := patients.QueueEntry{
+		Checkin_id:     row["checkin_id"].(int64),
+		Appointment_id: row["appointment_id"].(int64),
+		Department_id:  row["department_id"].(string),
+		Queue_date:     row["queue_date"].(time.Time).Format("2006-01-02"),
+		Queue_number:   int(row["queue_number"].(int64)),
+		Status:         stringOrEmpty(row["status"]),
+		Patient_id:     row["patient_id"].(string),
+		Patient_name:   stringOrEmpty(row["patient_name"]),
+		Appointment_at: appointmentStartFromRow(row).Format("2006-01-02 15:04:05"),
+		Employee_id:    stringOrEmpty(row["employee_id"]),
+		Checked_in_at:  timeOrEmpty(row["checked_in_at"]),
+		Called_at:      timeOrEmpty(row["called_at"]),
+		Called_by:      stringOrEmpty(row["called_by"]),
+		Room:           stringOrEmpty(row["room"]),
+		Finished_at:    timeOrEmpty(row["finished_at"]),
+	}
+
+	// Wait runs from check-in to the call; a patient never called waited until the entry was closed, or is still waiting
+	waitedUntil := now
+	if calledAt, ok := row["called_at"].(time.Time); ok {
+		waitedUntil = calledAt
+	} else if finishedAt, ok := row["finished_at"].(time.Time); ok {
+		waitedUntil = finishedAt
+	}
+	if wait := waitedUntil.Sub(row["checked_in_at"].(time.Time)); wait > 0 {
+		entry.Wait_minutes = int(wait.Minutes())
+	}
+	return entry
+}
+
+func getQueueEntry(checkinID int64) (*patients.QueueEntry, error) {
+	results, err := SelectData("Appointment_checkin", queueEntryFields, true, "Appointment_checkin.checkin_id = $1", []interface{}{checkinID},
+		true, "Patient_Appointment", "Appointment_checkin.appointment_id = Patient_Appointment.appointment_id", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("check-in not found")
+	}
+	entry := queueEntryFromRow(results[0], time.Now())
+	return &entry, nil
+}
+
+// CheckInAppointment marks today's appointment arrived and gives it the next queue number of the department.
+// The department row is locked while the number is taken, so two check-ins never get the same number
+func CheckInAppointment(appointmentID int64, req patients.CheckInRequest) (*patients.QueueEntry, error) {
+	if req.Checked_in_by != "" {
+		if err := checkActiveEmployee(req.Checked_in_by); err != nil {
+			return nil, err
+		}
+	}
+
+	var checkinID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		appointments, err := SelectDataTx(tx, "Patient_Appointment", []string{"appointment_id", "date", "cancelled_at", appointmentDepartmentColumn}, true,
+			"appointment_id = $1", []interface{}{appointmentID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(appointments) == 0 {
+			return fmt.Errorf("appointment not found")
+		}
+		appointment := appointments[0]
+		if appointment["cancelled_at"] != nil {
+			return fmt.Errorf("appointment is cancelled")
+		}
+		today := time.Now().Format("2006-01-02")
+		if appointment["date"].(time.Time).Format("2006-01-02") != today {
+			return fmt.Errorf("appointment is not today")
+		}
+
+		existing, err := SelectDataTx(tx, "Appointment_checkin", []string{"checkin_id"}, true, "appointment_id = $1", []interface{}{appointment["appointment_id"]}, false, "", "", "")
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("appointment is already checked in")
+		}
+
+		departmentID := req.Department_id
+		if departmentID == "" {
+			departmentID = stringOrEmpty(appointment["department_id"])
+		}
+		if departmentID == "" {
+			return fmt.Errorf("department_id is required, the appointment has no employee with a department")
+		}
+		department, err := SelectDataTx(tx, "Department", []string{"department_id"}, true, "department_id = $1", []interface{}{departmentID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(department) == 0 {
+			return fmt.Errorf("department not found")
+		}
+
+		next, err := SelectDataTx(tx, "Appointment_checkin", []string{"COALESCE(MAX(queue_number), 0) + 1 AS queue_number"}, true,
+			"department_id = $1 AND queue_date = $2", []interface{}{departmentID, today}, false, "", "", "")
+		if err != nil {
+			return err
+		}
+
+		id, err := InsertDataReturningTx(tx, "Appointment_checkin", map[string]interface{}{
+			"appointment_id": appointment["appointment_id"],
+			"department_id":  departmentID,
+			"queue_date":     today,
+			"queue_number":   next[0]["queue_number"],
+			"checked_in_at":  time.Now(),
+			"checked_in_by":  nullIfEmpty(req.Checked_in_by),
+		}, "checkin_id")
+		if err != nil {
+			return fmt.Errorf("insert check-in failed: %w", err)
+		}
+		checkinID = id.(int64)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := getQueueEntry(checkinID)
+	if err != nil {
+		return nil, err
+	}
+	publishQueueEvent("queue.checked_in", entry)
+	date, clock, _ := strings.Cut(entry.Appointment_at, " ")
+	publishScheduleEvent(entry.Employee_id, "appointment.checked_in", appointmentEventData(entry.Appointment_id, entry.Patient_id, entry.Employee_id, date, clock))
+	return entry, nil
+}
+
+// GetDepartmentQueue returns the waiting room of a department on date (YYYY-MM-DD): the patients waiting or called
+// in queue order, with every entry of the day when all is true. The averages always cover the whole day
+func GetDepartmentQueue(departmentID string, date string, all bool) (*patients.DepartmentQueue, error) {
+	department, err := GetDepartment(departmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := SelectData("Appointment_checkin", queueEntryFields, true,
+		"Appointment_checkin.department_id = $1 AND Appointment_checkin.queue_date = $2", []interface{}{departmentID, date},
+		true, "Patient_Appointment", "Appointment_checkin.appointment_id = Patient_Appointment.appointment_id", "ORDER BY Appointment_checkin.queue_number")
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &patients.DepartmentQueue{
+		Department_id:   department.Department_id,
+		Department_name: department.Department_name,
+		Queue_date:      date,
+		Entries:         []patients.QueueEntry{},
+	}
+	now := time.Now()
+	called, calledWait := 0, 0
+	for _, row := range results {
+		entry := queueEntryFromRow(row, now)
+		switch entry.Status {
+		case "waiting":
+			queue.Waiting_count++
+			if entry.Wait_minutes > queue.Longest_wait_minutes {
+				queue.Longest_wait_minutes = entry.Wait_minutes
+			}
+		case "called":
+			queue.Called_count++
+		}
+		if entry.Called_at != "" {
+			called++
+			calledWait += entry.Wait_minutes
+		}
+		if all || entry.Status == "waiting" || entry.Status == "called" {
+			queue.Entries = append(queue.Entries, entry)
+		}
+	}
+	if called > 0 {
+		queue.Average_wait_minutes = math.Round(float64(calledWait)/float64(called)*10) / 10
+	}
+
+	return queue, nil
+}
+
+// CallNextPatient calls the lowest queue number still waiting today in the department. SKIP LOCKED lets two
+// clinicians call at the same time without getting the same patient
+func CallNextPatient(departmentID string, req patients.CallNextRequest) (*patients.QueueEntry, error) {
+	if err := checkActiveEmployee(req.Employee_id); err != nil {
+		return nil, err
+	}
+
+	var checkinID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		results, err := SelectDataTx(tx, "Appointment_checkin", []string{"checkin_id"}, true,
+			"department_id = $1 AND queue_date = $2 AND status = 'waiting'", []interface{}{departmentID, time.Now().Format("2006-01-02")},
+			false, "", "", "ORDER BY queue_number LIMIT 1 FOR UPDATE SKIP LOCKED")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("no patient waiting")
+		}
+		checkinID = results[0]["checkin_id"].(int64)
+
+		_, err = UpdateDataTx(tx, "Appointment_checkin", map[string]interface{}{
+			"status":    "called",
+			"called_at": time.Now(),
+			"called_by": req.Employee_id,
+			"room":      nullIfEmpty(req.Room),
+		}, "checkin_id = $1", []interface{}{checkinID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := getQueueEntry(checkinID)
+	if err != nil {
+		return nil, err
+	}
+	publishQueueEvent("queue.called", entry)
+	return entry, nil
+}
+
+// FinishCheckIn closes a queue entry: completed once the called patient has been seen, no_show when the patient
+// did not answer the call or left before it
+func FinishCheckIn(checkinID int64, status string) (*patients.QueueEntry, error) {
+	var id int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		results, err := SelectDataTx(tx, "Appointment_checkin", []string{"checkin_id", "status"}, true, "checkin_id = $1", []interface{}{checkinID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("check-in not found")
+		}
+		id = results[0]["checkin_id"].(int64)
+
+		current := stringOrEmpty(results[0]["status"])
+		if status == "completed" && current != "called" {
+			return fmt.Errorf("only a called patient can be completed")
+		}
+		if status == "no_show" && current != "waiting" && current != "called" {
+			return fmt.Errorf("only a waiting or called patient can be marked no-show")
+		}
+
+		_, err = UpdateDataTx(tx, "Appointment_checkin", map[string]interface{}{
+			"status":      status,
+			"finished_at": time.Now(),
+		}, "checkin_id = $1", []interface{}{id})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := getQueueEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	publishQueueEvent("queue."+status, entry)
+	return entry, nil
+}
+
+// cancelAppointmentCheckInTx takes a cancelled appointment out of the waiting room, it returns the check-in id (0 when the patient was not waiting)
+func cancelAppointmentCheckInTx(tx *sql.Tx, appointmentID int64) (int64, error) {
+	results, err := SelectDataTx(tx, "Appointment_checkin", []string{"checkin_id"}, true, "appointment_id = $1 AND status = 'waiting'", []interface{}{appointmentID}, false, "", "", "FOR UPDATE")
+	if err != nil || len(results) == 0 {
+		return 0, err
+	}
+	checkinID := results[0]["checkin_id"].(int64)
+
+	_, err = UpdateDataTx(tx, "Appointment_checkin", map[string]interface{}{
+		"status":      "cancelled",
+		"finished_at": time.Now(),
+	}, "checkin_id = $1", []interface{}{checkinID})
+	if err != nil {
+		return 0, err
+	}
+	return checkinID, nil
+}
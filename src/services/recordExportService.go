@@ -0,0 +1,233 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/utils/databaseConnector"
+)
+
+// patientRecordFormatVersion changes when fields of PatientRecordExport are renamed or removed
+const patientRecordFormatVersion = 1
+
+// RecordPatientAccess adds an entry to the patient's access audit. A failure is only logged, it must not block the
+// care team from the record
+func RecordPatientAccess(patientID string, accessedBy string, role string, action string) {
+	_, err := InsertData("Patient_record_access", map[string]interface{}{
+		"patient_id":  patientID,
+		"accessed_by": accessedBy,
+		"role":        role,
+		"action":      action,
+	})
+	if err != nil {
+		fmt.Println("Recording access to patient", patientID, "failed:", err)
+	}
+}
+
+// RecordPatientsAccess is RecordPatientAccess for every patient of a list, search result or bulk export, in one insert
+func RecordPatientsAccess(patientIDs []string, accessedBy string, role string, action string) {
+	if len(patientIDs) == 0 {
+		return
+	}
+	_, err := databaseConnector.DB.Exec(
+		"INSERT INTO Patient_record_access (patient_id, accessed_by, role, action) SELECT DISTINCT unnest($1::varchar[]), $2, $3, $4",
+		pq.Array(patientIDs), accessedBy, role, action)
+	if err != nil {
+		fmt.Println("Recording access to", len(patientIDs), "patients failed:", err)
+	}
+}
+
+// GetPatientRecordAccess returns who viewed or exported the patient's record, newest first
+func GetPatientRecordAccess(patientID string) ([]patients.PatientRecordAccess, error) {
+	results, err := SelectData("Patient_record_access", []string{"accessed_by", "role", "action", "accessed_at"}, true, "patient_id = $1", []interface{}{patientID}, false, "", "", "ORDER BY accessed_at DESC, access_id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	accesses := []patients.PatientRecordAccess{}
+	for _, row := range results {
+		accesses = append(accesses, patients.PatientRecordAccess{
+			Accessed_by: row["accessed_by"].(string),
+			Role:        row["role"].(string),
+			Action:      row["action"].(string),
+			Accessed_at: timeOrEmpty(row["accessed_at"]),
+		})
+	}
+	return accesses, nil
+}
+
+func getPatientRecordAppointments(patientID string) ([]patients.RecordAppointment, error) {
+	fields := []string{
+		"appointment_id", "date", "time", "topic", "employee_id", "cancelled_at", "cancellation_reason",
+		"(SELECT first_name || ' ' || last_name FROM Employee WHERE Employee.employee_id = Patient_Appointment.employee_id) AS doctor_name",
+	}
+	results, err := SelectData("Patient_Appointment", fields, true, "patient_id = $1", []interface{}{patientID}, false, "", "", "ORDER BY date, time, appointment_id")
+	if err != nil {
+		return nil, err
+	}
+
+	appointments := []patients.RecordAppointment{}
+	for _, row := range results {
+		appointment := patients.RecordAppointment{
+			Appointment_id:      row["appointment_id"].(int64),
+			Date:                row["date"].(time.Time).Format("2006-01-02"),
+			Time:                row["time"].(time.Time).Format("15:04:05"),
+			Topic:               row["topic"].(string),
+			Employee_id:         stringOrEmpty(row["employee_id"]),
+			Doctor_name:         stringOrEmpty(row["doctor_name"]),
+			Status:              "booked",
+			Cancelled_at:        timeOrEmpty(row["cancelled_at"]),
+			Cancellation_reason: stringOrEmpty(row["cancellation_reason"]),
+		}
+		if appointment.Cancelled_at != "" {
+			appointment.Status = "cancelled"
+		}
+		appointments = append(appointments, appointment)
+	}
+	return appointments, nil
+}
+
+func getPatientRecordConditions(patientID string) ([]patients.RecordCondition, error) {
+	results, err := SelectData("Patient_chronic_disease", []string{"Disease.disease_id", "Disease.disease_name", "Disease.icd10_code"}, true, "Patient_chronic_disease.patient_id = $1", []interface{}{patientID}, true, "Disease", "Patient_chronic_disease.disease_id = Disease.disease_id", "ORDER BY Disease.disease_id")
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []patients.RecordCondition{}
+	for _, row := range results {
+		conditions = append(conditions, patients.RecordCondition{
+			Disease_id:   row["disease_id"].(string),
+			Disease_name: row["disease_name"].(string),
+			Icd10_code:   stringOrEmpty(row["icd10_code"]),
+		})
+	}
+	return conditions, nil
+}
+
+// ExportPatientRecord collects everything stored about a patient. The export is added to the access audit first, so
+// the copy shows who exported it and when
+func ExportPatientRecord(patientID string, accessedBy string, role string) (*patients.PatientRecordExport, error) {
+	if err := checkPatientExists(patientID); err != nil {
+		return nil, err
+	}
+	RecordPatientAccess(patientID, accessedBy, role, "export")
+
+	patient, err := GetPatient(patientID)
+	if err != nil {
+		return nil, err
+	}
+	record := &patients.PatientRecordExport{
+		Format_version:     patientRecordFormatVersion,
+		Exported_at:        time.Now().Format(time.RFC3339),
+		Patient:            patient.PatientGeneralInfo,
+		Emergency_contacts: patient.PatientEmergencyContacts,
+		Encounters:         patient.PatientEncounters,
+		Allergies:          patient.PatientDrugAllergy,
+	}
+	// GetPatient shows the date of birth as DD-MM-YYYY, the export uses ISO dates throughout
+	if dateOfBirth, err := time.Parse("02-01-2006", record.Patient.Date_of_birth); err == nil {
+		record.Patient.Date_of_birth = dateOfBirth.Format("2006-01-02")
+	}
+	if record.Emergency_contacts == nil {
+		record.Emergency_contacts = []patients.EmergencyContact{}
+	}
+	if record.Encounters == nil {
+		record.Encounters = []patients.Encounter{}
+	}
+	if record.Allergies == nil {
+		record.Allergies = []patients.DrugAllergyName{}
+	}
+
+	if record.Consents, err = GetPatientConsents(patientID, true); err != nil {
+		return nil, err
+	}
+	if record.Appointments, err = getPatientRecordAppointments(patientID); err != nil {
+		return nil, err
+	}
+	if record.Conditions, err = getPatientRecordConditions(patientID); err != nil {
+		return nil, err
+	}
+	if record.Prescriptions, err = GetPatientPrescriptions(patientID); err != nil {
+		return nil, err
+	}
+	if record.Observations, err = GetPatientObservations(patientID, patients.ObservationQuery{}); err != nil {
+		return nil, err
+	}
+	if record.Lab_orders, err = GetPatientLabOrders(patientID, ""); err != nil {
+		return nil, err
+	}
+	if record.Admissions, err = GetPatientAdmissions(patientID); err != nil {
+		return nil, err
+	}
+	if record.Insurance_policies, err = GetPatientPolicies(patientID); err != nil {
+		return nil, err
+	}
+	if record.Invoices, err = GetPatientInvoices(patientID); err != nil {
+		return nil, err
+	}
+	if record.Access_log, err = GetPatientRecordAccess(patientID); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// WritePatientRecordZip writes the record as a zip archive with one JSON file per section and a manifest.json
+// listing them, for patients who want to open the parts separately
+func WritePatientRecordZip(w io.Writer, record *patients.PatientRecordExport) error {
+	sections := []struct {
+		file string
+		data interface{}
+	}{
+		{"patient.json", record.Patient},
+		{"emergency_contacts.json", record.Emergency_contacts},
+		{"consents.json", record.Consents},
+		{"appointments.json", record.Appointments},
+		{"encounters.json", record.Encounters},
+		{"conditions.json", record.Conditions},
+		{"allergies.json", record.Allergies},
+		{"prescriptions.json", record.Prescriptions},
+		{"observations.json", record.Observations},
+		{"lab_orders.json", record.Lab_orders},
+		{"admissions.json", record.Admissions},
+		{"insurance_policies.json", record.Insurance_policies},
+		{"invoices.json", record.Invoices},
+		{"access_log.json", record.Access_log},
+	}
+
+	files := []string{}
+	for _, section := range sections {
+		files = append(files, section.file)
+	}
+	manifest := map[string]interface{}{
+		"format_version": record.Format_version,
+		"exported_at":    record.Exported_at,
+		"patient_id":     record.Patient.Patient_id,
+		"files":          files,
+	}
+
+	archive := zip.NewWriter(w)
+	writeJSON := func(file string, data interface{}) error {
+		f, err := archive.Create(file)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	}
+	if err := writeJSON("manifest.json", manifest); err != nil {
+		return err
+	}
+	for _, section := range sections {
+		if err := writeJSON(section.file, section.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
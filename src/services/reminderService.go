@@ -0,0 +1,431 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/NinePTH/GO_MVC-S/src/utils/notifier"
+)
+
+// Reminder settings, overridden from the environment by StartReminderDispatcher:
+//
+//	REMINDER_OFFSETS        comma separated durations before the appointment, e.g. "24h,2h"
+//	REMINDER_MAX_ATTEMPTS   sends tried before a reminder is marked failed
+//	REMINDER_POLL_INTERVAL  how often due reminders are looked for, e.g. "30s"
+var (
+	reminderOffsets      = []time.Duration{24 * time.Hour, 2 * time.Hour}
+	reminderMaxAttempts  = 5
+	reminderPollInterval = 30 * time.Second
+	reminderBaseBackoff  = time.Minute
+	reminderMaxBackoff   = time.Hour
+	reminderBatchSize    = 50
+)
+
+// reminderBackoff is the wait before the next try after attempts failed sends: 1m, 2m, 4m, ... up to 1h
+func reminderBackoff(attempts int) time.Duration {
+	return exponentialBackoff(reminderBaseBackoff, reminderMaxBackoff, attempts)
+}
+
+// loadReminderSettings reads the REMINDER_* variables, invalid values keep the defaults
+func loadReminderSettings() {
+	if raw := os.Getenv("REMINDER_OFFSETS"); raw != "" {
+		var offsets []time.Duration
+		for _, part := range strings.Split(raw, ",") {
+			offset, err := time.ParseDuration(strings.TrimSpace(part))
+			if err != nil || offset <= 0 {
+				fmt.Printf("reminder: ignoring invalid REMINDER_OFFSETS %q\n", raw)
+				offsets = nil
+				break
+			}
+			offsets = append(offsets, offset)
+		}
+		if len(offsets) > 0 {
+			reminderOffsets = offsets
+		}
+	}
+	if raw := os.Getenv("REMINDER_MAX_ATTEMPTS"); raw != "" {
+		if attempts, err := strconv.Atoi(raw); err == nil && attempts > 0 {
+			reminderMaxAttempts = attempts
+		}
+	}
+	if raw := os.Getenv("REMINDER_POLL_INTERVAL"); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			reminderPollInterval = interval
+		}
+	}
+}
+
+// StartReminderDispatcher loads the reminder settings and the notification senders, and schedules the
+// "reminders.dispatch" job every poll interval. The job runner started by StartJobRunner sends the due reminders
+func StartReminderDispatcher() {
+	loadReminderSettings()
+	notifier.InitSenders()
+	RegisterJobSchedule("reminders-dispatch", "reminders.dispatch", reminderPollInterval)
+	fmt.Printf("reminder: offsets %v, polling every %s\n", reminderOffsets, reminderPollInterval)
+}
+
+func init() {
+	RegisterJobHandler("reminders.dispatch", func(payload json.RawMessage) (interface{}, error) {
+		handled, err := DispatchDueReminders()
+		return map[string]int{"handled": handled}, err
+	})
+}
+
+// ParseAppointmentStart combines an appointment date (YYYY-MM-DD) and time (HH:MM or HH:MM:SS) into the local start time
+func ParseAppointmentStart(date string, clock string) (time.Time, error) {
+	layout := "2006-01-02 15:04:05"
+	if len(clock) == len("15:04") {
+		layout = "2006-01-02 15:04"
+	}
+	return time.ParseInLocation(layout, date+" "+clock, time.Local)
+}
+
+// appointmentStartFromRow rebuilds the local start time from the DATE and TIME columns, lib/pq returns both as UTC time.Time
+func appointmentStartFromRow(row map[string]interface{}) time.Time {
+	date := row["date"].(time.Time)
+	clock := row["time"].(time.Time)
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.Local)
+}
+
+// scheduleAppointmentRemindersTx queues a reminder per configured offset on every channel the patient agreed to be
+// contacted on (communication_email / communication_sms consent) and has an address for. Offsets already in the past are skipped
+func scheduleAppointmentRemindersTx(tx *sql.Tx, appointmentID int64, patientID string, start time.Time) (int, error) {
+	fields := []string{
+		"email",
+		"phone_number",
+		consentGrantedCondition("Patient.patient_id", ConsentCommunicationEmail) + " AS email_ok",
+		consentGrantedCondition("Patient.patient_id", ConsentCommunicationSMS) + " AS sms_ok",
+	}
+	results, err := SelectDataTx(tx, "Patient", fields, true, "patient_id = $1 AND "+patientNotDeleted, []interface{}{patientID}, false, "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, fmt.Errorf("Patient not found")
+	}
+
+	recipients := map[string]string{}
+	if email := stringOrEmpty(results[0]["email"]); email != "" && results[0]["email_ok"].(bool) {
+		recipients["email"] = email
+	}
+	if phone := stringOrEmpty(results[0]["phone_number"]); phone != "" && results[0]["sms_ok"].(bool) {
+		recipients["sms"] = phone
+	}
+
+	scheduled := 0
+	now := time.Now()
+	for _, offset := range reminderOffsets {
+		sendAt := start.Add(-offset)
+		if sendAt.Before(now) {
+			continue
+		}
+		for _, channel := range []string{"email", "sms"} {
+			recipient, ok := recipients[channel]
+			if !ok {
+				continue
+			}
+			_, err := InsertDataTx(tx, "Appointment_reminder", map[string]interface{}{
+				"appointment_id":  appointmentID,
+				"channel":         channel,
+				"recipient":       recipient,
+				"offset_minutes":  int(offset.Minutes()),
+				"send_at":         sendAt,
+				"next_attempt_at": sendAt,
+			})
+			if err != nil {
+				return scheduled, fmt.Errorf("insert reminder failed: %w", err)
+			}
+			scheduled++
+		}
+	}
+	return scheduled, nil
+}
+
+// cancelAppointmentRemindersTx cancels the reminders of an appointment that have not been sent yet
+func cancelAppointmentRemindersTx(tx *sql.Tx, appointmentID int64) (int64, error) {
+	return UpdateDataTx(tx, "Appointment_reminder", map[string]interface{}{
+		"status":       "cancelled",
+		"cancelled_at": time.Now(),
+	}, "appointment_id = $1 AND status = 'pending'", []interface{}{appointmentID})
+}
+
+// lockActiveAppointment locks an appointment that has not been cancelled
+func lockActiveAppointment(tx *sql.Tx, appointmentID int64) (map[string]interface{}, error) {
+	results, err := SelectDataTx(tx, "Patient_Appointment", []string{"appointment_id", "patient_id", "employee_id", "date", "time", "cancelled_at"}, true, "appointment_id = $1", []interface{}{appointmentID}, false, "", "", "FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("appointment not found")
+	}
+	if results[0]["cancelled_at"] != nil {
+		return nil, fmt.Errorf("appointment is cancelled")
+	}
+	return results[0], nil
+}
+
+// MoveAppointment changes the date and time of an appointment. Coverage is checked again on the new date,
+// the pending reminders are cancelled and new ones are queued for the new time
+func MoveAppointment(appointmentID int64, req patients.MoveAppointmentRequest) (*patients.CoverageEligibility, int, error) {
+	start, err := ParseAppointmentStart(req.Date, req.Time)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid appointment date or time")
+	}
+	if req.Employee_id != "" {
+		if err := checkActiveEmployee(req.Employee_id); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var eligibility *patients.CoverageEligibility
+	var scheduled int
+	var id int64
+	var patientID, previousEmployeeID string
+	err = WithTransaction(func(tx *sql.Tx) error {
+		appointment, err := lockActiveAppointment(tx, appointmentID)
+		if err != nil {
+			return err
+		}
+		id = appointment["appointment_id"].(int64)
+		patientID = appointment["patient_id"].(string)
+		previousEmployeeID = stringOrEmpty(appointment["employee_id"])
+
+		eligibility, err = CheckCoverageEligibility(patientID, req.Date)
+		if err != nil {
+			return err
+		}
+
+		data := map[string]interface{}{
+			"date":      req.Date,
+			"time":      req.Time,
+			"policy_id": nil,
+		}
+		if eligibility.Policy != nil {
+			data["policy_id"] = eligibility.Policy.Policy_id
+		}
+		if req.Topic != "" {
+			data["topic"] = req.Topic
+		}
+		if req.Employee_id != "" {
+			data["employee_id"] = req.Employee_id
+		}
+		if _, err := UpdateDataTx(tx, "Patient_Appointment", data, "appointment_id = $1", []interface{}{appointment["appointment_id"]}); err != nil {
+			return err
+		}
+
+		if _, err := cancelAppointmentRemindersTx(tx, appointment["appointment_id"].(int64)); err != nil {
+			return err
+		}
+		scheduled, err = scheduleAppointmentRemindersTx(tx, appointment["appointment_id"].(int64), patientID, start)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	employeeID := previousEmployeeID
+	if req.Employee_id != "" {
+		employeeID = req.Employee_id
+	}
+	event := appointmentEventData(id, patientID, employeeID, start.Format("2006-01-02"), start.Format("15:04:05"))
+	publishScheduleEvent(employeeID, "appointment.moved", event)
+	if previousEmployeeID != employeeID {
+		publishScheduleEvent(previousEmployeeID, "appointment.moved", event)
+	}
+	return eligibility, scheduled, nil
+}
+
+// CancelAppointment marks an appointment cancelled (it is kept for the record and never charged), cancels its pending reminders
+// and takes it out of the waiting room
+func CancelAppointment(appointmentID int64, req patients.CancelAppointmentRequest) error {
+	var appointment map[string]interface{}
+	var checkinID int64
+	err := WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		appointment, err = lockActiveAppointment(tx, appointmentID)
+		if err != nil {
+			return err
+		}
+
+		_, err = UpdateDataTx(tx, "Patient_Appointment", map[string]interface{}{
+			"cancelled_at":        time.Now(),
+			"cancellation_reason": nullIfEmpty(req.Reason),
+		}, "appointment_id = $1", []interface{}{appointment["appointment_id"]})
+		if err != nil {
+			return err
+		}
+
+		if _, err := cancelAppointmentRemindersTx(tx, appointment["appointment_id"].(int64)); err != nil {
+			return err
+		}
+		checkinID, err = cancelAppointmentCheckInTx(tx, appointment["appointment_id"].(int64))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	start := appointmentStartFromRow(appointment)
+	employeeID := stringOrEmpty(appointment["employee_id"])
+	publishScheduleEvent(employeeID, "appointment.cancelled", appointmentEventData(appointment["appointment_id"].(int64), appointment["patient_id"].(string), employeeID, start.Format("2006-01-02"), start.Format("15:04:05")))
+	if checkinID != 0 {
+		if entry, err := getQueueEntry(checkinID); err == nil {
+			publishQueueEvent("queue.cancelled", entry)
+		}
+	}
+	return nil
+}
+
+func appointmentReminderFromRow(row map[string]interface{}) patients.AppointmentReminder {
+	return patients.AppointmentReminder{
+		Reminder_id:     row["reminder_id"].(int64),
+		Appointment_id:  row["appointment_id"].(int64),
+		Channel:         stringOrEmpty(row["channel"]),
+		Recipient:       row["recipient"].(string),
+		Offset_minutes:  int(row["offset_minutes"].(int64)),
+		Send_at:         timeOrEmpty(row["send_at"]),
+		Status:          stringOrEmpty(row["status"]),
+		Attempts:        int(row["attempts"].(int64)),
+		Next_attempt_at: timeOrEmpty(row["next_attempt_at"]),
+		Last_error:      stringOrEmpty(row["last_error"]),
+		Sent_at:         timeOrEmpty(row["sent_at"]),
+		Cancelled_at:    timeOrEmpty(row["cancelled_at"]),
+	}
+}
+
+// GetAppointmentReminders lists every reminder of an appointment with its delivery status, in send order
+func GetAppointmentReminders(appointmentID int64) ([]patients.AppointmentReminder, error) {
+	appointment, err := SelectData("Patient_Appointment", []string{"appointment_id"}, true, "appointment_id = $1", []interface{}{appointmentID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(appointment) == 0 {
+		return nil, fmt.Errorf("appointment not found")
+	}
+
+	results, err := SelectData("Appointment_reminder", []string{"*"}, true, "appointment_id = $1", []interface{}{appointment[0]["appointment_id"]}, false, "", "", "ORDER BY send_at, channel, reminder_id")
+	if err != nil {
+		return nil, err
+	}
+
+	reminders := []patients.AppointmentReminder{}
+	for _, row := range results {
+		reminders = append(reminders, appointmentReminderFromRow(row))
+	}
+	return reminders, nil
+}
+
+var dueReminderFields = []string{
+	"Appointment_reminder.reminder_id",
+	"Appointment_reminder.channel",
+	"Appointment_reminder.recipient",
+	"Appointment_reminder.attempts",
+	"Patient_Appointment.patient_id",
+	"Patient_Appointment.date",
+	"Patient_Appointment.time",
+	"Patient_Appointment.topic",
+	"Patient_Appointment.cancelled_at",
+	"(SELECT first_name || ' ' || last_name FROM Employee WHERE Employee.employee_id = Patient_Appointment.employee_id) AS employee_name",
+}
+
+// DispatchDueReminders sends the reminders that are due, one transaction per reminder so a slow or failing
+// channel does not hold the others. It returns how many reminders were handled
+func DispatchDueReminders() (int, error) {
+	handled := 0
+	for handled < reminderBatchSize {
+		found := false
+		err := WithTransaction(func(tx *sql.Tx) error {
+			results, err := SelectDataTx(tx, "Appointment_reminder", dueReminderFields, true,
+				"Appointment_reminder.status = 'pending' AND Appointment_reminder.next_attempt_at <= $1 AND "+patientNotDeletedCondition("Patient_Appointment.patient_id"), []interface{}{time.Now()},
+				true, "Patient_Appointment", "Appointment_reminder.appointment_id = Patient_Appointment.appointment_id",
+				"ORDER BY Appointment_reminder.next_attempt_at LIMIT 1 FOR UPDATE OF Appointment_reminder SKIP LOCKED")
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				return nil
+			}
+			found = true
+			return dispatchReminderTx(tx, results[0])
+		})
+		if err != nil {
+			return handled, err
+		}
+		if !found {
+			break
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// dispatchReminderTx sends one locked reminder and records the outcome. Consent is checked again at send time,
+// a patient who withdrew it since booking is not contacted
+func dispatchReminderTx(tx *sql.Tx, row map[string]interface{}) error {
+	reminderID := row["reminder_id"].(int64)
+	channel := stringOrEmpty(row["channel"])
+	now := time.Now()
+
+	finish := func(status string, lastError string) error {
+		data := map[string]interface{}{"status": status, "last_error": nullIfEmpty(lastError)}
+		if status == "cancelled" {
+			data["cancelled_at"] = now
+		}
+		_, err := UpdateDataTx(tx, "Appointment_reminder", data, "reminder_id = $1", []interface{}{reminderID})
+		return err
+	}
+
+	if row["cancelled_at"] != nil {
+		return finish("cancelled", "appointment cancelled")
+	}
+	start := appointmentStartFromRow(row)
+	if !start.After(now) {
+		return finish("failed", "appointment time has passed")
+	}
+
+	consentType := ConsentCommunicationEmail
+	if channel == "sms" {
+		consentType = ConsentCommunicationSMS
+	}
+	consented, err := HasConsent(row["patient_id"].(string), consentType)
+	if err != nil {
+		return err
+	}
+	if !consented {
+		return finish("cancelled", consentType+" consent withdrawn")
+	}
+
+	body := fmt.Sprintf("Reminder: you have an appointment on %s at %s (%s)", start.Format("02-01-2006"), start.Format("15:04"), row["topic"].(string))
+	if name := stringOrEmpty(row["employee_name"]); name != "" {
+		body += " with " + name
+	}
+	body += "."
+	sendErr := notifier.Send(notifier.Message{
+		Channel: channel,
+		To:      row["recipient"].(string),
+		Subject: "Appointment reminder",
+		Body:    body,
+	})
+
+	attempts := int(row["attempts"].(int64)) + 1
+	data := map[string]interface{}{"attempts": attempts}
+	switch {
+	case sendErr == nil:
+		data["status"] = "sent"
+		data["sent_at"] = now
+	case attempts >= reminderMaxAttempts:
+		data["status"] = "failed"
+		data["last_error"] = sendErr.Error()
+	default:
+		data["next_attempt_at"] = now.Add(reminderBackoff(attempts))
+		data["last_error"] = sendErr.Error()
+	}
+	_, err = UpdateDataTx(tx, "Appointment_reminder", data, "reminder_id = $1", []interface{}{reminderID})
+	return err
+}
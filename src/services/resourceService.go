@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+	"github.com/lib/pq"
+)
+
+// Writes of the /api/v1 patient and employee resources. Partial updates are JSON Merge Patch (RFC 7386): a member of
+// the patch replaces the stored value, null removes it, members left out are kept and arrays are replaced as a whole
+
+// ConflictError is a write refused by a UNIQUE constraint (e.g. an email or id card number already in use) or by a
+// foreign key still pointing at the row
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// InvalidValueError is a value the database refused (a CHECK constraint, an unknown enum value, a string too long)
+type InvalidValueError struct {
+	Message string
+}
+
+func (e *InvalidValueError) Error() string {
+	return e.Message
+}
+
+// ResourceWriteError turns the constraint violations of a create or update into ConflictError / InvalidValueError,
+// other errors are returned as they are
+func ResourceWriteError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	message := pqErr.Message
+	if pqErr.Detail != "" {
+		message = pqErr.Detail
+	}
+	switch {
+	case pqErr.Code == "23505" || pqErr.Code == "23503":
+		return &ConflictError{Message: message}
+	case pqErr.Code == "23514" || pqErr.Code.Class() == "22":
+		return &InvalidValueError{Message: message}
+	}
+	return err
+}
+
+// PatchError is a merge patch that cannot be applied (unknown member, wrong type, removing a required field)
+type PatchError struct {
+	Message string
+}
+
+func (e *PatchError) Error() string {
+	return e.Message
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// patchString reads a member holding a string that must stay filled in
+func patchString(name string, raw json.RawMessage) (string, error) {
+	if isJSONNull(raw) {
+		return "", &PatchError{Message: name + " cannot be removed"}
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", &PatchError{Message: name + " must be a string"}
+	}
+	if strings.TrimSpace(value) == "" {
+		return "", &PatchError{Message: name + " cannot be empty"}
+	}
+	return value, nil
+}
+
+// patchDate reads a member holding a YYYY-MM-DD date
+func patchDate(name string, raw json.RawMessage) (string, error) {
+	value, err := patchString(name, raw)
+	if err != nil {
+		return "", err
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", &PatchError{Message: name + " must be YYYY-MM-DD"}
+	}
+	return value, nil
+}
+
+// patchList reads a member holding an array into list, null is the same as []
+func patchList(name string, raw json.RawMessage, list interface{}) error {
+	if isJSONNull(raw) {
+		return nil
+	}
+	if err := json.Unmarshal(raw, list); err != nil {
+		return &PatchError{Message: name + " must be an array of objects"}
+	}
+	return nil
+}
+
+// PatchPatient applies a merge patch shaped like the AddPatientRequest ({"patient": {...}, "patient_chronic_disease":
+// [...], ...}) to a patient. The patient fields cannot be removed, patient_id cannot be changed and health_insurance is
+// read only. Chronic diseases and drug allergies left out of the patch are kept as they are
+func PatchPatient(patientID string, patch map[string]json.RawMessage) error {
+	if err := checkPatientExists(patientID); err != nil {
+		return err
+	}
+	req, err := patientPatchRequest(patientID, patch)
+	if err != nil {
+		return err
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+
+	_, err = UpdatePatient(&req)
+	return err
+}
+
+// patientPatchRequest turns a patient merge patch into the UpdatePatient request it stands for
+func patientPatchRequest(patientID string, patch map[string]json.RawMessage) (patients.AddPatientRequest, error) {
+	req := patients.AddPatientRequest{Patient: patients.GeneralPatientInformation{Patient_id: patientID}}
+	for member := range patch {
+		switch member {
+		case "patient", "patient_chronic_disease", "patient_drug_allergy", "patient_emergency_contacts":
+		default:
+			return req, &PatchError{Message: fmt.Sprintf("unknown member %q", member)}
+		}
+	}
+
+	if raw, ok := patch["patient"]; ok {
+		var fields map[string]json.RawMessage
+		if isJSONNull(raw) || json.Unmarshal(raw, &fields) != nil {
+			return req, &PatchError{Message: "patient must be an object"}
+		}
+		for field, value := range fields {
+			if err := patchPatientField(&req.Patient, field, value); err != nil {
+				return req, err
+			}
+		}
+	}
+
+	// The lists are only touched when the patch has them (nil keeps the current ones, null or [] clears them)
+	if raw, ok := patch["patient_chronic_disease"]; ok {
+		req.PatientChronicDisease = []patients.ChronicDiseaseName{}
+		if err := patchList("patient_chronic_disease", raw, &req.PatientChronicDisease); err != nil {
+			return req, err
+		}
+	}
+
+	if raw, ok := patch["patient_drug_allergy"]; ok {
+		req.PatientDrugAllergy = []patients.DrugAllergyName{}
+		if err := patchList("patient_drug_allergy", raw, &req.PatientDrugAllergy); err != nil {
+			return req, err
+		}
+		if err := validateDrugAllergies(req.PatientDrugAllergy); err != nil {
+			return req, &PatchError{Message: err.Error()}
+		}
+	}
+
+	if raw, ok := patch["patient_emergency_contacts"]; ok {
+		req.PatientEmergencyContacts = []patients.EmergencyContact{}
+		if err := patchList("patient_emergency_contacts", raw, &req.PatientEmergencyContacts); err != nil {
+			return req, err
+		}
+		if err := ValidateEmergencyContacts(req.PatientEmergencyContacts); err != nil {
+			return req, &PatchError{Message: err.Error()}
+		}
+	}
+
+	return req, nil
+}
+
+// patchPatientField sets one member of the "patient" object of a patch
+func patchPatientField(p *patients.GeneralPatientInformation, field string, raw json.RawMessage) error {
+	name := "patient." + field
+	textFields := map[string]*string{
+		"first_name":        &p.First_name,
+		"last_name":         &p.Last_name,
+		"gender":            &p.Gender,
+		"blood_type":        &p.Blood_type,
+		"email":             &p.Email,
+		"address":           &p.Address,
+		"phone_number":      &p.Phone_number,
+		"id_card_number":    &p.Id_card_number,
+		"ongoing_treatment": &p.Ongoing_treatment,
+		"unhealthy_habits":  &p.Unhealthy_habits,
+	}
+
+	switch field {
+	case "patient_id":
+		id, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		if id != p.Patient_id {
+			return &PatchError{Message: name + " cannot be changed"}
+		}
+		return nil
+	case "health_insurance":
+		return &PatchError{Message: name + " is read only, it follows the insurance policies"}
+	case "age":
+		if isJSONNull(raw) {
+			return &PatchError{Message: name + " cannot be removed"}
+		}
+		if err := json.Unmarshal(raw, &p.Age); err != nil || p.Age <= 0 {
+			return &PatchError{Message: name + " must be a positive whole number"}
+		}
+		return nil
+	case "date_of_birth":
+		value, err := patchDate(name, raw)
+		p.Date_of_birth = value
+		return err
+	}
+
+	target, ok := textFields[field]
+	if !ok {
+		return &PatchError{Message: fmt.Sprintf("unknown member %q", name)}
+	}
+	value, err := patchString(name, raw)
+	*target = value
+	return err
+}
+
+// PatchEmployee applies a merge patch of EmployeeInsert fields to an employee. resignation_date is the only field that
+// can be removed (null); employee_id cannot be changed
+func PatchEmployee(employeeID string, patch map[string]json.RawMessage) error {
+	data, err := employeePatchData(employeeID, patch)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		_, err = GetEmployee(employeeID)
+		return err
+	}
+	rowsAffected, err := UpdateEmployee(employeeID, data)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("employee not found")
+	}
+	return nil
+}
+
+// employeePatchData turns an employee merge patch into the columns to update, nil clears resignation_date
+func employeePatchData(employeeID string, patch map[string]json.RawMessage) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for field, raw := range patch {
+		switch field {
+		case "employee_id":
+			id, err := patchString(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			if id != employeeID {
+				return nil, &PatchError{Message: field + " cannot be changed"}
+			}
+		case "first_name", "last_name", "position_id", "phone_number", "email":
+			value, err := patchString(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			data[field] = value
+		case "work_status":
+			value, err := patchString(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			if value != "yes" && value != "no" {
+				return nil, &PatchError{Message: "work_status must be yes or no"}
+			}
+			data[field] = value
+		case "hire_date":
+			value, err := patchDate(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			data[field] = value
+		case "resignation_date":
+			if isJSONNull(raw) {
+				data[field] = nil
+				continue
+			}
+			value, err := patchDate(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			data[field] = value
+		case "salary":
+			var salary float64
+			if isJSONNull(raw) || json.Unmarshal(raw, &salary) != nil || salary <= 0 {
+				return nil, &PatchError{Message: "salary must be a positive number"}
+			}
+			data[field] = salary
+		default:
+			return nil, &PatchError{Message: fmt.Sprintf("unknown member %q", field)}
+		}
+	}
+	return data, nil
+}
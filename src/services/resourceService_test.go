@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/NinePTH/GO_MVC-S/src/models/patients"
+)
+
+func mustPatch(t *testing.T, body string) map[string]json.RawMessage {
+	t.Helper()
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &patch); err != nil {
+		t.Fatalf("bad patch %s: %v", body, err)
+	}
+	return patch
+}
+
+func TestPatientPatchRequest(t *testing.T) {
+	base := patients.GeneralPatientInformation{Patient_id: "P001"}
+	named := base
+	named.First_name = "Somchai"
+	aged := base
+	aged.Age = 42
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    patients.AddPatientRequest
+		wantErr string
+	}{
+		{"empty patch", `{}`, patients.AddPatientRequest{Patient: base}, ""},
+		{"absent lists are kept", `{"patient": {"first_name": "Somchai"}}`, patients.AddPatientRequest{Patient: named}, ""},
+		{"unchanged patient_id", `{"patient": {"patient_id": "P001", "age": 42}}`, patients.AddPatientRequest{Patient: aged}, ""},
+		{"null clears a list", `{"patient_chronic_disease": null}`,
+			patients.AddPatientRequest{Patient: base, PatientChronicDisease: []patients.ChronicDiseaseName{}}, ""},
+		{"[] clears a list", `{"patient_drug_allergy": []}`,
+			patients.AddPatientRequest{Patient: base, PatientDrugAllergy: []patients.DrugAllergyName{}}, ""},
+		{"list replaces", `{"patient_chronic_disease": [{"disease_id": "D001"}]}`,
+			patients.AddPatientRequest{Patient: base, PatientChronicDisease: []patients.ChronicDiseaseName{{DiseaseID: "D001"}}}, ""},
+		{"contact priority filled in", `{"patient_emergency_contacts": [{"contact_name": "Malee", "relationship": "spouse", "phone_number": "0812345678"}]}`,
+			patients.AddPatientRequest{Patient: base, PatientEmergencyContacts: []patients.EmergencyContact{
+				{Contact_name: "Malee", Relationship: "spouse", Phone_number: "0812345678", Priority: 1},
+			}}, ""},
+		{"unknown member", `{"nickname": "Chai"}`, patients.AddPatientRequest{}, `unknown member "nickname"`},
+		{"unknown patient field", `{"patient": {"nickname": "Chai"}}`, patients.AddPatientRequest{}, `unknown member "patient.nickname"`},
+		{"patient null", `{"patient": null}`, patients.AddPatientRequest{}, "patient must be an object"},
+		{"patient field removed", `{"patient": {"first_name": null}}`, patients.AddPatientRequest{}, "patient.first_name cannot be removed"},
+		{"patient field emptied", `{"patient": {"last_name": " "}}`, patients.AddPatientRequest{}, "patient.last_name cannot be empty"},
+		{"patient_id changed", `{"patient": {"patient_id": "P002"}}`, patients.AddPatientRequest{}, "patient.patient_id cannot be changed"},
+		{"health_insurance read only", `{"patient": {"health_insurance": true}}`, patients.AddPatientRequest{},
+			"patient.health_insurance is read only, it follows the insurance policies"},
+		{"age not positive", `{"patient": {"age": 0}}`, patients.AddPatientRequest{}, "patient.age must be a positive whole number"},
+		{"bad date_of_birth", `{"patient": {"date_of_birth": "01/02/1980"}}`, patients.AddPatientRequest{}, "patient.date_of_birth must be YYYY-MM-DD"},
+		{"list not an array", `{"patient_chronic_disease": "D001"}`, patients.AddPatientRequest{}, "patient_chronic_disease must be an array of objects"},
+		{"invalid allergy", `{"patient_drug_allergy": [{"drug_id": "D1", "drug_class_id": "C1"}]}`, patients.AddPatientRequest{},
+			"patient_drug_allergy[0] must have either drug_id or drug_class_id, not both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patientPatchRequest("P001", mustPatch(t, tt.patch))
+			if tt.wantErr != "" {
+				var patchErr *PatchError
+				if !errors.As(err, &patchErr) || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want PatchError %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patientPatchRequest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmployeePatchData(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{"empty patch", `{}`, map[string]interface{}{}, ""},
+		{"unchanged employee_id", `{"employee_id": "E001"}`, map[string]interface{}{}, ""},
+		{"fields set", `{"first_name": "Malee", "work_status": "no", "salary": 25000.5, "hire_date": "2020-01-15"}`,
+			map[string]interface{}{"first_name": "Malee", "work_status": "no", "salary": 25000.5, "hire_date": "2020-01-15"}, ""},
+		{"resignation_date null clears it", `{"resignation_date": null}`, map[string]interface{}{"resignation_date": nil}, ""},
+		{"resignation_date set", `{"resignation_date": "2024-01-31"}`, map[string]interface{}{"resignation_date": "2024-01-31"}, ""},
+		{"employee_id changed", `{"employee_id": "E002"}`, nil, "employee_id cannot be changed"},
+		{"required field removed", `{"hire_date": null}`, nil, "hire_date cannot be removed"},
+		{"empty string", `{"first_name": ""}`, nil, "first_name cannot be empty"},
+		{"not a string", `{"email": 5}`, nil, "email must be a string"},
+		{"bad date", `{"hire_date": "15/01/2020"}`, nil, "hire_date must be YYYY-MM-DD"},
+		{"bad work_status", `{"work_status": "maybe"}`, nil, "work_status must be yes or no"},
+		{"salary null", `{"salary": null}`, nil, "salary must be a positive number"},
+		{"salary not positive", `{"salary": 0}`, nil, "salary must be a positive number"},
+		{"unknown member", `{"department_id": "D1"}`, nil, `unknown member "department_id"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := employeePatchData("E001", mustPatch(t, tt.patch))
+			if tt.wantErr != "" {
+				var patchErr *PatchError
+				if !errors.As(err, &patchErr) || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want PatchError %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("employeePatchData = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
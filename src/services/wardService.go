@@ -0,0 +1,196 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+)
+
+// Bed counts per ward, used as sub-selects so wards without beds still show up
+const wardTotalBedsColumn = "(SELECT COUNT(*) FROM Bed b WHERE b.ward_id = Ward.ward_id) AS total_beds"
+const wardOccupiedBedsColumn = "(SELECT COUNT(*) FROM Bed b WHERE b.ward_id = Ward.ward_id AND b.status = 'occupied') AS occupied_beds"
+const wardAvailableBedsColumn = "(SELECT COUNT(*) FROM Bed b WHERE b.ward_id = Ward.ward_id AND b.status = 'available') AS available_beds"
+
+func GetWards(departmentID string) ([]models.WardResponse, error) {
+	fields := []string{"Ward.ward_id", "Ward.ward_name", "Ward.department_id", "Department.department_name", wardTotalBedsColumn, wardOccupiedBedsColumn, wardAvailableBedsColumn}
+	join := "Department ON Ward.department_id = Department.department_id"
+
+	var results []map[string]interface{}
+	var err error
+	if departmentID != "" {
+		results, err = SelectData("Ward", fields, true, "Ward.department_id = $1", []interface{}{departmentID}, true, join, "", "ORDER BY Ward.ward_id")
+	} else {
+		results, err = SelectData("Ward", fields, false, "", nil, true, join, "", "ORDER BY Ward.ward_id")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wards := []models.WardResponse{}
+	for _, row := range results {
+		wards = append(wards, models.WardResponse{
+			Ward_id:         row["ward_id"].(string),
+			Ward_name:       row["ward_name"].(string),
+			Department_id:   row["department_id"].(string),
+			Department_name: row["department_name"].(string),
+			Total_beds:      int(row["total_beds"].(int64)),
+			Occupied_beds:   int(row["occupied_beds"].(int64)),
+			Available_beds:  int(row["available_beds"].(int64)),
+		})
+	}
+
+	return wards, nil
+}
+
+func AddWard(req models.Ward) error {
+	if err := checkDepartmentExists(req.Department_id); err != nil {
+		return err
+	}
+
+	existing, err := SelectData("Ward", []string{"ward_id"}, true, "ward_id = $1", []interface{}{req.Ward_id}, false, "", "", "")
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("ward already exists")
+	}
+
+	_, err = InsertData("Ward", map[string]interface{}{
+		"ward_id":       req.Ward_id,
+		"ward_name":     req.Ward_name,
+		"department_id": req.Department_id,
+	})
+	return err
+}
+
+// GetWardBeds lists the beds of a ward with the patient currently in each bed
+func GetWardBeds(wardID string) ([]models.BedResponse, error) {
+	ward, err := SelectData("Ward", []string{"ward_id"}, true, "ward_id = $1", []interface{}{wardID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(ward) == 0 {
+		return nil, fmt.Errorf("ward not found")
+	}
+
+	current := "(SELECT admission_id FROM Bed_assignment WHERE Bed_assignment.bed_id = Bed.bed_id AND released_at IS NULL)"
+	fields := []string{
+		"bed_id",
+		"ward_id",
+		"bed_number",
+		"status",
+		current + " AS admission_id",
+		"(SELECT patient_id FROM Admission WHERE Admission.admission_id = " + current + ") AS patient_id",
+		"(SELECT first_name || ' ' || last_name FROM Patient WHERE Patient.patient_id = (SELECT patient_id FROM Admission WHERE Admission.admission_id = " + current + ")) AS patient_name",
+	}
+	results, err := SelectData("Bed", fields, true, "ward_id = $1", []interface{}{wardID}, false, "", "", "ORDER BY bed_number")
+	if err != nil {
+		return nil, err
+	}
+
+	beds := []models.BedResponse{}
+	for _, row := range results {
+		bed := models.BedResponse{
+			Bed_id:       row["bed_id"].(int64),
+			Ward_id:      row["ward_id"].(string),
+			Bed_number:   row["bed_number"].(string),
+			Status:       stringOrEmpty(row["status"]),
+			Patient_id:   stringOrEmpty(row["patient_id"]),
+			Patient_name: stringOrEmpty(row["patient_name"]),
+		}
+		if admissionID, ok := row["admission_id"].(int64); ok {
+			bed.Admission_id = &admissionID
+		}
+		beds = append(beds, bed)
+	}
+
+	return beds, nil
+}
+
+// AddBed adds an available bed to a ward and returns its id
+func AddBed(wardID string, bedNumber string) (int64, error) {
+	ward, err := SelectData("Ward", []string{"ward_id"}, true, "ward_id = $1", []interface{}{wardID}, false, "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if len(ward) == 0 {
+		return 0, fmt.Errorf("ward not found")
+	}
+
+	id, err := InsertDataReturning("Bed", map[string]interface{}{"ward_id": wardID, "bed_number": bedNumber}, "bed_id")
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("bed number already exists in this ward")
+		}
+		return 0, err
+	}
+
+	return id.(int64), nil
+}
+
+// UpdateBedStatus sets a free bed to available, cleaning or maintenance. The row is locked so it cannot race with an admission
+func UpdateBedStatus(bedID int64, status string) error {
+	return WithTransaction(func(tx *sql.Tx) error {
+		bed, err := SelectDataTx(tx, "Bed", []string{"bed_id", "status"}, true, "bed_id = $1", []interface{}{bedID}, false, "", "", "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if len(bed) == 0 {
+			return fmt.Errorf("bed not found")
+		}
+		if stringOrEmpty(bed[0]["status"]) == "occupied" {
+			return fmt.Errorf("bed is occupied")
+		}
+
+		_, err = UpdateDataTx(tx, "Bed", map[string]interface{}{"status": status}, "bed_id = $1", []interface{}{bed[0]["bed_id"]})
+		return err
+	})
+}
+
+// GetBedOccupancy counts beds by status for every department that has wards, departmentID = "" returns all of them
+func GetBedOccupancy(departmentID string) ([]models.DepartmentOccupancy, error) {
+	fields := []string{
+		"Department.department_id",
+		"Department.department_name",
+		"COUNT(DISTINCT Ward.ward_id) AS wards",
+		"COUNT(Bed.bed_id) AS total_beds",
+		"COUNT(Bed.bed_id) FILTER (WHERE Bed.status = 'occupied') AS occupied",
+		"COUNT(Bed.bed_id) FILTER (WHERE Bed.status = 'available') AS available",
+		"COUNT(Bed.bed_id) FILTER (WHERE Bed.status = 'cleaning') AS cleaning",
+		"COUNT(Bed.bed_id) FILTER (WHERE Bed.status = 'maintenance') AS maintenance",
+	}
+	join := "Ward ON Ward.department_id = Department.department_id JOIN Bed ON Bed.ward_id = Ward.ward_id"
+	groupBy := "GROUP BY Department.department_id, Department.department_name ORDER BY Department.department_id"
+
+	var results []map[string]interface{}
+	var err error
+	if departmentID != "" {
+		results, err = SelectData("Department", fields, true, "Department.department_id = $1", []interface{}{departmentID}, true, join, "", groupBy)
+	} else {
+		results, err = SelectData("Department", fields, false, "", nil, true, join, "", groupBy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	occupancy := []models.DepartmentOccupancy{}
+	for _, row := range results {
+		department := models.DepartmentOccupancy{
+			Department_id:   row["department_id"].(string),
+			Department_name: row["department_name"].(string),
+			Wards:           int(row["wards"].(int64)),
+			Total_beds:      int(row["total_beds"].(int64)),
+			Occupied:        int(row["occupied"].(int64)),
+			Available:       int(row["available"].(int64)),
+			Cleaning:        int(row["cleaning"].(int64)),
+			Maintenance:     int(row["maintenance"].(int64)),
+		}
+		if department.Total_beds > 0 {
+			department.Occupancy_rate = float64(department.Occupied) / float64(department.Total_beds)
+		}
+		occupancy = append(occupancy, department)
+	}
+
+	return occupancy, nil
+}
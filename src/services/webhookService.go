@@ -0,0 +1,443 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/NinePTH/GO_MVC-S/src/models"
+	"github.com/lib/pq"
+)
+
+// Webhook settings, overridden from the environment by StartWebhookDispatcher:
+//
+//	WEBHOOK_MAX_ATTEMPTS   deliveries tried before they are marked failed
+//	WEBHOOK_POLL_INTERVAL  how often the outbox and due deliveries are looked at, e.g. "10s"
+//	WEBHOOK_TIMEOUT        how long a subscriber has to answer, e.g. "10s"
+var (
+	webhookMaxAttempts  = 8
+	webhookPollInterval = 10 * time.Second
+	webhookTimeout      = 10 * time.Second
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookBatchSize    = 50
+	webhookResponseMax  = 1024 // bytes of the subscriber's answer kept in the delivery log
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+func loadWebhookSettings() {
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		if attempts, err := strconv.Atoi(raw); err == nil && attempts > 0 {
+			webhookMaxAttempts = attempts
+		}
+	}
+	if raw := os.Getenv("WEBHOOK_POLL_INTERVAL"); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			webhookPollInterval = interval
+		}
+	}
+	if raw := os.Getenv("WEBHOOK_TIMEOUT"); raw != "" {
+		if timeout, err := time.ParseDuration(raw); err == nil && timeout > 0 {
+			webhookTimeout = timeout
+		}
+	}
+	webhookClient.Timeout = webhookTimeout
+}
+
+// StartWebhookDispatcher loads the webhook settings and schedules the "webhooks.dispatch" job, which fans new outbox
+// events out to the subscriptions and sends the due deliveries
+func StartWebhookDispatcher() {
+	loadWebhookSettings()
+	RegisterJobSchedule("webhooks-dispatch", "webhooks.dispatch", webhookPollInterval)
+}
+
+func init() {
+	RegisterJobHandler("webhooks.dispatch", func(payload json.RawMessage) (interface{}, error) {
+		queued, err := DispatchOutbox()
+		if err != nil {
+			return nil, err
+		}
+		sent, err := DeliverDueWebhooks()
+		return map[string]int{"deliveries_queued": queued, "deliveries_handled": sent}, err
+	})
+}
+
+// WebhookSignature is the X-Webhook-Signature header of a delivery: "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">".
+// Receivers recompute it with their secret and reject old timestamps to stop replays
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func subscriptionWantsEvent(eventTypes []string, eventType string) bool {
+	if len(eventTypes) == 0 {
+		return true
+	}
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DispatchOutbox creates a pending delivery per active subscription for every event not dispatched yet, and marks
+// the events dispatched. It returns how many deliveries were queued
+func DispatchOutbox() (int, error) {
+	queued := 0
+	for {
+		found := 0
+		err := WithTransaction(func(tx *sql.Tx) error {
+			events, err := SelectDataTx(tx, "Outbox_event", []string{"event_id", "event_type"}, true, "dispatched_at IS NULL", nil, false, "", "",
+				fmt.Sprintf("ORDER BY event_id LIMIT %d FOR UPDATE SKIP LOCKED", webhookBatchSize))
+			if err != nil || len(events) == 0 {
+				return err
+			}
+			found = len(events)
+
+			subscriptions, err := SelectDataTx(tx, "Webhook_subscription", []string{"subscription_id", "event_types"}, true, "is_active", nil, false, "", "", "")
+			if err != nil {
+				return err
+			}
+
+			eventIDs := []int64{}
+			for _, event := range events {
+				eventIDs = append(eventIDs, event["event_id"].(int64))
+				for _, subscription := range subscriptions {
+					var eventTypes pq.StringArray
+					if err := eventTypes.Scan(subscription["event_types"]); err != nil {
+						return err
+					}
+					if !subscriptionWantsEvent(eventTypes, event["event_type"].(string)) {
+						continue
+					}
+					_, err := InsertDataTx(tx, "Webhook_delivery", map[string]interface{}{
+						"subscription_id": subscription["subscription_id"],
+						"event_id":        event["event_id"],
+						"next_attempt_at": time.Now(),
+					})
+					if err != nil {
+						return fmt.Errorf("insert webhook delivery failed: %w", err)
+					}
+					queued++
+				}
+			}
+
+			_, err = UpdateDataTx(tx, "Outbox_event", map[string]interface{}{"dispatched_at": time.Now()}, "event_id = ANY($1)", []interface{}{pq.Array(eventIDs)})
+			return err
+		})
+		if err != nil {
+			return queued, err
+		}
+		if found < webhookBatchSize {
+			return queued, nil
+		}
+	}
+}
+
+var dueDeliveryFields = []string{
+	"Webhook_delivery.delivery_id",
+	"Webhook_delivery.event_id",
+	"Webhook_delivery.attempts",
+	"Webhook_subscription.url",
+	"Webhook_subscription.secret",
+}
+
+// DeliverDueWebhooks sends the deliveries that are due, one transaction per delivery like the appointment reminders.
+// Deliveries of paused subscriptions wait until the subscription is active again. It returns how many were handled
+func DeliverDueWebhooks() (int, error) {
+	handled := 0
+	for handled < webhookBatchSize {
+		found := false
+		err := WithTransaction(func(tx *sql.Tx) error {
+			results, err := SelectDataTx(tx, "Webhook_delivery", dueDeliveryFields, true,
+				"Webhook_delivery.status = 'pending' AND Webhook_delivery.next_attempt_at <= $1 AND Webhook_subscription.is_active", []interface{}{time.Now()},
+				true, "Webhook_subscription", "Webhook_delivery.subscription_id = Webhook_subscription.subscription_id",
+				"ORDER BY Webhook_delivery.next_attempt_at LIMIT 1 FOR UPDATE OF Webhook_delivery SKIP LOCKED")
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				return nil
+			}
+			found = true
+			return deliverWebhookTx(tx, results[0])
+		})
+		if err != nil {
+			return handled, err
+		}
+		if !found {
+			break
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// webhookBody is what subscribers receive. Events about a patient who has not granted data_sharing consent (checked at
+// send time) carry only the ids, with redacted set
+type webhookBody struct {
+	Event_id    int64           `json:"event_id"`
+	Event_type  string          `json:"event_type"`
+	Occurred_at string          `json:"occurred_at"`
+	Redacted    bool            `json:"redacted,omitempty"`
+	Data        json.RawMessage `json:"data"`
+}
+
+func webhookBodyTx(tx *sql.Tx, eventID int64) ([]byte, string, error) {
+	results, err := SelectDataTx(tx, "Outbox_event", []string{"*"}, true, "event_id = $1", []interface{}{eventID}, false, "", "", "")
+	if err != nil {
+		return nil, "", err
+	}
+	if len(results) == 0 {
+		return nil, "", fmt.Errorf("event not found")
+	}
+	event := domainEventFromRow(results[0])
+
+	body := webhookBody{
+		Event_id:    event.Event_id,
+		Event_type:  event.Event_type,
+		Occurred_at: event.Occurred_at,
+		Data:        event.Payload,
+	}
+	if event.Patient_id != "" {
+		shared, err := HasConsent(event.Patient_id, ConsentDataSharing)
+		if err != nil {
+			return nil, "", err
+		}
+		if !shared {
+			ids := map[string]string{"patient_id": event.Patient_id, event.Aggregate_type + "_id": event.Aggregate_id}
+			body.Redacted = true
+			body.Data, _ = json.Marshal(ids)
+		}
+	}
+
+	raw, err := json.Marshal(body)
+	return raw, event.Event_type, err
+}
+
+// deliverWebhookTx sends one locked delivery and records the outcome. A 2xx answer is a success, anything else is retried
+// with backoff until WEBHOOK_MAX_ATTEMPTS
+func deliverWebhookTx(tx *sql.Tx, row map[string]interface{}) error {
+	deliveryID := row["delivery_id"].(int64)
+	attempts := int(row["attempts"].(int64)) + 1
+
+	body, eventType, err := webhookBodyTx(tx, row["event_id"].(int64))
+	if err != nil {
+		return err
+	}
+
+	statusCode, response, sendErr := sendWebhook(row["url"].(string), row["secret"].(string), deliveryID, row["event_id"].(int64), eventType, body)
+
+	now := time.Now()
+	data := map[string]interface{}{
+		"attempts":         attempts,
+		"last_status_code": nil,
+		"response_body":    nullIfEmpty(response),
+	}
+	if statusCode != 0 {
+		data["last_status_code"] = statusCode
+	}
+	switch {
+	case sendErr == nil:
+		data["status"] = "delivered"
+		data["delivered_at"] = now
+		data["last_error"] = nil
+	case attempts >= webhookMaxAttempts:
+		data["status"] = "failed"
+		data["last_error"] = sendErr.Error()
+	default:
+		data["next_attempt_at"] = now.Add(exponentialBackoff(webhookBaseBackoff, webhookMaxBackoff, attempts))
+		data["last_error"] = sendErr.Error()
+	}
+
+	_, err = UpdateDataTx(tx, "Webhook_delivery", data, "delivery_id = $1", []interface{}{deliveryID})
+	return err
+}
+
+// sendWebhook POSTs body to url and returns the status code and the start of the answer
+func sendWebhook(url string, secret string, deliveryID int64, eventID int64, eventType string, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hospital-webhooks/1")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Event-Id", strconv.FormatInt(eventID, 10))
+	req.Header.Set("X-Webhook-Delivery-Id", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Webhook-Signature", WebhookSignature(secret, time.Now().Unix(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, int64(webhookResponseMax)))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(answer), fmt.Errorf("subscriber answered %s", resp.Status)
+	}
+	return resp.StatusCode, string(answer), nil
+}
+
+func webhookSubscriptionFromRow(row map[string]interface{}) (models.WebhookSubscription, error) {
+	var eventTypes pq.StringArray
+	if err := eventTypes.Scan(row["event_types"]); err != nil {
+		return models.WebhookSubscription{}, err
+	}
+	return models.WebhookSubscription{
+		Subscription_id: row["subscription_id"].(int64),
+		Url:             row["url"].(string),
+		Event_types:     []string(eventTypes),
+		Description:     stringOrEmpty(row["description"]),
+		Is_active:       row["is_active"].(bool),
+		Created_at:      timeOrEmpty(row["created_at"]),
+	}, nil
+}
+
+var webhookSubscriptionFields = []string{"subscription_id", "url", "event_types", "description", "is_active", "created_at"}
+
+func GetWebhookSubscriptions() ([]models.WebhookSubscription, error) {
+	results, err := SelectData("Webhook_subscription", webhookSubscriptionFields, false, "", nil, false, "", "", "ORDER BY subscription_id")
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []models.WebhookSubscription{}
+	for _, row := range results {
+		subscription, err := webhookSubscriptionFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// AddWebhookSubscription registers an endpoint. The returned subscription holds the secret, the only time it is shown
+func AddWebhookSubscription(req models.AddWebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	eventTypes := req.Event_types
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	id, err := InsertDataReturning("Webhook_subscription", map[string]interface{}{
+		"url":         req.Url,
+		"secret":      secret,
+		"event_types": pq.Array(eventTypes),
+		"description": nullIfEmpty(req.Description),
+	}, "subscription_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookSubscription{
+		Subscription_id: id.(int64),
+		Url:             req.Url,
+		Secret:          secret,
+		Event_types:     eventTypes,
+		Description:     req.Description,
+		Is_active:       true,
+		Created_at:      time.Now().Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+func UpdateWebhookSubscription(id int64, data map[string]interface{}) (int64, error) {
+	return UpdateData("Webhook_subscription", data, "subscription_id = $1", []interface{}{id})
+}
+
+// DeleteWebhookSubscription removes the subscription and its delivery log
+func DeleteWebhookSubscription(id int64) (int64, error) {
+	return DeleteData("Webhook_subscription", "subscription_id = $1", []interface{}{id})
+}
+
+// GetWebhookDeliveries lists the delivery log of a subscription newest first, filtered by status when given
+func GetWebhookDeliveries(subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	subscription, err := SelectData("Webhook_subscription", []string{"subscription_id"}, true, "subscription_id = $1", []interface{}{subscriptionID}, false, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(subscription) == 0 {
+		return nil, fmt.Errorf("webhook subscription not found")
+	}
+
+	whereCon := "Webhook_delivery.subscription_id = $1"
+	args := []interface{}{subscriptionID}
+	if status != "" {
+		whereCon += " AND Webhook_delivery.status::text = $2"
+		args = append(args, status)
+	}
+	fields := []string{"Webhook_delivery.*", "Outbox_event.event_type"}
+	results, err := SelectData("Webhook_delivery", fields, true, whereCon, args, true, "Outbox_event", "Webhook_delivery.event_id = Outbox_event.event_id",
+		fmt.Sprintf("ORDER BY Webhook_delivery.delivery_id DESC LIMIT %d", limit))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for _, row := range results {
+		delivery := models.WebhookDelivery{
+			Delivery_id:     row["delivery_id"].(int64),
+			Subscription_id: row["subscription_id"].(int64),
+			Event_id:        row["event_id"].(int64),
+			Event_type:      row["event_type"].(string),
+			Status:          stringOrEmpty(row["status"]),
+			Attempts:        int(row["attempts"].(int64)),
+			Next_attempt_at: timeOrEmpty(row["next_attempt_at"]),
+			Last_error:      stringOrEmpty(row["last_error"]),
+			Response_body:   stringOrEmpty(row["response_body"]),
+			Created_at:      timeOrEmpty(row["created_at"]),
+			Delivered_at:    timeOrEmpty(row["delivered_at"]),
+		}
+		if code, ok := row["last_status_code"].(int64); ok {
+			delivery.Last_status_code = int(code)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery gives a failed delivery a fresh set of attempts, starting now
+func RetryWebhookDelivery(deliveryID int64) error {
+	rowsAffected, err := UpdateData("Webhook_delivery", map[string]interface{}{
+		"status":          "pending",
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}, "delivery_id = $1 AND status = 'failed'", []interface{}{deliveryID})
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		results, err := SelectData("Webhook_delivery", []string{"delivery_id"}, true, "delivery_id = $1", []interface{}{deliveryID}, false, "", "", "")
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("webhook delivery not found")
+		}
+		return fmt.Errorf("only failed deliveries can be retried")
+	}
+	return nil
+}
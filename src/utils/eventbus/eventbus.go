@@ -0,0 +1,135 @@
+// Package eventbus is the in-process publish / subscribe bus behind the real-time endpoints. Services publish an
+// event after their transaction commits, subscribers (SSE streams) receive the events of the topics they follow.
+// Topics are hierarchical with ":" as separator, following "queue" receives "queue:D001", "queue:D002", ...
+//
+// The bus lives in one server process: a client only sees events published by the instance it is connected to
+package eventbus
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is one change pushed to subscribers
+type Event struct {
+	ID    int64       `json:"id"`
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data"`
+	Time  string      `json:"time"`
+}
+
+const (
+	subscriberBuffer = 64  // events a subscriber may lag behind before it is dropped
+	replaySize       = 500 // recent events kept for clients reconnecting with Last-Event-ID
+)
+
+// Subscription receives the events of its topics on Events until Done is closed
+type Subscription struct {
+	topics []string
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[*Subscription]struct{}{}
+	nextID      int64
+	recent      []Event
+)
+
+// Matches reports whether an event published on eventTopic is delivered to a subscriber of topic
+func Matches(topic string, eventTopic string) bool {
+	return eventTopic == topic || strings.HasPrefix(eventTopic, topic+":")
+}
+
+func (s *Subscription) matches(eventTopic string) bool {
+	for _, topic := range s.topics {
+		if Matches(topic, eventTopic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Events is the channel the subscription's events arrive on
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the subscription ends, either by Close or because the subscriber fell too far behind
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	mu.Lock()
+	delete(subscribers, s)
+	mu.Unlock()
+	s.once.Do(func() { close(s.done) })
+}
+
+// Subscribe follows topics. When lastEventID is not 0, the recent events after it that match the topics are
+// returned so a reconnecting client does not miss what happened while it was away
+func Subscribe(topics []string, lastEventID int64) (*Subscription, []Event) {
+	s := &Subscription{
+		topics: topics,
+		events: make(chan Event, subscriberBuffer),
+		done:   make(chan struct{}),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	subscribers[s] = struct{}{}
+
+	missed := []Event{}
+	if lastEventID > 0 {
+		for _, event := range recent {
+			if event.ID > lastEventID && s.matches(event.Topic) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	return s, missed
+}
+
+// Publish sends an event to every subscriber of topic. It never blocks: a subscriber whose buffer is full is
+// dropped, its client reconnects and catches up from the replay buffer
+func Publish(topic string, eventType string, data interface{}) {
+	mu.Lock()
+	nextID++
+	event := Event{
+		ID:    nextID,
+		Topic: topic,
+		Type:  eventType,
+		Data:  data,
+		Time:  time.Now().Format("2006-01-02 15:04:05"),
+	}
+	recent = append(recent, event)
+	if len(recent) > replaySize {
+		recent = recent[len(recent)-replaySize:]
+	}
+
+	var slow []*Subscription
+	for s := range subscribers {
+		if !s.matches(topic) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	for _, s := range slow {
+		delete(subscribers, s)
+	}
+	mu.Unlock()
+
+	for _, s := range slow {
+		s.once.Do(func() { close(s.done) })
+	}
+}
@@ -0,0 +1,348 @@
+// Package hl7 reads and writes HL7 v2 messages (ER7, the pipe and hat encoding) and builds their acknowledgements.
+// It knows the message structure only (segments, fields, repetitions, components, escapes); the meaning of the
+// segments is up to the caller. Field numbers are 1-based as in the HL7 tables, so Field(3) of PID is PID-3
+package hl7
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delimiters are the separators declared in MSH-1 and MSH-2
+type Delimiters struct {
+	FieldSep        byte
+	ComponentSep    byte
+	RepetitionSep   byte
+	EscapeChar      byte
+	SubcomponentSep byte
+}
+
+// DefaultDelimiters are |^~\& used for every message this package creates
+var DefaultDelimiters = Delimiters{FieldSep: '|', ComponentSep: '^', RepetitionSep: '~', EscapeChar: '\\', SubcomponentSep: '&'}
+
+func (d Delimiters) encodingCharacters() string {
+	return string([]byte{d.ComponentSep, d.RepetitionSep, d.EscapeChar, d.SubcomponentSep})
+}
+
+// Escape replaces the delimiters in a value by their escape sequences (\F\, \S\, \R\, \E\, \T\)
+func (d Delimiters) Escape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case d.EscapeChar:
+			b.WriteString(string(d.EscapeChar) + "E" + string(d.EscapeChar))
+		case d.FieldSep:
+			b.WriteString(string(d.EscapeChar) + "F" + string(d.EscapeChar))
+		case d.ComponentSep:
+			b.WriteString(string(d.EscapeChar) + "S" + string(d.EscapeChar))
+		case d.RepetitionSep:
+			b.WriteString(string(d.EscapeChar) + "R" + string(d.EscapeChar))
+		case d.SubcomponentSep:
+			b.WriteString(string(d.EscapeChar) + "T" + string(d.EscapeChar))
+		case '\r', '\n':
+			b.WriteString(string(d.EscapeChar) + ".br" + string(d.EscapeChar))
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// Unescape is the opposite of Escape. Hexadecimal (\Xhh\) sequences are decoded, formatting sequences other
+// than \.br\ are dropped
+func (d Delimiters) Unescape(value string) string {
+	if strings.IndexByte(value, d.EscapeChar) < 0 {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != d.EscapeChar {
+			b.WriteByte(value[i])
+			continue
+		}
+		end := strings.IndexByte(value[i+1:], d.EscapeChar)
+		if end < 0 {
+			b.WriteString(value[i:]) // unterminated, keep as is
+			break
+		}
+		sequence := value[i+1 : i+1+end]
+		switch {
+		case sequence == "F":
+			b.WriteByte(d.FieldSep)
+		case sequence == "S":
+			b.WriteByte(d.ComponentSep)
+		case sequence == "R":
+			b.WriteByte(d.RepetitionSep)
+		case sequence == "E":
+			b.WriteByte(d.EscapeChar)
+		case sequence == "T":
+			b.WriteByte(d.SubcomponentSep)
+		case sequence == ".br":
+			b.WriteByte('\n')
+		case strings.HasPrefix(sequence, "X"):
+			if decoded, err := hex.DecodeString(sequence[1:]); err == nil {
+				b.Write(decoded)
+			}
+		}
+		i += end + 1
+	}
+	return b.String()
+}
+
+// Join escapes components and joins them into one field value, trailing empty components are left out
+func (d Delimiters) Join(components ...string) string {
+	for len(components) > 0 && components[len(components)-1] == "" {
+		components = components[:len(components)-1]
+	}
+	escaped := make([]string, len(components))
+	for i, component := range components {
+		escaped[i] = d.Escape(component)
+	}
+	return strings.Join(escaped, string(d.ComponentSep))
+}
+
+// Repetitions splits a raw field on the repetition separator
+func (d Delimiters) Repetitions(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, string(d.RepetitionSep))
+}
+
+// Component returns component n (1-based) of a raw field or repetition, unescaped. A repeating field gives its first repetition
+func (d Delimiters) Component(raw string, n int) string {
+	if i := strings.IndexByte(raw, d.RepetitionSep); i >= 0 {
+		raw = raw[:i]
+	}
+	components := strings.Split(raw, string(d.ComponentSep))
+	if n < 1 || n > len(components) {
+		return ""
+	}
+	return d.Unescape(components[n-1])
+}
+
+// Segment is one line of a message. Fields[0] is the segment name, Fields[i] is field i still escaped.
+// For MSH, Fields[1] is the field separator and Fields[2] the encoding characters as the standard counts them
+type Segment struct {
+	Fields []string
+}
+
+func (s Segment) Name() string {
+	if len(s.Fields) == 0 {
+		return ""
+	}
+	return s.Fields[0]
+}
+
+// Field returns raw field i, "" when the segment is shorter
+func (s Segment) Field(i int) string {
+	if i < 0 || i >= len(s.Fields) {
+		return ""
+	}
+	return s.Fields[i]
+}
+
+// Message is a parsed HL7 v2 message
+type Message struct {
+	Delimiters Delimiters
+	Segments   []Segment
+}
+
+// Parse reads an ER7 message. Segments may end with \r (the standard), \n or \r\n
+func Parse(raw string) (*Message, error) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\r")
+	raw = strings.ReplaceAll(raw, "\n", "\r")
+	raw = strings.Trim(raw, "\r")
+	if !strings.HasPrefix(raw, "MSH") || len(raw) < 8 {
+		return nil, fmt.Errorf("message must start with an MSH segment")
+	}
+
+	d := Delimiters{FieldSep: raw[3], ComponentSep: raw[4], RepetitionSep: raw[5], EscapeChar: raw[6], SubcomponentSep: raw[7]}
+	if d.FieldSep == d.ComponentSep || d.FieldSep == d.RepetitionSep || d.FieldSep == d.EscapeChar || d.FieldSep == d.SubcomponentSep {
+		return nil, fmt.Errorf("invalid encoding characters in MSH-2")
+	}
+
+	msg := &Message{Delimiters: d}
+	for i, line := range strings.Split(raw, "\r") {
+		if line == "" {
+			continue
+		}
+		if len(line) < 3 {
+			return nil, fmt.Errorf("segment %d is too short", i+1)
+		}
+		if i == 0 {
+			// MSH-1 is the field separator itself, so the fields start after it
+			rest := strings.Split(line[4:], string(d.FieldSep))
+			msg.Segments = append(msg.Segments, Segment{Fields: append([]string{"MSH", string(d.FieldSep)}, rest...)})
+			continue
+		}
+		msg.Segments = append(msg.Segments, Segment{Fields: strings.Split(line, string(d.FieldSep))})
+	}
+	return msg, nil
+}
+
+// NewMessage starts a message with default delimiters and an MSH segment, fields are MSH-3 onwards (already joined)
+func NewMessage(fields ...string) *Message {
+	msg := &Message{Delimiters: DefaultDelimiters}
+	msh := append([]string{"MSH", string(DefaultDelimiters.FieldSep), DefaultDelimiters.encodingCharacters()}, fields...)
+	msg.Segments = append(msg.Segments, Segment{Fields: msh})
+	return msg
+}
+
+// Add appends a segment, fields are field 1 onwards (already joined with Delimiters.Join)
+func (m *Message) Add(name string, fields ...string) {
+	m.Segments = append(m.Segments, Segment{Fields: append([]string{name}, fields...)})
+}
+
+// Segment returns the first segment named name
+func (m *Message) Segment(name string) (Segment, bool) {
+	for _, segment := range m.Segments {
+		if segment.Name() == name {
+			return segment, true
+		}
+	}
+	return Segment{}, false
+}
+
+// SegmentsNamed returns every segment named name, in message order
+func (m *Message) SegmentsNamed(name string) []Segment {
+	segments := []Segment{}
+	for _, segment := range m.Segments {
+		if segment.Name() == name {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// Get returns component (1-based) of the first repetition of field in the first segment named name, unescaped
+func (m *Message) Get(name string, field int, component int) string {
+	segment, ok := m.Segment(name)
+	if !ok {
+		return ""
+	}
+	return m.Delimiters.Component(segment.Field(field), component)
+}
+
+// Type returns the message type and trigger event of MSH-9, e.g. "ADT", "A01"
+func (m *Message) Type() (string, string) {
+	return m.Get("MSH", 9, 1), m.Get("MSH", 9, 2)
+}
+
+// ControlID is MSH-10, echoed in the acknowledgement
+func (m *Message) ControlID() string {
+	return m.Get("MSH", 10, 1)
+}
+
+// String encodes the message with \r between segments
+func (m *Message) String() string {
+	lines := make([]string, 0, len(m.Segments))
+	for _, segment := range m.Segments {
+		if segment.Name() == "MSH" && len(segment.Fields) > 2 {
+			lines = append(lines, "MSH"+string(m.Delimiters.FieldSep)+strings.Join(segment.Fields[2:], string(m.Delimiters.FieldSep)))
+			continue
+		}
+		lines = append(lines, strings.Join(segment.Fields, string(m.Delimiters.FieldSep)))
+	}
+	return strings.Join(lines, "\r") + "\r"
+}
+
+// HL7 table 0357, message error condition codes
+const (
+	ErrSegmentSequence       = 100
+	ErrRequiredFieldMissing  = 101
+	ErrDataType              = 102
+	ErrTableValueNotFound    = 103
+	ErrUnsupportedMessage    = 200
+	ErrUnsupportedEvent      = 201
+	ErrUnsupportedProcessing = 202
+	ErrUnsupportedVersion    = 203
+	ErrUnknownKey            = 204
+	ErrDuplicateKey          = 205
+	ErrRecordLocked          = 206
+	ErrInternal              = 207
+)
+
+var errorCodeText = map[int]string{
+	ErrSegmentSequence:       "Segment sequence error",
+	ErrRequiredFieldMissing:  "Required field missing",
+	ErrDataType:              "Data type error",
+	ErrTableValueNotFound:    "Table value not found",
+	ErrUnsupportedMessage:    "Unsupported message type",
+	ErrUnsupportedEvent:      "Unsupported event code",
+	ErrUnsupportedProcessing: "Unsupported processing id",
+	ErrUnsupportedVersion:    "Unsupported version id",
+	ErrUnknownKey:            "Unknown key identifier",
+	ErrDuplicateKey:          "Duplicate key identifier",
+	ErrRecordLocked:          "Application record locked",
+	ErrInternal:              "Application internal error",
+}
+
+// Error is a processing error reported in the ERR segment of the acknowledgement, Segment and Field locate it (e.g. PID-8)
+type Error struct {
+	Code    int
+	Segment string
+	Field   int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Segment == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s-%d: %s", e.Segment, e.Field, e.Message)
+}
+
+// Rejects reports whether the error rejects the message as a whole (AR) rather than failing its processing (AE)
+func (e *Error) Rejects() bool {
+	return e.Code >= ErrUnsupportedMessage && e.Code <= ErrUnsupportedVersion
+}
+
+// Ack builds the original mode acknowledgement of msg: AA without errors, otherwise AE or AR (see Error.Rejects) with one
+// ERR segment per error. msg may be nil when it could not be parsed, the answer is then an AR without references
+func Ack(msg *Message, controlID string, now time.Time, errs ...*Error) *Message {
+	d := DefaultDelimiters
+	code, text := "AA", "Message accepted"
+	for _, err := range errs {
+		if err.Rejects() || msg == nil {
+			code = "AR"
+		} else if code == "AA" {
+			code = "AE"
+		}
+	}
+	if len(errs) > 0 {
+		text = errs[0].Error()
+	}
+
+	// The receiving side answers the sender: MSH-3/4 and MSH-5/6 swap places
+	var sendingApp, sendingFacility, receivingApp, receivingFacility, trigger, processingID, version, originalID string
+	processingID, version = "P", "2.5"
+	if msg != nil {
+		msh, _ := msg.Segment("MSH")
+		receivingApp, receivingFacility = msh.Field(3), msh.Field(4)
+		sendingApp, sendingFacility = msh.Field(5), msh.Field(6)
+		_, trigger = msg.Type()
+		if id := msg.Get("MSH", 11, 1); id != "" {
+			processingID = id
+		}
+		if v := msg.Get("MSH", 12, 1); v != "" {
+			version = v
+		}
+		originalID = msg.ControlID()
+	}
+
+	ack := NewMessage(sendingApp, sendingFacility, receivingApp, receivingFacility, now.Format("20060102150405"), "",
+		d.Join("ACK", trigger, "ACK"), d.Escape(controlID), d.Escape(processingID), d.Escape(version))
+	ack.Add("MSA", code, d.Escape(originalID), d.Escape(text))
+	for _, err := range errs {
+		location := ""
+		if err.Segment != "" {
+			location = d.Join(err.Segment, "1", fmt.Sprint(err.Field))
+		}
+		ack.Add("ERR", "", location, d.Join(fmt.Sprint(err.Code), errorCodeText[err.Code], "HL70357"), "E", "", "", "", d.Escape(err.Message))
+	}
+	return ack
+}
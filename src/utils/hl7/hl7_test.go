@@ -0,0 +1,258 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testADT = "MSH|^~\\&|REGADT|MCM|HOSPITAL_BACKEND|HOSPITAL|20240101120000||ADT^A04^ADT_A01|MSG00001|P|2.5\r" +
+	"EVN|A04|20240101120000\r" +
+	"PID|1||P001^^^MCM^MR~1234567890123^^^TH^NI||Doe^John||19940515|M|||123 Main St\\S\\Apt 4^^Cityville||0123456789^PRN^PH~^NET^Internet^john.doe@example.com\r"
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain text", "John Doe", "John Doe"},
+		{"field separator", "a|b", `a\F\b`},
+		{"component separator", "a^b", `a\S\b`},
+		{"repetition separator", "a~b", `a\R\b`},
+		{"escape character", `a\b`, `a\E\b`},
+		{"subcomponent separator", "a&b", `a\T\b`},
+		{"line breaks", "line 1\nline 2\rline 3", `line 1\.br\line 2\.br\line 3`},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultDelimiters.Escape(tt.value); got != tt.want {
+				t.Errorf("Escape(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain text", "John Doe", "John Doe"},
+		{"delimiters", `a\F\b\S\c\R\d\E\e\T\f`, `a|b^c~d\e&f`},
+		{"line break", `line 1\.br\line 2`, "line 1\nline 2"},
+		{"hexadecimal", `\X4142\C`, "ABC"},
+		{"invalid hexadecimal is dropped", `a\XZZ\b`, "ab"},
+		{"formatting sequence is dropped", `a\H\b\N\c`, "abc"},
+		{"unterminated sequence is kept", `a\F`, `a\F`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultDelimiters.Unescape(tt.value); got != tt.want {
+				t.Errorf("Unescape(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeRoundTrip(t *testing.T) {
+	for _, value := range []string{"", "plain", `|^~\&`, "Smith & Sons | Ltd ^ ~ \\", "two\nlines"} {
+		if got := DefaultDelimiters.Unescape(DefaultDelimiters.Escape(value)); got != value {
+			t.Errorf("Unescape(Escape(%q)) = %q", value, got)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		components []string
+		want       string
+	}{
+		{[]string{"Doe", "John"}, "Doe^John"},
+		{[]string{"Doe", "John", "", ""}, "Doe^John"},
+		{[]string{"", "John"}, "^John"},
+		{[]string{"A^B", "C"}, `A\S\B^C`},
+		{[]string{"", ""}, ""},
+	}
+	for _, tt := range tests {
+		if got := DefaultDelimiters.Join(tt.components...); got != tt.want {
+			t.Errorf("Join(%q) = %q, want %q", tt.components, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		segments []string
+		wantErr  string
+	}{
+		{"carriage returns", testADT, []string{"MSH", "EVN", "PID"}, ""},
+		{"new lines", strings.ReplaceAll(testADT, "\r", "\n"), []string{"MSH", "EVN", "PID"}, ""},
+		{"carriage return and new line", strings.ReplaceAll(testADT, "\r", "\r\n"), []string{"MSH", "EVN", "PID"}, ""},
+		{"empty lines are skipped", "\r\n" + strings.ReplaceAll(testADT, "\r", "\r\r"), []string{"MSH", "EVN", "PID"}, ""},
+		{"no MSH", "PID|1||P001", nil, "message must start with an MSH segment"},
+		{"MSH too short", "MSH|^~", nil, "message must start with an MSH segment"},
+		{"field separator reused", "MSH||~\\&|A", nil, "invalid encoding characters in MSH-2"},
+		{"short segment", "MSH|^~\\&|A\rPI", nil, "segment 2 is too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Parse(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var names []string
+			for _, segment := range msg.Segments {
+				names = append(names, segment.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.segments, ",") {
+				t.Errorf("segments = %v, want %v", names, tt.segments)
+			}
+		})
+	}
+}
+
+func TestMessageGet(t *testing.T) {
+	msg, err := Parse(testADT)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		segment   string
+		field     int
+		component int
+		want      string
+	}{
+		{"MSH", 1, 1, "|"},
+		{"MSH", 3, 1, "REGADT"},
+		{"MSH", 9, 3, "ADT_A01"},
+		{"EVN", 1, 1, "A04"},
+		{"PID", 3, 1, "P001"},
+		{"PID", 3, 5, "MR"},
+		{"PID", 5, 1, "Doe"},
+		{"PID", 5, 2, "John"},
+		{"PID", 11, 1, "123 Main St^Apt 4"},
+		{"PID", 11, 3, "Cityville"},
+		{"PID", 11, 9, ""},
+		{"PID", 30, 1, ""},
+		{"OBX", 5, 1, ""},
+	}
+	for _, tt := range tests {
+		if got := msg.Get(tt.segment, tt.field, tt.component); got != tt.want {
+			t.Errorf("Get(%s, %d, %d) = %q, want %q", tt.segment, tt.field, tt.component, got, tt.want)
+		}
+	}
+
+	if messageType, trigger := msg.Type(); messageType != "ADT" || trigger != "A04" {
+		t.Errorf("Type() = %q, %q, want ADT, A04", messageType, trigger)
+	}
+	if got := msg.ControlID(); got != "MSG00001" {
+		t.Errorf("ControlID() = %q, want MSG00001", got)
+	}
+
+	pid, _ := msg.Segment("PID")
+	repetitions := msg.Delimiters.Repetitions(pid.Field(3))
+	if len(repetitions) != 2 || msg.Delimiters.Component(repetitions[1], 1) != "1234567890123" {
+		t.Errorf("Repetitions(PID-3) = %q", repetitions)
+	}
+}
+
+func TestParseCustomDelimiters(t *testing.T) {
+	msg, err := Parse("MSH#:*!@#A#B\rPID#1##P001:::MCM:MR##Doe:John")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := msg.Get("PID", 5, 2); got != "John" {
+		t.Errorf("Get(PID, 5, 2) = %q, want John", got)
+	}
+	if got := msg.Get("PID", 3, 5); got != "MR" {
+		t.Errorf("Get(PID, 3, 5) = %q, want MR", got)
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	msg, err := Parse(testADT)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := msg.String(); got != testADT {
+		t.Errorf("String() = %q, want %q", got, testADT)
+	}
+}
+
+func TestAck(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	msg, err := Parse(testADT)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		msg  *Message
+		errs []*Error
+		want []string
+	}{
+		{
+			name: "accepted",
+			msg:  msg,
+			want: []string{
+				"MSH|^~\\&|HOSPITAL_BACKEND|HOSPITAL|REGADT|MCM|20240101123000||ACK^A04^ACK|ACK1|P|2.5",
+				"MSA|AA|MSG00001|Message accepted",
+			},
+		},
+		{
+			name: "processing error",
+			msg:  msg,
+			errs: []*Error{
+				{Code: ErrRequiredFieldMissing, Segment: "PID", Field: 7, Message: "date of birth is required"},
+				{Code: ErrTableValueNotFound, Segment: "PID", Field: 8, Message: "sex must be M|F"},
+			},
+			want: []string{
+				"MSH|^~\\&|HOSPITAL_BACKEND|HOSPITAL|REGADT|MCM|20240101123000||ACK^A04^ACK|ACK1|P|2.5",
+				"MSA|AE|MSG00001|PID-7: date of birth is required",
+				"ERR||PID^1^7|101^Required field missing^HL70357|E||||date of birth is required",
+				"ERR||PID^1^8|103^Table value not found^HL70357|E||||sex must be M\\F\\F",
+			},
+		},
+		{
+			name: "rejected",
+			msg:  msg,
+			errs: []*Error{{Code: ErrUnsupportedEvent, Segment: "MSH", Field: 9, Message: "only A01, A04 and A08 events are accepted"}},
+			want: []string{
+				"MSH|^~\\&|HOSPITAL_BACKEND|HOSPITAL|REGADT|MCM|20240101123000||ACK^A04^ACK|ACK1|P|2.5",
+				"MSA|AR|MSG00001|MSH-9: only A01, A04 and A08 events are accepted",
+				"ERR||MSH^1^9|201^Unsupported event code^HL70357|E||||only A01, A04 and A08 events are accepted",
+			},
+		},
+		{
+			name: "unparsable message",
+			errs: []*Error{{Code: ErrSegmentSequence, Message: "message must start with an MSH segment"}},
+			want: []string{
+				"MSH|^~\\&|||||20240101123000||ACK^^ACK|ACK1|P|2.5",
+				"MSA|AR||message must start with an MSH segment",
+				"ERR|||100^Segment sequence error^HL70357|E||||message must start with an MSH segment",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Ack(tt.msg, "ACK1", now, tt.errs...).String()
+			want := strings.Join(tt.want, "\r") + "\r"
+			if got != want {
+				t.Errorf("Ack() =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
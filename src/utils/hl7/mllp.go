@@ -0,0 +1,189 @@
+package hl7
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// MLLP (minimal lower layer protocol) frames each message as <VT> message <FS><CR> on a TCP connection
+const (
+	mllpStart = 0x0b
+	mllpEnd   = 0x1c
+	mllpCR    = 0x0d
+)
+
+// MaxMessageSize guards the listener against a peer that never closes its frame
+const MaxMessageSize = 1 << 20
+
+// IdleTimeout closes a connection that sends nothing for this long
+var IdleTimeout = 5 * time.Minute
+
+// ReadFrame reads the next framed message. Bytes before the start block are skipped, as senders may pad with new lines
+func ReadFrame(r *bufio.Reader) (string, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == mllpStart {
+			break
+		}
+	}
+
+	var frame []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		if b == mllpEnd {
+			next, err := r.ReadByte()
+			if err != nil {
+				return "", io.ErrUnexpectedEOF
+			}
+			if next != mllpCR {
+				return "", fmt.Errorf("end block must be followed by a carriage return")
+			}
+			return string(frame), nil
+		}
+		frame = append(frame, b)
+		if len(frame) > MaxMessageSize {
+			return "", fmt.Errorf("message larger than %d bytes", MaxMessageSize)
+		}
+	}
+}
+
+// WriteFrame writes msg framed for MLLP
+func WriteFrame(w io.Writer, msg string) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, mllpStart)
+	frame = append(frame, msg...)
+	frame = append(frame, mllpEnd, mllpCR)
+	_, err := w.Write(frame)
+	return err
+}
+
+// AllowList is the set of peer addresses the listener takes connections from
+type AllowList []*net.IPNet
+
+// ParseAllowList reads a comma separated list of IP addresses and CIDR ranges, e.g. "10.0.0.5, 10.1.0.0/16"
+func ParseAllowList(raw string) (AllowList, error) {
+	var list AllowList
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR range", entry)
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+// Allows reports whether a peer at addr may connect, addr is a net.Conn's RemoteAddr
+func (l AllowList) Allows(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range l {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Server answers MLLP messages with Handle's reply (the acknowledgement), one message at a time per connection as MLLP
+// requires. MLLP has no authentication, so only peers on Allowed are served (an empty list refuses everyone) and at
+// most MaxConnections connections are open at once (0 means no limit)
+type Server struct {
+	Handle         func(msg string) string
+	Allowed        AllowList
+	MaxConnections int
+}
+
+// Serve accepts connections on listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	var slots chan struct{}
+	if s.MaxConnections > 0 {
+		slots = make(chan struct{}, s.MaxConnections)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		if !s.Allowed.Allows(conn.RemoteAddr()) {
+			fmt.Println("MLLP connection from", conn.RemoteAddr(), "refused: address not allowed")
+			conn.Close()
+			continue
+		}
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				fmt.Println("MLLP connection from", conn.RemoteAddr(), "refused: too many connections")
+				conn.Close()
+				continue
+			}
+		}
+		go func() {
+			serveConn(conn, s.Handle)
+			if slots != nil {
+				<-slots
+			}
+		}()
+	}
+}
+
+func serveConn(conn net.Conn, handle func(msg string) string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(IdleTimeout))
+		msg, err := ReadFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("MLLP connection from", conn.RemoteAddr(), "closed:", err)
+			}
+			return
+		}
+		if err := WriteFrame(conn, handle(msg)); err != nil {
+			fmt.Println("MLLP reply to", conn.RemoteAddr(), "failed:", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{"one message", "\x0bMSH|^~\\&\x1c\r", []string{"MSH|^~\\&"}, io.EOF},
+		{"two messages", "\x0bfirst\x1c\r\x0bsecond\x1c\r", []string{"first", "second"}, io.EOF},
+		{"padding before the start block", "\r\n\x0bmsg\x1c\r", []string{"msg"}, io.EOF},
+		{"no frame", "", nil, io.EOF},
+		{"unterminated frame", "\x0bmsg", nil, io.ErrUnexpectedEOF},
+		{"end block without carriage return", "\x0bmsg\x1c", nil, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+			var got []string
+			var err error
+			for {
+				var msg string
+				msg, err = ReadFrame(reader)
+				if err != nil {
+					break
+				}
+				got = append(got, msg)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+			if err != tt.wantErr {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := ReadFrame(bufio.NewReader(strings.NewReader("\x0bmsg\x1cX")))
+	if err == nil || err.Error() != "end block must be followed by a carriage return" {
+		t.Errorf("end block followed by X: error = %v", err)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, "MSH|^~\\&"); err != nil {
+		t.Fatalf("WriteFrame() error = %v", err)
+	}
+	if got := buf.String(); got != "\x0bMSH|^~\\&\x1c\r" {
+		t.Errorf("WriteFrame() wrote %q", got)
+	}
+
+	msg, err := ReadFrame(bufio.NewReader(&buf))
+	if err != nil || msg != "MSH|^~\\&" {
+		t.Errorf("ReadFrame(WriteFrame()) = %q, %v", msg, err)
+	}
+}
+
+func TestParseAllowList(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		allowed []string
+		refused []string
+		wantErr bool
+	}{
+		{"empty refuses everyone", "", nil, []string{"127.0.0.1", "::1"}, false},
+		{"loopback", "127.0.0.1,::1", []string{"127.0.0.1", "::1", "::ffff:127.0.0.1"}, []string{"127.0.0.2", "10.0.0.1"}, false},
+		{"range and address with spaces", " 10.1.0.0/16 , 192.168.1.20 ", []string{"10.1.255.3", "192.168.1.20"}, []string{"10.2.0.1", "192.168.1.21"}, false},
+		{"IPv6 range", "fd00::/8", []string{"fd12::1"}, []string{"fe80::1"}, false},
+		{"not an address", "localhost", nil, nil, true},
+		{"bad range", "10.0.0.0/33", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := ParseAllowList(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAllowList(%q) error = nil, want an error", tt.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAllowList(%q) error = %v", tt.raw, err)
+			}
+			for _, ip := range tt.allowed {
+				if !list.Allows(&net.TCPAddr{IP: net.ParseIP(ip), Port: 2575}) {
+					t.Errorf("%s is refused, want allowed", ip)
+				}
+			}
+			for _, ip := range tt.refused {
+				if list.Allows(&net.TCPAddr{IP: net.ParseIP(ip), Port: 2575}) {
+					t.Errorf("%s is allowed, want refused", ip)
+				}
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	echo := func(msg string) string { return "ACK " + msg }
+	loopback, _ := ParseAllowList("127.0.0.1")
+
+	tests := []struct {
+		name   string
+		server *Server
+		want   string
+	}{
+		{"allowed peer", &Server{Handle: echo, Allowed: loopback, MaxConnections: 1}, "ACK hello"},
+		{"peer not allowed", &Server{Handle: echo, Allowed: AllowList{}, MaxConnections: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Skip("cannot listen on 127.0.0.1:", err)
+			}
+			defer listener.Close()
+			go tt.server.Serve(listener)
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			WriteFrame(conn, "hello")
+			got, _ := ReadFrame(bufio.NewReader(conn))
+			if got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerMaxConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on 127.0.0.1:", err)
+	}
+	defer listener.Close()
+	loopback, _ := ParseAllowList("127.0.0.1")
+	go (&Server{Handle: func(msg string) string { return msg }, Allowed: loopback, MaxConnections: 1}).Serve(listener)
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer first.Close()
+	firstReader := bufio.NewReader(first)
+	WriteFrame(first, "one")
+	if got, err := ReadFrame(firstReader); got != "one" {
+		t.Fatalf("first connection reply = %q, %v", got, err)
+	}
+
+	second, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer second.Close()
+	WriteFrame(second, "two")
+	if got, _ := ReadFrame(bufio.NewReader(second)); got != "" {
+		t.Errorf("second connection got %q while the first is open, want it closed", got)
+	}
+
+	WriteFrame(first, "three")
+	if got, err := ReadFrame(firstReader); got != "three" {
+		t.Errorf("first connection reply = %q, %v", got, err)
+	}
+}
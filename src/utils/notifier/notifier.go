@@ -0,0 +1,156 @@
+// Package notifier delivers messages to patients over a channel (email, SMS). Each channel has one Sender,
+// chosen at start-up from the environment so development can write messages to the console or a file
+// while production plugs in a real provider
+package notifier
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one notification to deliver
+type Message struct {
+	Channel string // email, sms
+	To      string // email address or phone number
+	Subject string // email only
+	Body    string
+}
+
+// Sender delivers messages of one channel. Send returns an error when the message may be retried later
+type Sender interface {
+	Send(msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	senders = map[string]Sender{}
+)
+
+// Register makes sender the Sender of channel, replacing the previous one
+func Register(channel string, sender Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+	senders[channel] = sender
+}
+
+// Send delivers msg with the Sender registered for its channel
+func Send(msg Message) error {
+	mu.RLock()
+	sender, ok := senders[msg.Channel]
+	mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no sender registered for channel %s", msg.Channel)
+	}
+	return sender.Send(msg)
+}
+
+// InitSenders registers a Sender for email and sms from the environment:
+//
+//	NOTIFY_EMAIL_SENDER / NOTIFY_SMS_SENDER  console (default), file or smtp (email only)
+//	NOTIFY_OUTBOX_DIR                        directory of the file sender, default ./outbox
+//	SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASSWORD, SMTP_FROM
+func InitSenders() {
+	for _, channel := range []string{"email", "sms"} {
+		kind := os.Getenv("NOTIFY_" + strings.ToUpper(channel) + "_SENDER")
+		switch kind {
+		case "file":
+			dir := os.Getenv("NOTIFY_OUTBOX_DIR")
+			if dir == "" {
+				dir = "./outbox"
+			}
+			Register(channel, &FileSender{Path: filepath.Join(dir, channel+".log")})
+		case "smtp":
+			if channel != "email" {
+				fmt.Printf("notifier: smtp sender is only available for email, using console for %s\n", channel)
+				Register(channel, ConsoleSender{})
+				continue
+			}
+			Register(channel, &SMTPSender{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     os.Getenv("SMTP_PORT"),
+				Username: os.Getenv("SMTP_USER"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     os.Getenv("SMTP_FROM"),
+			})
+		default:
+			Register(channel, ConsoleSender{})
+		}
+		fmt.Printf("notifier: %s sender is %s\n", channel, kindOrDefault(kind))
+	}
+}
+
+func kindOrDefault(kind string) string {
+	if kind == "" {
+		return "console"
+	}
+	return kind
+}
+
+// ConsoleSender prints messages to stdout, for development
+type ConsoleSender struct{}
+
+func (ConsoleSender) Send(msg Message) error {
+	fmt.Printf("[%s] to=%s subject=%q\n%s\n", msg.Channel, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender appends messages to a file, for development and tests of the reminder flow
+type FileSender struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (s *FileSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s [%s] to=%s subject=%q\n%s\n\n", time.Now().Format("2006-01-02 15:04:05"), msg.Channel, msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// SMTPSender sends email through an SMTP server with PLAIN auth (no auth when Username is empty)
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	if s.Host == "" || s.From == "" {
+		return fmt.Errorf("smtp sender is not configured")
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("recipient and subject must be a single line")
+	}
+	port := s.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	body := "From: " + s.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		msg.Body + "\r\n"
+	return smtp.SendMail(s.Host+":"+port, auth, s.From, []string{msg.To}, []byte(body))
+}